@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"github.com/lingdie/image-manip-server/pkg/options"
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+	"github.com/spf13/cobra"
+)
+
+func NewCmdAdd() *cobra.Command {
+	var addCmd = &cobra.Command{
+		Use:   "add SRC... DEST IMAGE_REF",
+		Short: "Add files of the host to a container image",
+		Long: `Add files and directories of the host to a container image, all in one new layer.
+
+DEST is a directory of the image if it ends with / or if there are several sources: the files are
+added in it under their own name. Otherwise, it is the path of the single source in the image. The
+content of a directory is added to DEST, not the directory itself, like the ADD instruction of a
+Dockerfile. Symbolic links are added as they are.`,
+		Args: cobra.MinimumNArgs(3),
+		RunE: addAction,
+	}
+	addCmd.Flags().String("new-image-name", "", "new image name, if not specified, will be the same as the original image")
+	addCmd.Flags().String("chown", "", "owner of the added files as numeric UID[:GID] (default root)")
+	addCmd.Flags().String("chmod", "", "octal permissions of the added files (default their own)")
+	addCmd.Flags().Bool("normalize-timestamps", false, "set the modification time of the added files to --created instead of keeping theirs")
+	addCommitFlags(addCmd)
+	addPlatformFlags(addCmd)
+	addOutputFlag(addCmd)
+	return addCmd
+}
+
+func addAction(cmd *cobra.Command, args []string) error {
+	opts, err := processAddCmdFlags(cmd)
+	if err != nil {
+		return err
+	}
+	opts.Sources = args[:len(args)-2]
+	opts.Dest = args[len(args)-2]
+	opts.ImageRef = args[len(args)-1]
+	output, err := processOutputCmdFlag(cmd)
+	if err != nil {
+		return err
+	}
+
+	r, err := runtime.NewRuntime(cmd.Context(), opts.RootOptions)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	result, err := r.Add(r.Context(), opts)
+	if err != nil {
+		return err
+	}
+	return printResult(cmd, output, result)
+}
+
+func processAddCmdFlags(cmd *cobra.Command) (options.AddOptions, error) {
+	o := options.AddOptions{}
+	var err error
+	o.RootOptions, err = processRootCmdFlags(cmd)
+	if err != nil {
+		return o, err
+	}
+	o.CommitOptions, err = processCommitCmdFlags(cmd)
+	if err != nil {
+		return o, err
+	}
+	o.PlatformOptions, err = processPlatformCmdFlags(cmd)
+	if err != nil {
+		return o, err
+	}
+	o.NewImageName, err = cmd.Flags().GetString("new-image-name")
+	if err != nil {
+		return o, err
+	}
+	o.Chown, err = cmd.Flags().GetString("chown")
+	if err != nil {
+		return o, err
+	}
+	o.Chmod, err = cmd.Flags().GetString("chmod")
+	if err != nil {
+		return o, err
+	}
+	o.NormalizeTimestamps, err = cmd.Flags().GetBool("normalize-timestamps")
+	if err != nil {
+		return o, err
+	}
+	return o, nil
+}
@@ -0,0 +1,277 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/containerd/platforms"
+	"github.com/lingdie/image-manip-server/pkg/options"
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/spf13/cobra"
+)
+
+func NewCmdConfig() *cobra.Command {
+	var configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Show or edit the config of a container image without touching its layers",
+	}
+	configCmd.AddCommand(newCmdConfigShow())
+	configCmd.AddCommand(newCmdConfigSet())
+	configCmd.AddCommand(newCmdConfigUnset())
+	return configCmd
+}
+
+func newCmdConfigShow() *cobra.Command {
+	var showCmd = &cobra.Command{
+		Use:   "show IMAGE_REF",
+		Short: "Print the config of an image as JSON",
+		Args:  cobra.ExactArgs(1),
+		RunE:  configShowAction,
+	}
+	showCmd.Flags().String("platform", "", "platform of a multi-platform image to show, e.g. linux/arm64 (default the platform of the host)")
+	return showCmd
+}
+
+func newCmdConfigSet() *cobra.Command {
+	var setCmd = &cobra.Command{
+		Use:   "set IMAGE_REF",
+		Short: "Set fields of the config of an image",
+		Long: `Set fields of the config of an image. A new config and manifest are written, reusing all
+the layers, and the change is recorded in an empty layer history entry.
+
+--entrypoint and --cmd take a JSON array, e.g. '["/app/server", "--port", "8080"]', or a single program.`,
+		Args: cobra.ExactArgs(1),
+		RunE: configSetAction,
+	}
+	setCmd.Flags().StringArray("env", nil, "set the environment variable NAME=VALUE, can be repeated")
+	setCmd.Flags().StringArray("label", nil, "set the label KEY=VALUE, can be repeated")
+	setCmd.Flags().StringArray("expose", nil, "expose the port PORT[/PROTOCOL], can be repeated")
+	setCmd.Flags().StringArray("volume", nil, "add the volume PATH, can be repeated")
+	setCmd.Flags().String("entrypoint", "", "set the entrypoint")
+	setCmd.Flags().String("cmd", "", "set the cmd")
+	setCmd.Flags().String("workdir", "", "set the working directory")
+	setCmd.Flags().String("user", "", "set the user")
+	setCmd.Flags().String("stop-signal", "", "set the stop signal")
+	addConfigEditFlags(setCmd)
+	return setCmd
+}
+
+func newCmdConfigUnset() *cobra.Command {
+	var unsetCmd = &cobra.Command{
+		Use:   "unset IMAGE_REF FIELD...",
+		Short: "Clear fields of the config of an image",
+		Long: `Clear fields of the config of an image, or remove entries from them. A FIELD is one of User,
+ExposedPorts, Env, Entrypoint, Cmd, Volumes, WorkingDir, Labels or StopSignal, or an entry of a field,
+e.g. Env.DEBUG, Labels.maintainer, ExposedPorts.8080/tcp or Volumes./data.`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: configUnsetAction,
+	}
+	addConfigEditFlags(unsetCmd)
+	return unsetCmd
+}
+
+func addConfigEditFlags(cmd *cobra.Command) {
+	cmd.Flags().String("new-image-name", "", "new image name, if not specified, will be the same as the original image")
+	cmd.Flags().Bool("dry-run", false, "print the changes without writing anything")
+	addCommitFlags(cmd)
+	addPlatformFlags(cmd)
+	addOutputFlag(cmd)
+}
+
+func configShowAction(cmd *cobra.Command, args []string) error {
+	rootOptions, err := processRootCmdFlags(cmd)
+	if err != nil {
+		return err
+	}
+	platformSpec, err := cmd.Flags().GetString("platform")
+	if err != nil {
+		return err
+	}
+	var platform *ocispec.Platform
+	if platformSpec != "" {
+		p, err := platforms.Parse(platformSpec)
+		if err != nil {
+			return fmt.Errorf("invalid platform %q: %w", platformSpec, err)
+		}
+		platform = &p
+	}
+	r, err := runtime.NewRuntime(cmd.Context(), rootOptions)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	image, err := r.GetPlatformImage(r.Context(), args[0], platform)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(cmd.OutOrStdout())
+	enc.SetIndent("", "    ")
+	return enc.Encode(image.Config.Config)
+}
+
+func configSetAction(cmd *cobra.Command, args []string) error {
+	opts, err := processConfigCmdFlags(cmd)
+	if err != nil {
+		return err
+	}
+	opts.Set, err = processConfigSetCmdFlags(cmd)
+	if err != nil {
+		return err
+	}
+	return runConfigEdit(cmd, args[0], opts)
+}
+
+func configUnsetAction(cmd *cobra.Command, args []string) error {
+	opts, err := processConfigCmdFlags(cmd)
+	if err != nil {
+		return err
+	}
+	opts.Unset = args[1:]
+	return runConfigEdit(cmd, args[0], opts)
+}
+
+func runConfigEdit(cmd *cobra.Command, imageRef string, opts options.ConfigOptions) error {
+	opts.ImageRef = imageRef
+	output, err := processOutputCmdFlag(cmd)
+	if err != nil {
+		return err
+	}
+
+	r, err := runtime.NewRuntime(cmd.Context(), opts.RootOptions)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	result, err := r.EditConfig(r.Context(), opts)
+	if err != nil {
+		return err
+	}
+	if opts.DryRun && output == OutputText {
+		printConfigChanges(cmd, "", result.ConfigChanges)
+		for _, p := range result.Platforms {
+			printConfigChanges(cmd, p.Platform, p.ConfigChanges)
+		}
+		return nil
+	}
+	return printResult(cmd, output, result)
+}
+
+// printConfigChanges prints the changes of the config of the given platform.
+func printConfigChanges(cmd *cobra.Command, platform string, changes []runtime.ConfigChange) {
+	out := cmd.OutOrStdout()
+	if platform != "" {
+		fmt.Fprintf(out, "PLATFORM:\t%s\n", platform)
+	}
+	if len(changes) == 0 {
+		fmt.Fprintln(out, "no change")
+	}
+	for _, c := range changes {
+		fmt.Fprintln(out, c.String())
+	}
+}
+
+func processConfigCmdFlags(cmd *cobra.Command) (options.ConfigOptions, error) {
+	o := options.ConfigOptions{}
+	var err error
+	o.RootOptions, err = processRootCmdFlags(cmd)
+	if err != nil {
+		return o, err
+	}
+	o.CommitOptions, err = processCommitCmdFlags(cmd)
+	if err != nil {
+		return o, err
+	}
+	o.PlatformOptions, err = processPlatformCmdFlags(cmd)
+	if err != nil {
+		return o, err
+	}
+	o.NewImageName, err = cmd.Flags().GetString("new-image-name")
+	if err != nil {
+		return o, err
+	}
+	o.DryRun, err = cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func processConfigSetCmdFlags(cmd *cobra.Command) (options.ConfigSet, error) {
+	o := options.ConfigSet{}
+	var err error
+	o.Env, err = cmd.Flags().GetStringArray("env")
+	if err != nil {
+		return o, err
+	}
+	labels, err := cmd.Flags().GetStringArray("label")
+	if err != nil {
+		return o, err
+	}
+	for _, kv := range labels {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return o, fmt.Errorf("invalid label %q, expected KEY=VALUE", kv)
+		}
+		if o.Labels == nil {
+			o.Labels = map[string]string{}
+		}
+		o.Labels[k] = v
+	}
+	o.ExposedPorts, err = cmd.Flags().GetStringArray("expose")
+	if err != nil {
+		return o, err
+	}
+	o.Volumes, err = cmd.Flags().GetStringArray("volume")
+	if err != nil {
+		return o, err
+	}
+	if cmd.Flags().Changed("entrypoint") {
+		o.Entrypoint, err = parseCommandFlag(cmd, "entrypoint")
+		if err != nil {
+			return o, err
+		}
+	}
+	if cmd.Flags().Changed("cmd") {
+		o.Cmd, err = parseCommandFlag(cmd, "cmd")
+		if err != nil {
+			return o, err
+		}
+	}
+	o.WorkingDir, err = cmd.Flags().GetString("workdir")
+	if err != nil {
+		return o, err
+	}
+	o.User, err = cmd.Flags().GetString("user")
+	if err != nil {
+		return o, err
+	}
+	o.StopSignal, err = cmd.Flags().GetString("stop-signal")
+	if err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+// parseCommandFlag parses the flag name holding either a JSON array or a single program.
+func parseCommandFlag(cmd *cobra.Command, name string) ([]string, error) {
+	s, err := cmd.Flags().GetString(name)
+	if err != nil {
+		return nil, err
+	}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, fmt.Errorf("--%s is empty, use `config unset` to clear it", name)
+	}
+	if !strings.HasPrefix(s, "[") {
+		return []string{s}, nil
+	}
+	var command []string
+	if err := json.Unmarshal([]byte(s), &command); err != nil {
+		return nil, fmt.Errorf("invalid --%s %q, expected a JSON array of strings: %w", name, s, err)
+	}
+	return command, nil
+}
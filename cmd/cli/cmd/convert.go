@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"github.com/lingdie/image-manip-server/pkg/options"
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+	"github.com/spf13/cobra"
+)
+
+func NewCmdConvert() *cobra.Command {
+	var convertCmd = &cobra.Command{
+		Use:   "convert IMAGE_REF",
+		Short: "Recompress the layers of a container image",
+		Args:  cobra.ExactArgs(1),
+		RunE:  convertAction,
+	}
+	convertCmd.Flags().String("new-image-name", "", "new image name, if not specified, will be the same as the original image")
+	convertCmd.Flags().String("compression", runtime.CompressionZstd, "compression of the layers: gzip, zstd, zstd:chunked or estargz")
+	convertCmd.Flags().String("manifest-format", "", "media types of the new image: docker or oci (default the format of the original image, oci for zstd layers)")
+	addPlatformFlags(convertCmd)
+	addOutputFlag(convertCmd)
+	return convertCmd
+}
+
+func convertAction(cmd *cobra.Command, args []string) error {
+	opts, err := processConvertCmdFlags(cmd)
+	if err != nil {
+		return err
+	}
+	opts.ImageRef = args[0]
+	output, err := processOutputCmdFlag(cmd)
+	if err != nil {
+		return err
+	}
+
+	r, err := runtime.NewRuntime(cmd.Context(), opts.RootOptions)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	result, err := r.Convert(r.Context(), opts)
+	if err != nil {
+		return err
+	}
+	return printResult(cmd, output, result)
+}
+
+func processConvertCmdFlags(cmd *cobra.Command) (options.ConvertOptions, error) {
+	o := options.ConvertOptions{}
+	var err error
+	o.RootOptions, err = processRootCmdFlags(cmd)
+	if err != nil {
+		return o, err
+	}
+	o.PlatformOptions, err = processPlatformCmdFlags(cmd)
+	if err != nil {
+		return o, err
+	}
+	o.NewImageName, err = cmd.Flags().GetString("new-image-name")
+	if err != nil {
+		return o, err
+	}
+	o.Compression, err = cmd.Flags().GetString("compression")
+	if err != nil {
+		return o, err
+	}
+	o.ManifestFormat, err = cmd.Flags().GetString("manifest-format")
+	if err != nil {
+		return o, err
+	}
+	return o, nil
+}
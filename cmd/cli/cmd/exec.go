@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/lingdie/image-manip-server/pkg/options"
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+	"github.com/spf13/cobra"
+)
+
+func NewCmdExec() *cobra.Command {
+	var execCmd = &cobra.Command{
+		Use:   "exec IMAGE_REF -- COMMAND [ARG...]",
+		Short: "Run a command in a container image and add its changes as a new layer",
+		Long: `Run a command in the root filesystem of a container image, like the RUN instruction of a
+Dockerfile, and add the files it changed as a new layer, e.g. to run update-ca-certificates.
+
+The command runs in a container without network, with the environment, working directory and user of
+the image. It is not run through a shell: use -- sh -c '...' for pipes or several commands. A command
+exiting with a non-zero status leaves the image unchanged.`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: execAction,
+	}
+	execCmd.Flags().String("new-image-name", "", "new image name, if not specified, will be the same as the original image")
+	execCmd.Flags().StringArray("env", nil, "set the environment variable NAME=VALUE for the command, can be repeated")
+	execCmd.Flags().String("workdir", "", "working directory of the command (default the one of the image)")
+	execCmd.Flags().String("user", "", "user running the command (default the one of the image)")
+	addCommitFlags(execCmd)
+	addPlatformFlags(execCmd)
+	addOutputFlag(execCmd)
+	return execCmd
+}
+
+func execAction(cmd *cobra.Command, args []string) error {
+	if cmd.ArgsLenAtDash() != 1 {
+		return fmt.Errorf("the command must follow --, e.g. exec IMAGE_REF -- update-ca-certificates")
+	}
+	opts, err := processExecCmdFlags(cmd)
+	if err != nil {
+		return err
+	}
+	opts.ImageRef = args[0]
+	opts.Command = args[1:]
+	output, err := processOutputCmdFlag(cmd)
+	if err != nil {
+		return err
+	}
+
+	r, err := runtime.NewRuntime(cmd.Context(), opts.RootOptions)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// keep stdout for the result in JSON mode
+	stdout := os.Stdout
+	if output == OutputJSON {
+		stdout = os.Stderr
+	}
+	result, err := r.Exec(runtime.WithOutput(r.Context(), stdout, os.Stderr), opts)
+	if err != nil {
+		return err
+	}
+	return printResult(cmd, output, result)
+}
+
+func processExecCmdFlags(cmd *cobra.Command) (options.ExecOptions, error) {
+	o := options.ExecOptions{}
+	var err error
+	o.RootOptions, err = processRootCmdFlags(cmd)
+	if err != nil {
+		return o, err
+	}
+	o.CommitOptions, err = processCommitCmdFlags(cmd)
+	if err != nil {
+		return o, err
+	}
+	o.PlatformOptions, err = processPlatformCmdFlags(cmd)
+	if err != nil {
+		return o, err
+	}
+	o.NewImageName, err = cmd.Flags().GetString("new-image-name")
+	if err != nil {
+		return o, err
+	}
+	o.Env, err = cmd.Flags().GetStringArray("env")
+	if err != nil {
+		return o, err
+	}
+	o.WorkingDir, err = cmd.Flags().GetString("workdir")
+	if err != nil {
+		return o, err
+	}
+	o.User, err = cmd.Flags().GetString("user")
+	if err != nil {
+		return o, err
+	}
+	return o, nil
+}
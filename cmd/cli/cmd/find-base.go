@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/containerd/nerdctl/pkg/formatter"
+	"github.com/lingdie/image-manip-server/pkg/options"
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+	"github.com/spf13/cobra"
+)
+
+func NewCmdFindBase() *cobra.Command {
+	var findBaseCmd = &cobra.Command{
+		Use:   "find-base IMAGE",
+		Short: "Find the local images an image is built on",
+		Long: `Find the local images an image is built on, by searching all the images of the namespace for
+those whose layers are a strict prefix of the layers of the image.
+
+The candidates are listed from the best one: the longest prefix first, then the tagged images before the
+dangling ones, then the most recent ones. SPLIT is the index of the first layer built on the candidate;
+the candidate can be given to rebase --base-image, or its top layer to squash --base-layer-digest.`,
+		Args: cobra.ExactArgs(1),
+		RunE: findBaseAction,
+	}
+	findBaseCmd.Flags().String("platform", "", "platform of a multi-platform image, e.g. linux/arm64 (default the platform of the host)")
+	addOutputFlag(findBaseCmd)
+	return findBaseCmd
+}
+
+func findBaseAction(cmd *cobra.Command, args []string) error {
+	opts, err := processFindBaseCmdFlags(cmd)
+	if err != nil {
+		return err
+	}
+	opts.ImageRef = args[0]
+	output, err := processOutputCmdFlag(cmd)
+	if err != nil {
+		return err
+	}
+
+	r, err := runtime.NewRuntime(cmd.Context(), opts.RootOptions)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	result, err := r.FindBase(r.Context(), opts)
+	if err != nil {
+		return err
+	}
+	if output == OutputText {
+		return printBaseCandidates(cmd, result.Candidates)
+	}
+	return printResult(cmd, output, result)
+}
+
+// printBaseCandidates prints the candidates as a table, the best one first.
+func printBaseCandidates(cmd *cobra.Command, candidates []runtime.BaseCandidate) error {
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 4, 8, 4, ' ', 0)
+	fmt.Fprintln(w, "NAME\tDIGEST\tSPLIT\tBASE LAYER\tCREATED")
+	for _, c := range candidates {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", c.Name, c.Digest, c.SplitIndex, c.BaseLayerDigest, formatter.TimeSinceInHuman(c.CreatedAt))
+	}
+	return w.Flush()
+}
+
+func processFindBaseCmdFlags(cmd *cobra.Command) (options.FindBaseOptions, error) {
+	o := options.FindBaseOptions{}
+	var err error
+	o.RootOptions, err = processRootCmdFlags(cmd)
+	if err != nil {
+		return o, err
+	}
+	o.Platform, err = cmd.Flags().GetString("platform")
+	if err != nil {
+		return o, err
+	}
+	return o, nil
+}
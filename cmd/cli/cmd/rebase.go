@@ -2,6 +2,9 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"strings"
 
 	"github.com/lingdie/image-manip-server/pkg/options"
 	"github.com/lingdie/image-manip-server/pkg/runtime"
@@ -15,14 +18,28 @@ const (
 func NewCmdRebase() *cobra.Command {
 
 	var rebaseCmd = &cobra.Command{
-		Use:   "rebase IMAGE_REF BASE_LAYER_DIGEST",
+		Use:   "rebase IMAGE_REF [BASE_LAYER_DIGEST]",
 		Short: "Rebase a container image",
-		Args:  cobra.ExactArgs(2),
-		RunE:  rebaseAction,
+		Long: `Rebase a container image.
+
+The layers above BASE_LAYER_DIGEST are rebased. Alternatively, --base-image
+can be used to rebase the layers above an old base image the image is built on.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: rebaseAction,
 	}
 	rebaseCmd.Flags().String("new-image-name", "", "new image name, if not specified, will be the same as the original image")
 	rebaseCmd.Flags().Bool("auto-squash", DefaultAutoSquash, "squash all new application layers into one")
+	rebaseCmd.Flags().String("base-image", "", "old base image ref, the layers above it will be rebased (instead of BASE_LAYER_DIGEST)")
 	rebaseCmd.Flags().String("new-base-image-ref", "", "new base image ref, if not specified, the image will be rebased back")
+	rebaseCmd.Flags().String("config-merge", "merge", "how to merge the application config into the new base config: keep-app, keep-base or merge (the application wins)")
+	rebaseCmd.Flags().StringSlice("config-field", []string{}, "override the merge policy of a config field, e.g. Labels=keep-base or Env.PATH=merge")
+	rebaseCmd.Flags().String("todo-file", "", "read the rebase todo list from a file (\"-\" for stdin) instead of generating it")
+	rebaseCmd.Flags().BoolP("interactive", "i", false, "edit the rebase todo list with $EDITOR before rebasing")
+	rebaseCmd.MarkFlagsMutuallyExclusive("todo-file", "interactive")
+	rebaseCmd.Flags().Bool("dry-run", false, "print the todo list, the new layers, config and history changes without rebasing")
+	addCommitFlags(rebaseCmd)
+	addPlatformFlags(rebaseCmd)
+	addOutputFlag(rebaseCmd)
 
 	return rebaseCmd
 }
@@ -38,9 +55,18 @@ func rebaseAction(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	// Positional arguments: imageRef, baseLayerDigest
+	output, err := processOutputCmdFlag(cmd)
+	if err != nil {
+		return err
+	}
+	// Positional arguments: imageRef, [baseLayerDigest]
 	imageRef = args[0]
-	baseLayerDigest = args[1]
+	if len(args) > 1 {
+		baseLayerDigest = args[1]
+	}
+	if (baseLayerDigest == "") == (rebaseOptions.BaseImageRef == "") {
+		return fmt.Errorf("exactly one of BASE_LAYER_DIGEST and --base-image must be specified")
+	}
 	rebaseOptions.ImageRef = imageRef
 	rebaseOptions.BaseLayerDigest = baseLayerDigest
 	// init the runtime
@@ -57,11 +83,18 @@ func rebaseAction(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	if err := fillTodoList(cmd, runtimeObj, &rebaseOptions); err != nil {
+		return err
+	}
 	// do the rebase
-	if err := runtimeObj.Rebase(runtimeObj.Context(), rebaseOptions); err != nil {
+	result, err := runtimeObj.Rebase(runtimeObj.Context(), rebaseOptions)
+	if err != nil {
 		return err
 	}
-	return nil
+	if printed, err := printPlans(cmd, output, result.Plan, result.Platforms); printed || err != nil {
+		return err
+	}
+	return printResult(cmd, output, result)
 }
 
 func processRebaseCmdFlags(cmd *cobra.Command) (options.RebaseOptions, error) {
@@ -72,6 +105,14 @@ func processRebaseCmdFlags(cmd *cobra.Command) (options.RebaseOptions, error) {
 		// handle error
 		return o, err
 	}
+	o.CommitOptions, err = processCommitCmdFlags(cmd)
+	if err != nil {
+		return o, err
+	}
+	o.PlatformOptions, err = processPlatformCmdFlags(cmd)
+	if err != nil {
+		return o, err
+	}
 	o.NewImageName, err = cmd.Flags().GetString("new-image-name")
 	if err != nil {
 		// handle error
@@ -82,10 +123,84 @@ func processRebaseCmdFlags(cmd *cobra.Command) (options.RebaseOptions, error) {
 		// handle error
 		return o, err
 	}
+	o.BaseImageRef, err = cmd.Flags().GetString("base-image")
+	if err != nil {
+		// handle error
+		return o, err
+	}
 	o.NewBaseImageRef, err = cmd.Flags().GetString("new-base-image-ref")
 	if err != nil {
 		// handle error
 		return o, err
 	}
+	o.ConfigMergePolicy, err = cmd.Flags().GetString("config-merge")
+	if err != nil {
+		// handle error
+		return o, err
+	}
+	configFields, err := cmd.Flags().GetStringSlice("config-field")
+	if err != nil {
+		// handle error
+		return o, err
+	}
+	o.ConfigFieldPolicies = make(map[string]string, len(configFields))
+	for _, f := range configFields {
+		field, policy, ok := strings.Cut(f, "=")
+		if !ok {
+			return o, fmt.Errorf("invalid config field policy %q, expected FIELD=POLICY", f)
+		}
+		o.ConfigFieldPolicies[field] = policy
+	}
+	o.DryRun, err = cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		// handle error
+		return o, err
+	}
 	return o, nil
 }
+
+// fillTodoList sets the todo list of the rebase options from --todo-file or --interactive
+func fillTodoList(cmd *cobra.Command, runtimeObj *runtime.Runtime, o *options.RebaseOptions) error {
+	todoFile, err := cmd.Flags().GetString("todo-file")
+	if err != nil {
+		return err
+	}
+	interactive, err := cmd.Flags().GetBool("interactive")
+	if err != nil {
+		return err
+	}
+	switch {
+	case todoFile == "-":
+		b, err := io.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return fmt.Errorf("failed to read todo list from stdin: %w", err)
+		}
+		o.TodoList = string(b)
+	case todoFile != "":
+		b, err := os.ReadFile(todoFile)
+		if err != nil {
+			return fmt.Errorf("failed to read todo file %q: %w", todoFile, err)
+		}
+		o.TodoList = string(b)
+	case interactive:
+		todo, err := runtimeObj.GenerateRebaseTodo(runtimeObj.Context(), *o)
+		if err != nil {
+			return err
+		}
+		o.TodoList, err = editInteractively(cmd, "rebase-todo-", todo)
+		if err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+	// an empty todo list aborts the rebase, rather than falling back to the default one
+	todoList, err := runtime.ParseTodoList(o.TodoList)
+	if err != nil {
+		return err
+	}
+	if len(todoList) == 0 {
+		return fmt.Errorf("nothing to do, the todo list is empty, the rebase is aborted")
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+	"github.com/spf13/cobra"
+)
+
+func NewCmdReflog() *cobra.Command {
+	var reflogCmd = &cobra.Command{
+		Use:   "reflog IMAGE",
+		Short: "List the previous targets of an image",
+		Long: `List the targets an image has pointed to, the current one first.
+
+The entry N can be restored with "reset IMAGE@{N}". The targets are kept from
+garbage collection as long as they are in the reflog of the image.`,
+		Args: cobra.ExactArgs(1),
+		RunE: reflogAction,
+	}
+	addOutputFlag(reflogCmd)
+	return reflogCmd
+}
+
+func reflogAction(cmd *cobra.Command, args []string) error {
+	rootOptions, err := processRootCmdFlags(cmd)
+	if err != nil {
+		return err
+	}
+	output, err := processOutputCmdFlag(cmd)
+	if err != nil {
+		return err
+	}
+	runtimeObj, err := runtime.NewRuntime(cmd.Context(), rootOptions)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := runtimeObj.Close()
+		if err != nil {
+			fmt.Printf("failed to close runtime: %v\n", err)
+		}
+	}()
+	entries, err := runtimeObj.Reflog(runtimeObj.Context(), args[0])
+	if err != nil {
+		return err
+	}
+	if output == OutputJSON {
+		return printResult(cmd, output, entries)
+	}
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 4, 8, 4, ' ', 0)
+	fmt.Fprintln(w, "REF\tDIGEST\tSINCE\tOPERATION")
+	for _, entry := range entries {
+		since := "-"
+		if !entry.Time.IsZero() {
+			since = entry.Time.Format(time.RFC3339)
+		}
+		operation := entry.Operation
+		if operation == "" {
+			operation = "-"
+		}
+		fmt.Fprintf(w, "@{%d}\t%s\t%s\t%s\n", entry.Index, entry.Target.Digest, since, operation)
+	}
+	return w.Flush()
+}
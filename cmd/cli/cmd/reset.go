@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+	"github.com/spf13/cobra"
+)
+
+func NewCmdReset() *cobra.Command {
+	var resetCmd = &cobra.Command{
+		Use:   "reset IMAGE@{N}",
+		Short: "Point an image back to a previous target listed by reflog",
+		Args:  cobra.ExactArgs(1),
+		RunE:  resetAction,
+	}
+	addOutputFlag(resetCmd)
+	return resetCmd
+}
+
+func resetAction(cmd *cobra.Command, args []string) error {
+	imageRef, index, err := runtime.ParseReflogRef(args[0])
+	if err != nil {
+		return err
+	}
+	rootOptions, err := processRootCmdFlags(cmd)
+	if err != nil {
+		return err
+	}
+	output, err := processOutputCmdFlag(cmd)
+	if err != nil {
+		return err
+	}
+	runtimeObj, err := runtime.NewRuntime(cmd.Context(), rootOptions)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := runtimeObj.Close()
+		if err != nil {
+			fmt.Printf("failed to close runtime: %v\n", err)
+		}
+	}()
+	result, err := runtimeObj.Reset(runtimeObj.Context(), imageRef, index)
+	if err != nil {
+		return err
+	}
+	return printResult(cmd, output, result)
+}
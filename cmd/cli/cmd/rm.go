@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/lingdie/image-manip-server/pkg/options"
 	"github.com/lingdie/image-manip-server/pkg/runtime"
@@ -10,26 +11,45 @@ import (
 
 func NewCmdRemove() *cobra.Command {
 	var removeCmd = &cobra.Command{
-		Use:   "remove IMAGE_REF FILE",
-		Short: "Remove a file from a container image",
-		Args:  cobra.ExactArgs(2),
-		RunE:  removeAction,
+		Use:   "remove IMAGE_REF PATH...",
+		Short: "Remove files from a container image",
+		Long: `Remove files from a container image, all in one new layer.
+
+A PATH is a plain path, a shell glob in which ** matches any number of directories
+(e.g. '/var/cache/apt/**' or '**/*.pyc'), or a regular expression prefixed with re:
+(e.g. 're:^/root/\.(bash|zsh)_history$'). Quote the globs so that the shell does not expand them.
+
+With --purge, the paths are removed from every layer containing them instead, e.g. to get rid of a
+leaked secret: those layers are rewritten, along with the diffIDs of the layers above them. The
+original blobs are still referenced by the reflog of the image, and by the other images sharing them.`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: removeAction,
 	}
 	removeCmd.Flags().String("new-image-name", "", "new image name, if not specified, will be the same as the original image")
+	removeCmd.Flags().Bool("allow-no-match", false, "only warn about the paths matching nothing, and leave the image unchanged if nothing matches")
+	removeCmd.Flags().Bool("purge", false, "remove the paths from every layer containing them rather than adding a layer of whiteouts")
+	removeCmd.Flags().Bool("dry-run", false, "print the layer to be created, or the layers to be purged, and the matching paths without removing them")
+	addCommitFlags(removeCmd)
+	addPlatformFlags(removeCmd)
+	addOutputFlag(removeCmd)
 	return removeCmd
 }
 
 func removeAction(cmd *cobra.Command, args []string) error {
 	var (
 		imageRef = args[0]
-		file     = args[1]
+		paths    = args[1:]
 	)
 
 	opts, err := processRemoveCmdFlags(cmd)
 	if err != nil {
 		return err
 	}
-	opts.File = file
+	output, err := processOutputCmdFlag(cmd)
+	if err != nil {
+		return err
+	}
+	opts.Paths = paths
 	opts.ImageRef = imageRef
 	runtimeObj, err := runtime.NewRuntime(
 		cmd.Context(),
@@ -44,10 +64,30 @@ func removeAction(cmd *cobra.Command, args []string) error {
 			fmt.Printf("failed to close runtime: %v\n", err)
 		}
 	}()
-	if err := runtimeObj.Remove(runtimeObj.Context(), opts); err != nil {
+	result, err := runtimeObj.Remove(runtimeObj.Context(), opts)
+	if err != nil {
 		return err
 	}
-	return nil
+	if opts.DryRun && opts.Purge && output == OutputText {
+		printPurgedLayers(cmd, "", result.PurgedLayers)
+		printMatches(cmd, "", result.Matches)
+		for _, p := range result.Platforms {
+			printPurgedLayers(cmd, p.Platform, p.PurgedLayers)
+			printMatches(cmd, p.Platform, p.Matches)
+		}
+		return nil
+	}
+	if printed, err := printPlans(cmd, output, result.Plan, result.Platforms); printed || err != nil {
+		if err != nil {
+			return err
+		}
+		printMatches(cmd, "", result.Matches)
+		for _, p := range result.Platforms {
+			printMatches(cmd, p.Platform, p.Matches)
+		}
+		return nil
+	}
+	return printResult(cmd, output, result)
 }
 
 func processRemoveCmdFlags(cmd *cobra.Command) (options.RemoveOptions, error) {
@@ -58,10 +98,69 @@ func processRemoveCmdFlags(cmd *cobra.Command) (options.RemoveOptions, error) {
 		// handle error
 		return o, err
 	}
+	o.CommitOptions, err = processCommitCmdFlags(cmd)
+	if err != nil {
+		return o, err
+	}
+	o.PlatformOptions, err = processPlatformCmdFlags(cmd)
+	if err != nil {
+		return o, err
+	}
 	o.NewImageName, err = cmd.Flags().GetString("new-image-name")
 	if err != nil {
 		// handle error
 		return o, err
 	}
+	o.AllowNoMatch, err = cmd.Flags().GetBool("allow-no-match")
+	if err != nil {
+		return o, err
+	}
+	o.Purge, err = cmd.Flags().GetBool("purge")
+	if err != nil {
+		return o, err
+	}
+	o.DryRun, err = cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		// handle error
+		return o, err
+	}
 	return o, nil
 }
+
+// printMatches prints the paths matched by a dry run in the given platform, if the image is unpacked.
+func printMatches(cmd *cobra.Command, platform string, matches []runtime.PathMatch) {
+	if matches == nil {
+		return
+	}
+	out := cmd.OutOrStdout()
+	if platform != "" {
+		fmt.Fprintf(out, "\nMATCHES (%s):\n", platform)
+	} else {
+		fmt.Fprintln(out, "\nMATCHES:")
+	}
+	for _, m := range matches {
+		fmt.Fprintf(out, "%s:\n", m.Pattern)
+		if len(m.Paths) == 0 {
+			fmt.Fprintln(out, "    <no match>")
+		}
+		for _, p := range m.Paths {
+			fmt.Fprintf(out, "    %s\n", p)
+		}
+	}
+}
+
+// printPurgedLayers prints the layers a purge would rewrite in the given platform.
+func printPurgedLayers(cmd *cobra.Command, platform string, layers []runtime.PurgedLayer) {
+	out := cmd.OutOrStdout()
+	if platform != "" {
+		fmt.Fprintf(out, "PLATFORM:\t%s\n", platform)
+	}
+	if len(layers) == 0 {
+		fmt.Fprintln(out, "no layer to purge")
+		return
+	}
+	fmt.Fprintln(out, "LAYERS TO PURGE:")
+	for _, l := range layers {
+		fmt.Fprintf(out, "  %d\t%s\t%s\n", l.Index, l.Digest, strings.Join(l.Paths, " "))
+	}
+}
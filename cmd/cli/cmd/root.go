@@ -1,7 +1,11 @@
 package cmd
 
 import (
+	"encoding/json"
+	"fmt"
+
 	"github.com/lingdie/image-manip-server/pkg/options"
+	"github.com/lingdie/image-manip-server/pkg/runtime"
 	"github.com/spf13/cobra"
 )
 
@@ -10,6 +14,12 @@ const (
 	DefaultContainerdAddress = "unix:///var/run/containerd/containerd.sock"
 	DefaultNamespace         = "k8s.io"
 	DefaultLogLevel          = "info"
+	DefaultOutput            = OutputText
+)
+
+const (
+	OutputText = "text"
+	OutputJSON = "json"
 )
 
 var Root = New()
@@ -22,6 +32,7 @@ func New() *cobra.Command {
 	rootCmd.PersistentFlags().String("containerd-address", DefaultContainerdAddress, "containerd address")
 	rootCmd.PersistentFlags().StringP("namespace", "n", DefaultNamespace, "containerd namespace")
 	rootCmd.PersistentFlags().StringP("log-level", "l", DefaultLogLevel, "log level")
+	rootCmd.PersistentFlags().String("lock-dir", runtime.DefaultLockDir, "directory of the lock files preventing concurrent manipulations of an image")
 
 	rootCmd.AddCommand(NewCmdRebase())
 	rootCmd.AddCommand(NewCmdRemove())
@@ -32,6 +43,14 @@ func New() *cobra.Command {
 	rootCmd.AddCommand(NewCmdRemote())
 	rootCmd.AddCommand(NewCmdTag())
 	rootCmd.AddCommand(NewCmdLs())
+	rootCmd.AddCommand(NewCmdServe())
+	rootCmd.AddCommand(NewCmdReflog())
+	rootCmd.AddCommand(NewCmdReset())
+	rootCmd.AddCommand(NewCmdConvert())
+	rootCmd.AddCommand(NewCmdAdd())
+	rootCmd.AddCommand(NewCmdConfig())
+	rootCmd.AddCommand(NewCmdExec())
+	rootCmd.AddCommand(NewCmdFindBase())
 
 	return rootCmd
 }
@@ -54,5 +73,128 @@ func processRootCmdFlags(cmd *cobra.Command) (options.RootOptions, error) {
 		// handle error
 		return o, err
 	}
+	o.LockDir, err = cmd.Flags().GetString("lock-dir")
+	if err != nil {
+		// handle error
+		return o, err
+	}
+	return o, nil
+}
+
+// addCommitFlags adds the flags of the metadata recorded for new layers and images
+func addCommitFlags(cmd *cobra.Command) {
+	cmd.Flags().String("author", "", "author of the new image and its new history entries (default \"image-manip\")")
+	cmd.Flags().StringP("message", "m", "", "comment of the new history entries")
+	cmd.Flags().String("created", "", "creation time of the new image and its new history entries, as unix seconds or RFC 3339 (default $SOURCE_DATE_EPOCH, or the current time, or the unix epoch with --reproducible)")
+	cmd.Flags().Bool("reproducible", false, "normalize new layers so that identical inputs give identical digests, file timestamps are clamped to --created")
+	cmd.Flags().String("manifest-format", "", "media types of the new image: docker or oci (default the format of the original image, oci for zstd layers)")
+	cmd.Flags().String("compression", runtime.CompressionGzip, "compression of the new layers: gzip, zstd, zstd:chunked or estargz")
+}
+
+func processCommitCmdFlags(cmd *cobra.Command) (options.CommitOptions, error) {
+	o := options.CommitOptions{}
+	var err error
+	o.Author, err = cmd.Flags().GetString("author")
+	if err != nil {
+		return o, err
+	}
+	o.Comment, err = cmd.Flags().GetString("message")
+	if err != nil {
+		return o, err
+	}
+	o.Created, err = cmd.Flags().GetString("created")
+	if err != nil {
+		return o, err
+	}
+	o.Reproducible, err = cmd.Flags().GetBool("reproducible")
+	if err != nil {
+		return o, err
+	}
+	o.ManifestFormat, err = cmd.Flags().GetString("manifest-format")
+	if err != nil {
+		return o, err
+	}
+	o.Compression, err = cmd.Flags().GetString("compression")
+	if err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+// addPlatformFlags adds the flags selecting the platforms of a multi-platform image to manipulate
+func addPlatformFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("platform", []string{}, "platforms of a multi-platform image to manipulate, e.g. linux/arm64 (default the platform of the host)")
+	cmd.Flags().Bool("all-platforms", false, "manipulate all the platforms of a multi-platform image")
+}
+
+func processPlatformCmdFlags(cmd *cobra.Command) (options.PlatformOptions, error) {
+	o := options.PlatformOptions{}
+	var err error
+	o.Platforms, err = cmd.Flags().GetStringSlice("platform")
+	if err != nil {
+		return o, err
+	}
+	o.AllPlatforms, err = cmd.Flags().GetBool("all-platforms")
+	if err != nil {
+		return o, err
+	}
+	if o.AllPlatforms && len(o.Platforms) > 0 {
+		return o, fmt.Errorf("--platform and --all-platforms are mutually exclusive")
+	}
 	return o, nil
 }
+
+// addOutputFlag adds the flag selecting how the result of a command is printed
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringP("output", "o", DefaultOutput, "output format: text or json")
+}
+
+func processOutputCmdFlag(cmd *cobra.Command) (string, error) {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return "", err
+	}
+	switch output {
+	case OutputText, OutputJSON:
+		return output, nil
+	default:
+		return "", fmt.Errorf("unknown output format %q, must be %q or %q", output, OutputText, OutputJSON)
+	}
+}
+
+// printPlans prints the plan of a dry run in text mode, or the plan of each platform of a multi-platform
+// image. It returns false if there is nothing to print, i.e. the command was not a dry run.
+func printPlans(cmd *cobra.Command, output string, plan *runtime.Plan, platforms []runtime.PlatformResult) (bool, error) {
+	if output != OutputText {
+		return false, nil
+	}
+	if plan != nil {
+		return true, plan.Print(cmd.OutOrStdout())
+	}
+	printed := false
+	for _, p := range platforms {
+		if p.Plan == nil {
+			continue
+		}
+		if printed {
+			fmt.Fprintln(cmd.OutOrStdout())
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "PLATFORM:\t%s\n", p.Platform)
+		if err := p.Plan.Print(cmd.OutOrStdout()); err != nil {
+			return true, err
+		}
+		printed = true
+	}
+	return printed, nil
+}
+
+// printResult prints result as JSON to stdout if output is json, the logs are written to stderr.
+// In text mode, nothing is printed since the result has been logged.
+func printResult(cmd *cobra.Command, output string, result interface{}) error {
+	if output != OutputJSON {
+		return nil
+	}
+	enc := json.NewEncoder(cmd.OutOrStdout())
+	enc.SetIndent("", "    ")
+	return enc.Encode(result)
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/lingdie/image-manip-server/pkg/options"
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+	"github.com/lingdie/image-manip-server/pkg/server"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+)
+
+const (
+	DefaultServeAddress   = "127.0.0.1:8080"
+	DefaultServeWorkers   = 2
+	DefaultServeQueueSize = 100
+	// shutdownTimeout is how long the running requests are waited for on shutdown
+	shutdownTimeout = 30 * time.Second
+)
+
+func NewCmdServe() *cobra.Command {
+	var serveCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the image operations over an HTTP/JSON API",
+		Long: `Serve the image operations over an HTTP/JSON API.
+
+The endpoints accept POST requests whose bodies are the options of the operations
+in JSON, and answer with their results:
+
+  /v1/rebase, /v1/squash    rebase options
+  /v1/remove                remove options
+  /v1/tag                   tag options
+  /v1/verify-base           verify-base options
+  /v1/history               history options
+  /v1/history/search        history search options
+  /v1/images                image list options
+
+The operations modifying images can be submitted as jobs instead, answered
+right away with the ID of the job:
+
+  POST /v1/jobs/{rebase,squash,remove,tag}  submit a job
+  GET  /v1/jobs                             list the jobs
+  GET  /v1/jobs/ID                          status and result of a job
+  POST /v1/jobs/ID/cancel                   cancel a job
+  GET  /v1/jobs/ID/events                   progress of a job, as Server-Sent Events
+
+With --grpc-address, the operations are also served over the gRPC service
+defined in pkg/api/v1/manip.proto, streaming the progress of rebase, squash
+and remove before their results.
+
+All the requests share the containerd connection configured by the global flags.`,
+		Args: cobra.NoArgs,
+		RunE: serveAction,
+	}
+	serveCmd.Flags().String("address", DefaultServeAddress, "TCP address to listen on")
+	serveCmd.Flags().String("grpc-address", "", "TCP address the gRPC API listens on, disabled if empty")
+	serveCmd.Flags().Int("workers", DefaultServeWorkers, "number of jobs run concurrently")
+	serveCmd.Flags().Int("queue-size", DefaultServeQueueSize, "number of jobs waiting for a worker, more jobs are rejected")
+	return serveCmd
+}
+
+func serveAction(cmd *cobra.Command, args []string) error {
+	opts, err := processServeCmdFlags(cmd)
+	if err != nil {
+		return err
+	}
+	runtimeObj, err := runtime.NewRuntime(cmd.Context(), opts.RootOptions)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := runtimeObj.Close()
+		if err != nil {
+			fmt.Printf("failed to close runtime: %v\n", err)
+		}
+	}()
+	apiServer := server.NewServer(runtimeObj, opts)
+	defer apiServer.Close()
+	httpServer := &http.Server{
+		Addr:              opts.Address,
+		Handler:           apiServer,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		runtimeObj.Infof("serving the HTTP API on %s", opts.Address)
+		errCh <- httpServer.ListenAndServe()
+	}()
+	var grpcServer *grpc.Server
+	grpcErrCh := make(chan error, 1)
+	if opts.GRPCAddress != "" {
+		lis, err := net.Listen("tcp", opts.GRPCAddress)
+		if err != nil {
+			return err
+		}
+		grpcServer = grpc.NewServer()
+		server.NewGRPCService(apiServer).Register(grpcServer)
+		go func() {
+			runtimeObj.Infof("serving the gRPC API on %s", opts.GRPCAddress)
+			grpcErrCh <- grpcServer.Serve(lis)
+		}()
+		defer grpcServer.Stop()
+	}
+	select {
+	case err := <-errCh:
+		return err
+	case err := <-grpcErrCh:
+		return err
+	case <-cmd.Context().Done():
+	}
+	if grpcServer != nil {
+		runtimeObj.Infof("shutting down the gRPC API")
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(shutdownTimeout):
+			grpcServer.Stop()
+		}
+	}
+	runtimeObj.Infof("shutting down the HTTP API")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func processServeCmdFlags(cmd *cobra.Command) (options.ServeOptions, error) {
+	var err error
+	o := options.ServeOptions{}
+	o.RootOptions, err = processRootCmdFlags(cmd)
+	if err != nil {
+		// handle error
+		return o, err
+	}
+	o.Address, err = cmd.Flags().GetString("address")
+	if err != nil {
+		// handle error
+		return o, err
+	}
+	o.GRPCAddress, err = cmd.Flags().GetString("grpc-address")
+	if err != nil {
+		// handle error
+		return o, err
+	}
+	o.Workers, err = cmd.Flags().GetInt("workers")
+	if err != nil {
+		// handle error
+		return o, err
+	}
+	if o.Workers < 1 {
+		return o, fmt.Errorf("at least one worker is required")
+	}
+	o.QueueSize, err = cmd.Flags().GetInt("queue-size")
+	if err != nil {
+		// handle error
+		return o, err
+	}
+	if o.QueueSize < 0 {
+		return o, fmt.Errorf("the queue size can not be negative")
+	}
+	return o, nil
+}
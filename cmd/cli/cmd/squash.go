@@ -1,22 +1,56 @@
 package cmd
 
 import (
+	"fmt"
+
+	"github.com/docker/go-units"
 	"github.com/lingdie/image-manip-server/pkg/options"
 	"github.com/lingdie/image-manip-server/pkg/runtime"
 	"github.com/spf13/cobra"
 )
 
-const defaultDockerfileComment = "buildkit.dockerfile.v0"
-
 func NewCmdSquash() *cobra.Command {
 
 	var squashCmd = &cobra.Command{
 		Use:   "squash IMAGE_REF",
 		Short: "Squash a container image",
-		Args:  cobra.ExactArgs(1),
-		RunE:  squashAction,
+		Long: `Squash the layers above the base layer of a container image into one. If neither --base-layer-digest
+nor --base-image is given, the base layer is detected by the strategies of --base-detection, in order:
+annotation (the base image annotations of the manifest), local (the local image whose layers are the
+longest prefix of the image's), buildah, buildkit, kaniko, ko and docker (the history markers of these
+builders). The first strategy of high confidence wins, otherwise the first one of the highest confidence,
+and the chosen strategy and its confidence are logged and reported in the JSON output.
+
+With --from and --to, only the layers from --from to --to are squashed into one, and the layers above
+them are kept as they are, e.g. to collapse the layers installing dependencies while keeping the layer
+of the application separate. Each end of the range is a layer digest or the index of an entry of the
+image history, counted from 0 for the oldest entry.
+
+With --max-layers, --min-layer-size or --keep-layer-size, the layers to squash are chosen from the sizes
+of their blobs: adjacent small layers are merged, smallest first, until no layer is smaller than
+--min-layer-size and the image has at most --max-layers layers. Layers of --keep-layer-size or more are
+kept on their own, and no layer is merged across a --stable-layer. The layers above the base, or all
+the layers of the image without a base, are planned, and the chosen todo list is logged.`,
+		Args: cobra.ExactArgs(1),
+		RunE: squashAction,
 	}
-	squashCmd.Flags().String("base-layer-digest", "", "base image digest, if not specified, the image will be squashed intelligently")
+	squashCmd.Flags().String("base-layer-digest", "", "base image digest, if not specified, it is detected")
+	squashCmd.Flags().String("base-image", "", "base image ref, the layers above it will be squashed")
+	squashCmd.MarkFlagsMutuallyExclusive("base-layer-digest", "base-image")
+	squashCmd.Flags().StringSlice("base-detection", nil, "strategies detecting the base layer, in order, e.g. annotation,local,buildkit (default all)")
+	squashCmd.Flags().String("from", "", "bottom layer of the range to squash, a layer digest or a history index")
+	squashCmd.Flags().String("to", "", "top layer of the range to squash, a layer digest or a history index")
+	squashCmd.MarkFlagsRequiredTogether("from", "to")
+	squashCmd.MarkFlagsMutuallyExclusive("from", "base-layer-digest")
+	squashCmd.MarkFlagsMutuallyExclusive("from", "base-image")
+	squashCmd.Flags().Int("max-layers", 0, "plan the squash so that the image has at most this number of layers")
+	squashCmd.Flags().String("min-layer-size", "", "plan the squash so that no layer is smaller than this size, e.g. 10MiB")
+	squashCmd.Flags().String("keep-layer-size", "", "plan the squash keeping the layers of this size or more on their own, e.g. 100MiB")
+	squashCmd.Flags().StringArray("stable-layer", nil, "plan the squash without merging this layer with the layers above it, a layer digest or a history index, can be repeated")
+	squashCmd.Flags().Bool("dry-run", false, "print the layers to squash and the new history without squashing")
+	addCommitFlags(squashCmd)
+	addPlatformFlags(squashCmd)
+	addOutputFlag(squashCmd)
 
 	return squashCmd
 }
@@ -31,10 +65,13 @@ func squashAction(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	output, err := processOutputCmdFlag(cmd)
+	if err != nil {
+		return err
+	}
 	// Positional arguments: imageRef
 	imageRef = args[0]
 	rebaseOptions.ImageRef = imageRef
-	rebaseOptions.AutoSquash = true
 
 	// init the runtime
 	runtimeObj, err := runtime.NewRuntime(
@@ -50,29 +87,15 @@ func squashAction(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	// if base layer digest is not provided, we will try to detect it intelligently
-	// by looking for the last layer with the default dockerfile comment
-	if rebaseOptions.BaseLayerDigest == "" {
-		runtimeObj.Infof("No base layer digest provided, attempting to detect it intelligently...")
-		// detect the base layer if not provided
-
-		possibleBaseLayerDigests, err := runtimeObj.CommentContains(runtimeObj.Context(), imageRef, defaultDockerfileComment)
-		if err != nil {
-			return err
-		}
-		if len(possibleBaseLayerDigests) > 0 {
-			rebaseOptions.BaseLayerDigest = possibleBaseLayerDigests[0].String()
-			runtimeObj.Infof("Detected base layer digest: %s\n", rebaseOptions.BaseLayerDigest)
-		} else {
-			runtimeObj.Infof("No layer with comment %q found. you might want to specify it manually.\n", defaultDockerfileComment)
-		}
+	// do the squash, the base layer is detected if not provided
+	result, err := runtimeObj.Squash(runtimeObj.Context(), rebaseOptions)
+	if err != nil {
+		return err
 	}
-
-	// do the rebase
-	if err := runtimeObj.Rebase(runtimeObj.Context(), rebaseOptions); err != nil {
+	if printed, err := printPlans(cmd, output, result.Plan, result.Platforms); printed || err != nil {
 		return err
 	}
-	return nil
+	return printResult(cmd, output, result)
 }
 
 func processSquashCmdFlags(cmd *cobra.Command) (options.RebaseOptions, error) {
@@ -83,10 +106,76 @@ func processSquashCmdFlags(cmd *cobra.Command) (options.RebaseOptions, error) {
 		// handle error
 		return o, err
 	}
+	o.CommitOptions, err = processCommitCmdFlags(cmd)
+	if err != nil {
+		return o, err
+	}
+	o.PlatformOptions, err = processPlatformCmdFlags(cmd)
+	if err != nil {
+		return o, err
+	}
 	o.BaseLayerDigest, err = cmd.Flags().GetString("base-layer-digest")
 	if err != nil {
 		// handle error
 		return o, err
 	}
+	o.BaseImageRef, err = cmd.Flags().GetString("base-image")
+	if err != nil {
+		// handle error
+		return o, err
+	}
+	o.BaseDetection, err = cmd.Flags().GetStringSlice("base-detection")
+	if err != nil {
+		return o, err
+	}
+	o.SquashFrom, err = cmd.Flags().GetString("from")
+	if err != nil {
+		return o, err
+	}
+	o.SquashTo, err = cmd.Flags().GetString("to")
+	if err != nil {
+		return o, err
+	}
+	o.SquashPlan, err = processSquashPlanCmdFlags(cmd)
+	if err != nil {
+		return o, err
+	}
+	o.DryRun, err = cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		// handle error
+		return o, err
+	}
+	return o, nil
+}
+
+// processSquashPlanCmdFlags returns the options of a planned squash, or nil if no plan flag is set.
+func processSquashPlanCmdFlags(cmd *cobra.Command) (*options.SquashPlanOptions, error) {
+	flags := cmd.Flags()
+	if !flags.Changed("max-layers") && !flags.Changed("min-layer-size") && !flags.Changed("keep-layer-size") && !flags.Changed("stable-layer") {
+		return nil, nil
+	}
+	o := &options.SquashPlanOptions{}
+	var err error
+	o.MaxLayers, err = flags.GetInt("max-layers")
+	if err != nil {
+		return nil, err
+	}
+	for name, size := range map[string]*int64{"min-layer-size": &o.MinLayerSize, "keep-layer-size": &o.KeepLayerSize} {
+		value, err := flags.GetString(name)
+		if err != nil {
+			return nil, err
+		}
+		if value == "" {
+			continue
+		}
+		*size, err = units.RAMInBytes(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s %q: %w", name, value, err)
+		}
+	}
+	o.StableLayers, err = flags.GetStringArray("stable-layer")
+	if err != nil {
+		return nil, err
+	}
 	return o, nil
 }
@@ -13,6 +13,7 @@ func NewCmdTag() *cobra.Command {
 		Args:  cobra.ExactArgs(2),
 		RunE:  tagAction,
 	}
+	addOutputFlag(tagCmd)
 	return tagCmd
 }
 
@@ -23,6 +24,10 @@ func tagAction(cmd *cobra.Command, args []string) error {
 	}
 	opts.SourceImageRef = args[0]
 	opts.TargetImage = args[1]
+	output, err := processOutputCmdFlag(cmd)
+	if err != nil {
+		return err
+	}
 
 	r, err := runtime.NewRuntime(cmd.Context(), opts.RootOptions)
 	if err != nil {
@@ -30,10 +35,11 @@ func tagAction(cmd *cobra.Command, args []string) error {
 	}
 	defer r.Close()
 
-	if err := r.Tag(r.Context(), opts.SourceImageRef, opts.TargetImage); err != nil {
+	result, err := r.Tag(r.Context(), opts.SourceImageRef, opts.TargetImage)
+	if err != nil {
 		return err
 	}
-	return nil
+	return printResult(cmd, output, result)
 }
 
 func processTagCmdFlags(cmd *cobra.Command) (options.TagOptions, error) {
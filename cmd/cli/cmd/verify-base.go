@@ -13,6 +13,7 @@ func NewCmdVerifyBase() *cobra.Command {
 		Args:  cobra.MinimumNArgs(2),
 		RunE:  verifyBaseAction,
 	}
+	addOutputFlag(verifyBaseCmd)
 	return verifyBaseCmd
 }
 
@@ -25,6 +26,10 @@ func verifyBaseAction(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	output, err := processOutputCmdFlag(cmd)
+	if err != nil {
+		return err
+	}
 
 	verifyBaseOptions.OriginalImage = originalImageRef
 	verifyBaseOptions.BaseImage = baseImageRef
@@ -35,10 +40,17 @@ func verifyBaseAction(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	if err := runtimeObj.Verifybase(runtimeObj.Context(), verifyBaseOptions); err != nil {
+	result, err := runtimeObj.Verifybase(runtimeObj.Context(), verifyBaseOptions)
+	if err != nil {
+		// a mismatch is reported in the result as well
+		if result.Reason != "" {
+			if err := printResult(cmd, output, result); err != nil {
+				return err
+			}
+		}
 		return err
 	}
-	return nil
+	return printResult(cmd, output, result)
 }
 
 func processVerifyBaseCmdFlags(cmd *cobra.Command) (options.VerifyBaseOptions, error) {
@@ -9,23 +9,23 @@ import (
 // ImageListOptions specifies options for `nerdctl image list`.
 type ImageListOptions struct {
 	options.RootOptions
-	Stdout io.Writer
+	Stdout io.Writer `json:"-"`
 	// Quiet only show numeric IDs
-	Quiet bool
+	Quiet bool `json:"quiet"`
 	// NoTrunc don't truncate output
-	NoTrunc bool
+	NoTrunc bool `json:"no_trunc"`
 	// Format the output using the given Go template, e.g, '{{json .}}', 'wide'
-	Format string
+	Format string `json:"format"`
 	// Filter output based on conditions provided, for the --filter argument
-	Filters []string
+	Filters []string `json:"filters"`
 	// NameAndRefFilter filters images by name and reference
-	NameAndRefFilter []string
+	NameAndRefFilter []string `json:"name_and_ref_filter"`
 	// Digests show digests (compatible with Docker, unlike ID)
-	Digests bool
+	Digests bool `json:"digests"`
 	// Names show image names
-	Names bool
+	Names bool `json:"names"`
 	// All (unimplemented yet, always true)
-	All bool
+	All bool `json:"all"`
 	// SortBy specifies the sort key
-	SortBy string
+	SortBy string `json:"sort_by"`
 }
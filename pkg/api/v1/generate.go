@@ -0,0 +1,4 @@
+// Package apiv1 is the gRPC API of image-manip, generated from manip.proto.
+package apiv1
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative manip.proto
@@ -0,0 +1,2820 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v5.29.3
+// source: manip.proto
+
+// The gRPC API of image-manip, mirroring the operations of the runtime and the HTTP API.
+// The Go stubs are generated with `go generate ./pkg/api/v1`.
+
+package apiv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// CommitOptions is the metadata recorded for the layers and the image created by an operation.
+type CommitOptions struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// author of the new image and its new history entries, "image-manip" if empty
+	Author string `protobuf:"bytes,1,opt,name=author,proto3" json:"author,omitempty"`
+	// comment of the new history entries
+	Comment string `protobuf:"bytes,2,opt,name=comment,proto3" json:"comment,omitempty"`
+	// created is the creation time, as seconds since the unix epoch or in RFC 3339 format,
+	// $SOURCE_DATE_EPOCH of the server if empty
+	Created string `protobuf:"bytes,3,opt,name=created,proto3" json:"created,omitempty"`
+	// reproducible normalizes new layers so that identical inputs give identical digests
+	Reproducible bool `protobuf:"varint,4,opt,name=reproducible,proto3" json:"reproducible,omitempty"`
+	// manifest_format is "docker" or "oci", the format of the original image is kept if empty
+	ManifestFormat string `protobuf:"bytes,5,opt,name=manifest_format,json=manifestFormat,proto3" json:"manifest_format,omitempty"`
+	// compression of the new layers: "gzip" (the default), "zstd", "zstd:chunked" or "estargz"
+	Compression   string `protobuf:"bytes,6,opt,name=compression,proto3" json:"compression,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommitOptions) Reset() {
+	*x = CommitOptions{}
+	mi := &file_manip_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommitOptions) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommitOptions) ProtoMessage() {}
+
+func (x *CommitOptions) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommitOptions.ProtoReflect.Descriptor instead.
+func (*CommitOptions) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *CommitOptions) GetAuthor() string {
+	if x != nil {
+		return x.Author
+	}
+	return ""
+}
+
+func (x *CommitOptions) GetComment() string {
+	if x != nil {
+		return x.Comment
+	}
+	return ""
+}
+
+func (x *CommitOptions) GetCreated() string {
+	if x != nil {
+		return x.Created
+	}
+	return ""
+}
+
+func (x *CommitOptions) GetReproducible() bool {
+	if x != nil {
+		return x.Reproducible
+	}
+	return false
+}
+
+func (x *CommitOptions) GetManifestFormat() string {
+	if x != nil {
+		return x.ManifestFormat
+	}
+	return ""
+}
+
+func (x *CommitOptions) GetCompression() string {
+	if x != nil {
+		return x.Compression
+	}
+	return ""
+}
+
+type RebaseRequest struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	ImageRef        string                 `protobuf:"bytes,1,opt,name=image_ref,json=imageRef,proto3" json:"image_ref,omitempty"`
+	NewImageName    string                 `protobuf:"bytes,2,opt,name=new_image_name,json=newImageName,proto3" json:"new_image_name,omitempty"`
+	BaseLayerDigest string                 `protobuf:"bytes,3,opt,name=base_layer_digest,json=baseLayerDigest,proto3" json:"base_layer_digest,omitempty"`
+	// base_image_ref is the old base image, it can not be used together with base_layer_digest
+	BaseImageRef    string `protobuf:"bytes,4,opt,name=base_image_ref,json=baseImageRef,proto3" json:"base_image_ref,omitempty"`
+	NewBaseImageRef string `protobuf:"bytes,5,opt,name=new_base_image_ref,json=newBaseImageRef,proto3" json:"new_base_image_ref,omitempty"`
+	AutoSquash      bool   `protobuf:"varint,6,opt,name=auto_squash,json=autoSquash,proto3" json:"auto_squash,omitempty"`
+	// todo_list is a git-style rebase todo list, it takes precedence over auto_squash
+	TodoList string `protobuf:"bytes,7,opt,name=todo_list,json=todoList,proto3" json:"todo_list,omitempty"`
+	// config_merge_policy is "keep-app", "keep-base" or "merge"
+	ConfigMergePolicy   string            `protobuf:"bytes,8,opt,name=config_merge_policy,json=configMergePolicy,proto3" json:"config_merge_policy,omitempty"`
+	ConfigFieldPolicies map[string]string `protobuf:"bytes,9,rep,name=config_field_policies,json=configFieldPolicies,proto3" json:"config_field_policies,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	DryRun              bool              `protobuf:"varint,10,opt,name=dry_run,json=dryRun,proto3" json:"dry_run,omitempty"`
+	Commit              *CommitOptions    `protobuf:"bytes,11,opt,name=commit,proto3" json:"commit,omitempty"`
+	// platforms selects the platforms of a multi-platform image, the default platform of the server if empty
+	Platforms    []string `protobuf:"bytes,12,rep,name=platforms,proto3" json:"platforms,omitempty"`
+	AllPlatforms bool     `protobuf:"varint,13,opt,name=all_platforms,json=allPlatforms,proto3" json:"all_platforms,omitempty"`
+	// squash_from and squash_to are the ends of a range of layers squashed into one, each a layer digest
+	// or a history index, the layers above the range are kept
+	SquashFrom string `protobuf:"bytes,14,opt,name=squash_from,json=squashFrom,proto3" json:"squash_from,omitempty"`
+	SquashTo   string `protobuf:"bytes,15,opt,name=squash_to,json=squashTo,proto3" json:"squash_to,omitempty"`
+	// squash_plan chooses the todo list from the sizes of the layers, if set
+	SquashPlan *SquashPlan `protobuf:"bytes,16,opt,name=squash_plan,json=squashPlan,proto3" json:"squash_plan,omitempty"`
+	// base_detection names the strategies detecting the base layer of a squash, in order, all if empty
+	BaseDetection []string `protobuf:"bytes,17,rep,name=base_detection,json=baseDetection,proto3" json:"base_detection,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RebaseRequest) Reset() {
+	*x = RebaseRequest{}
+	mi := &file_manip_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RebaseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RebaseRequest) ProtoMessage() {}
+
+func (x *RebaseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RebaseRequest.ProtoReflect.Descriptor instead.
+func (*RebaseRequest) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *RebaseRequest) GetImageRef() string {
+	if x != nil {
+		return x.ImageRef
+	}
+	return ""
+}
+
+func (x *RebaseRequest) GetNewImageName() string {
+	if x != nil {
+		return x.NewImageName
+	}
+	return ""
+}
+
+func (x *RebaseRequest) GetBaseLayerDigest() string {
+	if x != nil {
+		return x.BaseLayerDigest
+	}
+	return ""
+}
+
+func (x *RebaseRequest) GetBaseImageRef() string {
+	if x != nil {
+		return x.BaseImageRef
+	}
+	return ""
+}
+
+func (x *RebaseRequest) GetNewBaseImageRef() string {
+	if x != nil {
+		return x.NewBaseImageRef
+	}
+	return ""
+}
+
+func (x *RebaseRequest) GetAutoSquash() bool {
+	if x != nil {
+		return x.AutoSquash
+	}
+	return false
+}
+
+func (x *RebaseRequest) GetTodoList() string {
+	if x != nil {
+		return x.TodoList
+	}
+	return ""
+}
+
+func (x *RebaseRequest) GetConfigMergePolicy() string {
+	if x != nil {
+		return x.ConfigMergePolicy
+	}
+	return ""
+}
+
+func (x *RebaseRequest) GetConfigFieldPolicies() map[string]string {
+	if x != nil {
+		return x.ConfigFieldPolicies
+	}
+	return nil
+}
+
+func (x *RebaseRequest) GetDryRun() bool {
+	if x != nil {
+		return x.DryRun
+	}
+	return false
+}
+
+func (x *RebaseRequest) GetCommit() *CommitOptions {
+	if x != nil {
+		return x.Commit
+	}
+	return nil
+}
+
+func (x *RebaseRequest) GetPlatforms() []string {
+	if x != nil {
+		return x.Platforms
+	}
+	return nil
+}
+
+func (x *RebaseRequest) GetAllPlatforms() bool {
+	if x != nil {
+		return x.AllPlatforms
+	}
+	return false
+}
+
+func (x *RebaseRequest) GetSquashFrom() string {
+	if x != nil {
+		return x.SquashFrom
+	}
+	return ""
+}
+
+func (x *RebaseRequest) GetSquashTo() string {
+	if x != nil {
+		return x.SquashTo
+	}
+	return ""
+}
+
+func (x *RebaseRequest) GetSquashPlan() *SquashPlan {
+	if x != nil {
+		return x.SquashPlan
+	}
+	return nil
+}
+
+func (x *RebaseRequest) GetBaseDetection() []string {
+	if x != nil {
+		return x.BaseDetection
+	}
+	return nil
+}
+
+// SquashPlan chooses the layers to squash together from the sizes of their blobs.
+type SquashPlan struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// max_layers is the number of layers of the new image at most, 0 for no limit
+	MaxLayers int32 `protobuf:"varint,1,opt,name=max_layers,json=maxLayers,proto3" json:"max_layers,omitempty"`
+	// min_layer_size is the size in bytes below which a layer is merged with a neighbour
+	MinLayerSize int64 `protobuf:"varint,2,opt,name=min_layer_size,json=minLayerSize,proto3" json:"min_layer_size,omitempty"`
+	// keep_layer_size is the size in bytes from which a layer is kept on its own
+	KeepLayerSize int64 `protobuf:"varint,3,opt,name=keep_layer_size,json=keepLayerSize,proto3" json:"keep_layer_size,omitempty"`
+	// stable_layers are the layers no squashed layer spans above, each a layer digest or a history index
+	StableLayers  []string `protobuf:"bytes,4,rep,name=stable_layers,json=stableLayers,proto3" json:"stable_layers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SquashPlan) Reset() {
+	*x = SquashPlan{}
+	mi := &file_manip_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SquashPlan) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SquashPlan) ProtoMessage() {}
+
+func (x *SquashPlan) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SquashPlan.ProtoReflect.Descriptor instead.
+func (*SquashPlan) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SquashPlan) GetMaxLayers() int32 {
+	if x != nil {
+		return x.MaxLayers
+	}
+	return 0
+}
+
+func (x *SquashPlan) GetMinLayerSize() int64 {
+	if x != nil {
+		return x.MinLayerSize
+	}
+	return 0
+}
+
+func (x *SquashPlan) GetKeepLayerSize() int64 {
+	if x != nil {
+		return x.KeepLayerSize
+	}
+	return 0
+}
+
+func (x *SquashPlan) GetStableLayers() []string {
+	if x != nil {
+		return x.StableLayers
+	}
+	return nil
+}
+
+type RemoveRequest struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	ImageRef     string                 `protobuf:"bytes,1,opt,name=image_ref,json=imageRef,proto3" json:"image_ref,omitempty"`
+	File         string                 `protobuf:"bytes,2,opt,name=file,proto3" json:"file,omitempty"`
+	NewImageName string                 `protobuf:"bytes,3,opt,name=new_image_name,json=newImageName,proto3" json:"new_image_name,omitempty"`
+	DryRun       bool                   `protobuf:"varint,4,opt,name=dry_run,json=dryRun,proto3" json:"dry_run,omitempty"`
+	Commit       *CommitOptions         `protobuf:"bytes,5,opt,name=commit,proto3" json:"commit,omitempty"`
+	Platforms    []string               `protobuf:"bytes,6,rep,name=platforms,proto3" json:"platforms,omitempty"`
+	AllPlatforms bool                   `protobuf:"varint,7,opt,name=all_platforms,json=allPlatforms,proto3" json:"all_platforms,omitempty"`
+	// paths are paths, globs and regular expressions prefixed with "re:" removed along with file
+	Paths []string `protobuf:"bytes,8,rep,name=paths,proto3" json:"paths,omitempty"`
+	// allow_no_match only warns about the paths matching nothing
+	AllowNoMatch bool `protobuf:"varint,9,opt,name=allow_no_match,json=allowNoMatch,proto3" json:"allow_no_match,omitempty"`
+	// purge removes the paths from every layer containing them instead of adding a layer of whiteouts
+	Purge         bool `protobuf:"varint,10,opt,name=purge,proto3" json:"purge,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RemoveRequest) Reset() {
+	*x = RemoveRequest{}
+	mi := &file_manip_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemoveRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveRequest) ProtoMessage() {}
+
+func (x *RemoveRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveRequest.ProtoReflect.Descriptor instead.
+func (*RemoveRequest) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *RemoveRequest) GetImageRef() string {
+	if x != nil {
+		return x.ImageRef
+	}
+	return ""
+}
+
+func (x *RemoveRequest) GetFile() string {
+	if x != nil {
+		return x.File
+	}
+	return ""
+}
+
+func (x *RemoveRequest) GetNewImageName() string {
+	if x != nil {
+		return x.NewImageName
+	}
+	return ""
+}
+
+func (x *RemoveRequest) GetDryRun() bool {
+	if x != nil {
+		return x.DryRun
+	}
+	return false
+}
+
+func (x *RemoveRequest) GetCommit() *CommitOptions {
+	if x != nil {
+		return x.Commit
+	}
+	return nil
+}
+
+func (x *RemoveRequest) GetPlatforms() []string {
+	if x != nil {
+		return x.Platforms
+	}
+	return nil
+}
+
+func (x *RemoveRequest) GetAllPlatforms() bool {
+	if x != nil {
+		return x.AllPlatforms
+	}
+	return false
+}
+
+func (x *RemoveRequest) GetPaths() []string {
+	if x != nil {
+		return x.Paths
+	}
+	return nil
+}
+
+func (x *RemoveRequest) GetAllowNoMatch() bool {
+	if x != nil {
+		return x.AllowNoMatch
+	}
+	return false
+}
+
+func (x *RemoveRequest) GetPurge() bool {
+	if x != nil {
+		return x.Purge
+	}
+	return false
+}
+
+type TagRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	SourceImageRef string                 `protobuf:"bytes,1,opt,name=source_image_ref,json=sourceImageRef,proto3" json:"source_image_ref,omitempty"`
+	TargetImage    string                 `protobuf:"bytes,2,opt,name=target_image,json=targetImage,proto3" json:"target_image,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *TagRequest) Reset() {
+	*x = TagRequest{}
+	mi := &file_manip_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TagRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TagRequest) ProtoMessage() {}
+
+func (x *TagRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TagRequest.ProtoReflect.Descriptor instead.
+func (*TagRequest) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *TagRequest) GetSourceImageRef() string {
+	if x != nil {
+		return x.SourceImageRef
+	}
+	return ""
+}
+
+func (x *TagRequest) GetTargetImage() string {
+	if x != nil {
+		return x.TargetImage
+	}
+	return ""
+}
+
+type VerifyBaseRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	OriginalImage string                 `protobuf:"bytes,1,opt,name=original_image,json=originalImage,proto3" json:"original_image,omitempty"`
+	BaseImage     string                 `protobuf:"bytes,2,opt,name=base_image,json=baseImage,proto3" json:"base_image,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VerifyBaseRequest) Reset() {
+	*x = VerifyBaseRequest{}
+	mi := &file_manip_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VerifyBaseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VerifyBaseRequest) ProtoMessage() {}
+
+func (x *VerifyBaseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VerifyBaseRequest.ProtoReflect.Descriptor instead.
+func (*VerifyBaseRequest) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *VerifyBaseRequest) GetOriginalImage() string {
+	if x != nil {
+		return x.OriginalImage
+	}
+	return ""
+}
+
+func (x *VerifyBaseRequest) GetBaseImage() string {
+	if x != nil {
+		return x.BaseImage
+	}
+	return ""
+}
+
+type ListImagesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// filters are the conditions of the --filter flag of ls, e.g. "reference=my-app*"
+	Filters []string `protobuf:"bytes,1,rep,name=filters,proto3" json:"filters,omitempty"`
+	// names filters the images by name and reference
+	Names         []string `protobuf:"bytes,2,rep,name=names,proto3" json:"names,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListImagesRequest) Reset() {
+	*x = ListImagesRequest{}
+	mi := &file_manip_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListImagesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListImagesRequest) ProtoMessage() {}
+
+func (x *ListImagesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListImagesRequest.ProtoReflect.Descriptor instead.
+func (*ListImagesRequest) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ListImagesRequest) GetFilters() []string {
+	if x != nil {
+		return x.Filters
+	}
+	return nil
+}
+
+func (x *ListImagesRequest) GetNames() []string {
+	if x != nil {
+		return x.Names
+	}
+	return nil
+}
+
+type ImageHistoryRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	ImageRef string                 `protobuf:"bytes,1,opt,name=image_ref,json=imageRef,proto3" json:"image_ref,omitempty"`
+	// keyword only returns the entries whose comment contains it, if set
+	Keyword       string `protobuf:"bytes,2,opt,name=keyword,proto3" json:"keyword,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImageHistoryRequest) Reset() {
+	*x = ImageHistoryRequest{}
+	mi := &file_manip_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImageHistoryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImageHistoryRequest) ProtoMessage() {}
+
+func (x *ImageHistoryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImageHistoryRequest.ProtoReflect.Descriptor instead.
+func (*ImageHistoryRequest) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ImageHistoryRequest) GetImageRef() string {
+	if x != nil {
+		return x.ImageRef
+	}
+	return ""
+}
+
+func (x *ImageHistoryRequest) GetKeyword() string {
+	if x != nil {
+		return x.Keyword
+	}
+	return ""
+}
+
+// Progress is an event reported while an operation runs: a step has started, or a timed step
+// has completed, in which case duration is set.
+type Progress struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	Step          string                 `protobuf:"bytes,2,opt,name=step,proto3" json:"step,omitempty"`
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	Current       int32                  `protobuf:"varint,4,opt,name=current,proto3" json:"current,omitempty"`
+	Total         int32                  `protobuf:"varint,5,opt,name=total,proto3" json:"total,omitempty"`
+	Duration      *durationpb.Duration   `protobuf:"bytes,6,opt,name=duration,proto3" json:"duration,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Progress) Reset() {
+	*x = Progress{}
+	mi := &file_manip_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Progress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Progress) ProtoMessage() {}
+
+func (x *Progress) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Progress.ProtoReflect.Descriptor instead.
+func (*Progress) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Progress) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *Progress) GetStep() string {
+	if x != nil {
+		return x.Step
+	}
+	return ""
+}
+
+func (x *Progress) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Progress) GetCurrent() int32 {
+	if x != nil {
+		return x.Current
+	}
+	return 0
+}
+
+func (x *Progress) GetTotal() int32 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *Progress) GetDuration() *durationpb.Duration {
+	if x != nil {
+		return x.Duration
+	}
+	return nil
+}
+
+type Timing struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Duration      *durationpb.Duration   `protobuf:"bytes,2,opt,name=duration,proto3" json:"duration,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Timing) Reset() {
+	*x = Timing{}
+	mi := &file_manip_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Timing) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Timing) ProtoMessage() {}
+
+func (x *Timing) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Timing.ProtoReflect.Descriptor instead.
+func (*Timing) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Timing) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Timing) GetDuration() *durationpb.Duration {
+	if x != nil {
+		return x.Duration
+	}
+	return nil
+}
+
+type ResultLayer struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Digest    string                 `protobuf:"bytes,1,opt,name=digest,proto3" json:"digest,omitempty"`
+	DiffId    string                 `protobuf:"bytes,2,opt,name=diff_id,json=diffId,proto3" json:"diff_id,omitempty"`
+	MediaType string                 `protobuf:"bytes,3,opt,name=media_type,json=mediaType,proto3" json:"media_type,omitempty"`
+	Size      int64                  `protobuf:"varint,4,opt,name=size,proto3" json:"size,omitempty"`
+	// created is true if the layer has been created by the operation, false if it is reused
+	Created       bool `protobuf:"varint,5,opt,name=created,proto3" json:"created,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResultLayer) Reset() {
+	*x = ResultLayer{}
+	mi := &file_manip_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResultLayer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResultLayer) ProtoMessage() {}
+
+func (x *ResultLayer) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResultLayer.ProtoReflect.Descriptor instead.
+func (*ResultLayer) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ResultLayer) GetDigest() string {
+	if x != nil {
+		return x.Digest
+	}
+	return ""
+}
+
+func (x *ResultLayer) GetDiffId() string {
+	if x != nil {
+		return x.DiffId
+	}
+	return ""
+}
+
+func (x *ResultLayer) GetMediaType() string {
+	if x != nil {
+		return x.MediaType
+	}
+	return ""
+}
+
+func (x *ResultLayer) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *ResultLayer) GetCreated() bool {
+	if x != nil {
+		return x.Created
+	}
+	return false
+}
+
+// ImageResult is the image written by an operation, it is empty in dry-run mode.
+type ImageResult struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	NewImageName   string                 `protobuf:"bytes,1,opt,name=new_image_name,json=newImageName,proto3" json:"new_image_name,omitempty"`
+	ManifestDigest string                 `protobuf:"bytes,2,opt,name=manifest_digest,json=manifestDigest,proto3" json:"manifest_digest,omitempty"`
+	ConfigDigest   string                 `protobuf:"bytes,3,opt,name=config_digest,json=configDigest,proto3" json:"config_digest,omitempty"`
+	Layers         []*ResultLayer         `protobuf:"bytes,4,rep,name=layers,proto3" json:"layers,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *ImageResult) Reset() {
+	*x = ImageResult{}
+	mi := &file_manip_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImageResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImageResult) ProtoMessage() {}
+
+func (x *ImageResult) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImageResult.ProtoReflect.Descriptor instead.
+func (*ImageResult) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ImageResult) GetNewImageName() string {
+	if x != nil {
+		return x.NewImageName
+	}
+	return ""
+}
+
+func (x *ImageResult) GetManifestDigest() string {
+	if x != nil {
+		return x.ManifestDigest
+	}
+	return ""
+}
+
+func (x *ImageResult) GetConfigDigest() string {
+	if x != nil {
+		return x.ConfigDigest
+	}
+	return ""
+}
+
+func (x *ImageResult) GetLayers() []*ResultLayer {
+	if x != nil {
+		return x.Layers
+	}
+	return nil
+}
+
+type ConfigChange struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Field         string                 `protobuf:"bytes,1,opt,name=field,proto3" json:"field,omitempty"`
+	From          string                 `protobuf:"bytes,2,opt,name=from,proto3" json:"from,omitempty"`
+	To            string                 `protobuf:"bytes,3,opt,name=to,proto3" json:"to,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConfigChange) Reset() {
+	*x = ConfigChange{}
+	mi := &file_manip_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConfigChange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConfigChange) ProtoMessage() {}
+
+func (x *ConfigChange) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfigChange.ProtoReflect.Descriptor instead.
+func (*ConfigChange) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ConfigChange) GetField() string {
+	if x != nil {
+		return x.Field
+	}
+	return ""
+}
+
+func (x *ConfigChange) GetFrom() string {
+	if x != nil {
+		return x.From
+	}
+	return ""
+}
+
+func (x *ConfigChange) GetTo() string {
+	if x != nil {
+		return x.To
+	}
+	return ""
+}
+
+type History struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Created       *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=created,proto3" json:"created,omitempty"`
+	CreatedBy     string                 `protobuf:"bytes,2,opt,name=created_by,json=createdBy,proto3" json:"created_by,omitempty"`
+	Author        string                 `protobuf:"bytes,3,opt,name=author,proto3" json:"author,omitempty"`
+	Comment       string                 `protobuf:"bytes,4,opt,name=comment,proto3" json:"comment,omitempty"`
+	EmptyLayer    bool                   `protobuf:"varint,5,opt,name=empty_layer,json=emptyLayer,proto3" json:"empty_layer,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *History) Reset() {
+	*x = History{}
+	mi := &file_manip_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *History) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*History) ProtoMessage() {}
+
+func (x *History) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use History.ProtoReflect.Descriptor instead.
+func (*History) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *History) GetCreated() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Created
+	}
+	return nil
+}
+
+func (x *History) GetCreatedBy() string {
+	if x != nil {
+		return x.CreatedBy
+	}
+	return ""
+}
+
+func (x *History) GetAuthor() string {
+	if x != nil {
+		return x.Author
+	}
+	return ""
+}
+
+func (x *History) GetComment() string {
+	if x != nil {
+		return x.Comment
+	}
+	return ""
+}
+
+func (x *History) GetEmptyLayer() bool {
+	if x != nil {
+		return x.EmptyLayer
+	}
+	return false
+}
+
+type PlannedLayer struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// digest of a reused layer, empty for a layer to be created
+	Digest  string `protobuf:"bytes,1,opt,name=digest,proto3" json:"digest,omitempty"`
+	Created bool   `protobuf:"varint,2,opt,name=created,proto3" json:"created,omitempty"`
+	// sources are the layers squashed into a layer to be created
+	Sources       []string `protobuf:"bytes,3,rep,name=sources,proto3" json:"sources,omitempty"`
+	CreatedBy     string   `protobuf:"bytes,4,opt,name=created_by,json=createdBy,proto3" json:"created_by,omitempty"`
+	Size          int64    `protobuf:"varint,5,opt,name=size,proto3" json:"size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PlannedLayer) Reset() {
+	*x = PlannedLayer{}
+	mi := &file_manip_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PlannedLayer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PlannedLayer) ProtoMessage() {}
+
+func (x *PlannedLayer) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PlannedLayer.ProtoReflect.Descriptor instead.
+func (*PlannedLayer) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *PlannedLayer) GetDigest() string {
+	if x != nil {
+		return x.Digest
+	}
+	return ""
+}
+
+func (x *PlannedLayer) GetCreated() bool {
+	if x != nil {
+		return x.Created
+	}
+	return false
+}
+
+func (x *PlannedLayer) GetSources() []string {
+	if x != nil {
+		return x.Sources
+	}
+	return nil
+}
+
+func (x *PlannedLayer) GetCreatedBy() string {
+	if x != nil {
+		return x.CreatedBy
+	}
+	return ""
+}
+
+func (x *PlannedLayer) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+// Plan describes what an operation would do to an image, it is only set in dry-run mode.
+type Plan struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	ImageRef       string                 `protobuf:"bytes,1,opt,name=image_ref,json=imageRef,proto3" json:"image_ref,omitempty"`
+	NewImageName   string                 `protobuf:"bytes,2,opt,name=new_image_name,json=newImageName,proto3" json:"new_image_name,omitempty"`
+	SplitIndex     int32                  `protobuf:"varint,3,opt,name=split_index,json=splitIndex,proto3" json:"split_index,omitempty"`
+	BaseLayerCount int32                  `protobuf:"varint,4,opt,name=base_layer_count,json=baseLayerCount,proto3" json:"base_layer_count,omitempty"`
+	TodoList       string                 `protobuf:"bytes,5,opt,name=todo_list,json=todoList,proto3" json:"todo_list,omitempty"`
+	Layers         []*PlannedLayer        `protobuf:"bytes,6,rep,name=layers,proto3" json:"layers,omitempty"`
+	ConfigChanges  []*ConfigChange        `protobuf:"bytes,7,rep,name=config_changes,json=configChanges,proto3" json:"config_changes,omitempty"`
+	History        []*History             `protobuf:"bytes,8,rep,name=history,proto3" json:"history,omitempty"`
+	EstimatedSize  int64                  `protobuf:"varint,9,opt,name=estimated_size,json=estimatedSize,proto3" json:"estimated_size,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Plan) Reset() {
+	*x = Plan{}
+	mi := &file_manip_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Plan) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Plan) ProtoMessage() {}
+
+func (x *Plan) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Plan.ProtoReflect.Descriptor instead.
+func (*Plan) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *Plan) GetImageRef() string {
+	if x != nil {
+		return x.ImageRef
+	}
+	return ""
+}
+
+func (x *Plan) GetNewImageName() string {
+	if x != nil {
+		return x.NewImageName
+	}
+	return ""
+}
+
+func (x *Plan) GetSplitIndex() int32 {
+	if x != nil {
+		return x.SplitIndex
+	}
+	return 0
+}
+
+func (x *Plan) GetBaseLayerCount() int32 {
+	if x != nil {
+		return x.BaseLayerCount
+	}
+	return 0
+}
+
+func (x *Plan) GetTodoList() string {
+	if x != nil {
+		return x.TodoList
+	}
+	return ""
+}
+
+func (x *Plan) GetLayers() []*PlannedLayer {
+	if x != nil {
+		return x.Layers
+	}
+	return nil
+}
+
+func (x *Plan) GetConfigChanges() []*ConfigChange {
+	if x != nil {
+		return x.ConfigChanges
+	}
+	return nil
+}
+
+func (x *Plan) GetHistory() []*History {
+	if x != nil {
+		return x.History
+	}
+	return nil
+}
+
+func (x *Plan) GetEstimatedSize() int64 {
+	if x != nil {
+		return x.EstimatedSize
+	}
+	return 0
+}
+
+// PathMatch is the paths of an image a pattern of a removal matched.
+type PathMatch struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Pattern       string                 `protobuf:"bytes,1,opt,name=pattern,proto3" json:"pattern,omitempty"`
+	Paths         []string               `protobuf:"bytes,2,rep,name=paths,proto3" json:"paths,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PathMatch) Reset() {
+	*x = PathMatch{}
+	mi := &file_manip_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PathMatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PathMatch) ProtoMessage() {}
+
+func (x *PathMatch) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PathMatch.ProtoReflect.Descriptor instead.
+func (*PathMatch) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *PathMatch) GetPattern() string {
+	if x != nil {
+		return x.Pattern
+	}
+	return ""
+}
+
+func (x *PathMatch) GetPaths() []string {
+	if x != nil {
+		return x.Paths
+	}
+	return nil
+}
+
+// PurgedLayer is a layer rewritten by a purge, new_digest and new_diff_id are empty in dry-run mode.
+type PurgedLayer struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Index         int32                  `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	Digest        string                 `protobuf:"bytes,2,opt,name=digest,proto3" json:"digest,omitempty"`
+	NewDigest     string                 `protobuf:"bytes,3,opt,name=new_digest,json=newDigest,proto3" json:"new_digest,omitempty"`
+	NewDiffId     string                 `protobuf:"bytes,4,opt,name=new_diff_id,json=newDiffId,proto3" json:"new_diff_id,omitempty"`
+	Paths         []string               `protobuf:"bytes,5,rep,name=paths,proto3" json:"paths,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PurgedLayer) Reset() {
+	*x = PurgedLayer{}
+	mi := &file_manip_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PurgedLayer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PurgedLayer) ProtoMessage() {}
+
+func (x *PurgedLayer) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PurgedLayer.ProtoReflect.Descriptor instead.
+func (*PurgedLayer) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *PurgedLayer) GetIndex() int32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *PurgedLayer) GetDigest() string {
+	if x != nil {
+		return x.Digest
+	}
+	return ""
+}
+
+func (x *PurgedLayer) GetNewDigest() string {
+	if x != nil {
+		return x.NewDigest
+	}
+	return ""
+}
+
+func (x *PurgedLayer) GetNewDiffId() string {
+	if x != nil {
+		return x.NewDiffId
+	}
+	return ""
+}
+
+func (x *PurgedLayer) GetPaths() []string {
+	if x != nil {
+		return x.Paths
+	}
+	return nil
+}
+
+// PlatformResult is the result of an operation on one platform of a multi-platform image.
+type PlatformResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Platform      string                 `protobuf:"bytes,1,opt,name=platform,proto3" json:"platform,omitempty"`
+	Image         *ImageResult           `protobuf:"bytes,2,opt,name=image,proto3" json:"image,omitempty"`
+	ConfigChanges []*ConfigChange        `protobuf:"bytes,3,rep,name=config_changes,json=configChanges,proto3" json:"config_changes,omitempty"`
+	Plan          *Plan                  `protobuf:"bytes,4,opt,name=plan,proto3" json:"plan,omitempty"`
+	Matches       []*PathMatch           `protobuf:"bytes,5,rep,name=matches,proto3" json:"matches,omitempty"`
+	PurgedLayers  []*PurgedLayer         `protobuf:"bytes,6,rep,name=purged_layers,json=purgedLayers,proto3" json:"purged_layers,omitempty"`
+	BaseDetection *BaseDetection         `protobuf:"bytes,7,opt,name=base_detection,json=baseDetection,proto3" json:"base_detection,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PlatformResult) Reset() {
+	*x = PlatformResult{}
+	mi := &file_manip_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PlatformResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PlatformResult) ProtoMessage() {}
+
+func (x *PlatformResult) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PlatformResult.ProtoReflect.Descriptor instead.
+func (*PlatformResult) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *PlatformResult) GetPlatform() string {
+	if x != nil {
+		return x.Platform
+	}
+	return ""
+}
+
+func (x *PlatformResult) GetImage() *ImageResult {
+	if x != nil {
+		return x.Image
+	}
+	return nil
+}
+
+func (x *PlatformResult) GetConfigChanges() []*ConfigChange {
+	if x != nil {
+		return x.ConfigChanges
+	}
+	return nil
+}
+
+func (x *PlatformResult) GetPlan() *Plan {
+	if x != nil {
+		return x.Plan
+	}
+	return nil
+}
+
+func (x *PlatformResult) GetMatches() []*PathMatch {
+	if x != nil {
+		return x.Matches
+	}
+	return nil
+}
+
+func (x *PlatformResult) GetPurgedLayers() []*PurgedLayer {
+	if x != nil {
+		return x.PurgedLayers
+	}
+	return nil
+}
+
+func (x *PlatformResult) GetBaseDetection() *BaseDetection {
+	if x != nil {
+		return x.BaseDetection
+	}
+	return nil
+}
+
+// BaseDetection is the base layer of an image found by a base detection strategy.
+type BaseDetection struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Strategy string                 `protobuf:"bytes,1,opt,name=strategy,proto3" json:"strategy,omitempty"`
+	// confidence is "high", "medium" or "low"
+	Confidence      string `protobuf:"bytes,2,opt,name=confidence,proto3" json:"confidence,omitempty"`
+	BaseLayerIndex  int32  `protobuf:"varint,3,opt,name=base_layer_index,json=baseLayerIndex,proto3" json:"base_layer_index,omitempty"`
+	BaseLayerDigest string `protobuf:"bytes,4,opt,name=base_layer_digest,json=baseLayerDigest,proto3" json:"base_layer_digest,omitempty"`
+	BaseImage       string `protobuf:"bytes,5,opt,name=base_image,json=baseImage,proto3" json:"base_image,omitempty"`
+	Reason          string `protobuf:"bytes,6,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *BaseDetection) Reset() {
+	*x = BaseDetection{}
+	mi := &file_manip_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BaseDetection) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BaseDetection) ProtoMessage() {}
+
+func (x *BaseDetection) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BaseDetection.ProtoReflect.Descriptor instead.
+func (*BaseDetection) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *BaseDetection) GetStrategy() string {
+	if x != nil {
+		return x.Strategy
+	}
+	return ""
+}
+
+func (x *BaseDetection) GetConfidence() string {
+	if x != nil {
+		return x.Confidence
+	}
+	return ""
+}
+
+func (x *BaseDetection) GetBaseLayerIndex() int32 {
+	if x != nil {
+		return x.BaseLayerIndex
+	}
+	return 0
+}
+
+func (x *BaseDetection) GetBaseLayerDigest() string {
+	if x != nil {
+		return x.BaseLayerDigest
+	}
+	return ""
+}
+
+func (x *BaseDetection) GetBaseImage() string {
+	if x != nil {
+		return x.BaseImage
+	}
+	return ""
+}
+
+func (x *BaseDetection) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type RebaseResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ImageRef      string                 `protobuf:"bytes,1,opt,name=image_ref,json=imageRef,proto3" json:"image_ref,omitempty"`
+	Image         *ImageResult           `protobuf:"bytes,2,opt,name=image,proto3" json:"image,omitempty"`
+	ConfigChanges []*ConfigChange        `protobuf:"bytes,3,rep,name=config_changes,json=configChanges,proto3" json:"config_changes,omitempty"`
+	Plan          *Plan                  `protobuf:"bytes,4,opt,name=plan,proto3" json:"plan,omitempty"`
+	Timings       []*Timing              `protobuf:"bytes,5,rep,name=timings,proto3" json:"timings,omitempty"`
+	// platforms holds the result of each platform of a multi-platform image, image then refers to the new index
+	Platforms []*PlatformResult `protobuf:"bytes,6,rep,name=platforms,proto3" json:"platforms,omitempty"`
+	// base_detection is the detected base layer of a squash, if the base was not given
+	BaseDetection *BaseDetection `protobuf:"bytes,7,opt,name=base_detection,json=baseDetection,proto3" json:"base_detection,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RebaseResult) Reset() {
+	*x = RebaseResult{}
+	mi := &file_manip_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RebaseResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RebaseResult) ProtoMessage() {}
+
+func (x *RebaseResult) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RebaseResult.ProtoReflect.Descriptor instead.
+func (*RebaseResult) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *RebaseResult) GetImageRef() string {
+	if x != nil {
+		return x.ImageRef
+	}
+	return ""
+}
+
+func (x *RebaseResult) GetImage() *ImageResult {
+	if x != nil {
+		return x.Image
+	}
+	return nil
+}
+
+func (x *RebaseResult) GetConfigChanges() []*ConfigChange {
+	if x != nil {
+		return x.ConfigChanges
+	}
+	return nil
+}
+
+func (x *RebaseResult) GetPlan() *Plan {
+	if x != nil {
+		return x.Plan
+	}
+	return nil
+}
+
+func (x *RebaseResult) GetTimings() []*Timing {
+	if x != nil {
+		return x.Timings
+	}
+	return nil
+}
+
+func (x *RebaseResult) GetPlatforms() []*PlatformResult {
+	if x != nil {
+		return x.Platforms
+	}
+	return nil
+}
+
+func (x *RebaseResult) GetBaseDetection() *BaseDetection {
+	if x != nil {
+		return x.BaseDetection
+	}
+	return nil
+}
+
+type RemoveResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ImageRef      string                 `protobuf:"bytes,1,opt,name=image_ref,json=imageRef,proto3" json:"image_ref,omitempty"`
+	File          string                 `protobuf:"bytes,2,opt,name=file,proto3" json:"file,omitempty"`
+	Image         *ImageResult           `protobuf:"bytes,3,opt,name=image,proto3" json:"image,omitempty"`
+	Plan          *Plan                  `protobuf:"bytes,4,opt,name=plan,proto3" json:"plan,omitempty"`
+	Timings       []*Timing              `protobuf:"bytes,5,rep,name=timings,proto3" json:"timings,omitempty"`
+	Platforms     []*PlatformResult      `protobuf:"bytes,6,rep,name=platforms,proto3" json:"platforms,omitempty"`
+	Paths         []string               `protobuf:"bytes,7,rep,name=paths,proto3" json:"paths,omitempty"`
+	Matches       []*PathMatch           `protobuf:"bytes,8,rep,name=matches,proto3" json:"matches,omitempty"`
+	PurgedLayers  []*PurgedLayer         `protobuf:"bytes,9,rep,name=purged_layers,json=purgedLayers,proto3" json:"purged_layers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RemoveResult) Reset() {
+	*x = RemoveResult{}
+	mi := &file_manip_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemoveResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveResult) ProtoMessage() {}
+
+func (x *RemoveResult) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveResult.ProtoReflect.Descriptor instead.
+func (*RemoveResult) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *RemoveResult) GetImageRef() string {
+	if x != nil {
+		return x.ImageRef
+	}
+	return ""
+}
+
+func (x *RemoveResult) GetFile() string {
+	if x != nil {
+		return x.File
+	}
+	return ""
+}
+
+func (x *RemoveResult) GetImage() *ImageResult {
+	if x != nil {
+		return x.Image
+	}
+	return nil
+}
+
+func (x *RemoveResult) GetPlan() *Plan {
+	if x != nil {
+		return x.Plan
+	}
+	return nil
+}
+
+func (x *RemoveResult) GetTimings() []*Timing {
+	if x != nil {
+		return x.Timings
+	}
+	return nil
+}
+
+func (x *RemoveResult) GetPlatforms() []*PlatformResult {
+	if x != nil {
+		return x.Platforms
+	}
+	return nil
+}
+
+func (x *RemoveResult) GetPaths() []string {
+	if x != nil {
+		return x.Paths
+	}
+	return nil
+}
+
+func (x *RemoveResult) GetMatches() []*PathMatch {
+	if x != nil {
+		return x.Matches
+	}
+	return nil
+}
+
+func (x *RemoveResult) GetPurgedLayers() []*PurgedLayer {
+	if x != nil {
+		return x.PurgedLayers
+	}
+	return nil
+}
+
+// RebaseResponse is a progress event of a rebase or a squash, the last one holds the result.
+type RebaseResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Event:
+	//
+	//	*RebaseResponse_Progress
+	//	*RebaseResponse_Result
+	Event         isRebaseResponse_Event `protobuf_oneof:"event"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RebaseResponse) Reset() {
+	*x = RebaseResponse{}
+	mi := &file_manip_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RebaseResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RebaseResponse) ProtoMessage() {}
+
+func (x *RebaseResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RebaseResponse.ProtoReflect.Descriptor instead.
+func (*RebaseResponse) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *RebaseResponse) GetEvent() isRebaseResponse_Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *RebaseResponse) GetProgress() *Progress {
+	if x != nil {
+		if x, ok := x.Event.(*RebaseResponse_Progress); ok {
+			return x.Progress
+		}
+	}
+	return nil
+}
+
+func (x *RebaseResponse) GetResult() *RebaseResult {
+	if x != nil {
+		if x, ok := x.Event.(*RebaseResponse_Result); ok {
+			return x.Result
+		}
+	}
+	return nil
+}
+
+type isRebaseResponse_Event interface {
+	isRebaseResponse_Event()
+}
+
+type RebaseResponse_Progress struct {
+	Progress *Progress `protobuf:"bytes,1,opt,name=progress,proto3,oneof"`
+}
+
+type RebaseResponse_Result struct {
+	Result *RebaseResult `protobuf:"bytes,2,opt,name=result,proto3,oneof"`
+}
+
+func (*RebaseResponse_Progress) isRebaseResponse_Event() {}
+
+func (*RebaseResponse_Result) isRebaseResponse_Event() {}
+
+// RemoveResponse is a progress event of a removal, the last one holds the result.
+type RemoveResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Event:
+	//
+	//	*RemoveResponse_Progress
+	//	*RemoveResponse_Result
+	Event         isRemoveResponse_Event `protobuf_oneof:"event"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RemoveResponse) Reset() {
+	*x = RemoveResponse{}
+	mi := &file_manip_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemoveResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveResponse) ProtoMessage() {}
+
+func (x *RemoveResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveResponse.ProtoReflect.Descriptor instead.
+func (*RemoveResponse) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *RemoveResponse) GetEvent() isRemoveResponse_Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *RemoveResponse) GetProgress() *Progress {
+	if x != nil {
+		if x, ok := x.Event.(*RemoveResponse_Progress); ok {
+			return x.Progress
+		}
+	}
+	return nil
+}
+
+func (x *RemoveResponse) GetResult() *RemoveResult {
+	if x != nil {
+		if x, ok := x.Event.(*RemoveResponse_Result); ok {
+			return x.Result
+		}
+	}
+	return nil
+}
+
+type isRemoveResponse_Event interface {
+	isRemoveResponse_Event()
+}
+
+type RemoveResponse_Progress struct {
+	Progress *Progress `protobuf:"bytes,1,opt,name=progress,proto3,oneof"`
+}
+
+type RemoveResponse_Result struct {
+	Result *RemoveResult `protobuf:"bytes,2,opt,name=result,proto3,oneof"`
+}
+
+func (*RemoveResponse_Progress) isRemoveResponse_Event() {}
+
+func (*RemoveResponse_Result) isRemoveResponse_Event() {}
+
+type TagResult struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	SourceImage    string                 `protobuf:"bytes,1,opt,name=source_image,json=sourceImage,proto3" json:"source_image,omitempty"`
+	TargetImage    string                 `protobuf:"bytes,2,opt,name=target_image,json=targetImage,proto3" json:"target_image,omitempty"`
+	ManifestDigest string                 `protobuf:"bytes,3,opt,name=manifest_digest,json=manifestDigest,proto3" json:"manifest_digest,omitempty"`
+	Timings        []*Timing              `protobuf:"bytes,4,rep,name=timings,proto3" json:"timings,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *TagResult) Reset() {
+	*x = TagResult{}
+	mi := &file_manip_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TagResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TagResult) ProtoMessage() {}
+
+func (x *TagResult) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TagResult.ProtoReflect.Descriptor instead.
+func (*TagResult) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *TagResult) GetSourceImage() string {
+	if x != nil {
+		return x.SourceImage
+	}
+	return ""
+}
+
+func (x *TagResult) GetTargetImage() string {
+	if x != nil {
+		return x.TargetImage
+	}
+	return ""
+}
+
+func (x *TagResult) GetManifestDigest() string {
+	if x != nil {
+		return x.ManifestDigest
+	}
+	return ""
+}
+
+func (x *TagResult) GetTimings() []*Timing {
+	if x != nil {
+		return x.Timings
+	}
+	return nil
+}
+
+type VerifyBaseResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	OriginalImage string                 `protobuf:"bytes,1,opt,name=original_image,json=originalImage,proto3" json:"original_image,omitempty"`
+	BaseImage     string                 `protobuf:"bytes,2,opt,name=base_image,json=baseImage,proto3" json:"base_image,omitempty"`
+	Based         bool                   `protobuf:"varint,3,opt,name=based,proto3" json:"based,omitempty"`
+	// reason explains why the original image is not based on the base image
+	Reason         string    `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	BaseLayerCount int32     `protobuf:"varint,5,opt,name=base_layer_count,json=baseLayerCount,proto3" json:"base_layer_count,omitempty"`
+	Timings        []*Timing `protobuf:"bytes,6,rep,name=timings,proto3" json:"timings,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *VerifyBaseResult) Reset() {
+	*x = VerifyBaseResult{}
+	mi := &file_manip_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VerifyBaseResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VerifyBaseResult) ProtoMessage() {}
+
+func (x *VerifyBaseResult) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VerifyBaseResult.ProtoReflect.Descriptor instead.
+func (*VerifyBaseResult) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *VerifyBaseResult) GetOriginalImage() string {
+	if x != nil {
+		return x.OriginalImage
+	}
+	return ""
+}
+
+func (x *VerifyBaseResult) GetBaseImage() string {
+	if x != nil {
+		return x.BaseImage
+	}
+	return ""
+}
+
+func (x *VerifyBaseResult) GetBased() bool {
+	if x != nil {
+		return x.Based
+	}
+	return false
+}
+
+func (x *VerifyBaseResult) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *VerifyBaseResult) GetBaseLayerCount() int32 {
+	if x != nil {
+		return x.BaseLayerCount
+	}
+	return 0
+}
+
+func (x *VerifyBaseResult) GetTimings() []*Timing {
+	if x != nil {
+		return x.Timings
+	}
+	return nil
+}
+
+type ImageSummary struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Repository    string                 `protobuf:"bytes,2,opt,name=repository,proto3" json:"repository,omitempty"`
+	Tag           string                 `protobuf:"bytes,3,opt,name=tag,proto3" json:"tag,omitempty"`
+	Digest        string                 `protobuf:"bytes,4,opt,name=digest,proto3" json:"digest,omitempty"`
+	ConfigDigest  string                 `protobuf:"bytes,5,opt,name=config_digest,json=configDigest,proto3" json:"config_digest,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	Platform      string                 `protobuf:"bytes,7,opt,name=platform,proto3" json:"platform,omitempty"`
+	Size          int64                  `protobuf:"varint,8,opt,name=size,proto3" json:"size,omitempty"`
+	BlobSize      int64                  `protobuf:"varint,9,opt,name=blob_size,json=blobSize,proto3" json:"blob_size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImageSummary) Reset() {
+	*x = ImageSummary{}
+	mi := &file_manip_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImageSummary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImageSummary) ProtoMessage() {}
+
+func (x *ImageSummary) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImageSummary.ProtoReflect.Descriptor instead.
+func (*ImageSummary) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *ImageSummary) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ImageSummary) GetRepository() string {
+	if x != nil {
+		return x.Repository
+	}
+	return ""
+}
+
+func (x *ImageSummary) GetTag() string {
+	if x != nil {
+		return x.Tag
+	}
+	return ""
+}
+
+func (x *ImageSummary) GetDigest() string {
+	if x != nil {
+		return x.Digest
+	}
+	return ""
+}
+
+func (x *ImageSummary) GetConfigDigest() string {
+	if x != nil {
+		return x.ConfigDigest
+	}
+	return ""
+}
+
+func (x *ImageSummary) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *ImageSummary) GetPlatform() string {
+	if x != nil {
+		return x.Platform
+	}
+	return ""
+}
+
+func (x *ImageSummary) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *ImageSummary) GetBlobSize() int64 {
+	if x != nil {
+		return x.BlobSize
+	}
+	return 0
+}
+
+type ListImagesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Images        []*ImageSummary        `protobuf:"bytes,1,rep,name=images,proto3" json:"images,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListImagesResponse) Reset() {
+	*x = ListImagesResponse{}
+	mi := &file_manip_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListImagesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListImagesResponse) ProtoMessage() {}
+
+func (x *ListImagesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListImagesResponse.ProtoReflect.Descriptor instead.
+func (*ListImagesResponse) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *ListImagesResponse) GetImages() []*ImageSummary {
+	if x != nil {
+		return x.Images
+	}
+	return nil
+}
+
+type HistoryEntry struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	LastSnapshot string                 `protobuf:"bytes,1,opt,name=last_snapshot,json=lastSnapshot,proto3" json:"last_snapshot,omitempty"`
+	LastLayer    string                 `protobuf:"bytes,2,opt,name=last_layer,json=lastLayer,proto3" json:"last_layer,omitempty"`
+	// created_since is created in a human readable form, e.g. "2 days ago"
+	CreatedSince string `protobuf:"bytes,3,opt,name=created_since,json=createdSince,proto3" json:"created_since,omitempty"`
+	CreatedBy    string `protobuf:"bytes,4,opt,name=created_by,json=createdBy,proto3" json:"created_by,omitempty"`
+	// size is size_bytes in a human readable form, e.g. "1.2 MiB"
+	Size    string `protobuf:"bytes,5,opt,name=size,proto3" json:"size,omitempty"`
+	Comment string `protobuf:"bytes,6,opt,name=comment,proto3" json:"comment,omitempty"`
+	Empty   bool   `protobuf:"varint,7,opt,name=empty,proto3" json:"empty,omitempty"`
+	// created is the creation time of the entry, if recorded
+	Created *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=created,proto3" json:"created,omitempty"`
+	// size_bytes is the size of the snapshot of the layer, 0 for an empty layer
+	SizeBytes     int64 `protobuf:"varint,9,opt,name=size_bytes,json=sizeBytes,proto3" json:"size_bytes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HistoryEntry) Reset() {
+	*x = HistoryEntry{}
+	mi := &file_manip_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HistoryEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HistoryEntry) ProtoMessage() {}
+
+func (x *HistoryEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HistoryEntry.ProtoReflect.Descriptor instead.
+func (*HistoryEntry) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *HistoryEntry) GetLastSnapshot() string {
+	if x != nil {
+		return x.LastSnapshot
+	}
+	return ""
+}
+
+func (x *HistoryEntry) GetLastLayer() string {
+	if x != nil {
+		return x.LastLayer
+	}
+	return ""
+}
+
+func (x *HistoryEntry) GetCreatedSince() string {
+	if x != nil {
+		return x.CreatedSince
+	}
+	return ""
+}
+
+func (x *HistoryEntry) GetCreatedBy() string {
+	if x != nil {
+		return x.CreatedBy
+	}
+	return ""
+}
+
+func (x *HistoryEntry) GetSize() string {
+	if x != nil {
+		return x.Size
+	}
+	return ""
+}
+
+func (x *HistoryEntry) GetComment() string {
+	if x != nil {
+		return x.Comment
+	}
+	return ""
+}
+
+func (x *HistoryEntry) GetEmpty() bool {
+	if x != nil {
+		return x.Empty
+	}
+	return false
+}
+
+func (x *HistoryEntry) GetCreated() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Created
+	}
+	return nil
+}
+
+func (x *HistoryEntry) GetSizeBytes() int64 {
+	if x != nil {
+		return x.SizeBytes
+	}
+	return 0
+}
+
+type ImageHistoryResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Entries       []*HistoryEntry        `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImageHistoryResponse) Reset() {
+	*x = ImageHistoryResponse{}
+	mi := &file_manip_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImageHistoryResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImageHistoryResponse) ProtoMessage() {}
+
+func (x *ImageHistoryResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_manip_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImageHistoryResponse.ProtoReflect.Descriptor instead.
+func (*ImageHistoryResponse) Descriptor() ([]byte, []int) {
+	return file_manip_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *ImageHistoryResponse) GetEntries() []*HistoryEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+var File_manip_proto protoreflect.FileDescriptor
+
+const file_manip_proto_rawDesc = "" +
+	"\n" +
+	"\vmanip.proto\x12\rimagemanip.v1\x1a\x1egoogle/protobuf/duration.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xca\x01\n" +
+	"\rCommitOptions\x12\x16\n" +
+	"\x06author\x18\x01 \x01(\tR\x06author\x12\x18\n" +
+	"\acomment\x18\x02 \x01(\tR\acomment\x12\x18\n" +
+	"\acreated\x18\x03 \x01(\tR\acreated\x12\"\n" +
+	"\freproducible\x18\x04 \x01(\bR\freproducible\x12'\n" +
+	"\x0fmanifest_format\x18\x05 \x01(\tR\x0emanifestFormat\x12 \n" +
+	"\vcompression\x18\x06 \x01(\tR\vcompression\"\xa5\x06\n" +
+	"\rRebaseRequest\x12\x1b\n" +
+	"\timage_ref\x18\x01 \x01(\tR\bimageRef\x12$\n" +
+	"\x0enew_image_name\x18\x02 \x01(\tR\fnewImageName\x12*\n" +
+	"\x11base_layer_digest\x18\x03 \x01(\tR\x0fbaseLayerDigest\x12$\n" +
+	"\x0ebase_image_ref\x18\x04 \x01(\tR\fbaseImageRef\x12+\n" +
+	"\x12new_base_image_ref\x18\x05 \x01(\tR\x0fnewBaseImageRef\x12\x1f\n" +
+	"\vauto_squash\x18\x06 \x01(\bR\n" +
+	"autoSquash\x12\x1b\n" +
+	"\ttodo_list\x18\a \x01(\tR\btodoList\x12.\n" +
+	"\x13config_merge_policy\x18\b \x01(\tR\x11configMergePolicy\x12i\n" +
+	"\x15config_field_policies\x18\t \x03(\v25.imagemanip.v1.RebaseRequest.ConfigFieldPoliciesEntryR\x13configFieldPolicies\x12\x17\n" +
+	"\adry_run\x18\n" +
+	" \x01(\bR\x06dryRun\x124\n" +
+	"\x06commit\x18\v \x01(\v2\x1c.imagemanip.v1.CommitOptionsR\x06commit\x12\x1c\n" +
+	"\tplatforms\x18\f \x03(\tR\tplatforms\x12#\n" +
+	"\rall_platforms\x18\r \x01(\bR\fallPlatforms\x12\x1f\n" +
+	"\vsquash_from\x18\x0e \x01(\tR\n" +
+	"squashFrom\x12\x1b\n" +
+	"\tsquash_to\x18\x0f \x01(\tR\bsquashTo\x12:\n" +
+	"\vsquash_plan\x18\x10 \x01(\v2\x19.imagemanip.v1.SquashPlanR\n" +
+	"squashPlan\x12%\n" +
+	"\x0ebase_detection\x18\x11 \x03(\tR\rbaseDetection\x1aF\n" +
+	"\x18ConfigFieldPoliciesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x9e\x01\n" +
+	"\n" +
+	"SquashPlan\x12\x1d\n" +
+	"\n" +
+	"max_layers\x18\x01 \x01(\x05R\tmaxLayers\x12$\n" +
+	"\x0emin_layer_size\x18\x02 \x01(\x03R\fminLayerSize\x12&\n" +
+	"\x0fkeep_layer_size\x18\x03 \x01(\x03R\rkeepLayerSize\x12#\n" +
+	"\rstable_layers\x18\x04 \x03(\tR\fstableLayers\"\xca\x02\n" +
+	"\rRemoveRequest\x12\x1b\n" +
+	"\timage_ref\x18\x01 \x01(\tR\bimageRef\x12\x12\n" +
+	"\x04file\x18\x02 \x01(\tR\x04file\x12$\n" +
+	"\x0enew_image_name\x18\x03 \x01(\tR\fnewImageName\x12\x17\n" +
+	"\adry_run\x18\x04 \x01(\bR\x06dryRun\x124\n" +
+	"\x06commit\x18\x05 \x01(\v2\x1c.imagemanip.v1.CommitOptionsR\x06commit\x12\x1c\n" +
+	"\tplatforms\x18\x06 \x03(\tR\tplatforms\x12#\n" +
+	"\rall_platforms\x18\a \x01(\bR\fallPlatforms\x12\x14\n" +
+	"\x05paths\x18\b \x03(\tR\x05paths\x12$\n" +
+	"\x0eallow_no_match\x18\t \x01(\bR\fallowNoMatch\x12\x14\n" +
+	"\x05purge\x18\n" +
+	" \x01(\bR\x05purge\"Y\n" +
+	"\n" +
+	"TagRequest\x12(\n" +
+	"\x10source_image_ref\x18\x01 \x01(\tR\x0esourceImageRef\x12!\n" +
+	"\ftarget_image\x18\x02 \x01(\tR\vtargetImage\"Y\n" +
+	"\x11VerifyBaseRequest\x12%\n" +
+	"\x0eoriginal_image\x18\x01 \x01(\tR\roriginalImage\x12\x1d\n" +
+	"\n" +
+	"base_image\x18\x02 \x01(\tR\tbaseImage\"C\n" +
+	"\x11ListImagesRequest\x12\x18\n" +
+	"\afilters\x18\x01 \x03(\tR\afilters\x12\x14\n" +
+	"\x05names\x18\x02 \x03(\tR\x05names\"L\n" +
+	"\x13ImageHistoryRequest\x12\x1b\n" +
+	"\timage_ref\x18\x01 \x01(\tR\bimageRef\x12\x18\n" +
+	"\akeyword\x18\x02 \x01(\tR\akeyword\"\xcf\x01\n" +
+	"\bProgress\x12.\n" +
+	"\x04time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x12\n" +
+	"\x04step\x18\x02 \x01(\tR\x04step\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x12\x18\n" +
+	"\acurrent\x18\x04 \x01(\x05R\acurrent\x12\x14\n" +
+	"\x05total\x18\x05 \x01(\x05R\x05total\x125\n" +
+	"\bduration\x18\x06 \x01(\v2\x19.google.protobuf.DurationR\bduration\"S\n" +
+	"\x06Timing\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x125\n" +
+	"\bduration\x18\x02 \x01(\v2\x19.google.protobuf.DurationR\bduration\"\x8b\x01\n" +
+	"\vResultLayer\x12\x16\n" +
+	"\x06digest\x18\x01 \x01(\tR\x06digest\x12\x17\n" +
+	"\adiff_id\x18\x02 \x01(\tR\x06diffId\x12\x1d\n" +
+	"\n" +
+	"media_type\x18\x03 \x01(\tR\tmediaType\x12\x12\n" +
+	"\x04size\x18\x04 \x01(\x03R\x04size\x12\x18\n" +
+	"\acreated\x18\x05 \x01(\bR\acreated\"\xb5\x01\n" +
+	"\vImageResult\x12$\n" +
+	"\x0enew_image_name\x18\x01 \x01(\tR\fnewImageName\x12'\n" +
+	"\x0fmanifest_digest\x18\x02 \x01(\tR\x0emanifestDigest\x12#\n" +
+	"\rconfig_digest\x18\x03 \x01(\tR\fconfigDigest\x122\n" +
+	"\x06layers\x18\x04 \x03(\v2\x1a.imagemanip.v1.ResultLayerR\x06layers\"H\n" +
+	"\fConfigChange\x12\x14\n" +
+	"\x05field\x18\x01 \x01(\tR\x05field\x12\x12\n" +
+	"\x04from\x18\x02 \x01(\tR\x04from\x12\x0e\n" +
+	"\x02to\x18\x03 \x01(\tR\x02to\"\xb1\x01\n" +
+	"\aHistory\x124\n" +
+	"\acreated\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\acreated\x12\x1d\n" +
+	"\n" +
+	"created_by\x18\x02 \x01(\tR\tcreatedBy\x12\x16\n" +
+	"\x06author\x18\x03 \x01(\tR\x06author\x12\x18\n" +
+	"\acomment\x18\x04 \x01(\tR\acomment\x12\x1f\n" +
+	"\vempty_layer\x18\x05 \x01(\bR\n" +
+	"emptyLayer\"\x8d\x01\n" +
+	"\fPlannedLayer\x12\x16\n" +
+	"\x06digest\x18\x01 \x01(\tR\x06digest\x12\x18\n" +
+	"\acreated\x18\x02 \x01(\bR\acreated\x12\x18\n" +
+	"\asources\x18\x03 \x03(\tR\asources\x12\x1d\n" +
+	"\n" +
+	"created_by\x18\x04 \x01(\tR\tcreatedBy\x12\x12\n" +
+	"\x04size\x18\x05 \x01(\x03R\x04size\"\x83\x03\n" +
+	"\x04Plan\x12\x1b\n" +
+	"\timage_ref\x18\x01 \x01(\tR\bimageRef\x12$\n" +
+	"\x0enew_image_name\x18\x02 \x01(\tR\fnewImageName\x12\x1f\n" +
+	"\vsplit_index\x18\x03 \x01(\x05R\n" +
+	"splitIndex\x12(\n" +
+	"\x10base_layer_count\x18\x04 \x01(\x05R\x0ebaseLayerCount\x12\x1b\n" +
+	"\ttodo_list\x18\x05 \x01(\tR\btodoList\x123\n" +
+	"\x06layers\x18\x06 \x03(\v2\x1b.imagemanip.v1.PlannedLayerR\x06layers\x12B\n" +
+	"\x0econfig_changes\x18\a \x03(\v2\x1b.imagemanip.v1.ConfigChangeR\rconfigChanges\x120\n" +
+	"\ahistory\x18\b \x03(\v2\x16.imagemanip.v1.HistoryR\ahistory\x12%\n" +
+	"\x0eestimated_size\x18\t \x01(\x03R\restimatedSize\";\n" +
+	"\tPathMatch\x12\x18\n" +
+	"\apattern\x18\x01 \x01(\tR\apattern\x12\x14\n" +
+	"\x05paths\x18\x02 \x03(\tR\x05paths\"\x90\x01\n" +
+	"\vPurgedLayer\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\x05R\x05index\x12\x16\n" +
+	"\x06digest\x18\x02 \x01(\tR\x06digest\x12\x1d\n" +
+	"\n" +
+	"new_digest\x18\x03 \x01(\tR\tnewDigest\x12\x1e\n" +
+	"\vnew_diff_id\x18\x04 \x01(\tR\tnewDiffId\x12\x14\n" +
+	"\x05paths\x18\x05 \x03(\tR\x05paths\"\x85\x03\n" +
+	"\x0ePlatformResult\x12\x1a\n" +
+	"\bplatform\x18\x01 \x01(\tR\bplatform\x120\n" +
+	"\x05image\x18\x02 \x01(\v2\x1a.imagemanip.v1.ImageResultR\x05image\x12B\n" +
+	"\x0econfig_changes\x18\x03 \x03(\v2\x1b.imagemanip.v1.ConfigChangeR\rconfigChanges\x12'\n" +
+	"\x04plan\x18\x04 \x01(\v2\x13.imagemanip.v1.PlanR\x04plan\x122\n" +
+	"\amatches\x18\x05 \x03(\v2\x18.imagemanip.v1.PathMatchR\amatches\x12?\n" +
+	"\rpurged_layers\x18\x06 \x03(\v2\x1a.imagemanip.v1.PurgedLayerR\fpurgedLayers\x12C\n" +
+	"\x0ebase_detection\x18\a \x01(\v2\x1c.imagemanip.v1.BaseDetectionR\rbaseDetection\"\xd8\x01\n" +
+	"\rBaseDetection\x12\x1a\n" +
+	"\bstrategy\x18\x01 \x01(\tR\bstrategy\x12\x1e\n" +
+	"\n" +
+	"confidence\x18\x02 \x01(\tR\n" +
+	"confidence\x12(\n" +
+	"\x10base_layer_index\x18\x03 \x01(\x05R\x0ebaseLayerIndex\x12*\n" +
+	"\x11base_layer_digest\x18\x04 \x01(\tR\x0fbaseLayerDigest\x12\x1d\n" +
+	"\n" +
+	"base_image\x18\x05 \x01(\tR\tbaseImage\x12\x16\n" +
+	"\x06reason\x18\x06 \x01(\tR\x06reason\"\xfd\x02\n" +
+	"\fRebaseResult\x12\x1b\n" +
+	"\timage_ref\x18\x01 \x01(\tR\bimageRef\x120\n" +
+	"\x05image\x18\x02 \x01(\v2\x1a.imagemanip.v1.ImageResultR\x05image\x12B\n" +
+	"\x0econfig_changes\x18\x03 \x03(\v2\x1b.imagemanip.v1.ConfigChangeR\rconfigChanges\x12'\n" +
+	"\x04plan\x18\x04 \x01(\v2\x13.imagemanip.v1.PlanR\x04plan\x12/\n" +
+	"\atimings\x18\x05 \x03(\v2\x15.imagemanip.v1.TimingR\atimings\x12;\n" +
+	"\tplatforms\x18\x06 \x03(\v2\x1d.imagemanip.v1.PlatformResultR\tplatforms\x12C\n" +
+	"\x0ebase_detection\x18\a \x01(\v2\x1c.imagemanip.v1.BaseDetectionR\rbaseDetection\"\x93\x03\n" +
+	"\fRemoveResult\x12\x1b\n" +
+	"\timage_ref\x18\x01 \x01(\tR\bimageRef\x12\x12\n" +
+	"\x04file\x18\x02 \x01(\tR\x04file\x120\n" +
+	"\x05image\x18\x03 \x01(\v2\x1a.imagemanip.v1.ImageResultR\x05image\x12'\n" +
+	"\x04plan\x18\x04 \x01(\v2\x13.imagemanip.v1.PlanR\x04plan\x12/\n" +
+	"\atimings\x18\x05 \x03(\v2\x15.imagemanip.v1.TimingR\atimings\x12;\n" +
+	"\tplatforms\x18\x06 \x03(\v2\x1d.imagemanip.v1.PlatformResultR\tplatforms\x12\x14\n" +
+	"\x05paths\x18\a \x03(\tR\x05paths\x122\n" +
+	"\amatches\x18\b \x03(\v2\x18.imagemanip.v1.PathMatchR\amatches\x12?\n" +
+	"\rpurged_layers\x18\t \x03(\v2\x1a.imagemanip.v1.PurgedLayerR\fpurgedLayers\"\x87\x01\n" +
+	"\x0eRebaseResponse\x125\n" +
+	"\bprogress\x18\x01 \x01(\v2\x17.imagemanip.v1.ProgressH\x00R\bprogress\x125\n" +
+	"\x06result\x18\x02 \x01(\v2\x1b.imagemanip.v1.RebaseResultH\x00R\x06resultB\a\n" +
+	"\x05event\"\x87\x01\n" +
+	"\x0eRemoveResponse\x125\n" +
+	"\bprogress\x18\x01 \x01(\v2\x17.imagemanip.v1.ProgressH\x00R\bprogress\x125\n" +
+	"\x06result\x18\x02 \x01(\v2\x1b.imagemanip.v1.RemoveResultH\x00R\x06resultB\a\n" +
+	"\x05event\"\xab\x01\n" +
+	"\tTagResult\x12!\n" +
+	"\fsource_image\x18\x01 \x01(\tR\vsourceImage\x12!\n" +
+	"\ftarget_image\x18\x02 \x01(\tR\vtargetImage\x12'\n" +
+	"\x0fmanifest_digest\x18\x03 \x01(\tR\x0emanifestDigest\x12/\n" +
+	"\atimings\x18\x04 \x03(\v2\x15.imagemanip.v1.TimingR\atimings\"\xe1\x01\n" +
+	"\x10VerifyBaseResult\x12%\n" +
+	"\x0eoriginal_image\x18\x01 \x01(\tR\roriginalImage\x12\x1d\n" +
+	"\n" +
+	"base_image\x18\x02 \x01(\tR\tbaseImage\x12\x14\n" +
+	"\x05based\x18\x03 \x01(\bR\x05based\x12\x16\n" +
+	"\x06reason\x18\x04 \x01(\tR\x06reason\x12(\n" +
+	"\x10base_layer_count\x18\x05 \x01(\x05R\x0ebaseLayerCount\x12/\n" +
+	"\atimings\x18\x06 \x03(\v2\x15.imagemanip.v1.TimingR\atimings\"\x99\x02\n" +
+	"\fImageSummary\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1e\n" +
+	"\n" +
+	"repository\x18\x02 \x01(\tR\n" +
+	"repository\x12\x10\n" +
+	"\x03tag\x18\x03 \x01(\tR\x03tag\x12\x16\n" +
+	"\x06digest\x18\x04 \x01(\tR\x06digest\x12#\n" +
+	"\rconfig_digest\x18\x05 \x01(\tR\fconfigDigest\x129\n" +
+	"\n" +
+	"created_at\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x12\x1a\n" +
+	"\bplatform\x18\a \x01(\tR\bplatform\x12\x12\n" +
+	"\x04size\x18\b \x01(\x03R\x04size\x12\x1b\n" +
+	"\tblob_size\x18\t \x01(\x03R\bblobSize\"I\n" +
+	"\x12ListImagesResponse\x123\n" +
+	"\x06images\x18\x01 \x03(\v2\x1b.imagemanip.v1.ImageSummaryR\x06images\"\xaf\x02\n" +
+	"\fHistoryEntry\x12#\n" +
+	"\rlast_snapshot\x18\x01 \x01(\tR\flastSnapshot\x12\x1d\n" +
+	"\n" +
+	"last_layer\x18\x02 \x01(\tR\tlastLayer\x12#\n" +
+	"\rcreated_since\x18\x03 \x01(\tR\fcreatedSince\x12\x1d\n" +
+	"\n" +
+	"created_by\x18\x04 \x01(\tR\tcreatedBy\x12\x12\n" +
+	"\x04size\x18\x05 \x01(\tR\x04size\x12\x18\n" +
+	"\acomment\x18\x06 \x01(\tR\acomment\x12\x14\n" +
+	"\x05empty\x18\a \x01(\bR\x05empty\x124\n" +
+	"\acreated\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\acreated\x12\x1d\n" +
+	"\n" +
+	"size_bytes\x18\t \x01(\x03R\tsizeBytes\"M\n" +
+	"\x14ImageHistoryResponse\x125\n" +
+	"\aentries\x18\x01 \x03(\v2\x1b.imagemanip.v1.HistoryEntryR\aentries2\xa0\x04\n" +
+	"\n" +
+	"ImageManip\x12G\n" +
+	"\x06Rebase\x12\x1c.imagemanip.v1.RebaseRequest\x1a\x1d.imagemanip.v1.RebaseResponse0\x01\x12G\n" +
+	"\x06Squash\x12\x1c.imagemanip.v1.RebaseRequest\x1a\x1d.imagemanip.v1.RebaseResponse0\x01\x12G\n" +
+	"\x06Remove\x12\x1c.imagemanip.v1.RemoveRequest\x1a\x1d.imagemanip.v1.RemoveResponse0\x01\x12:\n" +
+	"\x03Tag\x12\x19.imagemanip.v1.TagRequest\x1a\x18.imagemanip.v1.TagResult\x12O\n" +
+	"\n" +
+	"VerifyBase\x12 .imagemanip.v1.VerifyBaseRequest\x1a\x1f.imagemanip.v1.VerifyBaseResult\x12Q\n" +
+	"\n" +
+	"ListImages\x12 .imagemanip.v1.ListImagesRequest\x1a!.imagemanip.v1.ListImagesResponse\x12W\n" +
+	"\fImageHistory\x12\".imagemanip.v1.ImageHistoryRequest\x1a#.imagemanip.v1.ImageHistoryResponseB8Z6github.com/lingdie/image-manip-server/pkg/api/v1;apiv1b\x06proto3"
+
+var (
+	file_manip_proto_rawDescOnce sync.Once
+	file_manip_proto_rawDescData []byte
+)
+
+func file_manip_proto_rawDescGZIP() []byte {
+	file_manip_proto_rawDescOnce.Do(func() {
+		file_manip_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_manip_proto_rawDesc), len(file_manip_proto_rawDesc)))
+	})
+	return file_manip_proto_rawDescData
+}
+
+var file_manip_proto_msgTypes = make([]protoimpl.MessageInfo, 31)
+var file_manip_proto_goTypes = []any{
+	(*CommitOptions)(nil),         // 0: imagemanip.v1.CommitOptions
+	(*RebaseRequest)(nil),         // 1: imagemanip.v1.RebaseRequest
+	(*SquashPlan)(nil),            // 2: imagemanip.v1.SquashPlan
+	(*RemoveRequest)(nil),         // 3: imagemanip.v1.RemoveRequest
+	(*TagRequest)(nil),            // 4: imagemanip.v1.TagRequest
+	(*VerifyBaseRequest)(nil),     // 5: imagemanip.v1.VerifyBaseRequest
+	(*ListImagesRequest)(nil),     // 6: imagemanip.v1.ListImagesRequest
+	(*ImageHistoryRequest)(nil),   // 7: imagemanip.v1.ImageHistoryRequest
+	(*Progress)(nil),              // 8: imagemanip.v1.Progress
+	(*Timing)(nil),                // 9: imagemanip.v1.Timing
+	(*ResultLayer)(nil),           // 10: imagemanip.v1.ResultLayer
+	(*ImageResult)(nil),           // 11: imagemanip.v1.ImageResult
+	(*ConfigChange)(nil),          // 12: imagemanip.v1.ConfigChange
+	(*History)(nil),               // 13: imagemanip.v1.History
+	(*PlannedLayer)(nil),          // 14: imagemanip.v1.PlannedLayer
+	(*Plan)(nil),                  // 15: imagemanip.v1.Plan
+	(*PathMatch)(nil),             // 16: imagemanip.v1.PathMatch
+	(*PurgedLayer)(nil),           // 17: imagemanip.v1.PurgedLayer
+	(*PlatformResult)(nil),        // 18: imagemanip.v1.PlatformResult
+	(*BaseDetection)(nil),         // 19: imagemanip.v1.BaseDetection
+	(*RebaseResult)(nil),          // 20: imagemanip.v1.RebaseResult
+	(*RemoveResult)(nil),          // 21: imagemanip.v1.RemoveResult
+	(*RebaseResponse)(nil),        // 22: imagemanip.v1.RebaseResponse
+	(*RemoveResponse)(nil),        // 23: imagemanip.v1.RemoveResponse
+	(*TagResult)(nil),             // 24: imagemanip.v1.TagResult
+	(*VerifyBaseResult)(nil),      // 25: imagemanip.v1.VerifyBaseResult
+	(*ImageSummary)(nil),          // 26: imagemanip.v1.ImageSummary
+	(*ListImagesResponse)(nil),    // 27: imagemanip.v1.ListImagesResponse
+	(*HistoryEntry)(nil),          // 28: imagemanip.v1.HistoryEntry
+	(*ImageHistoryResponse)(nil),  // 29: imagemanip.v1.ImageHistoryResponse
+	nil,                           // 30: imagemanip.v1.RebaseRequest.ConfigFieldPoliciesEntry
+	(*timestamppb.Timestamp)(nil), // 31: google.protobuf.Timestamp
+	(*durationpb.Duration)(nil),   // 32: google.protobuf.Duration
+}
+var file_manip_proto_depIdxs = []int32{
+	30, // 0: imagemanip.v1.RebaseRequest.config_field_policies:type_name -> imagemanip.v1.RebaseRequest.ConfigFieldPoliciesEntry
+	0,  // 1: imagemanip.v1.RebaseRequest.commit:type_name -> imagemanip.v1.CommitOptions
+	2,  // 2: imagemanip.v1.RebaseRequest.squash_plan:type_name -> imagemanip.v1.SquashPlan
+	0,  // 3: imagemanip.v1.RemoveRequest.commit:type_name -> imagemanip.v1.CommitOptions
+	31, // 4: imagemanip.v1.Progress.time:type_name -> google.protobuf.Timestamp
+	32, // 5: imagemanip.v1.Progress.duration:type_name -> google.protobuf.Duration
+	32, // 6: imagemanip.v1.Timing.duration:type_name -> google.protobuf.Duration
+	10, // 7: imagemanip.v1.ImageResult.layers:type_name -> imagemanip.v1.ResultLayer
+	31, // 8: imagemanip.v1.History.created:type_name -> google.protobuf.Timestamp
+	14, // 9: imagemanip.v1.Plan.layers:type_name -> imagemanip.v1.PlannedLayer
+	12, // 10: imagemanip.v1.Plan.config_changes:type_name -> imagemanip.v1.ConfigChange
+	13, // 11: imagemanip.v1.Plan.history:type_name -> imagemanip.v1.History
+	11, // 12: imagemanip.v1.PlatformResult.image:type_name -> imagemanip.v1.ImageResult
+	12, // 13: imagemanip.v1.PlatformResult.config_changes:type_name -> imagemanip.v1.ConfigChange
+	15, // 14: imagemanip.v1.PlatformResult.plan:type_name -> imagemanip.v1.Plan
+	16, // 15: imagemanip.v1.PlatformResult.matches:type_name -> imagemanip.v1.PathMatch
+	17, // 16: imagemanip.v1.PlatformResult.purged_layers:type_name -> imagemanip.v1.PurgedLayer
+	19, // 17: imagemanip.v1.PlatformResult.base_detection:type_name -> imagemanip.v1.BaseDetection
+	11, // 18: imagemanip.v1.RebaseResult.image:type_name -> imagemanip.v1.ImageResult
+	12, // 19: imagemanip.v1.RebaseResult.config_changes:type_name -> imagemanip.v1.ConfigChange
+	15, // 20: imagemanip.v1.RebaseResult.plan:type_name -> imagemanip.v1.Plan
+	9,  // 21: imagemanip.v1.RebaseResult.timings:type_name -> imagemanip.v1.Timing
+	18, // 22: imagemanip.v1.RebaseResult.platforms:type_name -> imagemanip.v1.PlatformResult
+	19, // 23: imagemanip.v1.RebaseResult.base_detection:type_name -> imagemanip.v1.BaseDetection
+	11, // 24: imagemanip.v1.RemoveResult.image:type_name -> imagemanip.v1.ImageResult
+	15, // 25: imagemanip.v1.RemoveResult.plan:type_name -> imagemanip.v1.Plan
+	9,  // 26: imagemanip.v1.RemoveResult.timings:type_name -> imagemanip.v1.Timing
+	18, // 27: imagemanip.v1.RemoveResult.platforms:type_name -> imagemanip.v1.PlatformResult
+	16, // 28: imagemanip.v1.RemoveResult.matches:type_name -> imagemanip.v1.PathMatch
+	17, // 29: imagemanip.v1.RemoveResult.purged_layers:type_name -> imagemanip.v1.PurgedLayer
+	8,  // 30: imagemanip.v1.RebaseResponse.progress:type_name -> imagemanip.v1.Progress
+	20, // 31: imagemanip.v1.RebaseResponse.result:type_name -> imagemanip.v1.RebaseResult
+	8,  // 32: imagemanip.v1.RemoveResponse.progress:type_name -> imagemanip.v1.Progress
+	21, // 33: imagemanip.v1.RemoveResponse.result:type_name -> imagemanip.v1.RemoveResult
+	9,  // 34: imagemanip.v1.TagResult.timings:type_name -> imagemanip.v1.Timing
+	9,  // 35: imagemanip.v1.VerifyBaseResult.timings:type_name -> imagemanip.v1.Timing
+	31, // 36: imagemanip.v1.ImageSummary.created_at:type_name -> google.protobuf.Timestamp
+	26, // 37: imagemanip.v1.ListImagesResponse.images:type_name -> imagemanip.v1.ImageSummary
+	31, // 38: imagemanip.v1.HistoryEntry.created:type_name -> google.protobuf.Timestamp
+	28, // 39: imagemanip.v1.ImageHistoryResponse.entries:type_name -> imagemanip.v1.HistoryEntry
+	1,  // 40: imagemanip.v1.ImageManip.Rebase:input_type -> imagemanip.v1.RebaseRequest
+	1,  // 41: imagemanip.v1.ImageManip.Squash:input_type -> imagemanip.v1.RebaseRequest
+	3,  // 42: imagemanip.v1.ImageManip.Remove:input_type -> imagemanip.v1.RemoveRequest
+	4,  // 43: imagemanip.v1.ImageManip.Tag:input_type -> imagemanip.v1.TagRequest
+	5,  // 44: imagemanip.v1.ImageManip.VerifyBase:input_type -> imagemanip.v1.VerifyBaseRequest
+	6,  // 45: imagemanip.v1.ImageManip.ListImages:input_type -> imagemanip.v1.ListImagesRequest
+	7,  // 46: imagemanip.v1.ImageManip.ImageHistory:input_type -> imagemanip.v1.ImageHistoryRequest
+	22, // 47: imagemanip.v1.ImageManip.Rebase:output_type -> imagemanip.v1.RebaseResponse
+	22, // 48: imagemanip.v1.ImageManip.Squash:output_type -> imagemanip.v1.RebaseResponse
+	23, // 49: imagemanip.v1.ImageManip.Remove:output_type -> imagemanip.v1.RemoveResponse
+	24, // 50: imagemanip.v1.ImageManip.Tag:output_type -> imagemanip.v1.TagResult
+	25, // 51: imagemanip.v1.ImageManip.VerifyBase:output_type -> imagemanip.v1.VerifyBaseResult
+	27, // 52: imagemanip.v1.ImageManip.ListImages:output_type -> imagemanip.v1.ListImagesResponse
+	29, // 53: imagemanip.v1.ImageManip.ImageHistory:output_type -> imagemanip.v1.ImageHistoryResponse
+	47, // [47:54] is the sub-list for method output_type
+	40, // [40:47] is the sub-list for method input_type
+	40, // [40:40] is the sub-list for extension type_name
+	40, // [40:40] is the sub-list for extension extendee
+	0,  // [0:40] is the sub-list for field type_name
+}
+
+func init() { file_manip_proto_init() }
+func file_manip_proto_init() {
+	if File_manip_proto != nil {
+		return
+	}
+	file_manip_proto_msgTypes[22].OneofWrappers = []any{
+		(*RebaseResponse_Progress)(nil),
+		(*RebaseResponse_Result)(nil),
+	}
+	file_manip_proto_msgTypes[23].OneofWrappers = []any{
+		(*RemoveResponse_Progress)(nil),
+		(*RemoveResponse_Result)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_manip_proto_rawDesc), len(file_manip_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   31,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_manip_proto_goTypes,
+		DependencyIndexes: file_manip_proto_depIdxs,
+		MessageInfos:      file_manip_proto_msgTypes,
+	}.Build()
+	File_manip_proto = out.File
+	file_manip_proto_goTypes = nil
+	file_manip_proto_depIdxs = nil
+}
@@ -0,0 +1,380 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: manip.proto
+
+// The gRPC API of image-manip, mirroring the operations of the runtime and the HTTP API.
+// The Go stubs are generated with `go generate ./pkg/api/v1`.
+
+package apiv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ImageManip_Rebase_FullMethodName       = "/imagemanip.v1.ImageManip/Rebase"
+	ImageManip_Squash_FullMethodName       = "/imagemanip.v1.ImageManip/Squash"
+	ImageManip_Remove_FullMethodName       = "/imagemanip.v1.ImageManip/Remove"
+	ImageManip_Tag_FullMethodName          = "/imagemanip.v1.ImageManip/Tag"
+	ImageManip_VerifyBase_FullMethodName   = "/imagemanip.v1.ImageManip/VerifyBase"
+	ImageManip_ListImages_FullMethodName   = "/imagemanip.v1.ImageManip/ListImages"
+	ImageManip_ImageHistory_FullMethodName = "/imagemanip.v1.ImageManip/ImageHistory"
+)
+
+// ImageManipClient is the client API for ImageManip service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ImageManipClient interface {
+	// Rebase rebases an image on a new base image, streaming its progress and then its result.
+	Rebase(ctx context.Context, in *RebaseRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RebaseResponse], error)
+	// Squash squashes the layers of an image above its base, streaming its progress and then its result.
+	// The base layer is detected if it is not set.
+	Squash(ctx context.Context, in *RebaseRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RebaseResponse], error)
+	// Remove removes a file from an image, streaming its progress and then its result.
+	Remove(ctx context.Context, in *RemoveRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RemoveResponse], error)
+	// Tag creates a new image name pointing to the same target as the source image.
+	Tag(ctx context.Context, in *TagRequest, opts ...grpc.CallOption) (*TagResult, error)
+	// VerifyBase checks that an image is built on a base image. A mismatch is not an error,
+	// it is reported by based and reason.
+	VerifyBase(ctx context.Context, in *VerifyBaseRequest, opts ...grpc.CallOption) (*VerifyBaseResult, error)
+	// ListImages lists the images, one per platform.
+	ListImages(ctx context.Context, in *ListImagesRequest, opts ...grpc.CallOption) (*ListImagesResponse, error)
+	// ImageHistory returns the history entries of an image, optionally filtered by a keyword.
+	ImageHistory(ctx context.Context, in *ImageHistoryRequest, opts ...grpc.CallOption) (*ImageHistoryResponse, error)
+}
+
+type imageManipClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewImageManipClient(cc grpc.ClientConnInterface) ImageManipClient {
+	return &imageManipClient{cc}
+}
+
+func (c *imageManipClient) Rebase(ctx context.Context, in *RebaseRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RebaseResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ImageManip_ServiceDesc.Streams[0], ImageManip_Rebase_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[RebaseRequest, RebaseResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ImageManip_RebaseClient = grpc.ServerStreamingClient[RebaseResponse]
+
+func (c *imageManipClient) Squash(ctx context.Context, in *RebaseRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RebaseResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ImageManip_ServiceDesc.Streams[1], ImageManip_Squash_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[RebaseRequest, RebaseResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ImageManip_SquashClient = grpc.ServerStreamingClient[RebaseResponse]
+
+func (c *imageManipClient) Remove(ctx context.Context, in *RemoveRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RemoveResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ImageManip_ServiceDesc.Streams[2], ImageManip_Remove_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[RemoveRequest, RemoveResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ImageManip_RemoveClient = grpc.ServerStreamingClient[RemoveResponse]
+
+func (c *imageManipClient) Tag(ctx context.Context, in *TagRequest, opts ...grpc.CallOption) (*TagResult, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TagResult)
+	err := c.cc.Invoke(ctx, ImageManip_Tag_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageManipClient) VerifyBase(ctx context.Context, in *VerifyBaseRequest, opts ...grpc.CallOption) (*VerifyBaseResult, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(VerifyBaseResult)
+	err := c.cc.Invoke(ctx, ImageManip_VerifyBase_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageManipClient) ListImages(ctx context.Context, in *ListImagesRequest, opts ...grpc.CallOption) (*ListImagesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListImagesResponse)
+	err := c.cc.Invoke(ctx, ImageManip_ListImages_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *imageManipClient) ImageHistory(ctx context.Context, in *ImageHistoryRequest, opts ...grpc.CallOption) (*ImageHistoryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ImageHistoryResponse)
+	err := c.cc.Invoke(ctx, ImageManip_ImageHistory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ImageManipServer is the server API for ImageManip service.
+// All implementations must embed UnimplementedImageManipServer
+// for forward compatibility.
+type ImageManipServer interface {
+	// Rebase rebases an image on a new base image, streaming its progress and then its result.
+	Rebase(*RebaseRequest, grpc.ServerStreamingServer[RebaseResponse]) error
+	// Squash squashes the layers of an image above its base, streaming its progress and then its result.
+	// The base layer is detected if it is not set.
+	Squash(*RebaseRequest, grpc.ServerStreamingServer[RebaseResponse]) error
+	// Remove removes a file from an image, streaming its progress and then its result.
+	Remove(*RemoveRequest, grpc.ServerStreamingServer[RemoveResponse]) error
+	// Tag creates a new image name pointing to the same target as the source image.
+	Tag(context.Context, *TagRequest) (*TagResult, error)
+	// VerifyBase checks that an image is built on a base image. A mismatch is not an error,
+	// it is reported by based and reason.
+	VerifyBase(context.Context, *VerifyBaseRequest) (*VerifyBaseResult, error)
+	// ListImages lists the images, one per platform.
+	ListImages(context.Context, *ListImagesRequest) (*ListImagesResponse, error)
+	// ImageHistory returns the history entries of an image, optionally filtered by a keyword.
+	ImageHistory(context.Context, *ImageHistoryRequest) (*ImageHistoryResponse, error)
+	mustEmbedUnimplementedImageManipServer()
+}
+
+// UnimplementedImageManipServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedImageManipServer struct{}
+
+func (UnimplementedImageManipServer) Rebase(*RebaseRequest, grpc.ServerStreamingServer[RebaseResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Rebase not implemented")
+}
+func (UnimplementedImageManipServer) Squash(*RebaseRequest, grpc.ServerStreamingServer[RebaseResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Squash not implemented")
+}
+func (UnimplementedImageManipServer) Remove(*RemoveRequest, grpc.ServerStreamingServer[RemoveResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Remove not implemented")
+}
+func (UnimplementedImageManipServer) Tag(context.Context, *TagRequest) (*TagResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Tag not implemented")
+}
+func (UnimplementedImageManipServer) VerifyBase(context.Context, *VerifyBaseRequest) (*VerifyBaseResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method VerifyBase not implemented")
+}
+func (UnimplementedImageManipServer) ListImages(context.Context, *ListImagesRequest) (*ListImagesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListImages not implemented")
+}
+func (UnimplementedImageManipServer) ImageHistory(context.Context, *ImageHistoryRequest) (*ImageHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ImageHistory not implemented")
+}
+func (UnimplementedImageManipServer) mustEmbedUnimplementedImageManipServer() {}
+func (UnimplementedImageManipServer) testEmbeddedByValue()                    {}
+
+// UnsafeImageManipServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ImageManipServer will
+// result in compilation errors.
+type UnsafeImageManipServer interface {
+	mustEmbedUnimplementedImageManipServer()
+}
+
+func RegisterImageManipServer(s grpc.ServiceRegistrar, srv ImageManipServer) {
+	// If the following call pancis, it indicates UnimplementedImageManipServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ImageManip_ServiceDesc, srv)
+}
+
+func _ImageManip_Rebase_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RebaseRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ImageManipServer).Rebase(m, &grpc.GenericServerStream[RebaseRequest, RebaseResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ImageManip_RebaseServer = grpc.ServerStreamingServer[RebaseResponse]
+
+func _ImageManip_Squash_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RebaseRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ImageManipServer).Squash(m, &grpc.GenericServerStream[RebaseRequest, RebaseResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ImageManip_SquashServer = grpc.ServerStreamingServer[RebaseResponse]
+
+func _ImageManip_Remove_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RemoveRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ImageManipServer).Remove(m, &grpc.GenericServerStream[RemoveRequest, RemoveResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ImageManip_RemoveServer = grpc.ServerStreamingServer[RemoveResponse]
+
+func _ImageManip_Tag_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TagRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageManipServer).Tag(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ImageManip_Tag_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageManipServer).Tag(ctx, req.(*TagRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageManip_VerifyBase_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VerifyBaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageManipServer).VerifyBase(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ImageManip_VerifyBase_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageManipServer).VerifyBase(ctx, req.(*VerifyBaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageManip_ListImages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListImagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageManipServer).ListImages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ImageManip_ListImages_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageManipServer).ListImages(ctx, req.(*ListImagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ImageManip_ImageHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ImageHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ImageManipServer).ImageHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ImageManip_ImageHistory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ImageManipServer).ImageHistory(ctx, req.(*ImageHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ImageManip_ServiceDesc is the grpc.ServiceDesc for ImageManip service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ImageManip_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "imagemanip.v1.ImageManip",
+	HandlerType: (*ImageManipServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Tag",
+			Handler:    _ImageManip_Tag_Handler,
+		},
+		{
+			MethodName: "VerifyBase",
+			Handler:    _ImageManip_VerifyBase_Handler,
+		},
+		{
+			MethodName: "ListImages",
+			Handler:    _ImageManip_ListImages_Handler,
+		},
+		{
+			MethodName: "ImageHistory",
+			Handler:    _ImageManip_ImageHistory_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Rebase",
+			Handler:       _ImageManip_Rebase_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Squash",
+			Handler:       _ImageManip_Squash_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Remove",
+			Handler:       _ImageManip_Remove_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "manip.proto",
+}
@@ -11,4 +11,7 @@ type Image struct {
 	Config      ocispec.Image
 	Image       images.Image
 	Manifest    *ocispec.Manifest
+	// ManifestDesc is the descriptor of Manifest. Its Platform is set if Manifest has been
+	// selected from the index Image points to.
+	ManifestDesc ocispec.Descriptor
 }
@@ -2,18 +2,152 @@ package options
 
 type RebaseOptions struct {
 	RootOptions
+	CommitOptions
+	PlatformOptions
 	ImageRef        string `json:"image_ref"`
 	NewImageName    string `json:"new_image_name"`
 	BaseLayerDigest string `json:"base_layer_digest"`
+	// BaseImageRef is the old base image, the layers above it are rebased.
+	// It can not be used together with BaseLayerDigest.
+	BaseImageRef    string `json:"base_image_ref"`
 	NewBaseImageRef string `json:"new_base_image_ref"`
 	AutoSquash      bool   `json:"auto_squash"`
+	// TodoList is a git-style rebase todo list, it takes precedence over AutoSquash
+	TodoList string `json:"todo_list"`
+	// SquashFrom and SquashTo are the bottom and top layers of a range squashed into one layer, each
+	// a layer digest or the index of an entry of the image history. The layers above the range are
+	// kept and applied again on the squashed layer. They replace the base layer and the todo list.
+	SquashFrom string `json:"squash_from"`
+	SquashTo   string `json:"squash_to"`
+	// BaseDetection names the strategies detecting the base layer of a squash, in order, all if empty
+	BaseDetection []string `json:"base_detection"`
+	// SquashPlan chooses the todo list from the sizes of the layers, if set
+	SquashPlan *SquashPlanOptions `json:"squash_plan"`
+	// ConfigMergePolicy decides how the application config is merged into the config of the
+	// new base image: "keep-app", "keep-base" or "merge" (default, the application wins on conflicts)
+	ConfigMergePolicy string `json:"config_merge_policy"`
+	// ConfigFieldPolicies overrides ConfigMergePolicy per field, e.g. {"Labels": "keep-base", "Env.PATH": "merge"}
+	ConfigFieldPolicies map[string]string `json:"config_field_policies"`
+	// DryRun prints the plan of the rebase without writing anything
+	DryRun bool `json:"dry_run"`
+}
+
+// SquashPlanOptions chooses the layers to squash together from their sizes, the sizes of their blobs.
+// Adjacent small layers are merged, smallest first, until no layer is smaller than MinLayerSize and
+// the image has at most MaxLayers layers.
+type SquashPlanOptions struct {
+	// MaxLayers is the number of layers of the new image at most, the base layers included, 0 for no limit
+	MaxLayers int `json:"max_layers"`
+	// MinLayerSize is the size in bytes below which a layer is merged with a neighbour, 0 for no minimum
+	MinLayerSize int64 `json:"min_layer_size"`
+	// KeepLayerSize is the size in bytes from which a layer is kept on its own, 0 for no threshold
+	KeepLayerSize int64 `json:"keep_layer_size"`
+	// StableLayers are the layers no squashed layer spans above, each a layer digest or a history index,
+	// e.g. the top layer of the base image or of a rarely changing dependency section
+	StableLayers []string `json:"stable_layers"`
 }
 
 type RemoveOptions struct {
 	RootOptions
-	File         string `json:"file"`
+	CommitOptions
+	PlatformOptions
+	// File is a path to remove, it is removed along with Paths
+	File string `json:"file"`
+	// Paths are the paths, shell globs ("**" matches any number of directories) and regular
+	// expressions prefixed with "re:" to remove, all in one new layer
+	Paths        []string `json:"paths"`
+	ImageRef     string   `json:"image_ref"`
+	NewImageName string   `json:"new_image_name"`
+	// AllowNoMatch only warns about the patterns matching nothing instead of failing.
+	// A platform in which nothing matches is left unchanged.
+	AllowNoMatch bool `json:"allow_no_match"`
+	// Purge removes the paths from every layer containing them, rewriting the history of the image,
+	// instead of adding a layer of whiteouts on top of it
+	Purge bool `json:"purge"`
+	// DryRun prints the plan of the removal without writing anything
+	DryRun bool `json:"dry_run"`
+}
+
+// AddOptions adds files of the host to an image, in one new layer.
+type AddOptions struct {
+	RootOptions
+	CommitOptions
+	PlatformOptions
+	// Sources are the files and directories of the host to add, the content of a directory is added
+	Sources []string `json:"sources"`
+	// Dest is the path of the image they are added to. It is a directory if it ends with "/"
+	// or if there are several sources, otherwise the name of the single source in the image.
+	Dest         string `json:"dest"`
+	ImageRef     string `json:"image_ref"`
+	NewImageName string `json:"new_image_name"`
+	// Chown is the owner of the added files, "UID[:GID]", root by default
+	Chown string `json:"chown"`
+	// Chmod is the octal permissions of the added files, their own by default
+	Chmod string `json:"chmod"`
+	// NormalizeTimestamps sets the modification time of the added files to the creation time
+	// of the image instead of keeping theirs
+	NormalizeTimestamps bool `json:"normalize_timestamps"`
+}
+
+// ExecOptions runs a command in the root filesystem of an image, and adds its changes as a new layer.
+type ExecOptions struct {
+	RootOptions
+	CommitOptions
+	PlatformOptions
 	ImageRef     string `json:"image_ref"`
 	NewImageName string `json:"new_image_name"`
+	// Command is the command to run, in exec form
+	Command []string `json:"command"`
+	// Env are "NAME=VALUE" variables added to the environment of the image
+	Env []string `json:"env"`
+	// WorkingDir and User override the ones of the image
+	WorkingDir string `json:"working_dir"`
+	User       string `json:"user"`
+}
+
+// ConfigOptions edits the config of an image without touching its layers. Unset is applied before Set.
+type ConfigOptions struct {
+	RootOptions
+	CommitOptions
+	PlatformOptions
+	ImageRef     string    `json:"image_ref"`
+	NewImageName string    `json:"new_image_name"`
+	Set          ConfigSet `json:"set"`
+	// Unset are the fields to clear, e.g. "Cmd", or the entries to remove from a field, e.g. "Env.DEBUG",
+	// "Labels.maintainer", "ExposedPorts.8080/tcp" or "Volumes./data"
+	Unset []string `json:"unset"`
+	// DryRun reports the changes without writing anything
+	DryRun bool `json:"dry_run"`
+}
+
+// ConfigSet are the values to set in the config of an image, the empty ones are left unchanged.
+type ConfigSet struct {
+	// Env are "NAME=VALUE" variables, replacing the variables of the same name
+	Env []string `json:"env"`
+	// Labels are added to the labels, replacing the ones of the same key
+	Labels map[string]string `json:"labels"`
+	// ExposedPorts are "PORT[/PROTOCOL]" ports added to the exposed ports, tcp by default
+	ExposedPorts []string `json:"exposed_ports"`
+	// Volumes are absolute paths added to the volumes
+	Volumes    []string `json:"volumes"`
+	Entrypoint []string `json:"entrypoint"`
+	Cmd        []string `json:"cmd"`
+	WorkingDir string   `json:"working_dir"`
+	User       string   `json:"user"`
+	StopSignal string   `json:"stop_signal"`
+}
+
+// ConvertOptions recompresses the layers of an image.
+type ConvertOptions struct {
+	RootOptions
+	PlatformOptions
+	ImageRef     string `json:"image_ref"`
+	NewImageName string `json:"new_image_name"`
+	// Compression of the layers: "gzip", "zstd", "zstd:chunked" or "estargz"
+	Compression string `json:"compression"`
+	// ManifestFormat is "docker" or "oci", the format of the original image is kept if empty,
+	// unless the layers are zstd ones, which require "oci"
+	ManifestFormat string `json:"manifest_format"`
 }
 
 type VerifyBaseOptions struct {
@@ -22,6 +156,13 @@ type VerifyBaseOptions struct {
 	BaseImage     string `json:"base_image"`
 }
 
+type FindBaseOptions struct {
+	RootOptions
+	ImageRef string `json:"image_ref"`
+	// Platform selects the manifest of a multi-platform image, the default platform if empty
+	Platform string `json:"platform"`
+}
+
 type HistoryOptions struct {
 	RootOptions
 	ImageRef string `json:"image_ref"`
@@ -46,8 +187,50 @@ type TagOptions struct {
 	TargetImage    string `json:"target_image"`
 }
 
+// CommitOptions is the metadata recorded for the layers and the image created by an operation.
+type CommitOptions struct {
+	// Author of the new image and its new history entries, "image-manip" if empty
+	Author string `json:"author"`
+	// Comment of the new history entries
+	Comment string `json:"comment"`
+	// Created is the creation time, as seconds since the unix epoch or in RFC 3339 format.
+	// $SOURCE_DATE_EPOCH is used if empty, otherwise the current time, or the unix epoch if Reproducible is set.
+	Created string `json:"created"`
+	// Reproducible normalizes new layers (sorted entries, timestamps clamped to Created,
+	// fixed gzip header) so that identical inputs give identical digests
+	Reproducible bool `json:"reproducible"`
+	// ManifestFormat is the format of the new manifest, config, layers and index: "docker" or "oci".
+	// The format of the original image is kept if empty, unless the new layers are zstd ones, which require "oci".
+	ManifestFormat string `json:"manifest_format"`
+	// Compression of the new layers: "gzip" (the default), "zstd", "zstd:chunked" or "estargz"
+	Compression string `json:"compression"`
+}
+
+// PlatformOptions selects the platforms of a multi-platform image an operation applies to.
+// The other platforms are kept untouched in the new index.
+type PlatformOptions struct {
+	// Platforms are the platforms to manipulate, e.g. "linux/arm64". The default platform is used if empty.
+	Platforms []string `json:"platforms"`
+	// AllPlatforms manipulates every platform of the image, it takes precedence over Platforms
+	AllPlatforms bool `json:"all_platforms"`
+}
+
+type ServeOptions struct {
+	RootOptions
+	// Address is the TCP address the HTTP API listens on
+	Address string `json:"address"`
+	// GRPCAddress is the TCP address the gRPC API listens on, it is disabled if empty
+	GRPCAddress string `json:"grpc_address"`
+	// Workers is the number of jobs run concurrently
+	Workers int `json:"workers"`
+	// QueueSize is the number of jobs waiting for a worker, more jobs are rejected
+	QueueSize int `json:"queue_size"`
+}
+
 type RootOptions struct {
 	ContainerdAddress string `json:"containerd_address"`
 	Namespace         string `json:"namespace"`
 	LogLevel          string `json:"log_level"`
+	// LockDir is the directory of the image lock files, shared by the processes manipulating images
+	LockDir string `json:"lock_dir"`
 }
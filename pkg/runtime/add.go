@@ -0,0 +1,373 @@
+package runtime
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/archive/compression"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/labels"
+	"github.com/containerd/platforms"
+	"github.com/lingdie/image-manip-server/pkg/options"
+	"github.com/lingdie/image-manip-server/pkg/util"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// fileAttributes are the attributes given to the files added to an image.
+type fileAttributes struct {
+	uid, gid int
+	// mode replaces the permissions of the files if set
+	mode *int64
+	// modTime replaces the modification time of the files if set
+	modTime *time.Time
+}
+
+// parseChown parses "UID[:GID]", the group is the user if it is not given. Names can not be
+// resolved, since the files are added without reading the image.
+func parseChown(s string) (uid, gid int, err error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	user, group, found := strings.Cut(s, ":")
+	uid, err = strconv.Atoi(user)
+	if err != nil || uid < 0 {
+		return 0, 0, fmt.Errorf("invalid owner %q, expected numeric UID[:GID]: %w", s, errdefs.ErrInvalidArgument)
+	}
+	if !found {
+		return uid, uid, nil
+	}
+	gid, err = strconv.Atoi(group)
+	if err != nil || gid < 0 {
+		return 0, 0, fmt.Errorf("invalid owner %q, expected numeric UID[:GID]: %w", s, errdefs.ErrInvalidArgument)
+	}
+	return uid, gid, nil
+}
+
+// parseChmod parses octal permissions like "644" or "0755".
+func parseChmod(s string) (*int64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	mode, err := strconv.ParseInt(s, 8, 64)
+	if err != nil || mode < 0 || mode > 07777 {
+		return nil, fmt.Errorf("invalid permissions %q, expected an octal mode like 644: %w", s, errdefs.ErrInvalidArgument)
+	}
+	return &mode, nil
+}
+
+// addCreatedBy returns the description of the layer adding sources to dest.
+func addCreatedBy(sources []string, dest string) string {
+	return "ADD " + strings.Join(append(append([]string{}, sources...), dest), " ")
+}
+
+// Add adds files and directories of the host to an image, in one new layer on top of it, like the
+// ADD instruction of a Dockerfile. The files belong to root unless opt.Chown is set, and keep their
+// permissions and modification time unless opt.Chmod or opt.NormalizeTimestamps is set. For a
+// multi-platform image, the same layer is added to each selected platform, and a new index is written.
+func (r *Runtime) Add(ctx context.Context, opt options.AddOptions) (result AddResult, err error) {
+	result.ImageRef = opt.ImageRef
+	result.Sources = opt.Sources
+	result.Dest = opt.Dest
+	r.Infof("start to add %q to %s in image %q", opt.Sources, opt.Dest, opt.ImageRef)
+	defer r.record(ctx, &result.Timings, time.Now(), "add")
+	if len(opt.Sources) == 0 || opt.Dest == "" {
+		return result, fmt.Errorf("sources and a destination are required: %w", errdefs.ErrInvalidArgument)
+	}
+	info, err := NewCommitInfo(opt.CommitOptions)
+	if err != nil {
+		return result, err
+	}
+	var attrs fileAttributes
+	attrs.uid, attrs.gid, err = parseChown(opt.Chown)
+	if err != nil {
+		return result, err
+	}
+	attrs.mode, err = parseChmod(opt.Chmod)
+	if err != nil {
+		return result, err
+	}
+	if opt.NormalizeTimestamps {
+		attrs.modTime = &info.Created
+	}
+	unlock, err := r.LockImages(ctx, opt.ImageRef, opt.NewImageName)
+	if err != nil {
+		return result, err
+	}
+	defer unlock()
+	imageName, err := r.FindImage(ctx, opt.ImageRef)
+	if err != nil {
+		r.Errorf("failed to get original image %q: %v", opt.ImageRef, err)
+		return result, err
+	}
+	orig, err := r.imagestore.Get(ctx, imageName)
+	if err != nil {
+		r.Errorf("failed to get original image %q: %v", opt.ImageRef, err)
+		return result, err
+	}
+	manifests, index, err := r.selectManifests(ctx, orig, opt.PlatformOptions)
+	if err != nil {
+		return result, err
+	}
+	newImageName := opt.NewImageName
+	if newImageName == "" {
+		newImageName = orig.Name
+	}
+	// the layer does not depend on the image, it is shared by the platforms
+	layer, err := r.createAddLayer(ctx, opt.Sources, opt.Dest, attrs, info)
+	if err != nil {
+		r.Errorf("failed to create the layer adding %q: %v", opt.Sources, err)
+		return result, err
+	}
+	createdBy := addCreatedBy(opt.Sources, opt.Dest)
+	var (
+		added    []platformWrite
+		replaced = map[digest.Digest]ocispec.Descriptor{}
+	)
+	for _, manifestDesc := range manifests {
+		image, err := r.readImage(ctx, orig, manifestDesc)
+		if err != nil {
+			return result, err
+		}
+		p := platformWrite{image: image}
+		p.layers, err = NewLayerChain(image.Manifest.Layers, image.Config.RootFS.DiffIDs)
+		if err != nil {
+			r.Errorf("failed to create layer chain for original image %q: %v", image.Image.Name, err)
+			return result, err
+		}
+		platformInfo := info.forManifest(image.ManifestDesc.MediaType)
+		newHistory := []ocispec.History{{CreatedBy: createdBy, Author: info.Author, Comment: info.Comment}}
+		p.written, err = r.WriteBack(ctx, image.Config, p.layers, NewLayerChainFromLayer(layer), newHistory, nil, image.Manifest.Annotations, platformInfo)
+		if err != nil {
+			if index != nil {
+				err = fmt.Errorf("platform %s: %w", platforms.Format(*manifestDesc.Platform), err)
+			}
+			r.Errorf("failed to write back image %q: %v", image.Image.Name, err)
+			return result, err
+		}
+		replaced[manifestDesc.Digest] = p.written.Manifest
+		added = append(added, p)
+	}
+	target := added[0].written.Manifest
+	if index != nil {
+		target, err = r.writeImageIndex(ctx, orig.Target, *index, replaced, info.ManifestFormat)
+		if err != nil {
+			r.Errorf("failed to write the index of image %q: %v", newImageName, err)
+			return result, err
+		}
+	}
+	img := images.Image{
+		Name:      newImageName,
+		Target:    target,
+		UpdatedAt: time.Now(),
+	}
+	img, err = r.CompareAndSwapImage(ctx, img, orig, "add "+strings.TrimPrefix(createdBy, "ADD "))
+	if err != nil {
+		r.Errorf("failed to update image %q: %v", newImageName, err)
+		return result, err
+	}
+	for _, p := range added {
+		reportProgress(ctx, Progress{Step: "unpack", Message: newImageName})
+		manifestDesc := p.written.Manifest
+		manifestDesc.Platform = p.image.ManifestDesc.Platform
+		if err := r.UnpackImage(ctx, img, manifestDesc); err != nil {
+			r.Errorf("failed to unpack image %q: %v", newImageName, err)
+			return result, err
+		}
+	}
+	if index == nil {
+		result.ImageResult = newImageResult(newImageName, added[0].written, added[0].layers)
+	} else {
+		result.ImageResult = ImageResult{NewImageName: newImageName, ManifestDigest: target.Digest}
+		for _, p := range added {
+			result.Platforms = append(result.Platforms, PlatformResult{
+				Platform:    platforms.Format(*p.image.ManifestDesc.Platform),
+				ImageResult: newImageResult(newImageName, p.written, p.layers),
+			})
+		}
+	}
+	r.Infof("%q added to %s in image %q successfully, new image: %q", opt.Sources, opt.Dest, opt.ImageRef, newImageName)
+	return result, nil
+}
+
+// createAddLayer writes the layer holding sources at dest, normalized and compressed according to info.
+func (r *Runtime) createAddLayer(ctx context.Context, sources []string, dest string, attrs fileAttributes, info CommitInfo) (Layer, error) {
+	defer r.track(ctx, time.Now(), "createAddLayer")
+	for _, src := range sources {
+		if _, err := os.Lstat(src); err != nil {
+			if os.IsNotExist(err) {
+				return Layer{}, fmt.Errorf("source %q does not exist: %w", src, errdefs.ErrNotFound)
+			}
+			return Layer{}, err
+		}
+	}
+	layer, err := r.writeTarLayer(ctx, images.MediaTypeDockerSchema2LayerGzip, "add", func(tw *tar.Writer) error {
+		return addSources(tw, sources, dest, attrs)
+	})
+	if err != nil {
+		return layer, err
+	}
+	if info.Reproducible {
+		layer, err = r.normalizeLayer(ctx, layer, info.Created)
+		if err != nil {
+			return layer, fmt.Errorf("failed to normalize layer: %w", err)
+		}
+	}
+	return r.compressLayer(ctx, layer, info.Compression)
+}
+
+// addSources writes sources at dest to tw. dest is a directory if it ends with "/" or if there are several
+// sources: the files are added in it under their own name, and the content of the directories is added
+// to it. dest is resolved from the root of the image, so that ".." can not lead out of it.
+func addSources(tw *tar.Writer, sources []string, dest string, attrs fileAttributes) error {
+	destDir := strings.HasSuffix(dest, "/") || len(sources) > 1
+	dest = path.Clean("/" + dest)
+	if dest == "/" {
+		destDir = true
+	}
+	for _, src := range sources {
+		if err := addSource(tw, src, dest, destDir, attrs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addSource writes src to tw: a directory is walked and its content written under dest, while another
+// file is written as dest, or in it if destDir is set. Symbolic links are written as they are.
+func addSource(tw *tar.Writer, src string, dest string, destDir bool, attrs fileAttributes) error {
+	fi, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		name := dest
+		if destDir {
+			name = path.Join(dest, filepath.Base(src))
+		}
+		return addFile(tw, src, name, fi, attrs)
+	}
+	return filepath.WalkDir(src, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, file)
+		if err != nil || rel == "." {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return addFile(tw, file, path.Join(dest, filepath.ToSlash(rel)), fi, attrs)
+	})
+}
+
+// addFile writes the file of the host file with the info fi as the absolute path name.
+func addFile(tw *tar.Writer, file string, name string, fi os.FileInfo, attrs fileAttributes) error {
+	var link string
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		var err error
+		if link, err = os.Readlink(file); err != nil {
+			return err
+		}
+	case fi.Mode()&os.ModeSocket != 0:
+		// sockets can not be archived, they are useless in an image anyway
+		return nil
+	}
+	hdr, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return fmt.Errorf("failed to add %q: %w", file, err)
+	}
+	hdr.Name = strings.TrimPrefix(name, "/")
+	if fi.IsDir() {
+		hdr.Name += "/"
+	}
+	hdr.Uid, hdr.Gid = attrs.uid, attrs.gid
+	hdr.Uname, hdr.Gname = "", ""
+	if attrs.mode != nil && fi.Mode()&os.ModeSymlink == 0 {
+		hdr.Mode = hdr.Mode&^07777 | *attrs.mode
+	}
+	if attrs.modTime != nil {
+		hdr.ModTime = *attrs.modTime
+	}
+	hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}
+	hdr.Format = tar.FormatPAX
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("failed to add %q: %w", file, err)
+	}
+	return nil
+}
+
+// writeTarLayer writes a gzip layer of the given media type whose tar is written by write, and
+// returns it along with its diffID. ref names the upload in the content store.
+func (r *Runtime) writeTarLayer(ctx context.Context, mediaType string, ref string, write func(tw *tar.Writer) error) (Layer, error) {
+	blob, err := os.CreateTemp("", "layer-blob-")
+	if err != nil {
+		return Layer{}, err
+	}
+	defer os.Remove(blob.Name())
+	defer blob.Close()
+	var (
+		diffIDDigester = digest.Canonical.Digester()
+		blobDigester   = digest.Canonical.Digester()
+	)
+	cw, err := compression.CompressStream(io.MultiWriter(blob, blobDigester.Hash()), compression.Gzip)
+	if err != nil {
+		return Layer{}, err
+	}
+	tw := tar.NewWriter(io.MultiWriter(cw, diffIDDigester.Hash()))
+	if err := write(tw); err != nil {
+		cw.Close()
+		return Layer{}, err
+	}
+	if err := tw.Close(); err != nil {
+		cw.Close()
+		return Layer{}, err
+	}
+	if err := cw.Close(); err != nil {
+		return Layer{}, err
+	}
+	size, err := blob.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return Layer{}, err
+	}
+	if _, err := blob.Seek(0, io.SeekStart); err != nil {
+		return Layer{}, err
+	}
+	layer := NewLayer(ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    blobDigester.Digest(),
+		Size:      size,
+	}, diffIDDigester.Digest())
+	labelOpt := content.WithLabels(map[string]string{
+		labels.LabelUncompressed: layer.DiffID.String(),
+	})
+	if err := content.WriteBlob(ctx, r.contentstore, fmt.Sprintf("%s-%s", ref, util.UniquePart()), blob, layer.Desc, labelOpt); err != nil {
+		return Layer{}, fmt.Errorf("failed to write layer: %w", err)
+	}
+	return layer, nil
+}
@@ -0,0 +1,218 @@
+package runtime_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+)
+
+// addContext returns the sources of an add: a file, and a directory holding a file, a subdirectory and
+// a symbolic link to a file out of the directory.
+func addContext(t *testing.T) (caFile, confDir string) {
+	root := t.TempDir()
+	caFile = filepath.Join(root, "host-ca.crt")
+	confDir = filepath.Join(root, "conf")
+	for name, content := range map[string]string{
+		caFile:                                    "ca",
+		filepath.Join(confDir, "app.conf"):        "conf",
+		filepath.Join(confDir, "sub", "x"):        "x",
+		filepath.Join(root, "secret", "password"): "secret",
+	} {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("../secret/password", filepath.Join(confDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	return caFile, confDir
+}
+
+// readAddTar returns the headers of the tar written by an add, and the content of its regular files.
+func readAddTar(t *testing.T, sources []string, dest, chown, chmod string, modTime *time.Time) ([]*tar.Header, map[string]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := runtime.AddTar(&buf, sources, dest, chown, chmod, modTime); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		headers  []*tar.Header
+		contents = map[string]string{}
+	)
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers = append(headers, hdr)
+		if hdr.Typeflag == tar.TypeReg {
+			b, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			contents[hdr.Name] = string(b)
+		}
+	}
+	return headers, contents
+}
+
+func TestAddDest(t *testing.T) {
+	caFile, confDir := addContext(t)
+	confEntries := func(dir string) []string {
+		return []string{dir + "app.conf", dir + "link", dir + "sub/", dir + "sub/x"}
+	}
+	for _, tc := range []struct {
+		name     string
+		sources  []string
+		dest     string
+		expected []string
+	}{
+		{
+			name:     "file renamed",
+			sources:  []string{caFile},
+			dest:     "/etc/ssl/certs/ca-certificates.crt",
+			expected: []string{"etc/ssl/certs/ca-certificates.crt"},
+		},
+		{
+			name:     "relative destination from the root",
+			sources:  []string{caFile},
+			dest:     "etc/ssl/ca.crt",
+			expected: []string{"etc/ssl/ca.crt"},
+		},
+		{
+			name:     "file in a directory",
+			sources:  []string{caFile},
+			dest:     "/etc/ssl/",
+			expected: []string{"etc/ssl/host-ca.crt"},
+		},
+		{
+			name:     "file in the root",
+			sources:  []string{caFile},
+			dest:     "/",
+			expected: []string{"host-ca.crt"},
+		},
+		{
+			name:     "content of a directory",
+			sources:  []string{confDir},
+			dest:     "/etc/app",
+			expected: confEntries("etc/app/"),
+		},
+		{
+			name:     "several sources in a directory",
+			sources:  []string{caFile, confDir},
+			dest:     "/opt",
+			expected: append([]string{"opt/host-ca.crt"}, confEntries("opt/")...),
+		},
+		{
+			name:     "destination out of the root",
+			sources:  []string{caFile},
+			dest:     "../../etc/ssl/ca.crt",
+			expected: []string{"etc/ssl/ca.crt"},
+		},
+		{
+			name:     "directory out of the root",
+			sources:  []string{confDir},
+			dest:     "/opt/../../../app/",
+			expected: confEntries("app/"),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			headers, _ := readAddTar(t, tc.sources, tc.dest, "", "", nil)
+			var names []string
+			for _, hdr := range headers {
+				names = append(names, hdr.Name)
+			}
+			if !reflect.DeepEqual(names, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, names)
+			}
+		})
+	}
+}
+
+func TestAddSymlinkNotFollowed(t *testing.T) {
+	_, confDir := addContext(t)
+	headers, contents := readAddTar(t, []string{confDir}, "/etc/app/", "", "", nil)
+	for _, hdr := range headers {
+		if hdr.Name != "etc/app/link" {
+			continue
+		}
+		// the link is added as it is, the file it points to out of the source is not read
+		if hdr.Typeflag != tar.TypeSymlink || hdr.Linkname != "../secret/password" {
+			t.Errorf("expected a symbolic link to ../secret/password, got %+v", hdr)
+		}
+	}
+	for name, content := range contents {
+		if content == "secret" {
+			t.Errorf("the file out of the source has been added as %s", name)
+		}
+	}
+	if contents["etc/app/app.conf"] != "conf" || contents["etc/app/sub/x"] != "x" {
+		t.Errorf("unexpected contents %v", contents)
+	}
+}
+
+func TestAddAttributes(t *testing.T) {
+	caFile, confDir := addContext(t)
+	modTime := time.Unix(1700000000, 0).UTC()
+	headers, _ := readAddTar(t, []string{caFile, confDir}, "/opt/", "1000:2000", "644", &modTime)
+	for _, hdr := range headers {
+		if hdr.Uid != 1000 || hdr.Gid != 2000 || hdr.Uname != "" || hdr.Gname != "" {
+			t.Errorf("%s: expected the owner 1000:2000, got %d:%d (%q:%q)", hdr.Name, hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname)
+		}
+		if !hdr.ModTime.Equal(modTime) {
+			t.Errorf("%s: expected the modification time %s, got %s", hdr.Name, modTime, hdr.ModTime)
+		}
+		expectedMode := int64(0o644)
+		if hdr.Typeflag == tar.TypeSymlink {
+			// the permissions of a link are not used
+			expectedMode = 0o777
+		}
+		if hdr.Mode&0o7777 != expectedMode {
+			t.Errorf("%s: expected the permissions %o, got %o", hdr.Name, expectedMode, hdr.Mode&0o7777)
+		}
+	}
+
+	// by default, the files belong to root and keep their permissions and modification time
+	fi, err := os.Stat(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, _ = readAddTar(t, []string{caFile}, "/etc/ca.crt", "", "", nil)
+	if hdr := headers[0]; hdr.Uid != 0 || hdr.Gid != 0 || hdr.Mode&0o7777 != 0o600 || !hdr.ModTime.Equal(fi.ModTime()) {
+		t.Errorf("unexpected default attributes %+v", hdr)
+	}
+	headers, _ = readAddTar(t, []string{caFile}, "/etc/ca.crt", "1000", "", nil)
+	if hdr := headers[0]; hdr.Uid != 1000 || hdr.Gid != 1000 {
+		t.Errorf("expected the group to be the user, got %d:%d", hdr.Uid, hdr.Gid)
+	}
+
+	for _, tc := range []struct {
+		chown, chmod string
+	}{
+		{chown: "app"},
+		{chown: "1000:staff"},
+		{chown: "-1"},
+		{chmod: "rw-r--r--"},
+		{chmod: "988"},
+		{chmod: "17777"},
+	} {
+		if err := runtime.AddTar(io.Discard, []string{caFile}, "/etc/ca.crt", tc.chown, tc.chmod, nil); !errdefs.IsInvalidArgument(err) {
+			t.Errorf("chown %q chmod %q: expected an invalid argument, got %v", tc.chown, tc.chmod, err)
+		}
+	}
+}
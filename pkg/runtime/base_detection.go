@@ -0,0 +1,334 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	imagesutil "github.com/lingdie/image-manip-server/pkg/images"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Confidence is how sure a base detection strategy is of the base layer it found.
+type Confidence string
+
+const (
+	// ConfidenceHigh is the confidence of a base verified against the layers of a local image.
+	ConfidenceHigh Confidence = "high"
+	// ConfidenceMedium is the confidence of a base found from the history markers of a builder.
+	ConfidenceMedium Confidence = "medium"
+	// ConfidenceLow is the confidence of a base guessed from the shape of the history.
+	ConfidenceLow Confidence = "low"
+)
+
+func (c Confidence) rank() int {
+	switch c {
+	case ConfidenceHigh:
+		return 3
+	case ConfidenceMedium:
+		return 2
+	case ConfidenceLow:
+		return 1
+	}
+	return 0
+}
+
+// BaseDetection is the base layer of the manifest of a platform of an image, found by a strategy.
+type BaseDetection struct {
+	Strategy   string     `json:"strategy"`
+	Confidence Confidence `json:"confidence"`
+	// BaseLayerIndex is the index of the topmost base layer in the layers of the image
+	BaseLayerIndex  int           `json:"base_layer_index"`
+	BaseLayerDigest digest.Digest `json:"base_layer_digest"`
+	// BaseImage is the name of the base image, if the strategy found it
+	BaseImage string `json:"base_image,omitempty"`
+	// Reason tells what the strategy found
+	Reason string `json:"reason"`
+}
+
+// BaseStrategy is a heuristic finding the base layer of the manifest of a platform of an image.
+type BaseStrategy interface {
+	// Name is the name a strategy is selected by.
+	Name() string
+	// DetectBase returns the base layer of image. found is false if the strategy does not apply to it.
+	DetectBase(ctx context.Context, image imagesutil.Image) (detection BaseDetection, found bool, err error)
+}
+
+// RegisterBaseStrategy adds a strategy to the strategies of DetectBase, after the default ones.
+// A strategy with the name of a registered one replaces it.
+func (r *Runtime) RegisterBaseStrategy(strategy BaseStrategy) {
+	for i, s := range r.baseStrategies {
+		if s.Name() == strategy.Name() {
+			r.baseStrategies[i] = strategy
+			return
+		}
+	}
+	r.baseStrategies = append(r.baseStrategies, strategy)
+}
+
+// BaseStrategies returns the names of the strategies of DetectBase, in their default order.
+func (r *Runtime) BaseStrategies() []string {
+	names := make([]string, len(r.baseStrategies))
+	for i, s := range r.baseStrategies {
+		names[i] = s.Name()
+	}
+	return names
+}
+
+// defaultBaseStrategies returns the strategies of DetectBase, the most reliable ones first.
+func defaultBaseStrategies(r *Runtime) []BaseStrategy {
+	return append([]BaseStrategy{annotationStrategy{r}, localPrefixStrategy{r}}, HistoryBaseStrategies()...)
+}
+
+// HistoryBaseStrategies returns the strategies finding the base layer of an image from the history
+// left by its builder, which need nothing but the image: buildah, buildkit, kaniko, ko and docker,
+// the legacy builder of docker.
+func HistoryBaseStrategies() []BaseStrategy {
+	return []BaseStrategy{
+		buildahStrategy{},
+		historyMarkerStrategy{
+			name:       "buildkit",
+			confidence: ConfidenceMedium,
+			marks: func(h ocispec.History) bool {
+				return strings.Contains(h.Comment, DefaultDockerfileComment)
+			},
+		},
+		historyMarkerStrategy{
+			name:       "kaniko",
+			confidence: ConfidenceMedium,
+			marks: func(h ocispec.History) bool {
+				return h.Author == "kaniko"
+			},
+		},
+		historyMarkerStrategy{
+			name:       "ko",
+			confidence: ConfidenceMedium,
+			marks: func(h ocispec.History) bool {
+				return h.Author == "github.com/google/ko" || strings.HasPrefix(h.CreatedBy, "ko build")
+			},
+		},
+		historyMarkerStrategy{
+			name:       "docker",
+			confidence: ConfidenceLow,
+			marks: func(h ocispec.History) bool {
+				return legacyBuildPattern.MatchString(h.CreatedBy)
+			},
+		},
+	}
+}
+
+// DetectBase finds the base layer of image, the manifest of one platform of an image, with the
+// strategies of the given names, in order, or with all the strategies if none is given.
+// The first detection of high confidence is returned, otherwise the first one of the highest confidence.
+func (r *Runtime) DetectBase(ctx context.Context, image imagesutil.Image, strategies []string) (BaseDetection, bool, error) {
+	selected := r.baseStrategies
+	if len(strategies) > 0 {
+		selected = nil
+		for _, name := range strategies {
+			strategy, ok := r.baseStrategy(name)
+			if !ok {
+				return BaseDetection{}, false, fmt.Errorf("unknown base detection strategy %q, expected one of %s: %w", name, strings.Join(r.BaseStrategies(), ", "), errdefs.ErrInvalidArgument)
+			}
+			selected = append(selected, strategy)
+		}
+	}
+	var (
+		best  BaseDetection
+		found bool
+	)
+	for _, strategy := range selected {
+		detection, ok, err := strategy.DetectBase(ctx, image)
+		if err != nil {
+			return best, false, fmt.Errorf("base detection %q: %w", strategy.Name(), err)
+		}
+		if !ok {
+			r.Debugf("base detection %q does not apply to image %q", strategy.Name(), image.Image.Name)
+			continue
+		}
+		detection.Strategy = strategy.Name()
+		r.Debugf("base detection %q found layer %d (%s confidence): %s", strategy.Name(), detection.BaseLayerIndex, detection.Confidence, detection.Reason)
+		if !found || detection.Confidence.rank() > best.Confidence.rank() {
+			best, found = detection, true
+		}
+		if best.Confidence == ConfidenceHigh {
+			break
+		}
+	}
+	return best, found, nil
+}
+
+func (r *Runtime) baseStrategy(name string) (BaseStrategy, bool) {
+	for _, s := range r.baseStrategies {
+		if s.Name() == name {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// newBaseDetection returns the detection of the layer of index baseLayerIndex of image.
+func newBaseDetection(image imagesutil.Image, baseLayerIndex int, confidence Confidence, reason string) BaseDetection {
+	return BaseDetection{
+		Confidence:      confidence,
+		BaseLayerIndex:  baseLayerIndex,
+		BaseLayerDigest: image.Manifest.Layers[baseLayerIndex].Digest,
+		Reason:          reason,
+	}
+}
+
+// annotationStrategy finds the base image recorded in the annotations of the manifest, e.g. by
+// buildkit or a rebase, among the local images.
+type annotationStrategy struct {
+	r *Runtime
+}
+
+func (annotationStrategy) Name() string {
+	return "annotation"
+}
+
+func (s annotationStrategy) DetectBase(ctx context.Context, image imagesutil.Image) (BaseDetection, bool, error) {
+	baseDigest := image.Manifest.Annotations[ocispec.AnnotationBaseImageDigest]
+	baseName := image.Manifest.Annotations[ocispec.AnnotationBaseImageName]
+	if baseDigest == "" {
+		return BaseDetection{}, false, nil
+	}
+	dgst, err := digest.Parse(baseDigest)
+	if err != nil {
+		s.r.Warnf("invalid base image digest annotation %q of image %q", baseDigest, image.Image.Name)
+		return BaseDetection{}, false, nil
+	}
+	// the image of the annotated name is preferred, unless the name has been moved to another target since
+	candidates, err := s.r.imagestore.List(ctx, fmt.Sprintf("target.digest==%s", dgst))
+	if err != nil {
+		return BaseDetection{}, false, err
+	}
+	if baseName != "" {
+		if img, err := s.r.imagestore.Get(ctx, baseName); err == nil && img.Target.Digest == dgst {
+			candidates = append([]images.Image{img}, candidates...)
+		}
+	}
+	for _, candidate := range candidates {
+		base, err := s.r.GetPlatformImage(ctx, candidate.Name, image.ManifestDesc.Platform)
+		if err != nil || len(base.Manifest.Layers) == 0 {
+			continue
+		}
+		if err := verifyBaseLayers(image, image.Image.Name, base, candidate.Name); err != nil {
+			s.r.Warnf("image %q is annotated with the base image %q but is not built on it: %v", image.Image.Name, candidate.Name, err)
+			continue
+		}
+		detection := newBaseDetection(image, len(base.Manifest.Layers)-1, ConfidenceHigh, fmt.Sprintf("the manifest is annotated with base image %s", dgst))
+		detection.BaseImage = candidate.Name
+		return detection, true, nil
+	}
+	s.r.Infof("the base image %s %s of image %q is not stored locally", baseName, dgst, image.Image.Name)
+	return BaseDetection{}, false, nil
+}
+
+// localPrefixStrategy finds the local image whose layers are the longest strict prefix of the layers
+// of the image.
+type localPrefixStrategy struct {
+	r *Runtime
+}
+
+func (localPrefixStrategy) Name() string {
+	return "local"
+}
+
+func (s localPrefixStrategy) DetectBase(ctx context.Context, image imagesutil.Image) (BaseDetection, bool, error) {
+	candidates, err := s.r.localBaseImages(ctx, image)
+	if err != nil {
+		return BaseDetection{}, false, err
+	}
+	if len(candidates) == 0 {
+		return BaseDetection{}, false, nil
+	}
+	best := candidates[0]
+	detection := newBaseDetection(image, best.SplitIndex-1, ConfidenceHigh, fmt.Sprintf("the layers of the local image %s are a prefix of the layers of the image", best.Name))
+	detection.BaseImage = best.Name
+	return detection, true, nil
+}
+
+var (
+	// legacyBuildPattern matches the CreatedBy of the entries of the legacy builder of docker:
+	// RUN commands, with their build arguments if any, and the other instructions marked #(nop)
+	legacyBuildPattern = regexp.MustCompile(`^(\|\d+ .*)?/bin/sh -c `)
+	// imageEndPattern matches the CreatedBy of a CMD or an ENTRYPOINT instruction, which usually
+	// end a Dockerfile, whatever the builder
+	imageEndPattern = regexp.MustCompile(`(^|#\(nop\)\s+)(CMD|ENTRYPOINT)\s`)
+)
+
+// historyMarkerStrategy finds the layers built by a builder from a marker it leaves in the history
+// entries it creates. The layers of the image are the topmost run of marked layers, stopping at a CMD
+// or an ENTRYPOINT entry, which likely ends the image the run is built on. The base layer is right
+// below them.
+type historyMarkerStrategy struct {
+	name       string
+	confidence Confidence
+	marks      func(h ocispec.History) bool
+}
+
+func (s historyMarkerStrategy) Name() string {
+	return s.name
+}
+
+func (s historyMarkerStrategy) DetectBase(ctx context.Context, image imagesutil.Image) (BaseDetection, bool, error) {
+	histories, _ := splitHistory(image.Config.History, len(image.Manifest.Layers))
+	first := len(histories)
+	for i := len(histories) - 1; i >= 0; i-- {
+		if !s.marks(histories[i].Layer) {
+			break
+		}
+		first = i
+		if endsImage(histories[i].EmptyLayers) {
+			break
+		}
+	}
+	// nothing is marked, or the whole image is, in which case there is no base to tell
+	if first == len(histories) || first == 0 {
+		return BaseDetection{}, false, nil
+	}
+	reason := fmt.Sprintf("the %d topmost layers are marked as built by %s", len(histories)-first, s.name)
+	return newBaseDetection(image, first-1, s.confidence, reason), true, nil
+}
+
+// endsImage reports whether the history entries hold a CMD or an ENTRYPOINT instruction.
+func endsImage(entries []ocispec.History) bool {
+	for _, h := range entries {
+		if imageEndPattern.MatchString(h.CreatedBy) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildahStrategy finds the layers built by buildah, which records the base image of a build in the
+// comment of the first history entry of the build, e.g. "FROM docker.io/library/alpine:3.20".
+type buildahStrategy struct{}
+
+func (buildahStrategy) Name() string {
+	return "buildah"
+}
+
+func (buildahStrategy) DetectBase(ctx context.Context, image imagesutil.Image) (BaseDetection, bool, error) {
+	layerIndex := 0
+	baseLayerIndex := -1
+	var from string
+	for _, h := range image.Config.History {
+		if strings.HasPrefix(h.Comment, "FROM ") {
+			// the layers created so far are the base of the build
+			baseLayerIndex = layerIndex - 1
+			from = strings.TrimPrefix(h.Comment, "FROM ")
+		}
+		if !h.EmptyLayer {
+			layerIndex++
+		}
+	}
+	if baseLayerIndex < 0 || baseLayerIndex >= len(image.Manifest.Layers) {
+		return BaseDetection{}, false, nil
+	}
+	return newBaseDetection(image, baseLayerIndex, ConfidenceMedium, fmt.Sprintf("the history records a build from %s", from)), true, nil
+}
@@ -0,0 +1,159 @@
+package runtime_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	imagesutil "github.com/lingdie/image-manip-server/pkg/images"
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestHistoryBaseStrategies(t *testing.T) {
+	const buildkit = runtime.DefaultDockerfileComment
+	imageOf := func(history ...ocispec.History) imagesutil.Image {
+		manifest := &ocispec.Manifest{}
+		for _, h := range history {
+			if !h.EmptyLayer {
+				manifest.Layers = append(manifest.Layers, ocispec.Descriptor{Digest: digest.FromString(fmt.Sprintf("layer %d", len(manifest.Layers)))})
+			}
+		}
+		return imagesutil.Image{Manifest: manifest, Config: ocispec.Image{History: history}}
+	}
+	for _, tc := range []struct {
+		name  string
+		image imagesutil.Image
+		// expected is the base layer index found by each strategy, the other ones find nothing
+		expected map[string]int
+	}{
+		{
+			name: "buildkit on a legacy base",
+			image: imageOf(
+				ocispec.History{CreatedBy: "/bin/sh -c #(nop) ADD file:4c2f3 in / "},
+				ocispec.History{CreatedBy: "/bin/sh -c apt-get update"},
+				ocispec.History{CreatedBy: `/bin/sh -c #(nop)  CMD ["bash"]`, EmptyLayer: true},
+				ocispec.History{CreatedBy: "RUN /bin/sh -c apt-get install -y curl # buildkit", Comment: buildkit},
+				ocispec.History{CreatedBy: "ENV APP=1", Comment: buildkit, EmptyLayer: true},
+				ocispec.History{CreatedBy: "COPY . /app # buildkit", Comment: buildkit},
+			),
+			expected: map[string]int{"buildkit": 1},
+		},
+		{
+			name: "buildkit on a buildkit base",
+			image: imageOf(
+				ocispec.History{CreatedBy: "ADD alpine-minirootfs.tar.gz / # buildkit", Comment: buildkit},
+				ocispec.History{CreatedBy: "RUN /bin/sh -c apk add python3 # buildkit", Comment: buildkit},
+				ocispec.History{CreatedBy: `CMD ["python3"]`, Comment: buildkit, EmptyLayer: true},
+				ocispec.History{CreatedBy: "COPY . /app # buildkit", Comment: buildkit},
+			),
+			expected: map[string]int{"buildkit": 1},
+		},
+		{
+			name: "legacy docker build",
+			image: imageOf(
+				ocispec.History{CreatedBy: "/bin/sh -c #(nop) ADD file:4c2f3 in / "},
+				ocispec.History{CreatedBy: `/bin/sh -c #(nop)  CMD ["bash"]`, EmptyLayer: true},
+				ocispec.History{CreatedBy: "|1 VERSION=1.2 /bin/sh -c make install"},
+				ocispec.History{CreatedBy: "/bin/sh -c #(nop) COPY dir:9a3c1 in /app "},
+			),
+			expected: map[string]int{"docker": 0},
+		},
+		{
+			name: "buildah",
+			image: imageOf(
+				ocispec.History{CreatedBy: "/bin/sh -c #(nop) ADD file:4c2f3 in / "},
+				ocispec.History{CreatedBy: "/bin/sh -c #(nop) COPY file:5d1e2 in /etc "},
+				ocispec.History{CreatedBy: "/bin/sh -c dnf install -y nginx", Comment: "FROM registry.fedoraproject.org/fedora:40"},
+			),
+			expected: map[string]int{"buildah": 1},
+		},
+		{
+			name: "kaniko",
+			image: imageOf(
+				ocispec.History{CreatedBy: "ADD alpine-minirootfs.tar.gz / # buildkit", Comment: buildkit},
+				ocispec.History{CreatedBy: "RUN apk add git", Author: "kaniko"},
+				ocispec.History{CreatedBy: "COPY . /src", Author: "kaniko"},
+			),
+			expected: map[string]int{"kaniko": 0},
+		},
+		{
+			name: "ko",
+			image: imageOf(
+				ocispec.History{CreatedBy: "bazel build //base:static"},
+				ocispec.History{CreatedBy: "ko build ko://example.com/app", Author: "github.com/google/ko", Comment: "kodata contents, at $KO_DATA_PATH"},
+				ocispec.History{CreatedBy: "ko build ko://example.com/app", Author: "github.com/google/ko", Comment: "go build output, at /ko-app/app"},
+			),
+			expected: map[string]int{"ko": 0},
+		},
+		{
+			name: "built from scratch",
+			image: imageOf(
+				ocispec.History{CreatedBy: "COPY app /app # buildkit", Comment: buildkit},
+				ocispec.History{CreatedBy: "COPY config /etc/app # buildkit", Comment: buildkit},
+			),
+			expected: map[string]int{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, strategy := range runtime.HistoryBaseStrategies() {
+				detection, found, err := strategy.DetectBase(context.Background(), tc.image)
+				if err != nil {
+					t.Fatal(err)
+				}
+				expected, ok := tc.expected[strategy.Name()]
+				if found != ok {
+					t.Errorf("%s: expected found %v, got %v (%+v)", strategy.Name(), ok, found, detection)
+					continue
+				}
+				if !found {
+					continue
+				}
+				if detection.BaseLayerIndex != expected {
+					t.Errorf("%s: expected base layer %d, got %d", strategy.Name(), expected, detection.BaseLayerIndex)
+				}
+				if detection.BaseLayerDigest != tc.image.Manifest.Layers[expected].Digest {
+					t.Errorf("%s: base layer digest does not match its index", strategy.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestDetectRebaseSplitRepeatedDigest(t *testing.T) {
+	const buildkit = runtime.DefaultDockerfileComment
+	// the empty layer buildkit creates for WORKDIR is both the topmost base layer and a lower one
+	empty := ocispec.Descriptor{Digest: digest.FromString("empty layer")}
+	layer := func(s string) ocispec.Descriptor {
+		return ocispec.Descriptor{Digest: digest.FromString(s)}
+	}
+	layers := []ocispec.Descriptor{layer("rootfs"), empty, layer("make"), empty, layer("app"), layer("config")}
+	var diffIDs []digest.Digest
+	for _, l := range layers {
+		diffIDs = append(diffIDs, l.Digest)
+	}
+	image := imagesutil.Image{
+		Manifest: &ocispec.Manifest{Layers: layers},
+		Config: ocispec.Image{RootFS: ocispec.RootFS{Type: "layers", DiffIDs: diffIDs}, History: []ocispec.History{
+			{CreatedBy: "ADD rootfs.tar.gz / # buildkit", Comment: buildkit},
+			{CreatedBy: "WORKDIR /src", Comment: buildkit},
+			{CreatedBy: "RUN /bin/sh -c make install # buildkit", Comment: buildkit},
+			{CreatedBy: "WORKDIR /", Comment: buildkit},
+			{CreatedBy: `CMD ["sh"]`, Comment: buildkit, EmptyLayer: true},
+			{CreatedBy: "COPY app /app # buildkit", Comment: buildkit},
+			{CreatedBy: "COPY config /etc/app # buildkit", Comment: buildkit},
+		}},
+	}
+	detection, first, err := runtime.DetectRebaseSplit(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detection.BaseLayerIndex != 3 || detection.BaseLayerDigest != empty.Digest {
+		t.Fatalf("expected base layer 3 %s, got %d %s", empty.Digest, detection.BaseLayerIndex, detection.BaseLayerDigest)
+	}
+	// the split is right after the detected layer, not after the first layer with its digest
+	if first != 4 {
+		t.Errorf("expected the rebase to start at layer 4, got %d", first)
+	}
+}
@@ -0,0 +1,89 @@
+package runtime
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lingdie/image-manip-server/pkg/options"
+)
+
+// CommitInfo is the metadata recorded in the image config and the history entries generated by an operation.
+type CommitInfo struct {
+	Author  string
+	Comment string
+	Created time.Time
+	// Reproducible normalizes the new layers, clamping their timestamps to Created
+	Reproducible bool
+	// ManifestFormat is ManifestFormatDocker or ManifestFormatOCI, or empty to keep the format of the
+	// original image until the image is known
+	ManifestFormat string
+	// Compression is the compression of the new layers, one of the Compression constants
+	Compression string
+}
+
+// sourceDateEpochEnv is the environment variable of the default creation time
+const sourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+// NewCommitInfo fills the unset options with the defaults: defaultAuthor, defaultMessage and
+// $SOURCE_DATE_EPOCH if set, otherwise the current time, or the unix epoch for a reproducible commit.
+// The environment is read whatever the entry point, the CLI or the server.
+func NewCommitInfo(opt options.CommitOptions) (CommitInfo, error) {
+	info := CommitInfo{
+		Author:       strings.TrimSpace(opt.Author),
+		Comment:      strings.TrimSpace(opt.Comment),
+		Reproducible: opt.Reproducible,
+	}
+	if info.Author == "" {
+		info.Author = defaultAuthor
+	}
+	if info.Comment == "" {
+		info.Comment = defaultMessage
+	}
+	createdOpt := strings.TrimSpace(opt.Created)
+	if createdOpt == "" {
+		// https://reproducible-builds.org/specs/source-date-epoch/
+		createdOpt = strings.TrimSpace(os.Getenv(sourceDateEpochEnv))
+	}
+	created, err := ParseCreatedTime(createdOpt)
+	if err != nil {
+		return info, err
+	}
+	info.Created = created
+	if info.Reproducible && createdOpt == "" {
+		// the current time would make every run give a different digest
+		info.Created = time.Unix(0, 0).UTC()
+	}
+	info.ManifestFormat, err = parseManifestFormat(strings.TrimSpace(opt.ManifestFormat))
+	if err != nil {
+		return info, err
+	}
+	info.Compression, err = parseCompression(strings.TrimSpace(opt.Compression))
+	if err != nil {
+		return info, err
+	}
+	info.ManifestFormat, err = manifestFormatFor(info.ManifestFormat, info.Compression)
+	if err != nil {
+		return info, err
+	}
+	return info, nil
+}
+
+// ParseCreatedTime parses a creation time given either as seconds since the unix epoch
+// (like SOURCE_DATE_EPOCH) or in RFC 3339 format. An empty string means the current time.
+func ParseCreatedTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Now(), nil
+	}
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid creation time %q, expected seconds since the unix epoch or RFC 3339: %w", s, err)
+	}
+	return t.UTC(), nil
+}
@@ -0,0 +1,97 @@
+package runtime_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/lingdie/image-manip-server/pkg/options"
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+)
+
+func TestNewCommitInfoCreated(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	for _, c := range []struct {
+		name     string
+		opt      options.CommitOptions
+		expected time.Time
+	}{
+		{
+			name:     "reproducible defaults to the epoch",
+			opt:      options.CommitOptions{Reproducible: true},
+			expected: time.Unix(0, 0).UTC(),
+		},
+		{
+			name:     "reproducible with a time",
+			opt:      options.CommitOptions{Reproducible: true, Created: "1700000000"},
+			expected: time.Unix(1700000000, 0).UTC(),
+		},
+		{
+			name:     "explicit epoch",
+			opt:      options.CommitOptions{Created: "0"},
+			expected: time.Unix(0, 0).UTC(),
+		},
+	} {
+		info, err := runtime.NewCommitInfo(c.opt)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if !info.Created.Equal(c.expected) {
+			t.Errorf("%s: expected %s, got %s", c.name, c.expected, info.Created)
+		}
+	}
+
+	info, err := runtime.NewCommitInfo(options.CommitOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(info.Created) > time.Minute {
+		t.Errorf("expected the current time without --reproducible, got %s", info.Created)
+	}
+}
+
+func TestNewCommitInfoSourceDateEpoch(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1600000000")
+	for _, opt := range []options.CommitOptions{{}, {Reproducible: true}} {
+		info, err := runtime.NewCommitInfo(opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := time.Unix(1600000000, 0).UTC(); !info.Created.Equal(expected) {
+			t.Errorf("reproducible %v: expected %s, got %s", opt.Reproducible, expected, info.Created)
+		}
+	}
+	// an explicit time wins over the environment
+	info, err := runtime.NewCommitInfo(options.CommitOptions{Created: "2024-01-02T03:04:05Z"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); !info.Created.Equal(expected) {
+		t.Errorf("expected %s, got %s", expected, info.Created)
+	}
+	t.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if _, err := runtime.NewCommitInfo(options.CommitOptions{}); err == nil {
+		t.Error("expected an invalid SOURCE_DATE_EPOCH to be rejected")
+	}
+}
+
+func TestNewCommitInfoZstdManifestFormat(t *testing.T) {
+	info, err := runtime.NewCommitInfo(options.CommitOptions{Compression: runtime.CompressionZstd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ManifestFormat != runtime.ManifestFormatOCI {
+		t.Errorf("expected zstd layers to write an OCI image, got %q", info.ManifestFormat)
+	}
+	_, err = runtime.NewCommitInfo(options.CommitOptions{Compression: runtime.CompressionZstdChunked, ManifestFormat: runtime.ManifestFormatDocker})
+	if !errdefs.IsInvalidArgument(err) {
+		t.Errorf("expected zstd layers in a Docker image to be rejected, got %v", err)
+	}
+	info, err = runtime.NewCommitInfo(options.CommitOptions{ManifestFormat: runtime.ManifestFormatDocker})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ManifestFormat != runtime.ManifestFormatDocker {
+		t.Errorf("expected gzip layers to keep the Docker format, got %q", info.ManifestFormat)
+	}
+}
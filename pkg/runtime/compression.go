@@ -0,0 +1,184 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/containerd/containerd/archive/compression"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/images/converter"
+	"github.com/containerd/containerd/labels"
+	"github.com/containerd/stargz-snapshotter/estargz"
+	estargzconvert "github.com/containerd/stargz-snapshotter/nativeconverter/estargz"
+	zstdchunkedconvert "github.com/containerd/stargz-snapshotter/nativeconverter/zstdchunked"
+	"github.com/lingdie/image-manip-server/pkg/util"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+	// CompressionZstdChunked is zstd with a table of contents, which allows lazy pulling
+	CompressionZstdChunked = "zstd:chunked"
+	// CompressionEstargz is gzip with a table of contents, which allows lazy pulling
+	CompressionEstargz = "estargz"
+)
+
+// parseCompression checks the compression of new layers, gzip if empty.
+func parseCompression(s string) (string, error) {
+	switch s {
+	case "":
+		return CompressionGzip, nil
+	case CompressionGzip, CompressionZstd, CompressionZstdChunked, CompressionEstargz:
+		return s, nil
+	default:
+		return "", fmt.Errorf("unknown compression %q, must be %q, %q, %q or %q: %w",
+			s, CompressionGzip, CompressionZstd, CompressionZstdChunked, CompressionEstargz, errdefs.ErrInvalidArgument)
+	}
+}
+
+// layerCompression returns the compression of the layer desc, empty if it is not compressed.
+func layerCompression(ctx context.Context, desc ocispec.Descriptor) (string, error) {
+	c, err := images.DiffCompression(ctx, desc.MediaType)
+	if err != nil {
+		return "", err
+	}
+	// the layers with a table of contents are told apart by their annotations
+	if _, ok := desc.Annotations[estargz.TOCJSONDigestAnnotation]; ok {
+		switch c {
+		case CompressionGzip:
+			return CompressionEstargz, nil
+		case CompressionZstd:
+			return CompressionZstdChunked, nil
+		}
+	}
+	return c, nil
+}
+
+// compressLayer returns layer compressed with c, or layer itself if it is already. gzip and zstd
+// keep the diffID of the layer, while estargz and zstd:chunked change it: they add their table of
+// contents to the tar. Non-distributable layers are left as they are, since their blob is not local.
+func (r *Runtime) compressLayer(ctx context.Context, layer Layer, c string) (Layer, error) {
+	if images.IsNonDistributable(layer.Desc.MediaType) {
+		return layer, nil
+	}
+	current, err := layerCompression(ctx, layer.Desc)
+	if err != nil {
+		return layer, err
+	}
+	if current == c {
+		return layer, nil
+	}
+	defer r.track(ctx, time.Now(), fmt.Sprintf("compressLayer %s", layer.Desc.Digest))
+	r.Infof("compress layer %s with %s", layer.Desc.Digest, c)
+	var convert converter.ConvertFunc
+	switch c {
+	case CompressionGzip:
+		return r.recompressLayer(ctx, layer, compression.Gzip, c)
+	case CompressionZstd:
+		return r.recompressLayer(ctx, layer, compression.Zstd, c)
+	case CompressionEstargz:
+		convert = estargzconvert.LayerConvertFunc()
+	case CompressionZstdChunked:
+		convert = zstdchunkedconvert.LayerConvertFunc()
+	default:
+		return layer, fmt.Errorf("unknown compression %q: %w", c, errdefs.ErrInvalidArgument)
+	}
+	newDesc, err := convert(ctx, r.contentstore, layer.Desc)
+	if err != nil {
+		return layer, fmt.Errorf("failed to convert layer %s to %s: %w", layer.Desc.Digest, c, err)
+	}
+	if newDesc == nil {
+		return layer, nil
+	}
+	info, err := r.contentstore.Info(ctx, newDesc.Digest)
+	if err != nil {
+		return layer, err
+	}
+	diffID, err := digest.Parse(info.Labels[labels.LabelUncompressed])
+	if err != nil {
+		return layer, fmt.Errorf("converted layer %s has no valid diffID: %w", newDesc.Digest, err)
+	}
+	return NewLayer(*newDesc, diffID), nil
+}
+
+// recompressLayer decompresses layer and compresses it again with c, named name. The tar is not
+// touched, so that the diffID does not change.
+func (r *Runtime) recompressLayer(ctx context.Context, layer Layer, c compression.Compression, name string) (Layer, error) {
+	ra, err := r.contentstore.ReaderAt(ctx, layer.Desc)
+	if err != nil {
+		return layer, err
+	}
+	defer ra.Close()
+	ds, err := compression.DecompressStream(content.NewReader(ra))
+	if err != nil {
+		return layer, err
+	}
+	defer ds.Close()
+	blob, err := os.CreateTemp("", "layer-blob-")
+	if err != nil {
+		return layer, err
+	}
+	defer os.Remove(blob.Name())
+	defer blob.Close()
+	blobDigester := digest.Canonical.Digester()
+	cw, err := compression.CompressStream(io.MultiWriter(blob, blobDigester.Hash()), c)
+	if err != nil {
+		return layer, err
+	}
+	if _, err := io.Copy(cw, ds); err != nil {
+		cw.Close()
+		return layer, fmt.Errorf("failed to read layer %s: %w", layer.Desc.Digest, err)
+	}
+	if err := cw.Close(); err != nil {
+		return layer, err
+	}
+	size, err := blob.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return layer, err
+	}
+	if _, err := blob.Seek(0, io.SeekStart); err != nil {
+		return layer, err
+	}
+	newDesc := ocispec.Descriptor{
+		MediaType: compressedMediaType(layer.Desc.MediaType, name),
+		Digest:    blobDigester.Digest(),
+		Size:      size,
+	}
+	if len(layer.Desc.Annotations) > 0 {
+		newDesc.Annotations = make(map[string]string, len(layer.Desc.Annotations))
+		for key, value := range layer.Desc.Annotations {
+			newDesc.Annotations[key] = value
+		}
+		// the table of contents of the original blob does not apply to the new one
+		delete(newDesc.Annotations, estargz.TOCJSONDigestAnnotation)
+		delete(newDesc.Annotations, estargz.StoreUncompressedSizeAnnotation)
+	}
+	labelOpt := content.WithLabels(map[string]string{
+		labels.LabelUncompressed: layer.DiffID.String(),
+	})
+	ref := fmt.Sprintf("recompress-%s", util.UniquePart())
+	if err := content.WriteBlob(ctx, r.contentstore, ref, blob, newDesc, labelOpt); err != nil {
+		return layer, fmt.Errorf("failed to write recompressed layer: %w", err)
+	}
+	r.Infof("layer %s recompressed to %s", layer.Desc.Digest, newDesc.Digest)
+	return NewLayer(newDesc, layer.DiffID), nil
+}
+
+// compressedMediaType returns the media type of a layer of the given media type compressed with c,
+// gzip or zstd. Docker has no zstd media type, zstd layers always have the OCI one.
+func compressedMediaType(mediaType string, c string) string {
+	if c == CompressionZstd {
+		return ocispec.MediaTypeImageLayerZstd
+	}
+	if images.IsDockerType(mediaType) {
+		return images.MediaTypeDockerSchema2LayerGzip
+	}
+	return ocispec.MediaTypeImageLayerGzip
+}
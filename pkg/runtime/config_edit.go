@@ -0,0 +1,350 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/platforms"
+	imagesutil "github.com/lingdie/image-manip-server/pkg/images"
+	"github.com/lingdie/image-manip-server/pkg/options"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// platformConfigEdit is the edition of the config of one platform of an image.
+type platformConfigEdit struct {
+	image imagesutil.Image
+	// layers are the layers of the manifest, they are all reused
+	layers  LayerChain
+	changes []ConfigChange
+	// written is nil in dry-run mode or if the config has not changed
+	written *WrittenImage
+}
+
+// EditConfig changes the config of an image according to opt, and writes a new config and manifest
+// reusing all the layers. The edits are recorded in an empty layer history entry. For a multi-platform
+// image, the config of each selected platform is edited, and a new index is written. In dry-run mode,
+// only the changes are reported.
+func (r *Runtime) EditConfig(ctx context.Context, opt options.ConfigOptions) (result ConfigResult, err error) {
+	result.ImageRef = opt.ImageRef
+	r.Infof("start to edit the config of image %q", opt.ImageRef)
+	defer r.record(ctx, &result.Timings, time.Now(), "config")
+	info, err := NewCommitInfo(opt.CommitOptions)
+	if err != nil {
+		return result, err
+	}
+	if !opt.DryRun {
+		unlock, err := r.LockImages(ctx, opt.ImageRef, opt.NewImageName)
+		if err != nil {
+			return result, err
+		}
+		defer unlock()
+	}
+	imageName, err := r.FindImage(ctx, opt.ImageRef)
+	if err != nil {
+		r.Errorf("failed to get original image %q: %v", opt.ImageRef, err)
+		return result, err
+	}
+	orig, err := r.imagestore.Get(ctx, imageName)
+	if err != nil {
+		r.Errorf("failed to get original image %q: %v", opt.ImageRef, err)
+		return result, err
+	}
+	manifests, index, err := r.selectManifests(ctx, orig, opt.PlatformOptions)
+	if err != nil {
+		return result, err
+	}
+	newImageName := opt.NewImageName
+	if newImageName == "" {
+		newImageName = orig.Name
+	}
+	var (
+		edited    []platformConfigEdit
+		replaced  = map[digest.Digest]ocispec.Descriptor{}
+		createdBy string
+	)
+	for _, manifestDesc := range manifests {
+		image, err := r.readImage(ctx, orig, manifestDesc)
+		if err != nil {
+			return result, err
+		}
+		p := platformConfigEdit{image: image}
+		var config ocispec.ImageConfig
+		config, p.changes, createdBy, err = ApplyConfigEdits(image.Config.Config, opt.Set, opt.Unset)
+		if err != nil {
+			return result, err
+		}
+		for _, c := range p.changes {
+			r.Infof("config field %s: %q -> %q", c.Field, c.From, c.To)
+		}
+		if !opt.DryRun && len(p.changes) > 0 {
+			p.layers, err = NewLayerChain(image.Manifest.Layers, image.Config.RootFS.DiffIDs)
+			if err != nil {
+				r.Errorf("failed to create layer chain for original image %q: %v", image.Image.Name, err)
+				return result, err
+			}
+			newConfig := image.Config
+			newConfig.Config = config
+			newHistory := []ocispec.History{{CreatedBy: createdBy, Author: info.Author, Comment: info.Comment, EmptyLayer: true}}
+			written, err := r.WriteBack(ctx, newConfig, p.layers, NewEmptyLayerChain(), newHistory, nil, image.Manifest.Annotations, info.forManifest(image.ManifestDesc.MediaType))
+			if err != nil {
+				if index != nil {
+					err = fmt.Errorf("platform %s: %w", platforms.Format(*manifestDesc.Platform), err)
+				}
+				r.Errorf("failed to write back image %q: %v", image.Image.Name, err)
+				return result, err
+			}
+			p.written = &written
+			replaced[manifestDesc.Digest] = written.Manifest
+		}
+		edited = append(edited, p)
+	}
+	if index == nil {
+		result.ConfigChanges = edited[0].changes
+	}
+	if opt.DryRun || len(replaced) == 0 {
+		if !opt.DryRun {
+			r.Warnf("the edits do not change the config of image %q, it is left unchanged", opt.ImageRef)
+		}
+		for _, p := range edited {
+			if index != nil {
+				result.Platforms = append(result.Platforms, PlatformResult{Platform: platforms.Format(*p.image.ManifestDesc.Platform), ConfigChanges: p.changes})
+			}
+		}
+		return result, nil
+	}
+	var target ocispec.Descriptor
+	if index == nil {
+		target = edited[0].written.Manifest
+	} else {
+		target, err = r.writeImageIndex(ctx, orig.Target, *index, replaced, info.ManifestFormat)
+		if err != nil {
+			r.Errorf("failed to write the index of image %q: %v", newImageName, err)
+			return result, err
+		}
+	}
+	img := images.Image{
+		Name:      newImageName,
+		Target:    target,
+		UpdatedAt: time.Now(),
+	}
+	img, err = r.CompareAndSwapImage(ctx, img, orig, "config "+strings.ReplaceAll(createdBy, "\n", "; "))
+	if err != nil {
+		r.Errorf("failed to update image %q: %v", newImageName, err)
+		return result, err
+	}
+	for _, p := range edited {
+		if p.written == nil {
+			continue
+		}
+		reportProgress(ctx, Progress{Step: "unpack", Message: newImageName})
+		manifestDesc := p.written.Manifest
+		manifestDesc.Platform = p.image.ManifestDesc.Platform
+		if err := r.UnpackImage(ctx, img, manifestDesc); err != nil {
+			r.Errorf("failed to unpack image %q: %v", newImageName, err)
+			return result, err
+		}
+	}
+	if index == nil {
+		result.ImageResult = newImageResult(newImageName, *edited[0].written, edited[0].layers)
+	} else {
+		result.ImageResult = ImageResult{NewImageName: newImageName, ManifestDigest: target.Digest}
+		for _, p := range edited {
+			platformResult := PlatformResult{
+				Platform:      platforms.Format(*p.image.ManifestDesc.Platform),
+				ConfigChanges: p.changes,
+			}
+			if p.written != nil {
+				platformResult.ImageResult = newImageResult(newImageName, *p.written, p.layers)
+			}
+			result.Platforms = append(result.Platforms, platformResult)
+		}
+	}
+	r.Infof("config of image %q edited successfully, new image: %q", opt.ImageRef, newImageName)
+	return result, nil
+}
+
+// ApplyConfigEdits returns a copy of config in which the fields and entries of unset are removed, then
+// the values of set are applied. It also returns the fields which changed, and the description of the
+// edits for the history of the image, one Dockerfile-like instruction per line.
+func ApplyConfigEdits(config ocispec.ImageConfig, set options.ConfigSet, unset []string) (ocispec.ImageConfig, []ConfigChange, string, error) {
+	edited := copyImageConfig(config)
+	var createdBy []string
+	for _, key := range unset {
+		field, entry, hasEntry := strings.Cut(key, ".")
+		if !isEditableField(field) {
+			return config, nil, "", fmt.Errorf("unknown config field %q, must be one of %s: %w", field, strings.Join(configFields, ", "), errdefs.ErrInvalidArgument)
+		}
+		switch {
+		case !hasEntry:
+			v := reflect.ValueOf(&edited).Elem().FieldByName(field)
+			v.Set(reflect.Zero(v.Type()))
+			if field == "Cmd" {
+				edited.ArgsEscaped = false
+			}
+		case field == "Env":
+			edited.Env = removeEnv(edited.Env, entry)
+		case field == "Labels":
+			delete(edited.Labels, entry)
+		case field == "ExposedPorts":
+			port, err := normalizePort(entry)
+			if err != nil {
+				return config, nil, "", err
+			}
+			delete(edited.ExposedPorts, port)
+		case field == "Volumes":
+			delete(edited.Volumes, entry)
+		default:
+			return config, nil, "", fmt.Errorf("config field %s has no entries, unset %q instead: %w", field, field, errdefs.ErrInvalidArgument)
+		}
+		createdBy = append(createdBy, "UNSET "+key)
+	}
+	if len(set.Env) > 0 {
+		for _, kv := range set.Env {
+			name, _, ok := strings.Cut(kv, "=")
+			if !ok || name == "" {
+				return config, nil, "", fmt.Errorf("invalid environment variable %q, expected NAME=VALUE: %w", kv, errdefs.ErrInvalidArgument)
+			}
+			edited.Env = append(removeEnv(edited.Env, name), kv)
+		}
+		createdBy = append(createdBy, "ENV "+strings.Join(set.Env, " "))
+	}
+	if len(set.Labels) > 0 {
+		if edited.Labels == nil {
+			edited.Labels = map[string]string{}
+		}
+		keys := make([]string, 0, len(set.Labels))
+		for k := range set.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		labels := make([]string, 0, len(keys))
+		for _, k := range keys {
+			edited.Labels[k] = set.Labels[k]
+			labels = append(labels, k+"="+strconv.Quote(set.Labels[k]))
+		}
+		createdBy = append(createdBy, "LABEL "+strings.Join(labels, " "))
+	}
+	if len(set.ExposedPorts) > 0 {
+		if edited.ExposedPorts == nil {
+			edited.ExposedPorts = map[string]struct{}{}
+		}
+		var ports []string
+		for _, p := range set.ExposedPorts {
+			port, err := normalizePort(p)
+			if err != nil {
+				return config, nil, "", err
+			}
+			edited.ExposedPorts[port] = struct{}{}
+			ports = append(ports, port)
+		}
+		createdBy = append(createdBy, "EXPOSE "+strings.Join(ports, " "))
+	}
+	if len(set.Volumes) > 0 {
+		if edited.Volumes == nil {
+			edited.Volumes = map[string]struct{}{}
+		}
+		for _, v := range set.Volumes {
+			if !path.IsAbs(v) {
+				return config, nil, "", fmt.Errorf("volume %q is not an absolute path: %w", v, errdefs.ErrInvalidArgument)
+			}
+			edited.Volumes[v] = struct{}{}
+		}
+		createdBy = append(createdBy, "VOLUME "+strings.Join(set.Volumes, " "))
+	}
+	if set.Entrypoint != nil {
+		edited.Entrypoint = append([]string{}, set.Entrypoint...)
+		createdBy = append(createdBy, "ENTRYPOINT "+jsonArray(set.Entrypoint))
+	}
+	if set.Cmd != nil {
+		edited.Cmd = append([]string{}, set.Cmd...)
+		edited.ArgsEscaped = false
+		createdBy = append(createdBy, "CMD "+jsonArray(set.Cmd))
+	}
+	if set.WorkingDir != "" {
+		if !path.IsAbs(set.WorkingDir) {
+			return config, nil, "", fmt.Errorf("working directory %q is not an absolute path: %w", set.WorkingDir, errdefs.ErrInvalidArgument)
+		}
+		edited.WorkingDir = set.WorkingDir
+		createdBy = append(createdBy, "WORKDIR "+set.WorkingDir)
+	}
+	if set.User != "" {
+		edited.User = set.User
+		createdBy = append(createdBy, "USER "+set.User)
+	}
+	if set.StopSignal != "" {
+		edited.StopSignal = set.StopSignal
+		createdBy = append(createdBy, "STOPSIGNAL "+set.StopSignal)
+	}
+	if len(createdBy) == 0 {
+		return config, nil, "", fmt.Errorf("no config field to set or unset: %w", errdefs.ErrInvalidArgument)
+	}
+	return edited, diffImageConfig(config, edited), strings.Join(createdBy, "\n"), nil
+}
+
+func isEditableField(field string) bool {
+	for _, f := range configFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// copyImageConfig copies the slices and maps of config, so that the copy can be edited.
+func copyImageConfig(config ocispec.ImageConfig) ocispec.ImageConfig {
+	c := config
+	c.Env = append([]string(nil), config.Env...)
+	c.Entrypoint = append([]string(nil), config.Entrypoint...)
+	c.Cmd = append([]string(nil), config.Cmd...)
+	c.ExposedPorts = mergeMap(config.ExposedPorts, nil)
+	c.Volumes = mergeMap(config.Volumes, nil)
+	c.Labels = mergeMap(config.Labels, nil)
+	return c
+}
+
+// removeEnv removes the variable name from env.
+func removeEnv(env []string, name string) []string {
+	var kept []string
+	for _, kv := range env {
+		if k, _, _ := strings.Cut(kv, "="); k != name {
+			kept = append(kept, kv)
+		}
+	}
+	return kept
+}
+
+// normalizePort checks a "PORT[/PROTOCOL]" port and adds the default tcp protocol.
+func normalizePort(s string) (string, error) {
+	port, proto, found := strings.Cut(s, "/")
+	if !found {
+		proto = "tcp"
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid port %q, expected PORT[/PROTOCOL]: %w", s, errdefs.ErrInvalidArgument)
+	}
+	switch proto = strings.ToLower(proto); proto {
+	case "tcp", "udp", "sctp":
+	default:
+		return "", fmt.Errorf("invalid protocol of port %q, must be tcp, udp or sctp: %w", s, errdefs.ErrInvalidArgument)
+	}
+	return strconv.Itoa(n) + "/" + proto, nil
+}
+
+func jsonArray(values []string) string {
+	b, err := json.Marshal(values)
+	if err != nil {
+		return strings.Join(values, " ")
+	}
+	return string(b)
+}
@@ -0,0 +1,82 @@
+package runtime_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lingdie/image-manip-server/pkg/options"
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestApplyConfigEdits(t *testing.T) {
+	config := ocispec.ImageConfig{
+		Env:          []string{"PATH=/usr/bin", "DEBUG=1"},
+		Cmd:          []string{"/bin/sh"},
+		Labels:       map[string]string{"maintainer": "base"},
+		ExposedPorts: map[string]struct{}{"80/tcp": {}},
+	}
+	for _, tc := range []struct {
+		name      string
+		set       options.ConfigSet
+		unset     []string
+		expected  ocispec.ImageConfig
+		createdBy string
+	}{
+		{
+			name: "set",
+			set: options.ConfigSet{
+				Env:          []string{"PATH=/app/bin:/usr/bin", "APP=1"},
+				Labels:       map[string]string{"team": "payments"},
+				ExposedPorts: []string{"8080"},
+				User:         "1000",
+			},
+			expected: ocispec.ImageConfig{
+				Env:          []string{"DEBUG=1", "PATH=/app/bin:/usr/bin", "APP=1"},
+				Cmd:          []string{"/bin/sh"},
+				Labels:       map[string]string{"maintainer": "base", "team": "payments"},
+				ExposedPorts: map[string]struct{}{"80/tcp": {}, "8080/tcp": {}},
+				User:         "1000",
+			},
+			createdBy: "ENV PATH=/app/bin:/usr/bin APP=1\nLABEL team=\"payments\"\nEXPOSE 8080/tcp\nUSER 1000",
+		},
+		{
+			name:  "unset",
+			unset: []string{"Cmd", "Env.DEBUG", "Labels.maintainer", "ExposedPorts.80"},
+			expected: ocispec.ImageConfig{
+				Env:          []string{"PATH=/usr/bin"},
+				Labels:       map[string]string{},
+				ExposedPorts: map[string]struct{}{},
+			},
+			createdBy: "UNSET Cmd\nUNSET Env.DEBUG\nUNSET Labels.maintainer\nUNSET ExposedPorts.80",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			edited, changes, createdBy, err := runtime.ApplyConfigEdits(config, tc.set, tc.unset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(edited, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, edited)
+			}
+			if createdBy != tc.createdBy {
+				t.Errorf("expected created by %q, got %q", tc.createdBy, createdBy)
+			}
+			if len(changes) == 0 {
+				t.Error("expected changes")
+			}
+		})
+	}
+	if config.Env[1] != "DEBUG=1" || len(config.Labels) != 1 {
+		t.Error("the original config has been modified")
+	}
+
+	for _, unset := range [][]string{{"Foo"}, {"User.name"}, {"ExposedPorts.http"}} {
+		if _, _, _, err := runtime.ApplyConfigEdits(config, options.ConfigSet{}, unset); err == nil {
+			t.Errorf("expected an error for %q", unset)
+		}
+	}
+	if _, _, _, err := runtime.ApplyConfigEdits(config, options.ConfigSet{}, nil); err == nil {
+		t.Error("expected an error without edits")
+	}
+}
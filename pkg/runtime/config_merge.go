@@ -0,0 +1,300 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/containerd/containerd/errdefs"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ConfigMergePolicy decides which image config wins when an application is rebased onto a new base image.
+type ConfigMergePolicy string
+
+const (
+	// ConfigMergeKeepApp keeps the value of the application image.
+	ConfigMergeKeepApp ConfigMergePolicy = "keep-app"
+	// ConfigMergeKeepBase keeps the value of the new base image.
+	ConfigMergeKeepBase ConfigMergePolicy = "keep-base"
+	// ConfigMergeMerge merges both values, the application image wins on conflicts.
+	// Maps and environment variables are merged by key, other fields are taken from
+	// the application image if they are set there.
+	// For a single environment variable (e.g. "Env.PATH"), the colon separated lists are
+	// concatenated, application entries first.
+	ConfigMergeMerge ConfigMergePolicy = "merge"
+)
+
+const DefaultConfigMergePolicy = ConfigMergeMerge
+
+// envFieldPrefix is the prefix of per variable policies, e.g. "Env.PATH"
+const envFieldPrefix = "Env."
+
+// configFields are the fields of ocispec.ImageConfig which can be merged
+var configFields = []string{"User", "ExposedPorts", "Env", "Entrypoint", "Cmd", "Volumes", "WorkingDir", "Labels", "StopSignal"}
+
+func ParseConfigMergePolicy(s string) (ConfigMergePolicy, error) {
+	switch p := ConfigMergePolicy(s); p {
+	case "":
+		return DefaultConfigMergePolicy, nil
+	case ConfigMergeKeepApp, ConfigMergeKeepBase, ConfigMergeMerge:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown config merge policy %q, must be one of %q, %q or %q: %w", s, ConfigMergeKeepApp, ConfigMergeKeepBase, ConfigMergeMerge, errdefs.ErrInvalidArgument)
+	}
+}
+
+// ConfigMerge describes how the config of an application image is merged into the config of a new base image.
+type ConfigMerge struct {
+	AppConfig ocispec.ImageConfig
+	Policy    ConfigMergePolicy
+	// FieldPolicies overrides Policy for a field (e.g. "Labels") or an environment variable (e.g. "Env.PATH")
+	FieldPolicies map[string]ConfigMergePolicy
+}
+
+// NewConfigMerge parses the policies given as strings in options.
+func NewConfigMerge(appConfig ocispec.ImageConfig, policy string, fieldPolicies map[string]string) (*ConfigMerge, error) {
+	p, err := ParseConfigMergePolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+	merge := &ConfigMerge{
+		AppConfig:     appConfig,
+		Policy:        p,
+		FieldPolicies: make(map[string]ConfigMergePolicy, len(fieldPolicies)),
+	}
+	for field, fp := range fieldPolicies {
+		if !isConfigField(field) {
+			return nil, fmt.Errorf("unknown config field %q, must be one of %s or %s<NAME>: %w", field, strings.Join(configFields, ", "), envFieldPrefix, errdefs.ErrInvalidArgument)
+		}
+		p, err := ParseConfigMergePolicy(fp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid policy for config field %q: %w", field, err)
+		}
+		merge.FieldPolicies[field] = p
+	}
+	return merge, nil
+}
+
+func isConfigField(field string) bool {
+	if strings.HasPrefix(field, envFieldPrefix) {
+		return len(field) > len(envFieldPrefix)
+	}
+	for _, f := range configFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *ConfigMerge) policy(field string) ConfigMergePolicy {
+	if p, ok := m.FieldPolicies[field]; ok {
+		return p
+	}
+	if strings.HasPrefix(field, envFieldPrefix) {
+		// a variable follows the policy of the whole environment unless overridden
+		return m.policy("Env")
+	}
+	return m.Policy
+}
+
+// ConfigChange is a config field whose value in the new image differs from the application image.
+type ConfigChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+func (c ConfigChange) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Field, c.From, c.To)
+}
+
+// Merge merges the application config into baseConfig and reports the fields which differ from the application config.
+func (m *ConfigMerge) Merge(baseConfig ocispec.ImageConfig) (ocispec.ImageConfig, []ConfigChange) {
+	app := m.AppConfig
+	merged := baseConfig
+	switch m.policy("User") {
+	case ConfigMergeKeepApp:
+		merged.User = app.User
+	case ConfigMergeMerge:
+		merged.User = mergeString(app.User, baseConfig.User)
+	}
+	switch m.policy("WorkingDir") {
+	case ConfigMergeKeepApp:
+		merged.WorkingDir = app.WorkingDir
+	case ConfigMergeMerge:
+		merged.WorkingDir = mergeString(app.WorkingDir, baseConfig.WorkingDir)
+	}
+	switch m.policy("StopSignal") {
+	case ConfigMergeKeepApp:
+		merged.StopSignal = app.StopSignal
+	case ConfigMergeMerge:
+		merged.StopSignal = mergeString(app.StopSignal, baseConfig.StopSignal)
+	}
+	switch m.policy("Entrypoint") {
+	case ConfigMergeKeepApp:
+		merged.Entrypoint = app.Entrypoint
+	case ConfigMergeMerge:
+		if len(app.Entrypoint) > 0 {
+			merged.Entrypoint = app.Entrypoint
+		}
+	}
+	switch m.policy("Cmd") {
+	case ConfigMergeKeepApp:
+		merged.Cmd = app.Cmd
+		merged.ArgsEscaped = app.ArgsEscaped
+	case ConfigMergeMerge:
+		// like Dockerfile, setting an entrypoint resets the cmd of the base image
+		if len(app.Cmd) > 0 || len(app.Entrypoint) > 0 {
+			merged.Cmd = app.Cmd
+			merged.ArgsEscaped = app.ArgsEscaped
+		}
+	}
+	switch m.policy("ExposedPorts") {
+	case ConfigMergeKeepApp:
+		merged.ExposedPorts = app.ExposedPorts
+	case ConfigMergeMerge:
+		merged.ExposedPorts = mergeMap(app.ExposedPorts, baseConfig.ExposedPorts)
+	}
+	switch m.policy("Volumes") {
+	case ConfigMergeKeepApp:
+		merged.Volumes = app.Volumes
+	case ConfigMergeMerge:
+		merged.Volumes = mergeMap(app.Volumes, baseConfig.Volumes)
+	}
+	switch m.policy("Labels") {
+	case ConfigMergeKeepApp:
+		merged.Labels = app.Labels
+	case ConfigMergeMerge:
+		merged.Labels = mergeMap(app.Labels, baseConfig.Labels)
+	}
+	merged.Env = m.mergeEnv(app.Env, baseConfig.Env)
+	return merged, diffImageConfig(app, merged)
+}
+
+func mergeString(app, base string) string {
+	if app != "" {
+		return app
+	}
+	return base
+}
+
+func mergeMap[V any](app, base map[string]V) map[string]V {
+	if len(app) == 0 && len(base) == 0 {
+		return nil
+	}
+	merged := make(map[string]V, len(app)+len(base))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range app {
+		merged[k] = v
+	}
+	return merged
+}
+
+// mergeEnv merges the environment variables by name, keeping the order of the base image
+// and appending the variables which are only set in the application image.
+func (m *ConfigMerge) mergeEnv(app, base []string) []string {
+	appValues := make(map[string]string, len(app))
+	for _, kv := range app {
+		k, v, _ := strings.Cut(kv, "=")
+		appValues[k] = v
+	}
+	baseValues := make(map[string]string, len(base))
+	var names []string
+	seen := map[string]bool{}
+	for _, kv := range base {
+		k, v, _ := strings.Cut(kv, "=")
+		if !seen[k] {
+			seen[k] = true
+			names = append(names, k)
+		}
+		baseValues[k] = v
+	}
+	for _, kv := range app {
+		k, _, _ := strings.Cut(kv, "=")
+		if !seen[k] {
+			seen[k] = true
+			names = append(names, k)
+		}
+	}
+	var merged []string
+	for _, name := range names {
+		appValue, inApp := appValues[name]
+		baseValue, inBase := baseValues[name]
+		var (
+			value string
+			keep  bool
+		)
+		switch m.policy(envFieldPrefix + name) {
+		case ConfigMergeKeepBase:
+			value, keep = baseValue, inBase
+		case ConfigMergeKeepApp:
+			value, keep = appValue, inApp
+		case ConfigMergeMerge:
+			switch {
+			case inApp && inBase && m.FieldPolicies[envFieldPrefix+name] == ConfigMergeMerge:
+				// an explicit merge of a single variable concatenates the lists
+				value, keep = mergeList(appValue, baseValue), true
+			case inApp:
+				value, keep = appValue, true
+			default:
+				value, keep = baseValue, true
+			}
+		}
+		if keep {
+			merged = append(merged, name+"="+value)
+		}
+	}
+	return merged
+}
+
+// mergeList concatenates two colon separated lists, removing duplicated entries.
+func mergeList(app, base string) string {
+	seen := map[string]bool{}
+	var entries []string
+	for _, e := range append(strings.Split(app, ":"), strings.Split(base, ":")...) {
+		if e == "" || seen[e] {
+			continue
+		}
+		seen[e] = true
+		entries = append(entries, e)
+	}
+	return strings.Join(entries, ":")
+}
+
+func diffImageConfig(from, to ocispec.ImageConfig) []ConfigChange {
+	var changes []ConfigChange
+	fromValue := reflect.ValueOf(from)
+	toValue := reflect.ValueOf(to)
+	for _, field := range configFields {
+		f := configValueString(fromValue.FieldByName(field).Interface())
+		t := configValueString(toValue.FieldByName(field).Interface())
+		if f != t {
+			changes = append(changes, ConfigChange{Field: field, From: f, To: t})
+		}
+	}
+	return changes
+}
+
+// configValueString formats a config value for reports, empty values are formatted as "".
+func configValueString(v interface{}) string {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String:
+		if rv.Len() == 0 {
+			return ""
+		}
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,92 @@
+package runtime_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestConfigMerge(t *testing.T) {
+	app := ocispec.ImageConfig{
+		Env:        []string{"PATH=/app/bin:/usr/bin", "APP=1"},
+		Entrypoint: []string{"/app/bin/server"},
+		Labels:     map[string]string{"app": "demo", "maintainer": "app"},
+	}
+	base := ocispec.ImageConfig{
+		Env:    []string{"PATH=/usr/local/bin:/usr/bin", "LANG=C.UTF-8"},
+		Cmd:    []string{"/bin/sh"},
+		Labels: map[string]string{"maintainer": "base"},
+		User:   "nobody",
+	}
+	for _, tc := range []struct {
+		name          string
+		policy        string
+		fieldPolicies map[string]string
+		expected      ocispec.ImageConfig
+	}{
+		{
+			name:   "merge",
+			policy: "merge",
+			fieldPolicies: map[string]string{
+				"Env.PATH": "merge",
+			},
+			expected: ocispec.ImageConfig{
+				Env:        []string{"PATH=/app/bin:/usr/bin:/usr/local/bin", "LANG=C.UTF-8", "APP=1"},
+				Entrypoint: []string{"/app/bin/server"},
+				Labels:     map[string]string{"app": "demo", "maintainer": "app"},
+				User:       "nobody",
+			},
+		},
+		{
+			name:     "keep-app",
+			policy:   "keep-app",
+			expected: app,
+		},
+		{
+			name:   "keep-base with overrides",
+			policy: "keep-base",
+			fieldPolicies: map[string]string{
+				"Entrypoint": "keep-app",
+				"Cmd":        "keep-app",
+				"Env.APP":    "keep-app",
+			},
+			expected: ocispec.ImageConfig{
+				Env:        []string{"PATH=/usr/local/bin:/usr/bin", "LANG=C.UTF-8", "APP=1"},
+				Entrypoint: []string{"/app/bin/server"},
+				Labels:     map[string]string{"maintainer": "base"},
+				User:       "nobody",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			merge, err := runtime.NewConfigMerge(app, tc.policy, tc.fieldPolicies)
+			if err != nil {
+				t.Fatal(err)
+			}
+			merged, _ := merge.Merge(base)
+			if !reflect.DeepEqual(merged, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, merged)
+			}
+		})
+	}
+
+	for _, tc := range []struct {
+		name          string
+		policy        string
+		fieldPolicies map[string]string
+	}{
+		{name: "unknown policy", policy: "keep-all"},
+		{name: "unknown field", policy: "merge", fieldPolicies: map[string]string{"Foo": "merge"}},
+		{name: "unknown field policy", policy: "merge", fieldPolicies: map[string]string{"Cmd": "keep-all"}},
+	} {
+		if _, err := runtime.NewConfigMerge(app, tc.policy, tc.fieldPolicies); !errdefs.IsInvalidArgument(err) {
+			t.Errorf("%s: expected an invalid argument, got %v", tc.name, err)
+		}
+	}
+	if _, err := runtime.ParseConfigMergePolicy("keep-all"); !errdefs.IsInvalidArgument(err) {
+		t.Errorf("expected an invalid argument for an unknown policy, got %v", err)
+	}
+}
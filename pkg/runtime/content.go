@@ -7,57 +7,53 @@ import (
 	"fmt"
 
 	"github.com/containerd/containerd/content"
-	"github.com/containerd/containerd/images"
 	"github.com/opencontainers/go-digest"
 	"github.com/opencontainers/image-spec/identity"
 	"github.com/opencontainers/image-spec/specs-go"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
-// WriteImageMetadata writes the image config and manifest to the content store and returns the manifest descriptor.
-func (r *Runtime) writeImageMetadata(ctx context.Context, config ocispec.Image, layers []ocispec.Descriptor) (ocispec.Descriptor, error) {
+// WriteImageMetadata writes the image config and manifest to the content store and returns the manifest and config descriptors.
+// The manifest and the config are written in the given format, the manifest with the given annotations.
+func (r *Runtime) writeImageMetadata(ctx context.Context, config ocispec.Image, layers []ocispec.Descriptor, annotations map[string]string, format string) (ocispec.Descriptor, ocispec.Descriptor, error) {
 	// write image contents to content store
-	configDesc, err := r.writeImageConfig(ctx, config)
+	configDesc, err := r.writeImageConfig(ctx, config, format)
 	if err != nil {
-		return ocispec.Descriptor{}, err
+		return ocispec.Descriptor{}, ocispec.Descriptor{}, err
 	}
-	manifestDesc, err := r.writeImageManifest(ctx, configDesc, layers)
+	manifestDesc, err := r.writeImageManifest(ctx, configDesc, layers, annotations, format)
 	if err != nil {
-		return ocispec.Descriptor{}, err
+		return ocispec.Descriptor{}, ocispec.Descriptor{}, err
 	}
-	return manifestDesc, nil
+	return manifestDesc, configDesc, nil
 }
 
-func createImageManifest(manifestJSON []byte) ocispec.Descriptor {
+func createImageManifest(manifestJSON []byte, mediaType string) ocispec.Descriptor {
 	manifestDesc := ocispec.Descriptor{
-		MediaType: images.MediaTypeDockerSchema2Manifest,
+		MediaType: mediaType,
 		Digest:    digest.FromBytes(manifestJSON),
 		Size:      int64(len(manifestJSON)),
 	}
 	return manifestDesc
 }
 
-func (r *Runtime) writeImageManifest(ctx context.Context, configDesc ocispec.Descriptor, layers []ocispec.Descriptor) (ocispec.Descriptor, error) {
-	manifest := struct {
-		MediaType string `json:"mediaType,omitempty"`
-		ocispec.Manifest
-	}{
-		MediaType: images.MediaTypeDockerSchema2Manifest,
-		Manifest: ocispec.Manifest{
-			Versioned: specs.Versioned{
-				SchemaVersion: 2,
-			},
-			Config: configDesc,
-			Layers: layers,
+func (r *Runtime) writeImageManifest(ctx context.Context, configDesc ocispec.Descriptor, layers []ocispec.Descriptor, annotations map[string]string, format string) (ocispec.Descriptor, error) {
+	manifest := ocispec.Manifest{
+		Versioned: specs.Versioned{
+			SchemaVersion: 2,
 		},
+		MediaType:   manifestMediaType(format),
+		Config:      configDesc,
+		Layers:      layers,
+		Annotations: annotations,
 	}
 
-	manifestJSON, err := json.MarshalIndent(manifest, "", "    ")
+	manifestJSON, err := json.Marshal(manifest)
 	if err != nil {
 		return ocispec.Descriptor{}, err
 	}
 
-	manifestDesc := createImageManifest(manifestJSON)
+	manifestDesc := createImageManifest(manifestJSON, manifest.MediaType)
 
 	// new manifest should reference the layers and config content
 	labels := map[string]string{
@@ -74,23 +70,23 @@ func (r *Runtime) writeImageManifest(ctx context.Context, configDesc ocispec.Des
 	return manifestDesc, nil
 }
 
-func createImageConfig(configJSON []byte) ocispec.Descriptor {
+func createImageConfig(configJSON []byte, mediaType string) ocispec.Descriptor {
 	configDesc := ocispec.Descriptor{
-		MediaType: images.MediaTypeDockerSchema2Config,
+		MediaType: mediaType,
 		Digest:    digest.FromBytes(configJSON),
 		Size:      int64(len(configJSON)),
 	}
 	return configDesc
 }
 
-func (r *Runtime) writeImageConfig(ctx context.Context, config ocispec.Image) (ocispec.Descriptor, error) {
+func (r *Runtime) writeImageConfig(ctx context.Context, config ocispec.Image, format string) (ocispec.Descriptor, error) {
 	// marshal config to JSON
 	configJSON, err := json.Marshal(config)
 	if err != nil {
 		return ocispec.Descriptor{}, err
 	}
 	// create config descriptor
-	configDesc := createImageConfig(configJSON)
+	configDesc := createImageConfig(configJSON, configMediaType(format))
 	snapshot := identity.ChainID(config.RootFS.DiffIDs).String()
 	// there should be a reference from image to snapshot in the config
 	labelOpt := content.WithLabels(map[string]string{
@@ -102,25 +98,43 @@ func (r *Runtime) writeImageConfig(ctx context.Context, config ocispec.Image) (o
 	return configDesc, nil
 }
 
-func (r *Runtime) WriteBack(ctx context.Context, origConfig ocispec.Image, firstLayerIndexToRebase int, baseLayers LayerChain, newLayers LayerChain) (ocispec.Descriptor, error) {
+// WrittenImage is an image whose manifest and config have been written to the content store.
+type WrittenImage struct {
+	Manifest ocispec.Descriptor
+	Config   ocispec.Descriptor
+	// Layers is the full layer chain of the image
+	Layers LayerChain
+}
+
+// WriteBack writes the manifest and the config of an image made of baseLayers and newLayers. The manifest
+// is written in the format of info, which must be set, and the media types of the layers follow it.
+func (r *Runtime) WriteBack(ctx context.Context, origConfig ocispec.Image, baseLayers LayerChain, newLayers LayerChain, newHistory []ocispec.History, merge *ConfigMerge, annotations map[string]string, info CommitInfo) (WrittenImage, error) {
 	// generate image config
-	imageConfig, err := r.GenerateMergedImageConfig(ctx, origConfig, firstLayerIndexToRebase, baseLayers, newLayers)
+	imageConfig, err := r.GenerateMergedImageConfig(ctx, origConfig, baseLayers, newLayers, newHistory, merge, info)
 	if err != nil {
 		r.Errorf("failed to generate new image config: %v", err)
-		return ocispec.Descriptor{}, err
+		return WrittenImage{}, err
 	}
 	allLayers, err := NewLayerChain(
 		baseLayers.Descriptors,
 		baseLayers.DiffIDs,
 	)
 	if err != nil {
-		return ocispec.Descriptor{}, err
+		return WrittenImage{}, err
 	}
 	allLayers.AppendLayers(newLayers)
+	// the layers of a base image may be in another format than the image
+	for i := range allLayers.Descriptors {
+		allLayers.Descriptors[i].MediaType = layerMediaType(info.ManifestFormat, allLayers.Descriptors[i].MediaType)
+	}
 	// write image metadata
-	manifestDesc, err := r.writeImageMetadata(ctx, imageConfig, allLayers.Descriptors)
+	manifestDesc, configDesc, err := r.writeImageMetadata(ctx, imageConfig, allLayers.Descriptors, annotations, info.ManifestFormat)
 	if err != nil {
-		return ocispec.Descriptor{}, err
+		return WrittenImage{}, err
 	}
-	return manifestDesc, nil
+	return WrittenImage{
+		Manifest: manifestDesc,
+		Config:   configDesc,
+		Layers:   allLayers,
+	}, nil
 }
@@ -0,0 +1,175 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/platforms"
+	imagesutil "github.com/lingdie/image-manip-server/pkg/images"
+	"github.com/lingdie/image-manip-server/pkg/options"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// platformWrite is the manifest of one platform of an image, written again by an operation
+// which does not depend on its content, like a conversion.
+type platformWrite struct {
+	image imagesutil.Image
+	// layers are the layers of the original manifest
+	layers  LayerChain
+	written WrittenImage
+}
+
+// Convert recompresses every layer of an image with opt.Compression, and rewrites its manifest and
+// config accordingly. The layers already compressed that way are kept. For a multi-platform image,
+// the selected platforms are converted and a new index is written.
+func (r *Runtime) Convert(ctx context.Context, opt options.ConvertOptions) (result ConvertResult, err error) {
+	r.Infof("start to convert image %q to %s", opt.ImageRef, opt.Compression)
+	defer r.record(ctx, &result.Timings, time.Now(), "convert")
+	result.ImageRef = opt.ImageRef
+	if opt.Compression == "" {
+		return result, fmt.Errorf("compression must be specified: %w", errdefs.ErrInvalidArgument)
+	}
+	var info CommitInfo
+	info.Compression, err = parseCompression(opt.Compression)
+	if err != nil {
+		return result, err
+	}
+	info.ManifestFormat, err = parseManifestFormat(opt.ManifestFormat)
+	if err != nil {
+		return result, err
+	}
+	info.ManifestFormat, err = manifestFormatFor(info.ManifestFormat, info.Compression)
+	if err != nil {
+		return result, err
+	}
+	result.Compression = info.Compression
+	unlock, err := r.LockImages(ctx, opt.ImageRef, opt.NewImageName)
+	if err != nil {
+		return result, err
+	}
+	defer unlock()
+	imageName, err := r.FindImage(ctx, opt.ImageRef)
+	if err != nil {
+		r.Errorf("failed to get original image %q: %v", opt.ImageRef, err)
+		return result, err
+	}
+	orig, err := r.imagestore.Get(ctx, imageName)
+	if err != nil {
+		r.Errorf("failed to get original image %q: %v", opt.ImageRef, err)
+		return result, err
+	}
+	manifests, index, err := r.selectManifests(ctx, orig, opt.PlatformOptions)
+	if err != nil {
+		return result, err
+	}
+	newImageName := opt.NewImageName
+	if newImageName == "" {
+		newImageName = orig.Name
+	}
+	var (
+		converted []platformWrite
+		replaced  = map[digest.Digest]ocispec.Descriptor{}
+	)
+	for _, manifestDesc := range manifests {
+		image, err := r.readImage(ctx, orig, manifestDesc)
+		if err != nil {
+			return result, err
+		}
+		p, err := r.convertPlatform(ctx, image, info)
+		if err != nil {
+			if index != nil {
+				err = fmt.Errorf("platform %s: %w", platforms.Format(*manifestDesc.Platform), err)
+			}
+			return result, err
+		}
+		if p.written.Manifest.Digest != manifestDesc.Digest {
+			replaced[manifestDesc.Digest] = p.written.Manifest
+		}
+		converted = append(converted, p)
+	}
+	target := converted[0].written.Manifest
+	if index != nil {
+		target, err = r.writeImageIndex(ctx, orig.Target, *index, replaced, info.ManifestFormat)
+		if err != nil {
+			r.Errorf("failed to write the index of image %q: %v", newImageName, err)
+			return result, err
+		}
+	}
+	img := images.Image{
+		Name:      newImageName,
+		Target:    target,
+		UpdatedAt: time.Now(),
+	}
+	img, err = r.CompareAndSwapImage(ctx, img, orig, "convert "+info.Compression)
+	if err != nil {
+		r.Errorf("failed to update image %q: %v", newImageName, err)
+		return result, err
+	}
+	for _, p := range converted {
+		reportProgress(ctx, Progress{Step: "unpack", Message: newImageName})
+		manifestDesc := p.written.Manifest
+		manifestDesc.Platform = p.image.ManifestDesc.Platform
+		if err := r.UnpackImage(ctx, img, manifestDesc); err != nil {
+			r.Errorf("failed to unpack image %q: %v", newImageName, err)
+			return result, err
+		}
+	}
+	if index == nil {
+		result.ImageResult = newImageResult(newImageName, converted[0].written, converted[0].layers)
+	} else {
+		result.ImageResult = ImageResult{NewImageName: newImageName, ManifestDigest: target.Digest}
+		for _, p := range converted {
+			result.Platforms = append(result.Platforms, PlatformResult{
+				Platform:    platforms.Format(*p.image.ManifestDesc.Platform),
+				ImageResult: newImageResult(newImageName, p.written, p.layers),
+			})
+		}
+	}
+	r.Infof("image %q converted to %s successfully, new image: %q", opt.ImageRef, info.Compression, newImageName)
+	return result, nil
+}
+
+// convertPlatform recompresses the layers of image, the manifest of one platform of the image, and
+// writes the new manifest without updating the image store. The diffIDs of the config follow the layers,
+// for the compressions adding a table of contents.
+func (r *Runtime) convertPlatform(ctx context.Context, image imagesutil.Image, info CommitInfo) (platformWrite, error) {
+	p := platformWrite{image: image}
+	info = info.forManifest(image.ManifestDesc.MediaType)
+	layers, err := NewLayerChain(image.Manifest.Layers, image.Config.RootFS.DiffIDs)
+	if err != nil {
+		r.Errorf("failed to create layer chain for original image %q: %v", image.Image.Name, err)
+		return p, err
+	}
+	p.layers = layers
+	newLayers := NewEmptyLayerChain()
+	for i := 0; i < layers.Len(); i++ {
+		layer, err := layers.GetLayerByIndex(i)
+		if err != nil {
+			return p, err
+		}
+		reportProgress(ctx, Progress{Step: "compressLayer", Message: layer.Desc.Digest.String(), Current: i + 1, Total: layers.Len()})
+		layer, err = r.compressLayer(ctx, layer, info.Compression)
+		if err != nil {
+			return p, err
+		}
+		layer.Desc.MediaType = layerMediaType(info.ManifestFormat, layer.Desc.MediaType)
+		newLayers.AppendLayer(layer)
+	}
+	config := image.Config
+	config.RootFS.DiffIDs = newLayers.DiffIDs
+	manifestDesc, configDesc, err := r.writeImageMetadata(ctx, config, newLayers.Descriptors, image.Manifest.Annotations, info.ManifestFormat)
+	if err != nil {
+		r.Errorf("failed to write image %q: %v", image.Image.Name, err)
+		return p, err
+	}
+	p.written = WrittenImage{
+		Manifest: manifestDesc,
+		Config:   configDesc,
+		Layers:   newLayers,
+	}
+	return p, nil
+}
@@ -0,0 +1,287 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/cio"
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/oci"
+	"github.com/containerd/platforms"
+	imagesutil "github.com/lingdie/image-manip-server/pkg/images"
+	"github.com/lingdie/image-manip-server/pkg/options"
+	"github.com/lingdie/image-manip-server/pkg/util"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/identity"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+type outputKey struct{}
+
+// commandOutput is where the commands run by Exec write their output.
+type commandOutput struct {
+	stdout, stderr io.Writer
+}
+
+// WithOutput returns a context in which the commands run by Exec write their output to stdout and
+// stderr. Without it, the output is discarded.
+func WithOutput(ctx context.Context, stdout, stderr io.Writer) context.Context {
+	return context.WithValue(ctx, outputKey{}, commandOutput{stdout: stdout, stderr: stderr})
+}
+
+func outputOf(ctx context.Context) commandOutput {
+	out, _ := ctx.Value(outputKey{}).(commandOutput)
+	if out.stdout == nil {
+		out.stdout = io.Discard
+	}
+	if out.stderr == nil {
+		out.stderr = io.Discard
+	}
+	return out
+}
+
+// Exec runs a command in the root filesystem of an image, like the RUN instruction of a Dockerfile,
+// and adds the changes it made as a new layer. The command runs in a container of its own, without
+// network, with the environment, working directory and user of the image unless opt overrides them.
+// For a multi-platform image, the command runs in each selected platform, which must be runnable
+// on the host, and a new index is written.
+func (r *Runtime) Exec(ctx context.Context, opt options.ExecOptions) (result ExecResult, err error) {
+	result.ImageRef = opt.ImageRef
+	result.Command = opt.Command
+	r.Infof("start to run %q in image %q", opt.Command, opt.ImageRef)
+	defer r.record(ctx, &result.Timings, time.Now(), "exec")
+	if len(opt.Command) == 0 {
+		return result, fmt.Errorf("no command to run: %w", errdefs.ErrInvalidArgument)
+	}
+	info, err := NewCommitInfo(opt.CommitOptions)
+	if err != nil {
+		return result, err
+	}
+	unlock, err := r.LockImages(ctx, opt.ImageRef, opt.NewImageName)
+	if err != nil {
+		return result, err
+	}
+	defer unlock()
+	imageName, err := r.FindImage(ctx, opt.ImageRef)
+	if err != nil {
+		r.Errorf("failed to get original image %q: %v", opt.ImageRef, err)
+		return result, err
+	}
+	orig, err := r.imagestore.Get(ctx, imageName)
+	if err != nil {
+		r.Errorf("failed to get original image %q: %v", opt.ImageRef, err)
+		return result, err
+	}
+	manifests, index, err := r.selectManifests(ctx, orig, opt.PlatformOptions)
+	if err != nil {
+		return result, err
+	}
+	newImageName := opt.NewImageName
+	if newImageName == "" {
+		newImageName = orig.Name
+	}
+	var (
+		executed []platformWrite
+		replaced = map[digest.Digest]ocispec.Descriptor{}
+	)
+	for _, manifestDesc := range manifests {
+		image, err := r.readImage(ctx, orig, manifestDesc)
+		if err != nil {
+			return result, err
+		}
+		p, err := r.execPlatform(ctx, image, opt, info)
+		if err != nil {
+			if index != nil {
+				err = fmt.Errorf("platform %s: %w", platforms.Format(*manifestDesc.Platform), err)
+			}
+			return result, err
+		}
+		replaced[manifestDesc.Digest] = p.written.Manifest
+		executed = append(executed, p)
+	}
+	target := executed[0].written.Manifest
+	if index != nil {
+		target, err = r.writeImageIndex(ctx, orig.Target, *index, replaced, info.ManifestFormat)
+		if err != nil {
+			r.Errorf("failed to write the index of image %q: %v", newImageName, err)
+			return result, err
+		}
+	}
+	img := images.Image{
+		Name:      newImageName,
+		Target:    target,
+		UpdatedAt: time.Now(),
+	}
+	img, err = r.CompareAndSwapImage(ctx, img, orig, "exec "+strings.Join(opt.Command, " "))
+	if err != nil {
+		r.Errorf("failed to update image %q: %v", newImageName, err)
+		return result, err
+	}
+	for _, p := range executed {
+		reportProgress(ctx, Progress{Step: "unpack", Message: newImageName})
+		manifestDesc := p.written.Manifest
+		manifestDesc.Platform = p.image.ManifestDesc.Platform
+		if err := r.UnpackImage(ctx, img, manifestDesc); err != nil {
+			r.Errorf("failed to unpack image %q: %v", newImageName, err)
+			return result, err
+		}
+	}
+	if index == nil {
+		result.ImageResult = newImageResult(newImageName, executed[0].written, executed[0].layers)
+	} else {
+		result.ImageResult = ImageResult{NewImageName: newImageName, ManifestDigest: target.Digest}
+		for _, p := range executed {
+			result.Platforms = append(result.Platforms, PlatformResult{
+				Platform:    platforms.Format(*p.image.ManifestDesc.Platform),
+				ImageResult: newImageResult(newImageName, p.written, p.layers),
+			})
+		}
+	}
+	r.Infof("%q run in image %q successfully, new image: %q", opt.Command, opt.ImageRef, newImageName)
+	return result, nil
+}
+
+// execPlatform runs the command of opt on a snapshot of image, the manifest of one platform of the
+// image, and writes the new manifest with the diff of the snapshot as a new layer, without updating
+// the image store.
+func (r *Runtime) execPlatform(ctx context.Context, image imagesutil.Image, opt options.ExecOptions, info CommitInfo) (platformWrite, error) {
+	p := platformWrite{image: image}
+	info = info.forManifest(image.ManifestDesc.MediaType)
+	layers, err := NewLayerChain(image.Manifest.Layers, image.Config.RootFS.DiffIDs)
+	if err != nil {
+		r.Errorf("failed to create layer chain for original image %q: %v", image.Image.Name, err)
+		return p, err
+	}
+	p.layers = layers
+	// the snapshots of the platforms other than the default one are usually not unpacked
+	if err := r.prepareParent(ctx, layers); err != nil {
+		r.Errorf("failed to prepare the rootfs of image %q: %v", image.Image.Name, err)
+		return p, err
+	}
+	layer, err := r.execLayer(ctx, image.Config.RootFS.DiffIDs, info, func(key string) error {
+		return r.runCommand(ctx, image, key, opt)
+	})
+	if err != nil {
+		return p, err
+	}
+	newHistory := []ocispec.History{{CreatedBy: "RUN " + jsonArray(opt.Command), Author: info.Author, Comment: info.Comment}}
+	p.written, err = r.WriteBack(ctx, image.Config, layers, NewLayerChainFromLayer(layer), newHistory, nil, image.Manifest.Annotations, info)
+	if err != nil {
+		r.Errorf("failed to write back image %q: %v", image.Image.Name, err)
+		return p, err
+	}
+	return p, nil
+}
+
+// execLayer runs run on a new active snapshot on top of the layers parentDiffIDs, and returns the diff
+// of the snapshot as a new layer. The snapshot is committed only if run succeeds, it is removed otherwise.
+func (r *Runtime) execLayer(ctx context.Context, parentDiffIDs []digest.Digest, info CommitInfo, run func(key string) error) (Layer, error) {
+	var (
+		key    = fmt.Sprintf("exec-%s", util.UniquePart())
+		parent = identity.ChainID(parentDiffIDs)
+	)
+	if _, err := r.snapshotter.Prepare(ctx, key, parent.String()); err != nil {
+		r.Errorf("failed to prepare snapshot %q: %v", key, err)
+		return Layer{}, err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			r.snapshotter.Remove(ctx, key)
+		}
+	}()
+	if err := run(key); err != nil {
+		return Layer{}, err
+	}
+	layer, err := r.createDiff(ctx, key, info)
+	if err != nil {
+		r.Errorf("failed to create diff for snapshot %q: %v", key, err)
+		return Layer{}, err
+	}
+	child := identity.ChainID(append(parentDiffIDs, layer.DiffID)).String()
+	if err := r.snapshotter.Commit(ctx, child, key); err != nil && !errdefs.IsAlreadyExists(err) {
+		r.Errorf("failed to commit snapshot %q: %v", child, err)
+		return Layer{}, err
+	}
+	committed = true
+	return layer, nil
+}
+
+// execSpecOpts returns the options of the spec of the container running the command of opt: the
+// environment, working directory and user come from the config of image, unless opt overrides them.
+func execSpecOpts(image oci.Image, opt options.ExecOptions) []oci.SpecOpts {
+	specOpts := []oci.SpecOpts{oci.WithImageConfig(image)}
+	if len(opt.Env) > 0 {
+		specOpts = append(specOpts, oci.WithEnv(opt.Env))
+	}
+	if opt.WorkingDir != "" {
+		specOpts = append(specOpts, oci.WithProcessCwd(opt.WorkingDir))
+	}
+	if opt.User != "" {
+		// the additional groups are those of the user rather than those of the user of the image,
+		// looked up by UID as oci.WithImageConfig does
+		specOpts = append(specOpts, oci.WithUser(opt.User), func(ctx context.Context, client oci.Client, c *containers.Container, s *oci.Spec) error {
+			return oci.WithAdditionalGIDs(strconv.FormatUint(uint64(s.Process.User.UID), 10))(ctx, client, c, s)
+		})
+	}
+	return append(specOpts, oci.WithProcessArgs(opt.Command...))
+}
+
+// runCommand runs the command of opt in a container whose rootfs is the active snapshot key, and
+// waits for it. The container has its own network namespace, with only a loopback interface.
+// A command exiting with a non-zero status is an error.
+func (r *Runtime) runCommand(ctx context.Context, image imagesutil.Image, key string, opt options.ExecOptions) error {
+	defer r.track(ctx, time.Now(), "runCommand")
+	reportProgress(ctx, Progress{Step: "runCommand", Message: strings.Join(opt.Command, " ")})
+	id := fmt.Sprintf("image-manip-exec-%s", util.UniquePart())
+	container, err := r.client.NewContainer(ctx, id,
+		containerd.WithSnapshotter(r.snapshotterName),
+		containerd.WithSnapshot(key),
+		containerd.WithNewSpec(execSpecOpts(image.ClientImage, opt)...),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create the container running %q: %w", opt.Command, err)
+	}
+	// the snapshot is not the container's, it is committed or removed by the caller
+	defer container.Delete(context.WithoutCancel(ctx))
+	out := outputOf(ctx)
+	task, err := container.NewTask(ctx, cio.NewCreator(cio.WithStreams(nil, out.stdout, out.stderr)))
+	if err != nil {
+		return fmt.Errorf("failed to create the task running %q: %w", opt.Command, err)
+	}
+	defer task.Delete(context.WithoutCancel(ctx), containerd.WithProcessKill)
+	statusC, err := task.Wait(ctx)
+	if err != nil {
+		return err
+	}
+	r.Infof("run %q", opt.Command)
+	if err := task.Start(ctx); err != nil {
+		return fmt.Errorf("failed to start %q: %w", opt.Command, err)
+	}
+	select {
+	case status := <-statusC:
+		code, _, err := status.Result()
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			return fmt.Errorf("command %q exited with status %d", opt.Command, code)
+		}
+		return nil
+	case <-ctx.Done():
+		r.Warnf("kill %q: %v", opt.Command, ctx.Err())
+		if err := task.Kill(context.WithoutCancel(ctx), syscall.SIGKILL); err != nil {
+			r.Errorf("failed to kill %q: %v", opt.Command, err)
+		}
+		<-statusC
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,297 @@
+package runtime_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/diff"
+	"github.com/containerd/containerd/mount"
+	"github.com/containerd/containerd/snapshots"
+	"github.com/lingdie/image-manip-server/pkg/options"
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/identity"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// configImage is an oci.Image whose config is a blob of a content store.
+type configImage struct {
+	store  content.Store
+	config ocispec.Descriptor
+}
+
+func (i configImage) Config(ctx context.Context) (ocispec.Descriptor, error) {
+	return i.config, nil
+}
+
+func (i configImage) ContentStore() content.Store {
+	return i.store
+}
+
+// execRootfs returns a root filesystem holding the users and groups of an image.
+func execRootfs(t *testing.T) string {
+	rootfs := t.TempDir()
+	for name, content := range map[string]string{
+		"etc/passwd": "root:x:0:0:root:/root:/bin/sh\napp:x:1000:1000::/home/app:/bin/sh\nweb:x:33:33::/var/www:/bin/sh\n",
+		"etc/group":  "root:x:0:\napp:x:1000:\ndocker:x:999:app\nwww-data:x:33:\nstaff:x:50:web\n",
+	} {
+		if err := os.MkdirAll(filepath.Join(rootfs, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(rootfs, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rootfs
+}
+
+func TestExecSpec(t *testing.T) {
+	store, err := local.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootfs := execRootfs(t)
+	imageOf := func(config ocispec.ImageConfig) configImage {
+		return configImage{store: store, config: writeJSONBlob(t, store, ocispec.MediaTypeImageConfig, ocispec.Image{
+			Platform: ocispec.Platform{Architecture: "amd64", OS: "linux"},
+			Config:   config,
+		})}
+	}
+	app := imageOf(ocispec.ImageConfig{
+		Env:        []string{"PATH=/usr/local/bin:/usr/bin:/bin", "LANG=C"},
+		WorkingDir: "/app",
+		User:       "app",
+		Entrypoint: []string{"/docker-entrypoint.sh"},
+		Cmd:        []string{"serve"},
+	})
+	command := []string{"update-ca-certificates", "--fresh"}
+	for _, tc := range []struct {
+		name  string
+		image configImage
+		opt   options.ExecOptions
+		env   []string
+		cwd   string
+		uid   uint32
+		gid   uint32
+		// groups are the additional groups of the user, along with its own group
+		groups []uint32
+	}{
+		{
+			name:   "image config",
+			image:  app,
+			opt:    options.ExecOptions{Command: command},
+			env:    []string{"PATH=/usr/local/bin:/usr/bin:/bin", "LANG=C"},
+			cwd:    "/app",
+			uid:    1000,
+			gid:    1000,
+			groups: []uint32{1000, 999},
+		},
+		{
+			name:   "overrides",
+			image:  app,
+			opt:    options.ExecOptions{Command: command, Env: []string{"LANG=C.UTF-8", "DEBUG=1"}, WorkingDir: "/src", User: "web"},
+			env:    []string{"PATH=/usr/local/bin:/usr/bin:/bin", "LANG=C.UTF-8", "DEBUG=1"},
+			cwd:    "/src",
+			uid:    33,
+			gid:    33,
+			groups: []uint32{33, 50},
+		},
+		{
+			name:   "numeric user",
+			image:  app,
+			opt:    options.ExecOptions{Command: command, User: "0:0"},
+			env:    []string{"PATH=/usr/local/bin:/usr/bin:/bin", "LANG=C"},
+			cwd:    "/app",
+			groups: []uint32{0},
+		},
+		{
+			name:   "empty config",
+			image:  imageOf(ocispec.ImageConfig{}),
+			opt:    options.ExecOptions{Command: command},
+			env:    []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"},
+			cwd:    "/",
+			groups: []uint32{0},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spec, err := runtime.ExecSpec(tc.image, rootfs, tc.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			process := spec.Process
+			// the command replaces the entrypoint and the command of the image
+			if !reflect.DeepEqual(process.Args, command) {
+				t.Errorf("expected the command %q, got %q", command, process.Args)
+			}
+			if !reflect.DeepEqual(process.Env, tc.env) {
+				t.Errorf("expected the environment %q, got %q", tc.env, process.Env)
+			}
+			if process.Cwd != tc.cwd {
+				t.Errorf("expected the working directory %q, got %q", tc.cwd, process.Cwd)
+			}
+			if process.User.UID != tc.uid || process.User.GID != tc.gid {
+				t.Errorf("expected the user %d:%d, got %d:%d", tc.uid, tc.gid, process.User.UID, process.User.GID)
+			}
+			if !reflect.DeepEqual(process.User.AdditionalGids, tc.groups) {
+				t.Errorf("expected the groups %v, got %v", tc.groups, process.User.AdditionalGids)
+			}
+		})
+	}
+}
+
+// recordingSnapshotter is a snapshotter of active snapshots recording the calls of an exec.
+type recordingSnapshotter struct {
+	snapshots.Snapshotter
+	prepared  map[string]string
+	removed   []string
+	committed map[string]string
+}
+
+func (s *recordingSnapshotter) Prepare(ctx context.Context, key, parent string, opts ...snapshots.Opt) ([]mount.Mount, error) {
+	s.prepared[key] = parent
+	return nil, nil
+}
+
+func (s *recordingSnapshotter) View(ctx context.Context, key, parent string, opts ...snapshots.Opt) ([]mount.Mount, error) {
+	return nil, nil
+}
+
+func (s *recordingSnapshotter) Stat(ctx context.Context, key string) (snapshots.Info, error) {
+	return snapshots.Info{Kind: snapshots.KindActive, Name: key, Parent: s.prepared[key]}, nil
+}
+
+func (s *recordingSnapshotter) Mounts(ctx context.Context, key string) ([]mount.Mount, error) {
+	return nil, nil
+}
+
+func (s *recordingSnapshotter) Commit(ctx context.Context, name, key string, opts ...snapshots.Opt) error {
+	s.committed[name] = key
+	return nil
+}
+
+func (s *recordingSnapshotter) Remove(ctx context.Context, key string) error {
+	s.removed = append(s.removed, key)
+	return nil
+}
+
+// layerDiffer is a differ whose diffs are a given layer.
+type layerDiffer struct {
+	containerd.DiffService
+	layer    ocispec.Descriptor
+	compared int
+}
+
+func (d *layerDiffer) Compare(ctx context.Context, lower, upper []mount.Mount, opts ...diff.Opt) (ocispec.Descriptor, error) {
+	d.compared++
+	return d.layer, nil
+}
+
+// memoryLabelStore keeps the labels of a content store in memory.
+type memoryLabelStore struct {
+	mu     sync.Mutex
+	labels map[digest.Digest]map[string]string
+}
+
+func (s *memoryLabelStore) Get(dgst digest.Digest) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.labels[dgst], nil
+}
+
+func (s *memoryLabelStore) Set(dgst digest.Digest, labels map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.labels[dgst] = labels
+	return nil
+}
+
+func (s *memoryLabelStore) Update(dgst digest.Digest, update map[string]string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	labels := s.labels[dgst]
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	for k, v := range update {
+		if v == "" {
+			delete(labels, k)
+		} else {
+			labels[k] = v
+		}
+	}
+	s.labels[dgst] = labels
+	return labels, nil
+}
+
+func TestExecLayer(t *testing.T) {
+	store, err := local.NewLabeledStore(t.TempDir(), &memoryLabelStore{labels: map[digest.Digest]map[string]string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffID := digest.FromString("diff")
+	layer := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageLayerGzip, Digest: digest.FromString("layer"), Size: int64(len("layer"))}
+	if err := content.WriteBlob(context.Background(), store, "layer", strings.NewReader("layer"), layer,
+		content.WithLabels(map[string]string{"containerd.io/uncompressed": diffID.String()})); err != nil {
+		t.Fatal(err)
+	}
+	parentDiffIDs := []digest.Digest{digest.FromString("base"), digest.FromString("app")}
+	parent := identity.ChainID(parentDiffIDs).String()
+
+	t.Run("command failed", func(t *testing.T) {
+		sn := &recordingSnapshotter{prepared: map[string]string{}, committed: map[string]string{}}
+		differ := &layerDiffer{layer: layer}
+		exitErr := errors.New(`command ["false"] exited with status 1`)
+		var runKey string
+		_, err := runtime.ExecLayer(sn, differ, store, parentDiffIDs, func(key string) error {
+			runKey = key
+			return exitErr
+		})
+		if !errors.Is(err, exitErr) {
+			t.Fatalf("expected the error of the command, got %v", err)
+		}
+		if sn.prepared[runKey] != parent {
+			t.Errorf("expected the command to run on a snapshot of %s, got %v", parent, sn.prepared)
+		}
+		// no layer is created and the snapshot of the command is thrown away
+		if differ.compared != 0 || len(sn.committed) != 0 {
+			t.Errorf("expected no layer to be created, got %d diffs and commits %v", differ.compared, sn.committed)
+		}
+		if !reflect.DeepEqual(sn.removed, []string{runKey}) {
+			t.Errorf("expected the snapshot %s to be removed, got %v", runKey, sn.removed)
+		}
+	})
+
+	t.Run("command succeeded", func(t *testing.T) {
+		sn := &recordingSnapshotter{prepared: map[string]string{}, committed: map[string]string{}}
+		differ := &layerDiffer{layer: layer}
+		var runKey string
+		newLayer, err := runtime.ExecLayer(sn, differ, store, parentDiffIDs, func(key string) error {
+			runKey = key
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if newLayer.Desc.Digest != layer.Digest || newLayer.DiffID != diffID {
+			t.Errorf("expected the diff of the snapshot, got %+v", newLayer)
+		}
+		child := identity.ChainID(append(append([]digest.Digest{}, parentDiffIDs...), diffID)).String()
+		if sn.committed[child] != runKey {
+			t.Errorf("expected the snapshot %s to be committed as %s, got %v", runKey, child, sn.committed)
+		}
+		for _, key := range sn.removed {
+			if key == runKey {
+				t.Errorf("the committed snapshot %s has been removed", runKey)
+			}
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package runtime
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/oci"
+	"github.com/containerd/containerd/snapshots"
+	imagesutil "github.com/lingdie/image-manip-server/pkg/images"
+	"github.com/lingdie/image-manip-server/pkg/options"
+	"github.com/lingdie/image-manip-server/pkg/timer"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// PlanLayerIndexes returns the positions in layers of the layers of each group the todo list makes.
+func PlanLayerIndexes(layers LayerChain, todoList TodoList) ([][]int, error) {
+	r := &Runtime{Logger: logrus.New()}
+	plan, err := r.planLayers(layers, nil, todoList)
+	if err != nil {
+		return nil, err
+	}
+	var indexes [][]int
+	for _, group := range plan.groups {
+		indexes = append(indexes, group.indexes)
+	}
+	return indexes, nil
+}
+
+// NewImageStoreRuntime returns a runtime using store as its image store and locking the images with locker.
+func NewImageStoreRuntime(store images.Store, locker *ImageLocker) *Runtime {
+	return &Runtime{Logger: logrus.New(), imagestore: store, locker: locker}
+}
+
+// NewContentStoreRuntime returns a runtime reading the images from store.
+func NewContentStoreRuntime(store content.Store) *Runtime {
+	return &Runtime{Logger: logrus.New(), contentstore: store}
+}
+
+// SelectManifests is selectManifests, the manifests of an image an operation applies to.
+var SelectManifests = (*Runtime).selectManifests
+
+// WriteImageIndex is writeImageIndex, the index of an image whose manifests are rewritten.
+var WriteImageIndex = (*Runtime).writeImageIndex
+
+// PlanText is planText, the text of a cell of the plan table.
+var PlanText = planText
+
+// DetectRebaseSplit detects the base layer of image with the history strategies, and returns the index
+// of the first layer a rebase from the detected base rebases.
+func DetectRebaseSplit(image imagesutil.Image) (BaseDetection, int, error) {
+	ctx := context.Background()
+	r := &Runtime{Logger: logrus.New(), baseStrategies: HistoryBaseStrategies()}
+	detection, found, err := r.DetectBase(ctx, image, nil)
+	if err != nil || !found {
+		return detection, -1, err
+	}
+	target, err := r.resolveRebaseTarget(ctx, options.RebaseOptions{}, image, &detection)
+	if err != nil {
+		return detection, -1, err
+	}
+	return detection, target.firstLayerIndexToRebase, nil
+}
+
+// LayerIndexOf is layerIndexOf, the index of the layer a digest or a history index refers to.
+var LayerIndexOf = layerIndexOf
+
+// SquashRangeTodoList returns the number of base layers and the todo list of a squash of the layers of
+// image from one end to the other.
+func SquashRangeTodoList(image imagesutil.Image, from, to string) (int, TodoList, error) {
+	r := &Runtime{Logger: logrus.New()}
+	target, err := r.resolveRebaseTarget(context.Background(), options.RebaseOptions{SquashFrom: from, SquashTo: to}, image, nil)
+	if err != nil {
+		return -1, nil, err
+	}
+	layersToRebase, err := target.layersToRebase()
+	if err != nil {
+		return -1, nil, err
+	}
+	todoList, err := target.todoList(layersToRebase, false)
+	return target.firstLayerIndexToRebase, todoList, err
+}
+
+// AddTar writes to w the tar of the layer adding sources to dest, owned by chown with the permissions chmod,
+// and with the modification time modTime if set.
+func AddTar(w io.Writer, sources []string, dest, chown, chmod string, modTime *time.Time) error {
+	attrs := fileAttributes{modTime: modTime}
+	var err error
+	attrs.uid, attrs.gid, err = parseChown(chown)
+	if err != nil {
+		return err
+	}
+	attrs.mode, err = parseChmod(chmod)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	if err := addSources(tw, sources, dest, attrs); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// ExecSpec returns the spec of the container running the command of opt in image, whose root
+// filesystem is the directory rootfs.
+func ExecSpec(image oci.Image, rootfs string, opt options.ExecOptions) (*oci.Spec, error) {
+	ctx := namespaces.WithNamespace(context.Background(), "test")
+	specOpts := append([]oci.SpecOpts{oci.WithRootFSPath(rootfs)}, execSpecOpts(image, opt)...)
+	return oci.GenerateSpec(ctx, nil, &containers.Container{ID: "exec"}, specOpts...)
+}
+
+// ExecLayer is execLayer on the snapshots of sn, whose diff is written by differ to store.
+func ExecLayer(sn snapshots.Snapshotter, differ containerd.DiffService, store content.Store, parentDiffIDs []digest.Digest, run func(key string) error) (Layer, error) {
+	logger := logrus.New()
+	t, err := timer.NewTimerImpl(logger)
+	if err != nil {
+		return Layer{}, err
+	}
+	r := &Runtime{Logger: logger, Timer: t, snapshotter: sn, differ: differ, contentstore: store}
+	return r.execLayer(context.Background(), parentDiffIDs, CommitInfo{}, run)
+}
+
+// NewImageResult is newImageResult, the result describing a written image.
+var NewImageResult = newImageResult
+
+// FilterTar is filterTar, the filter of the entries of a tar purged of patterns.
+var FilterTar = filterTar
+
+// PurgeHistory is purgeHistory, the history of the layers rewritten by a purge.
+var PurgeHistory = purgeHistory
+
+// NormalizeTarHeader is normalizeTarHeader, the header of an entry of a reproducible layer.
+var NormalizeTarHeader = normalizeTarHeader
+
+// SortTarNames returns the names of headers in the order sortTarEntries writes them.
+func SortTarNames(headers []*tar.Header) []string {
+	entries := make([]tarEntry, len(headers))
+	for i, h := range headers {
+		entries[i] = tarEntry{header: h}
+	}
+	var names []string
+	for _, e := range sortTarEntries(entries) {
+		names = append(names, e.header.Name)
+	}
+	return names
+}
@@ -0,0 +1,112 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/platforms"
+	imagesutil "github.com/lingdie/image-manip-server/pkg/images"
+	"github.com/lingdie/image-manip-server/pkg/options"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// BaseCandidate is a local image an image is built on.
+type BaseCandidate struct {
+	Name   string        `json:"name"`
+	Digest digest.Digest `json:"digest"`
+	// SplitIndex is the number of layers of the base image, the index of the first layer built on it
+	SplitIndex int `json:"split_index"`
+	// BaseLayerDigest is the digest of the topmost layer of the base image
+	BaseLayerDigest digest.Digest `json:"base_layer_digest"`
+	// Dangling is true if the image is only known by its digest
+	Dangling  bool      `json:"dangling"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FindBase returns the local images of the namespace an image is built on, the images whose layers
+// are a strict prefix of the layers of the image for its platform. The best candidates come first:
+// the longest prefix, then the tagged images, then the most recent ones.
+func (r *Runtime) FindBase(ctx context.Context, opt options.FindBaseOptions) (result FindBaseResult, err error) {
+	defer r.record(ctx, &result.Timings, time.Now(), "findBase")
+	result.ImageRef = opt.ImageRef
+	var platform *ocispec.Platform
+	if opt.Platform != "" {
+		p, err := platforms.Parse(opt.Platform)
+		if err != nil {
+			return result, fmt.Errorf("invalid platform %q: %w", opt.Platform, errdefs.ErrInvalidArgument)
+		}
+		platform = &p
+	}
+	image, err := r.GetPlatformImage(ctx, opt.ImageRef, platform)
+	if err != nil {
+		r.Errorf("failed to get image %q: %v", opt.ImageRef, err)
+		return result, err
+	}
+	if image.ManifestDesc.Platform != nil {
+		result.Platform = platforms.Format(*image.ManifestDesc.Platform)
+	}
+	result.Candidates, err = r.localBaseImages(ctx, image)
+	if err != nil {
+		return result, err
+	}
+	if len(result.Candidates) == 0 {
+		r.Infof("no local image is a base of image %q", opt.ImageRef)
+	} else {
+		best := result.Candidates[0]
+		r.Infof("image %q is built on %q, split at layer %d", opt.ImageRef, best.Name, best.SplitIndex)
+	}
+	return result, nil
+}
+
+// localBaseImages returns the local images whose layers are a strict prefix of the layers of image,
+// for its platform, ranked like FindBase.
+func (r *Runtime) localBaseImages(ctx context.Context, image imagesutil.Image) ([]BaseCandidate, error) {
+	imageList, err := r.imagestore.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bases := []BaseCandidate{}
+	for _, img := range imageList {
+		if img.Target.Digest == image.Image.Target.Digest {
+			continue
+		}
+		candidate, err := r.GetPlatformImage(ctx, img.Name, image.ManifestDesc.Platform)
+		if err != nil {
+			// e.g. the platform is not available, or the image has not been pulled completely
+			r.Debugf("skip image %q: %v", img.Name, err)
+			continue
+		}
+		layers := candidate.Manifest.Layers
+		if len(layers) == 0 || len(layers) >= len(image.Manifest.Layers) {
+			continue
+		}
+		if verifyBaseLayers(image, image.Image.Name, candidate, img.Name) != nil {
+			continue
+		}
+		bases = append(bases, BaseCandidate{
+			Name:            img.Name,
+			Digest:          img.Target.Digest,
+			SplitIndex:      len(layers),
+			BaseLayerDigest: layers[len(layers)-1].Digest,
+			Dangling:        len(FilterDangling([]images.Image{img}, true)) == 1,
+			CreatedAt:       img.CreatedAt,
+		})
+	}
+	sort.SliceStable(bases, func(i, j int) bool {
+		a, b := bases[i], bases[j]
+		switch {
+		case a.SplitIndex != b.SplitIndex:
+			return a.SplitIndex > b.SplitIndex
+		case a.Dangling != b.Dangling:
+			return !a.Dangling
+		default:
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+	})
+	return bases, nil
+}
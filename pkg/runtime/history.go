@@ -0,0 +1,138 @@
+package runtime
+
+import (
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// layerHistory is the history of a single layer: the empty layer entries
+// created right before it (e.g. ENV or LABEL), followed by the entry of the layer itself.
+type layerHistory struct {
+	EmptyLayers []ocispec.History
+	Layer       ocispec.History
+}
+
+// Entries returns the history entries in the order they appear in an image config.
+func (h layerHistory) Entries() []ocispec.History {
+	entries := make([]ocispec.History, 0, len(h.EmptyLayers)+1)
+	entries = append(entries, h.EmptyLayers...)
+	return append(entries, h.Layer)
+}
+
+// splitHistory splits the history of an image into one layerHistory per layer, and
+// the empty layer entries after the last layer (e.g. CMD at the end of a Dockerfile).
+// Missing entries are left as zero values so that the result always has layerCount items.
+func splitHistory(history []ocispec.History, layerCount int) ([]layerHistory, []ocispec.History) {
+	histories := make([]layerHistory, layerCount)
+	var pending []ocispec.History
+	layerIndex := 0
+	for _, h := range history {
+		if h.EmptyLayer || layerIndex >= layerCount {
+			pending = append(pending, h)
+			continue
+		}
+		histories[layerIndex] = layerHistory{
+			EmptyLayers: pending,
+			Layer:       h,
+		}
+		pending = nil
+		layerIndex++
+	}
+	return histories, pending
+}
+
+// truncateHistory keeps the history entries up to the layerCount-th layer.
+// If the image does not have more layers, the trailing empty layer entries are kept as well.
+func truncateHistory(history []ocispec.History, layerCount int) []ocispec.History {
+	histories, trailing := splitHistory(history, layerCount)
+	truncated := []ocispec.History{}
+	for _, h := range histories {
+		truncated = append(truncated, h.Entries()...)
+	}
+	for _, h := range trailing {
+		if !h.EmptyLayer {
+			// the image has more layers than layerCount
+			return truncated
+		}
+	}
+	return append(truncated, trailing...)
+}
+
+// generateHistory keeps the history of the first baseLayerCount layers of origHistory, and appends newHistory.
+// newHistory holds the empty layer entries and one entry per new layer; new layers without an entry
+// get a generated one. Entries without a creation time are stamped with the time of info.
+func generateHistory(origHistory []ocispec.History, baseLayerCount int, newLayers LayerChain, newHistory []ocispec.History, info CommitInfo) []ocispec.History {
+	history := truncateHistory(origHistory, baseLayerCount)
+	createdTime := info.Created
+	generated := func(layerIndex int) ocispec.History {
+		layer := newLayers.Descriptors[layerIndex]
+		return ocispec.History{
+			CreatedBy:  "ADD " + layer.Digest.String() + " in " + layer.MediaType,
+			Author:     info.Author,
+			Comment:    info.Comment,
+			EmptyLayer: false,
+		}
+	}
+	layerIndex := 0
+	for _, h := range newHistory {
+		if !h.EmptyLayer {
+			if layerIndex >= newLayers.Len() {
+				// more entries than layers, they can not be matched to any layer
+				continue
+			}
+			if h.CreatedBy == "" {
+				h = generated(layerIndex)
+			}
+			layerIndex++
+		}
+		if h.Created == nil {
+			h.Created = &createdTime
+		}
+		history = append(history, h)
+	}
+	for ; layerIndex < newLayers.Len(); layerIndex++ {
+		h := generated(layerIndex)
+		h.Created = &createdTime
+		history = append(history, h)
+	}
+	return history
+}
+
+// squashHistory returns the entry of a layer squashed from several layers.
+// The CreatedBy lines of all the layers are listed and their comments are combined,
+// followed by the comment of info.
+func squashHistory(histories []ocispec.History, info CommitInfo) ocispec.History {
+	created := info.Created
+	squashed := ocispec.History{
+		Created: &created,
+		Author:  info.Author,
+	}
+	var createdBy []string
+	for _, h := range histories {
+		if h.CreatedBy != "" {
+			createdBy = append(createdBy, h.CreatedBy)
+		}
+		squashed.Comment = combineComments(squashed.Comment, h.Comment)
+	}
+	squashed.Comment = combineComments(squashed.Comment, info.Comment)
+	squashed.CreatedBy = strings.Join(createdBy, "\n")
+	return squashed
+}
+
+// combineComments appends comment to combined, skipping it if it is empty or already present.
+func combineComments(combined, comment string) string {
+	comment = strings.TrimSpace(comment)
+	if comment == "" {
+		return combined
+	}
+	if combined == "" {
+		return comment
+	}
+	for _, c := range strings.Split(combined, "\n") {
+		if c == comment {
+			return combined
+		}
+	}
+	return combined + "\n" + comment
+}
@@ -10,6 +10,7 @@ import (
 	"strings"
 	"text/tabwriter"
 	"text/template"
+	"time"
 
 	"github.com/containerd/containerd/pkg/progress"
 	"github.com/containerd/log"
@@ -20,16 +21,23 @@ import (
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
-type historyPrintable struct {
+// HistoryEntry is a history entry of an image, along with the snapshot and the layer it belongs to.
+// The JSON form holds the raw creation time and size, CreatedSince and Size are their human
+// readable forms for the CLI.
+type HistoryEntry struct {
 	// LastSnapshot is the last snapshot name
-	LastSnapshot string
+	LastSnapshot string `json:"last_snapshot"`
 	// LastLayer is the last non-empty layer's descriptor digest
-	LastLayer    string
-	CreatedSince string
-	CreatedBy    string
-	Size         string
-	Comment      string
-	Empty        bool
+	LastLayer string `json:"last_layer"`
+	// Created is the creation time of the entry, if recorded
+	Created      *time.Time `json:"created,omitempty"`
+	CreatedSince string     `json:"-"`
+	CreatedBy    string     `json:"created_by"`
+	// SizeBytes is the size of the snapshot of the layer, 0 for an empty layer
+	SizeBytes int64  `json:"size"`
+	Size      string `json:"-"`
+	Comment   string `json:"comment"`
+	Empty     bool   `json:"empty"`
 }
 
 // ImageHistory returns the history entries for the given image reference.
@@ -46,11 +54,16 @@ func (r *Runtime) ImageHistory(ctx context.Context, imageRef string) (LayerChain
 }
 
 func (r *Runtime) CommentContains(ctx context.Context, imageRef string, pattern string) ([]digest.Digest, error) {
-	var digests []digest.Digest
 	layers, histories, err := r.ImageHistory(ctx, imageRef)
 	if err != nil {
-		return digests, err
+		return nil, err
 	}
+	return layersWithComment(layers, histories, pattern), nil
+}
+
+// layersWithComment returns the layers whose history comment contains pattern, from the topmost one.
+func layersWithComment(layers LayerChain, histories []ocispec.History, pattern string) []digest.Digest {
+	var digests []digest.Digest
 	layerIndex := len(layers.Descriptors) - 1
 	for i := len(histories) - 1; i >= 0; i-- {
 		h := histories[i]
@@ -63,25 +76,27 @@ func (r *Runtime) CommentContains(ctx context.Context, imageRef string, pattern
 		}
 		layerIndex--
 	}
-	return digests, nil
+	return digests
 }
 
-func (r *Runtime) ListImageHistory(ctx context.Context, opts options.HistoryOptions) error {
-	layers, histories, err := r.ImageHistory(ctx, opts.ImageRef)
+// HistoryEntries returns the history entries of an image, from the oldest to the newest.
+// If keyword is not empty, only the entries whose CreatedBy contains it (case insensitive) are returned.
+func (r *Runtime) HistoryEntries(ctx context.Context, imageRef string, keyword string) ([]HistoryEntry, error) {
+	layers, histories, err := r.ImageHistory(ctx, imageRef)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if len(layers.Descriptors) != len(layers.DiffIDs) {
-		return fmt.Errorf("invalid image: number of layers descriptors and diff IDs do not match")
+		return nil, fmt.Errorf("invalid image: number of layers descriptors and diff IDs do not match")
 	}
 	layerLen := len(layers.DiffIDs)
 	layerIndex := 0
 	lastSnapshotName := ""
 	lastLayerName := ""
-	var all []historyPrintable
+	var entries []HistoryEntry
 	for _, h := range histories {
 		var (
-			size  string
+			size  int64
 			empty bool
 		)
 		if layerLen <= layerIndex {
@@ -91,93 +106,60 @@ func (r *Runtime) ListImageHistory(ctx context.Context, opts options.HistoryOpti
 			chainID := identity.ChainID(layers.DiffIDs[0 : layerIndex+1]).String()
 			stat, err := r.snapshotter.Stat(ctx, chainID)
 			if err != nil {
-				return fmt.Errorf("failed to get stat: %w", err)
+				return nil, fmt.Errorf("failed to get stat: %w", err)
 			}
 			use, err := r.snapshotter.Usage(ctx, chainID)
 			if err != nil {
-				return fmt.Errorf("failed to get usage: %w", err)
+				return nil, fmt.Errorf("failed to get usage: %w", err)
 			}
-			size = progress.Bytes(use.Size).String()
+			size = use.Size
 			lastSnapshotName = stat.Name
 			lastLayerName = layers.Descriptors[layerIndex].Digest.String()
 			layerIndex++
 		} else {
-			size = progress.Bytes(0).String()
 			empty = true
 		}
-		history := historyPrintable{
+		if keyword != "" && !strings.Contains(strings.ToLower(h.CreatedBy), strings.ToLower(keyword)) {
+			continue
+		}
+		var createdSince string
+		if h.Created != nil {
+			createdSince = formatter.TimeSinceInHuman(*h.Created)
+		}
+		entries = append(entries, HistoryEntry{
 			LastSnapshot: lastSnapshotName,
 			LastLayer:    lastLayerName,
-			CreatedSince: formatter.TimeSinceInHuman(*h.Created),
+			Created:      h.Created,
+			CreatedSince: createdSince,
 			CreatedBy:    h.CreatedBy,
-			Size:         size,
+			SizeBytes:    size,
+			Size:         progress.Bytes(size).String(),
 			Comment:      h.Comment,
 			Empty:        empty,
-		}
-		all = append(all, history)
+		})
+	}
+	return entries, nil
+}
+
+func (r *Runtime) ListImageHistory(ctx context.Context, opts options.HistoryOptions) error {
+	all, err := r.HistoryEntries(ctx, opts.ImageRef, "")
+	if err != nil {
+		return err
 	}
 	return printHistory(all, opts)
 }
 
 // SearchImageHistory searches the image history for entries matching the given keyword.
-// TODO: merge this function with ListImageHistory
 func (r *Runtime) SearchImageHistory(ctx context.Context, opts options.SearchHistoryOptions) error {
-	layers, histories, err := r.ImageHistory(ctx, opts.ImageRef)
+	matched, err := r.HistoryEntries(ctx, opts.ImageRef, opts.Keyword)
 	if err != nil {
 		return err
 	}
-	if len(layers.Descriptors) != len(layers.DiffIDs) {
-		return fmt.Errorf("invalid image: number of layers descriptors and diff IDs do not match")
-	}
-	layerLen := len(layers.DiffIDs)
-	layerIndex := 0
-	lastSnapshotName := ""
-	lastLayerName := ""
-	var matched []historyPrintable
-	for _, h := range histories {
-		var (
-			size  string
-			empty bool
-		)
-		if layerLen <= layerIndex {
-			break
-		}
-		if !h.EmptyLayer {
-			chainID := identity.ChainID(layers.DiffIDs[0 : layerIndex+1]).String()
-			stat, err := r.snapshotter.Stat(ctx, chainID)
-			if err != nil {
-				return fmt.Errorf("failed to get stat: %w", err)
-			}
-			use, err := r.snapshotter.Usage(ctx, chainID)
-			if err != nil {
-				return fmt.Errorf("failed to get usage: %w", err)
-			}
-			size = progress.Bytes(use.Size).String()
-			lastSnapshotName = stat.Name
-			lastLayerName = layers.Descriptors[layerIndex].Digest.String()
-			layerIndex++
-		} else {
-			size = progress.Bytes(0).String()
-			empty = true
-		}
-		if strings.Contains(strings.ToLower(h.CreatedBy), strings.ToLower(opts.Keyword)) {
-			history := historyPrintable{
-				LastSnapshot: lastSnapshotName,
-				LastLayer:    lastLayerName,
-				CreatedSince: formatter.TimeSinceInHuman(*h.Created),
-				CreatedBy:    h.CreatedBy,
-				Size:         size,
-				Comment:      h.Comment,
-				Empty:        empty,
-			}
-			matched = append(matched, history)
-		}
-	}
 	return printHistory(matched, opts.HistoryOptions)
 }
 
 /*
-	func printMatchedHistory(matched []historyPrintable, opts options.SearchHistoryOptions) error {
+	func printMatchedHistory(matched []HistoryEntry, opts options.SearchHistoryOptions) error {
 		for i := len(matched) - 1; i >= 0; i-- {
 			h := matched[i]
 			fmt.Printf("SNAPSHOT: %s, LAST SNAPSHOT: %s, BY: %s, CREATED: %s, SIZE: %s, COMMENT: %s\n",
@@ -193,7 +175,7 @@ type historyPrinter struct {
 	tmpl           *template.Template
 }
 
-func printHistory(histories []historyPrintable, opts options.HistoryOptions) error {
+func printHistory(histories []HistoryEntry, opts options.HistoryOptions) error {
 	var tmpl *template.Template
 	format := opts.Format
 	quiet := opts.Quiet
@@ -238,7 +220,11 @@ func printHistory(histories []historyPrintable, opts options.HistoryOptions) err
 	return nil
 }
 
-func (x *historyPrinter) printHistory(p historyPrintable) error {
+func (x *historyPrinter) printHistory(p HistoryEntry) error {
+	if x.tmpl == nil {
+		// squashed layers list the CreatedBy of every merged layer on its own line
+		p.CreatedBy = strings.ReplaceAll(p.CreatedBy, "\n", "; ")
+	}
 	if !x.noTrunc {
 		if len(p.CreatedBy) > 45 {
 			p.CreatedBy = p.CreatedBy[0:44] + "…"
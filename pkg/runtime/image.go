@@ -11,7 +11,7 @@ import (
 	"github.com/containerd/containerd/errdefs"
 	"github.com/containerd/containerd/images"
 	"github.com/containerd/nerdctl/pkg/idutil/imagewalker"
-	"github.com/containerd/nerdctl/pkg/imgutil"
+	"github.com/containerd/platforms"
 	imagesutil "github.com/lingdie/image-manip-server/pkg/images"
 	"github.com/opencontainers/go-digest"
 
@@ -39,7 +39,7 @@ func (r *Runtime) FindImage(ctx context.Context, imageRef string) (string, error
 		return "", err
 	}
 	if matchCount < 1 {
-		return "", fmt.Errorf("image %q not found", imageRef)
+		return "", fmt.Errorf("image %q: %w", imageRef, errdefs.ErrNotFound)
 	} else if matchCount > 1 {
 		r.Infof("multiple images found for %q", imageRef)
 		return srcName, nil
@@ -47,70 +47,107 @@ func (r *Runtime) FindImage(ctx context.Context, imageRef string) (string, error
 	return srcName, nil
 }
 
+// GetImage returns the image imageRef refers to, for the default platform if it is a multi-platform image.
 func (r *Runtime) GetImage(ctx context.Context, imageRef string) (imagesutil.Image, error) {
-	imageName, err := r.FindImage(ctx, imageRef)
-	image := imagesutil.Image{}
-	if err != nil {
-		return image, err
-	}
-	containerImage, err := r.imagestore.Get(ctx, imageName)
-	if err != nil {
-		return image, err
-	}
-	clientImage := containerd.NewImage(r.client, containerImage)
-	manifest, _, err := imgutil.ReadManifest(ctx, clientImage)
-	if err != nil {
-		return imagesutil.Image{}, err
-	}
-	config, _, err := imgutil.ReadImageConfig(ctx, clientImage)
-	if err != nil {
-		return imagesutil.Image{}, err
-	}
-	image = imagesutil.Image{
-		ClientImage: clientImage,
-		Config:      config,
-		Image:       containerImage,
-		Manifest:    manifest,
-	}
-	return image, err
+	return r.GetPlatformImage(ctx, imageRef, nil)
 }
 
-func (r *Runtime) UpdateImage(ctx context.Context, img images.Image) (images.Image, error) {
+// UpdateImage points the image img.Name to img.Target, creating it if needed. The previous target
+// is kept in the reflog of the image, along with the operation changing it.
+func (r *Runtime) UpdateImage(ctx context.Context, img images.Image, operation string) (images.Image, error) {
+	prev, err := r.imagestore.Get(ctx, img.Name)
+	if err != nil && !errdefs.IsNotFound(err) {
+		return images.Image{}, err
+	}
+	img.Labels, err = withReflog(prev, img, operation)
+	if err != nil {
+		return images.Image{}, err
+	}
 	newImg, err := r.imagestore.Update(ctx, img)
 	if err != nil {
 		// if err has `not found` in the message then create the image, otherwise return the error
 		if !errdefs.IsNotFound(err) {
 			return newImg, fmt.Errorf("failed to update new image %s: %w", img.Name, err)
 		}
-		if _, err := r.imagestore.Create(ctx, img); err != nil {
+		newImg, err = r.imagestore.Create(ctx, img)
+		if err != nil {
 			return newImg, fmt.Errorf("failed to create new image %s: %w", img.Name, err)
 		}
 	}
 	return newImg, nil
 }
 
+// CompareAndSwapImage updates img like UpdateImage. If img replaces orig, the image it was computed
+// from, it fails with ErrFailedPrecondition unless the image still points to the target of orig,
+// rather than overwriting a change made in the meantime.
+//
+// The image store has no conditional update: the check and the update are two calls, so the swap
+// is atomic only with respect to the writers holding the lock of img.Name, see LockImages. The
+// caller must hold it. A writer not taking the lock (e.g. ctr or nerdctl) can still change the
+// image between the check and the update, the check only narrows that window.
+func (r *Runtime) CompareAndSwapImage(ctx context.Context, img images.Image, orig images.Image, operation string) (images.Image, error) {
+	if img.Name == orig.Name {
+		current, err := r.imagestore.Get(ctx, img.Name)
+		if err != nil {
+			if errdefs.IsNotFound(err) {
+				return images.Image{}, fmt.Errorf("image %s has been removed since it was read: %w", img.Name, errdefs.ErrFailedPrecondition)
+			}
+			return images.Image{}, err
+		}
+		if current.Target.Digest != orig.Target.Digest {
+			return images.Image{}, fmt.Errorf("image %s has changed since it was read (%s -> %s): %w",
+				img.Name, orig.Target.Digest, current.Target.Digest, errdefs.ErrFailedPrecondition)
+		}
+	}
+	return r.UpdateImage(ctx, img, operation)
+}
+
+// LockImages locks the image imageRef refers to, along with the other image names written by an
+// operation, see ImageLocker. unlock releases the locks.
+func (r *Runtime) LockImages(ctx context.Context, imageRef string, names ...string) (unlock func(), err error) {
+	name, err := r.FindImage(ctx, imageRef)
+	if err != nil {
+		return nil, err
+	}
+	return r.locker.Lock(ctx, append(names, name)...)
+}
+
 // Tag creates a new image name (tag) pointing to the same target as source image
-func (r *Runtime) Tag(ctx context.Context, srcRef, target string) error {
+func (r *Runtime) Tag(ctx context.Context, srcRef, target string) (result TagResult, err error) {
+	defer r.record(ctx, &result.Timings, time.Now(), "tag")
+	result.TargetImage = target
+	unlock, err := r.locker.Lock(ctx, target)
+	if err != nil {
+		return result, err
+	}
+	defer unlock()
 	// find the source image
 	srcImg, err := r.GetImage(ctx, srcRef)
 	if err != nil {
-		return err
+		return result, err
 	}
+	result.SourceImage = srcImg.Image.Name
 	// create or update target image referencing same target descriptor
 	newImg := images.Image{
 		Name:      target,
 		Target:    srcImg.Image.Target,
 		UpdatedAt: time.Now(),
 	}
-	if _, err := r.UpdateImage(ctx, newImg); err != nil {
-		return err
+	if _, err := r.UpdateImage(ctx, newImg, "tag "+srcImg.Image.Name); err != nil {
+		return result, err
 	}
+	result.ManifestDigest = srcImg.Image.Target.Digest
 	r.Infof("Tagged image %s as %s", srcImg.Image.Name, target)
-	return nil
+	return result, nil
 }
 
+// UnpackImage unpacks the image img to the snapshot storage, for the platform of manifestDesc
+// if it is a manifest of a multi-platform image.
 func (r *Runtime) UnpackImage(ctx context.Context, img images.Image, manifestDesc ocispec.Descriptor) error {
 	cimg := containerd.NewImage(r.client, img)
+	if manifestDesc.Platform != nil {
+		cimg = containerd.NewImageWithPlatform(r.client, img, platforms.Only(*manifestDesc.Platform))
+	}
 	// unpack image to the snapshot storage
 	if err := cimg.Unpack(ctx, r.snapshotterName); err != nil {
 		return err
@@ -119,32 +156,41 @@ func (r *Runtime) UnpackImage(ctx context.Context, img images.Image, manifestDes
 }
 
 // GenerateMergedImageConfig generates a new image config by merging the base image config and the new layers.
-func (r *Runtime) GenerateMergedImageConfig(ctx context.Context, origConfig ocispec.Image, firstLayerIndexToRebase int, baseLayers, newLayers LayerChain) (ocispec.Image, error) {
-	createdTime := time.Now()
-	arch := origConfig.Architecture
-	if arch == "" {
-		arch = runtime.GOARCH
-		r.Warnf("assuming arch=%q", arch)
-	}
-	os := origConfig.OS
-	if os == "" {
-		os = runtime.GOOS
-		r.Warnf("assuming os=%q", os)
-	}
-	author := strings.TrimSpace(defaultAuthor) //TODO: make this configurable
+// The history of origConfig is kept up to its baseLayers.Len()-th layer, followed by newHistory, which holds
+// the entries of the new layers and any empty layer entries in between (see generateHistory).
+// If merge is not nil, the application config it carries is merged into the config of origConfig.
+// The author and the creation time of the new image are taken from info.
+func (r *Runtime) GenerateMergedImageConfig(ctx context.Context, origConfig ocispec.Image, baseLayers, newLayers LayerChain, newHistory []ocispec.History, merge *ConfigMerge, info CommitInfo) (ocispec.Image, error) {
+	createdTime := info.Created
+	// the variant, the OS version and features of the platform are kept as they are
+	platform := origConfig.Platform
+	if platform.Architecture == "" {
+		platform.Architecture = runtime.GOARCH
+		r.Warnf("assuming arch=%q", platform.Architecture)
+	}
+	if platform.OS == "" {
+		platform.OS = runtime.GOOS
+		r.Warnf("assuming os=%q", platform.OS)
+	}
+	author := strings.TrimSpace(info.Author)
 	if author == "" {
 		author = origConfig.Author
 	}
+	config := origConfig.Config
+	if merge != nil {
+		var changes []ConfigChange
+		config, changes = merge.Merge(origConfig.Config)
+		for _, c := range changes {
+			r.Infof("config field %s differs from the application image: %q -> %q", c.Field, c.From, c.To)
+		}
+	}
 	return ocispec.Image{
-		Platform: ocispec.Platform{
-			Architecture: arch,
-			OS:           os,
-		},
-		Created: &createdTime,
-		Author:  author,
-		Config:  origConfig.Config,
-		RootFS:  generateRootFS(baseLayers, newLayers),
-		History: generateHistory(origConfig.History, firstLayerIndexToRebase, newLayers),
+		Platform: platform,
+		Created:  &createdTime,
+		Author:   author,
+		Config:   config,
+		RootFS:   generateRootFS(baseLayers, newLayers),
+		History:  generateHistory(origConfig.History, baseLayers.Len(), newLayers, newHistory, info),
 	}, nil
 }
 
@@ -157,35 +203,3 @@ func generateRootFS(baseLayers, newLayers LayerChain) ocispec.RootFS {
 		DiffIDs: diffIDs,
 	}
 }
-
-func generateHistory(origHistory []ocispec.History, firstLayerIndexToRebase int, newLayers LayerChain) []ocispec.History {
-	history := []ocispec.History{}
-	nonEmptyLayerCount := 0
-	for _, h := range origHistory {
-		history = append(history, ocispec.History{
-			Created:    h.Created,
-			CreatedBy:  h.CreatedBy,
-			Author:     h.Author,
-			Comment:    h.Comment,
-			EmptyLayer: h.EmptyLayer,
-		})
-		if !h.EmptyLayer {
-			nonEmptyLayerCount++
-		}
-		if nonEmptyLayerCount >= firstLayerIndexToRebase {
-			break
-		}
-	}
-	author := strings.TrimSpace(defaultAuthor)   //TODO: make this configurable
-	comment := strings.TrimSpace(defaultMessage) //TODO: make this configurable
-	for _, layer := range newLayers.Descriptors {
-		history = append(history, ocispec.History{
-			Created:    nil,
-			CreatedBy:  "ADD " + layer.Digest.String() + " in " + layer.MediaType,
-			Author:     author,
-			Comment:    comment,
-			EmptyLayer: false,
-		})
-	}
-	return history
-}
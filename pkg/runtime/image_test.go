@@ -0,0 +1,145 @@
+package runtime_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// memoryImageStore is an images.Store keeping the images in memory
+type memoryImageStore struct {
+	mu     sync.Mutex
+	images map[string]images.Image
+}
+
+func (s *memoryImageStore) Get(ctx context.Context, name string) (images.Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	img, ok := s.images[name]
+	if !ok {
+		return images.Image{}, fmt.Errorf("image %q: %w", name, errdefs.ErrNotFound)
+	}
+	return img, nil
+}
+
+func (s *memoryImageStore) List(ctx context.Context, filters ...string) ([]images.Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []images.Image
+	for _, img := range s.images {
+		list = append(list, img)
+	}
+	return list, nil
+}
+
+func (s *memoryImageStore) Create(ctx context.Context, img images.Image) (images.Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.images[img.Name]; ok {
+		return images.Image{}, fmt.Errorf("image %q: %w", img.Name, errdefs.ErrAlreadyExists)
+	}
+	s.images[img.Name] = img
+	return img, nil
+}
+
+func (s *memoryImageStore) Update(ctx context.Context, img images.Image, fieldpaths ...string) (images.Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.images[img.Name]; !ok {
+		return images.Image{}, fmt.Errorf("image %q: %w", img.Name, errdefs.ErrNotFound)
+	}
+	s.images[img.Name] = img
+	return img, nil
+}
+
+func (s *memoryImageStore) Delete(ctx context.Context, name string, opts ...images.DeleteOpt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.images, name)
+	return nil
+}
+
+func testImage(name, content string) images.Image {
+	return images.Image{
+		Name: name,
+		Target: ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageManifest,
+			Digest:    digest.FromString(content),
+			Size:      int64(len(content)),
+		},
+	}
+}
+
+func TestCompareAndSwapImage(t *testing.T) {
+	const name = "docker.io/library/app:latest"
+	ctx := context.Background()
+	store := &memoryImageStore{images: map[string]images.Image{}}
+	locker := runtime.NewImageLocker(t.TempDir())
+	r := runtime.NewImageStoreRuntime(store, locker)
+	orig, err := store.Create(ctx, testImage(name, "orig"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// concurrent writers computed their image from orig, the lock makes only one of them win
+	const writers = 8
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded []images.Image
+		failed    int
+	)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			unlock, err := locker.Lock(ctx, name)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer unlock()
+			img, err := r.CompareAndSwapImage(ctx, testImage(name, fmt.Sprintf("writer %d", i)), orig, "test")
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				succeeded = append(succeeded, img)
+			case errdefs.IsFailedPrecondition(err):
+				failed++
+			default:
+				t.Errorf("writer %d: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(succeeded) != 1 || failed != writers-1 {
+		t.Fatalf("expected 1 writer to succeed and %d to fail, got %d and %d", writers-1, len(succeeded), failed)
+	}
+	current, err := store.Get(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.Target.Digest != succeeded[0].Target.Digest {
+		t.Errorf("expected the image to point to %s, got %s", succeeded[0].Target.Digest, current.Target.Digest)
+	}
+
+	// a removed image is not created again
+	if err := store.Delete(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.CompareAndSwapImage(ctx, testImage(name, "late"), current, "test"); !errdefs.IsFailedPrecondition(err) {
+		t.Errorf("expected a failed precondition for a removed image, got %v", err)
+	}
+	// a new image name is written whatever orig is
+	if _, err := r.CompareAndSwapImage(ctx, testImage(name+"-new", "new"), current, "test"); err != nil {
+		t.Errorf("expected a new image to be created, got %v", err)
+	}
+}
@@ -45,22 +45,69 @@ type platformSpecificAttr struct {
 
 // ListImages prints images with columns: REPOSITORY, TAG, IMAGE ID, CREATED, PLATFORM, SIZE, BLOB SIZE
 func (r *Runtime) ListImages(ctx context.Context, opts types.ImageListOptions) error {
-	imageList, err := r.imagestore.List(ctx, opts.NameAndRefFilter...)
+	imageAttrList, err := r.listImageAttrs(ctx, opts)
 	if err != nil {
 		return err
 	}
+	return r.printImages(imageAttrList, opts)
+}
+
+// ImageSummary is an image returned by ImageSummaries, one per platform.
+type ImageSummary struct {
+	Name       string        `json:"name"`
+	Repository string        `json:"repository"`
+	Tag        string        `json:"tag"`
+	Digest     digest.Digest `json:"digest"`
+	// ConfigDigest is the digest of the config for the platform
+	ConfigDigest digest.Digest `json:"config_digest"`
+	CreatedAt    time.Time     `json:"created_at"`
+	Platform     string        `json:"platform"`
+	// Size is the size of the unpacked snapshots
+	Size int64 `json:"size"`
+	// BlobSize is the size of the blobs in the content store
+	BlobSize int64 `json:"blob_size"`
+}
+
+// ImageSummaries returns the images matching the filters of opts, sorted like ListImages.
+func (r *Runtime) ImageSummaries(ctx context.Context, opts types.ImageListOptions) ([]ImageSummary, error) {
+	imageAttrList, err := r.listImageAttrs(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]ImageSummary, 0, len(imageAttrList))
+	for _, imgAttr := range imageAttrList {
+		summaries = append(summaries, ImageSummary{
+			Name:         imgAttr.Name,
+			Repository:   imgAttr.PSA.Repository,
+			Tag:          imgAttr.PSA.Tag,
+			Digest:       imgAttr.Digest,
+			ConfigDigest: imgAttr.PSA.Config.Digest,
+			CreatedAt:    imgAttr.CreatedAt,
+			Platform:     platforms.Format(imgAttr.PSA.Platform),
+			Size:         imgAttr.Size,
+			BlobSize:     imgAttr.PSA.BlobSize,
+		})
+	}
+	return summaries, nil
+}
+
+func (r *Runtime) listImageAttrs(ctx context.Context, opts types.ImageListOptions) ([]imageAttr, error) {
+	imageList, err := r.imagestore.List(ctx, opts.NameAndRefFilter...)
+	if err != nil {
+		return nil, err
+	}
 	if len(opts.Filters) > 0 {
 		imageList, err = r.filterImages(ctx, imageList, opts.Filters)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 	imageAttrList, err := r.GetImageAttrList(ctx, imageList, opts.Names)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	handleSortBy(imageAttrList, opts.SortBy)
-	return r.printImages(imageAttrList, opts)
+	return imageAttrList, nil
 }
 
 // Supported filters:
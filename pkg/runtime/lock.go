@@ -0,0 +1,93 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/sys/unix"
+)
+
+// lockPollInterval is how often a lock held by someone else is tried again
+const lockPollInterval = 100 * time.Millisecond
+
+// ImageLocker holds advisory locks on image names, so that the operations rewriting an image do
+// not run concurrently. The locks are flock(2) locks on files of a directory: they are shared by
+// all the processes using the same directory, the CLI and the server alike, and are released
+// when the process holding them exits.
+type ImageLocker struct {
+	dir string
+	// OnWait is called, if set, when a lock is held by someone else and has to be waited for
+	OnWait func(name string)
+}
+
+// NewImageLocker returns a locker keeping its lock files in dir, which is created if needed.
+func NewImageLocker(dir string) *ImageLocker {
+	return &ImageLocker{dir: dir}
+}
+
+// Lock locks the given image names, waiting until ctx is done for the locks held by others.
+// The empty and duplicate names are ignored. unlock releases all the locks.
+func (l *ImageLocker) Lock(ctx context.Context, names ...string) (unlock func(), err error) {
+	// lock in a fixed order, so that two operations locking the same names do not deadlock
+	sorted := make([]string, 0, len(names))
+	seen := map[string]bool{"": true}
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			sorted = append(sorted, name)
+		}
+	}
+	sort.Strings(sorted)
+	var files []*os.File
+	unlock = func() {
+		for i := len(files) - 1; i >= 0; i-- {
+			// closing the file releases the lock
+			files[i].Close()
+		}
+	}
+	for _, name := range sorted {
+		f, err := l.lock(ctx, name)
+		if err != nil {
+			unlock()
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return unlock, nil
+}
+
+func (l *ImageLocker) lock(ctx context.Context, name string) (*os.File, error) {
+	if err := os.MkdirAll(l.dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	// image names may contain slashes and colons, the file is named after the digest of the name
+	path := filepath.Join(l.dir, digest.FromString(name).Encoded()+".lock")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file of image %q: %w", name, err)
+	}
+	for waited := false; ; waited = true {
+		err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+		if err == nil {
+			return f, nil
+		}
+		if err != unix.EWOULDBLOCK && err != unix.EINTR {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock image %q: %w", name, err)
+		}
+		if !waited && l.OnWait != nil {
+			l.OnWait(name)
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, fmt.Errorf("image %q is locked by another operation: %w", name, ctx.Err())
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package runtime_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+)
+
+func TestImageLocker(t *testing.T) {
+	locker := runtime.NewImageLocker(t.TempDir())
+	ctx := context.Background()
+	// duplicate and empty names are locked once
+	unlock, err := locker.Lock(ctx, "docker.io/library/app:latest", "", "docker.io/library/app:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waited := false
+	locker.OnWait = func(name string) {
+		waited = true
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+	defer cancel()
+	if _, err := locker.Lock(timeoutCtx, "docker.io/library/a-base:latest", "docker.io/library/app:latest"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the lock to time out, got %v", err)
+	}
+	if !waited {
+		t.Error("expected OnWait to be called")
+	}
+	// the locks taken before the failure have been released
+	unlockOther, err := locker.Lock(ctx, "docker.io/library/a-base:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlockOther()
+
+	unlock()
+	unlock, err = locker.Lock(ctx, "docker.io/library/app:latest")
+	if err != nil {
+		t.Fatalf("expected the lock to be released, got %v", err)
+	}
+	unlock()
+}
@@ -0,0 +1,104 @@
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// ManifestFormatDocker writes Docker schema2 manifests, configs, layers and manifest lists
+	ManifestFormatDocker = "docker"
+	// ManifestFormatOCI writes OCI manifests, configs, layers and indexes
+	ManifestFormatOCI = "oci"
+)
+
+// dockerToOCILayerTypes maps the Docker layer media types to their OCI counterparts. The blobs are
+// the same, only the media types differ.
+var dockerToOCILayerTypes = map[string]string{
+	images.MediaTypeDockerSchema2Layer:            ocispec.MediaTypeImageLayer,
+	images.MediaTypeDockerSchema2LayerGzip:        ocispec.MediaTypeImageLayerGzip,
+	images.MediaTypeDockerSchema2LayerForeign:     ocispec.MediaTypeImageLayerNonDistributable,
+	images.MediaTypeDockerSchema2LayerForeignGzip: ocispec.MediaTypeImageLayerNonDistributableGzip,
+}
+
+// parseManifestFormat checks format, the empty format keeps the format of the original image.
+func parseManifestFormat(format string) (string, error) {
+	switch format {
+	case "", ManifestFormatDocker, ManifestFormatOCI:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown manifest format %q, must be %q or %q: %w", format, ManifestFormatDocker, ManifestFormatOCI, errdefs.ErrInvalidArgument)
+	}
+}
+
+// manifestFormatFor checks that a manifest of format can describe layers compressed with c. zstd
+// layers only have OCI media types: the OCI format is chosen for them if format is empty, and
+// the Docker format is rejected.
+func manifestFormatFor(format, c string) (string, error) {
+	if c != CompressionZstd && c != CompressionZstdChunked {
+		return format, nil
+	}
+	switch format {
+	case ManifestFormatDocker:
+		return "", fmt.Errorf("%s layers have no Docker media type, the manifest format must be %q: %w", c, ManifestFormatOCI, errdefs.ErrInvalidArgument)
+	case "":
+		return ManifestFormatOCI, nil
+	}
+	return format, nil
+}
+
+// manifestFormatOf returns the format of a manifest or an index of the given media type.
+func manifestFormatOf(mediaType string) string {
+	switch mediaType {
+	case ocispec.MediaTypeImageManifest, ocispec.MediaTypeImageIndex:
+		return ManifestFormatOCI
+	default:
+		return ManifestFormatDocker
+	}
+}
+
+// forManifest returns info with the format of the manifest of the given media type, unless a format is set.
+func (info CommitInfo) forManifest(mediaType string) CommitInfo {
+	if info.ManifestFormat == "" {
+		info.ManifestFormat = manifestFormatOf(mediaType)
+	}
+	return info
+}
+
+func manifestMediaType(format string) string {
+	if format == ManifestFormatOCI {
+		return ocispec.MediaTypeImageManifest
+	}
+	return images.MediaTypeDockerSchema2Manifest
+}
+
+func configMediaType(format string) string {
+	if format == ManifestFormatOCI {
+		return ocispec.MediaTypeImageConfig
+	}
+	return images.MediaTypeDockerSchema2Config
+}
+
+func indexMediaType(format string) string {
+	if format == ManifestFormatOCI {
+		return ocispec.MediaTypeImageIndex
+	}
+	return images.MediaTypeDockerSchema2ManifestList
+}
+
+// layerMediaType returns the media type of a layer of the given media type in a manifest of format.
+// The media types without a counterpart in format, like zstd layers in a Docker manifest, are kept.
+func layerMediaType(format string, mediaType string) string {
+	for docker, oci := range dockerToOCILayerTypes {
+		switch {
+		case format == ManifestFormatOCI && mediaType == docker:
+			return oci
+		case format == ManifestFormatDocker && mediaType == oci:
+			return docker
+		}
+	}
+	return mediaType
+}
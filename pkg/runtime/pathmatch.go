@@ -0,0 +1,211 @@
+package runtime
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/containerd/containerd/errdefs"
+)
+
+// regexpPatternPrefix prefixes the path patterns which are regular expressions
+const regexpPatternPrefix = "re:"
+
+// PathMatch is the paths of an image a pattern matched.
+type PathMatch struct {
+	Pattern string   `json:"pattern"`
+	Paths   []string `json:"paths"`
+}
+
+// PathPattern selects paths of a root filesystem: it is either a plain path, a shell glob in which
+// "**" matches any number of directories, or a regular expression prefixed with "re:". The patterns
+// are matched against absolute paths, a relative glob like "**/*.pyc" is taken from the root.
+type PathPattern struct {
+	raw string
+	// literal is the clean absolute path of a plain path pattern
+	literal string
+	re      *regexp.Regexp
+}
+
+// ParsePathPattern parses a path, a glob or a regular expression.
+func ParsePathPattern(s string) (PathPattern, error) {
+	p := PathPattern{raw: s}
+	switch {
+	case strings.TrimSpace(s) == "":
+		return p, fmt.Errorf("empty path pattern: %w", errdefs.ErrInvalidArgument)
+	case strings.HasPrefix(s, regexpPatternPrefix):
+		re, err := regexp.Compile(strings.TrimPrefix(s, regexpPatternPrefix))
+		if err != nil {
+			return p, fmt.Errorf("invalid regular expression %q: %v: %w", s, err, errdefs.ErrInvalidArgument)
+		}
+		p.re = re
+	case strings.ContainsAny(s, "*?["):
+		re, err := globToRegexp(path.Clean("/" + s))
+		if err != nil {
+			return p, fmt.Errorf("invalid glob %q: %v: %w", s, err, errdefs.ErrInvalidArgument)
+		}
+		p.re = re
+	default:
+		p.literal = path.Clean("/" + s)
+		if p.literal == "/" {
+			return p, fmt.Errorf("the root directory can not be removed: %w", errdefs.ErrInvalidArgument)
+		}
+	}
+	return p, nil
+}
+
+// ParsePathPatterns parses patterns with ParsePathPattern.
+func ParsePathPatterns(patterns []string) ([]PathPattern, error) {
+	parsed := make([]PathPattern, 0, len(patterns))
+	for _, s := range patterns {
+		p, err := ParsePathPattern(s)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, p)
+	}
+	return parsed, nil
+}
+
+// String returns the pattern as it was given.
+func (p PathPattern) String() string {
+	return p.raw
+}
+
+// Match reports whether the absolute path name matches the pattern.
+func (p PathPattern) Match(name string) bool {
+	if p.re == nil {
+		return name == p.literal
+	}
+	return p.re.MatchString(name)
+}
+
+// globToRegexp translates a glob into an anchored regular expression. "*", "?" and character
+// classes do not match "/", while "**" matches anything, and "**/" any number of directories.
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class")
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// findPaths returns the paths of the root filesystem mounted at root matched by each pattern, in
+// the order of patterns. A matched directory is reported, not its content. The walk does not
+// follow symbolic links, and a plain path going through one is rejected, since the link would be
+// resolved on the host.
+func findPaths(root string, patterns []PathPattern) ([]PathMatch, error) {
+	matches := make([]PathMatch, len(patterns))
+	walk := false
+	for i, p := range patterns {
+		matches[i].Pattern = p.raw
+		if p.re != nil {
+			walk = true
+			continue
+		}
+		found, err := lstatInRoot(root, p.literal)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			matches[i].Paths = append(matches[i].Paths, p.literal)
+		}
+	}
+	if !walk {
+		return matches, nil
+	}
+	err := filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil || rel == "." {
+			return err
+		}
+		name := "/" + filepath.ToSlash(rel)
+		matched := false
+		for i, p := range patterns {
+			if p.re != nil && p.Match(name) {
+				matches[i].Paths = append(matches[i].Paths, name)
+				matched = true
+			}
+		}
+		if matched && d.IsDir() {
+			// the whole directory is removed
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk the rootfs: %w", err)
+	}
+	return matches, nil
+}
+
+// lstatInRoot reports whether the absolute path name exists in root, checking that none of its
+// parents is a symbolic link.
+func lstatInRoot(root string, name string) (bool, error) {
+	current := root
+	parts := strings.Split(strings.TrimPrefix(name, "/"), "/")
+	for i, part := range parts {
+		current = filepath.Join(current, part)
+		fi, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if i < len(parts)-1 && fi.Mode()&os.ModeSymlink != 0 {
+			return false, fmt.Errorf("path %q goes through the symbolic link %q, remove the link or its target instead: %w",
+				name, "/"+path.Join(parts[:i+1]...), errdefs.ErrInvalidArgument)
+		}
+	}
+	return true, nil
+}
+
+// matchedPaths returns the distinct paths of matches.
+func matchedPaths(matches []PathMatch) []string {
+	var paths []string
+	seen := map[string]bool{}
+	for _, m := range matches {
+		for _, p := range m.Paths {
+			if !seen[p] {
+				seen[p] = true
+				paths = append(paths, p)
+			}
+		}
+	}
+	return paths
+}
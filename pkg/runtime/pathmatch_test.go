@@ -0,0 +1,71 @@
+package runtime_test
+
+import (
+	"testing"
+
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+)
+
+func TestPathPattern(t *testing.T) {
+	for _, tc := range []struct {
+		pattern   string
+		matches   []string
+		unmatched []string
+	}{
+		{
+			pattern:   "/etc/passwd",
+			matches:   []string{"/etc/passwd"},
+			unmatched: []string{"/etc/passwd-", "/etc"},
+		},
+		{
+			pattern: "etc/../tmp/",
+			matches: []string{"/tmp"},
+		},
+		{
+			pattern:   "/var/cache/apt/**",
+			matches:   []string{"/var/cache/apt/archives", "/var/cache/apt/archives/partial/x.deb"},
+			unmatched: []string{"/var/cache/apt", "/var/cache/aptitude/x"},
+		},
+		{
+			pattern:   "**/*.pyc",
+			matches:   []string{"/a.pyc", "/usr/lib/python3/x.pyc"},
+			unmatched: []string{"/usr/lib/python3/x.py", "/usr/lib/x.pyc/y"},
+		},
+		{
+			pattern:   "/tmp/?.log",
+			matches:   []string{"/tmp/a.log"},
+			unmatched: []string{"/tmp/ab.log", "/tmp//.log"},
+		},
+		{
+			pattern:   "/tmp/[!a]*",
+			matches:   []string{"/tmp/b"},
+			unmatched: []string{"/tmp/a", "/tmp/b/c"},
+		},
+		{
+			pattern:   `re:^/root/\.(bash|zsh)_history$`,
+			matches:   []string{"/root/.bash_history", "/root/.zsh_history"},
+			unmatched: []string{"/root/.fish_history", "/home/root/.bash_history"},
+		},
+	} {
+		p, err := runtime.ParsePathPattern(tc.pattern)
+		if err != nil {
+			t.Errorf("%s: %v", tc.pattern, err)
+			continue
+		}
+		for _, name := range tc.matches {
+			if !p.Match(name) {
+				t.Errorf("%s: expected %s to match", tc.pattern, name)
+			}
+		}
+		for _, name := range tc.unmatched {
+			if p.Match(name) {
+				t.Errorf("%s: expected %s not to match", tc.pattern, name)
+			}
+		}
+	}
+	for _, invalid := range []string{"", "/", "/..", "re:(", "/tmp/[a"} {
+		if _, err := runtime.ParsePathPattern(invalid); err == nil {
+			t.Errorf("%q: expected an error", invalid)
+		}
+	}
+}
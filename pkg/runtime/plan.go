@@ -0,0 +1,203 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/containerd/containerd/pkg/progress"
+	imagesutil "github.com/lingdie/image-manip-server/pkg/images"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/identity"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Plan describes what an operation would do to an image, it is printed in dry-run mode.
+type Plan struct {
+	ImageRef     string `json:"image_ref"`
+	NewImageName string `json:"new_image_name"`
+	// SplitIndex is the index of the first layer of the image which is modified
+	SplitIndex int `json:"split_index"`
+	// BaseLayerCount is the number of layers of the new image which are kept from the base
+	BaseLayerCount int      `json:"base_layer_count"`
+	TodoList       TodoList `json:"todo_list,omitempty"`
+	// Layers is the layer chain of the new image
+	Layers        []PlannedLayer `json:"layers"`
+	ConfigChanges []ConfigChange `json:"config_changes,omitempty"`
+	// History holds the history entries of the new image above the base layers
+	History []ocispec.History `json:"history"`
+	// EstimatedSize is the estimated size of the unpacked new image, in bytes
+	EstimatedSize int64 `json:"estimated_size"`
+}
+
+// PlannedLayer is a layer of the new image.
+type PlannedLayer struct {
+	// Digest is the digest of a reused layer, it is empty for a layer to be created
+	Digest digest.Digest `json:"digest,omitempty"`
+	// Created is true if the layer does not exist yet
+	Created bool `json:"created"`
+	// Sources are the layers squashed into a layer to be created
+	Sources   []digest.Digest `json:"sources,omitempty"`
+	CreatedBy string          `json:"created_by"`
+	// Size is the unpacked size of the layer, estimated from the snapshot usage
+	Size int64 `json:"size"`
+}
+
+// newRebasePlan describes the new image a rebase would produce: the base layers, followed by
+// the groups of plan placed on top of them, and the config merged into origConfig.
+func (r *Runtime) newRebasePlan(ctx context.Context, target rebaseTarget, baseLayers LayerChain, plan layerPlan, todo TodoList, origConfig ocispec.Image, merge *ConfigMerge, info CommitInfo) (Plan, error) {
+	p := Plan{
+		ImageRef:       target.image.Image.Name,
+		SplitIndex:     target.firstLayerIndexToRebase,
+		BaseLayerCount: baseLayers.Len(),
+		TodoList:       todo,
+	}
+	baseHistories, _ := splitHistory(origConfig.History, baseLayers.Len())
+	for i, desc := range baseLayers.Descriptors {
+		size := r.layerUsage(ctx, baseLayers.DiffIDs[:i+1], desc)
+		p.Layers = append(p.Layers, PlannedLayer{
+			Digest:    desc.Digest,
+			CreatedBy: baseHistories[i].Layer.CreatedBy,
+			Size:      size,
+		})
+		p.EstimatedSize += size
+	}
+	// the layers of the groups are estimated from the snapshots of the original image
+	for _, group := range plan.groups {
+		entry := group.history(info)
+		layer := PlannedLayer{
+			CreatedBy: entry.CreatedBy,
+		}
+		for j, desc := range group.layers.Descriptors {
+			i := target.firstLayerIndexToRebase + group.indexes[j]
+			// the size of a squashed layer is at most the sum of its layers
+			layer.Size += r.layerUsage(ctx, target.layers.DiffIDs[:i+1], desc)
+		}
+		if group.layers.Len() == 1 {
+			layer.Digest = group.layers.Descriptors[0].Digest
+		} else {
+			layer.Created = true
+			for _, desc := range group.layers.Descriptors {
+				layer.Sources = append(layer.Sources, desc.Digest)
+			}
+		}
+		p.Layers = append(p.Layers, layer)
+		p.EstimatedSize += layer.Size
+		p.History = append(p.History, group.emptyLayers...)
+		p.History = append(p.History, entry)
+	}
+	p.History = append(p.History, plan.emptyLayers...)
+	p.History = append(p.History, target.trailingHistory...)
+	if merge != nil {
+		_, p.ConfigChanges = merge.Merge(origConfig.Config)
+	}
+	return p, nil
+}
+
+// newRemovePlan describes the new image a removal would produce: the layers of image,
+// followed by a layer to be created which holds the whiteouts of the paths matching patterns.
+func (r *Runtime) newRemovePlan(ctx context.Context, image imagesutil.Image, patterns []PathPattern, info CommitInfo) (Plan, error) {
+	layers, err := NewLayerChain(image.Manifest.Layers, image.Config.RootFS.DiffIDs)
+	if err != nil {
+		return Plan{}, err
+	}
+	p := Plan{
+		ImageRef:       image.Image.Name,
+		SplitIndex:     layers.Len(),
+		BaseLayerCount: layers.Len(),
+	}
+	histories, _ := splitHistory(image.Config.History, layers.Len())
+	for i, desc := range layers.Descriptors {
+		size := r.layerUsage(ctx, layers.DiffIDs[:i+1], desc)
+		p.Layers = append(p.Layers, PlannedLayer{
+			Digest:    desc.Digest,
+			CreatedBy: histories[i].Layer.CreatedBy,
+			Size:      size,
+		})
+		p.EstimatedSize += size
+	}
+	// a whiteout hides the file but does not shrink the layers below it
+	p.Layers = append(p.Layers, PlannedLayer{
+		Created:   true,
+		CreatedBy: removeCreatedBy(patterns),
+	})
+	created := info.Created
+	p.History = append(p.History, ocispec.History{
+		Created:   &created,
+		CreatedBy: removeCreatedBy(patterns),
+		Author:    info.Author,
+		Comment:   info.Comment,
+	})
+	return p, nil
+}
+
+// layerUsage returns the usage of the snapshot of the layer whose diffID is the last of diffIDs.
+// The size of the compressed blob is used if the layer is not unpacked.
+func (r *Runtime) layerUsage(ctx context.Context, diffIDs []digest.Digest, desc ocispec.Descriptor) int64 {
+	chainID := identity.ChainID(diffIDs).String()
+	usage, err := r.snapshotter.Usage(ctx, chainID)
+	if err != nil {
+		r.Debugf("failed to get usage of snapshot %q, using the blob size: %v", chainID, err)
+		return desc.Size
+	}
+	return usage.Size
+}
+
+// Print writes the plan in a human readable form.
+func (p Plan) Print(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 4, 8, 4, ' ', 0)
+	fmt.Fprintf(w, "IMAGE:\t%s\n", p.ImageRef)
+	fmt.Fprintf(w, "NEW IMAGE:\t%s\n", p.NewImageName)
+	fmt.Fprintf(w, "SPLIT INDEX:\t%d\n", p.SplitIndex)
+	fmt.Fprintf(w, "ESTIMATED SIZE:\t%s\n", progress.Bytes(p.EstimatedSize))
+	if len(p.TodoList) > 0 {
+		fmt.Fprintln(w, "\nTODO LIST:")
+		for _, item := range p.TodoList {
+			fmt.Fprintf(w, "%s\n", item)
+		}
+	}
+	fmt.Fprintln(w, "\nLAYERS:")
+	fmt.Fprintln(w, "INDEX\tLAYER\tACTION\tSIZE\tCREATED BY")
+	for i, l := range p.Layers {
+		var (
+			layer  = l.Digest.String()
+			action = "reuse"
+		)
+		switch {
+		case i < p.BaseLayerCount:
+			action = "base"
+		case l.Created && len(l.Sources) > 0:
+			action = fmt.Sprintf("squash %d layers", len(l.Sources))
+			layer = "<new>"
+		case l.Created:
+			action = "create"
+			layer = "<new>"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", i, layer, action, progress.Bytes(l.Size), planText(l.CreatedBy))
+	}
+	if len(p.ConfigChanges) > 0 {
+		fmt.Fprintln(w, "\nCONFIG CHANGES:")
+		fmt.Fprintln(w, "FIELD\tAPPLICATION\tNEW IMAGE")
+		for _, c := range p.ConfigChanges {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", c.Field, planText(c.From), planText(c.To))
+		}
+	}
+	fmt.Fprintln(w, "\nNEW HISTORY:")
+	fmt.Fprintln(w, "EMPTY\tCREATED BY\tCOMMENT")
+	for _, h := range p.History {
+		fmt.Fprintf(w, "%t\t%s\t%s\n", h.EmptyLayer, planText(h.CreatedBy), planText(h.Comment))
+	}
+	return w.Flush()
+}
+
+// planText flattens and truncates a value so that it fits in a table cell. It is truncated by
+// runes, so that a multi-byte character is never cut.
+func planText(s string) string {
+	s = strings.ReplaceAll(s, "\n", "; ")
+	if runes := []rune(s); len(runes) > 45 {
+		s = string(runes[:44]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,26 @@
+package runtime_test
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+)
+
+func TestPlanText(t *testing.T) {
+	if got := runtime.PlanText("RUN make\nRUN make install"); got != "RUN make; RUN make install" {
+		t.Errorf("expected the lines to be joined, got %q", got)
+	}
+	short := strings.Repeat("é", 45)
+	if got := runtime.PlanText(short); got != short {
+		t.Errorf("expected 45 runes to be kept, got %q", got)
+	}
+	got := runtime.PlanText("RUN echo " + strings.Repeat("日本語", 20))
+	if !utf8.ValidString(got) {
+		t.Errorf("expected valid UTF-8, got %q", got)
+	}
+	if n := utf8.RuneCountInString(got); n != 45 || !strings.HasSuffix(got, "…") {
+		t.Errorf("expected 44 runes and an ellipsis, got %d runes: %q", n, got)
+	}
+}
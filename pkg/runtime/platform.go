@@ -0,0 +1,241 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/platforms"
+	imagesutil "github.com/lingdie/image-manip-server/pkg/images"
+	"github.com/lingdie/image-manip-server/pkg/options"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// the annotations of the attestation manifests of buildkit, referring to the manifest they attest
+	attestationReferenceTypeAnnotation   = "vnd.docker.reference.type"
+	attestationReferenceDigestAnnotation = "vnd.docker.reference.digest"
+	attestationManifestType              = "attestation-manifest"
+)
+
+// GetPlatformImage returns the image imageRef refers to, for the given platform. If the image is an
+// index, the best manifest for the platform is selected, or for the default platform if platform is nil.
+// If it is a single manifest, its config must match the platform.
+func (r *Runtime) GetPlatformImage(ctx context.Context, imageRef string, platform *ocispec.Platform) (imagesutil.Image, error) {
+	imageName, err := r.FindImage(ctx, imageRef)
+	if err != nil {
+		return imagesutil.Image{}, err
+	}
+	img, err := r.imagestore.Get(ctx, imageName)
+	if err != nil {
+		return imagesutil.Image{}, err
+	}
+	var opt options.PlatformOptions
+	if platform != nil {
+		opt.Platforms = []string{platforms.Format(*platform)}
+	}
+	manifests, _, err := r.selectManifests(ctx, img, opt)
+	if err != nil {
+		return imagesutil.Image{}, err
+	}
+	return r.readImage(ctx, img, manifests[0])
+}
+
+// readImage reads the manifest manifestDesc of img and its config.
+func (r *Runtime) readImage(ctx context.Context, img images.Image, manifestDesc ocispec.Descriptor) (imagesutil.Image, error) {
+	var manifest ocispec.Manifest
+	if err := r.readJSON(ctx, manifestDesc, &manifest); err != nil {
+		return imagesutil.Image{}, fmt.Errorf("failed to read manifest of image %s: %w", img.Name, err)
+	}
+	var config ocispec.Image
+	if err := r.readJSON(ctx, manifest.Config, &config); err != nil {
+		return imagesutil.Image{}, fmt.Errorf("failed to read config of image %s: %w", img.Name, err)
+	}
+	clientImage := containerd.NewImage(r.client, img)
+	if manifestDesc.Platform != nil {
+		clientImage = containerd.NewImageWithPlatform(r.client, img, platforms.Only(*manifestDesc.Platform))
+	}
+	return imagesutil.Image{
+		ClientImage:  clientImage,
+		Config:       config,
+		Image:        img,
+		Manifest:     &manifest,
+		ManifestDesc: manifestDesc,
+	}, nil
+}
+
+func (r *Runtime) readJSON(ctx context.Context, desc ocispec.Descriptor, v interface{}) error {
+	b, err := content.ReadBlob(ctx, r.contentstore, desc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// selectManifests returns the manifests of img an operation applies to according to opt, along with the
+// index of img, nil if img is a single manifest. The manifests of an index have their Platform set.
+func (r *Runtime) selectManifests(ctx context.Context, img images.Image, opt options.PlatformOptions) ([]ocispec.Descriptor, *ocispec.Index, error) {
+	switch {
+	case images.IsManifestType(img.Target.MediaType):
+		if len(opt.Platforms) > 0 && !opt.AllPlatforms {
+			if err := r.checkManifestPlatform(ctx, img, opt.Platforms); err != nil {
+				return nil, nil, err
+			}
+		}
+		return []ocispec.Descriptor{img.Target}, nil, nil
+	case images.IsIndexType(img.Target.MediaType):
+	default:
+		return nil, nil, fmt.Errorf("image %s has an unsupported media type %q: %w", img.Name, img.Target.MediaType, errdefs.ErrNotImplemented)
+	}
+	var index ocispec.Index
+	if err := r.readJSON(ctx, img.Target, &index); err != nil {
+		return nil, nil, fmt.Errorf("failed to read index of image %s: %w", img.Name, err)
+	}
+	var selected []ocispec.Descriptor
+	if opt.AllPlatforms {
+		for _, desc := range index.Manifests {
+			if isPlatformManifest(desc) {
+				selected = append(selected, desc)
+			}
+		}
+	} else {
+		matchers := []platforms.MatchComparer{platforms.Default()}
+		if len(opt.Platforms) > 0 {
+			matchers = matchers[:0]
+			for _, p := range opt.Platforms {
+				platform, err := platforms.Parse(p)
+				if err != nil {
+					return nil, nil, fmt.Errorf("invalid platform %q: %w", p, errdefs.ErrInvalidArgument)
+				}
+				matchers = append(matchers, platforms.Only(platform))
+			}
+		}
+		for i, matcher := range matchers {
+			desc, ok := bestManifest(index.Manifests, matcher)
+			if !ok {
+				name := "the default platform"
+				if len(opt.Platforms) > 0 {
+					name = fmt.Sprintf("platform %s", opt.Platforms[i])
+				}
+				return nil, nil, fmt.Errorf("image %s has no manifest for %s: %w", img.Name, name, errdefs.ErrNotFound)
+			}
+			if !containsDescriptor(selected, desc) {
+				selected = append(selected, desc)
+			}
+		}
+	}
+	if len(selected) == 0 {
+		return nil, nil, fmt.Errorf("image %s has no platform manifest: %w", img.Name, errdefs.ErrNotFound)
+	}
+	for _, desc := range selected {
+		if _, err := r.contentstore.Info(ctx, desc.Digest); err != nil {
+			return nil, nil, fmt.Errorf("the manifest of platform %s of image %s is not available locally, pull it first: %w",
+				platforms.Format(*desc.Platform), img.Name, err)
+		}
+	}
+	return selected, &index, nil
+}
+
+// checkManifestPlatform checks that the config of the single manifest image img matches one of the platforms.
+func (r *Runtime) checkManifestPlatform(ctx context.Context, img images.Image, platformSpecs []string) error {
+	image, err := r.readImage(ctx, img, img.Target)
+	if err != nil {
+		return err
+	}
+	for _, p := range platformSpecs {
+		platform, err := platforms.Parse(p)
+		if err != nil {
+			return fmt.Errorf("invalid platform %q: %w", p, errdefs.ErrInvalidArgument)
+		}
+		if platforms.Only(platform).Match(image.Config.Platform) {
+			return nil
+		}
+	}
+	return fmt.Errorf("image %s is a single %s image, it has no manifest for %v: %w",
+		img.Name, platforms.Format(image.Config.Platform), platformSpecs, errdefs.ErrNotFound)
+}
+
+// isPlatformManifest returns whether desc is the manifest of a platform, rather than e.g. an attestation.
+func isPlatformManifest(desc ocispec.Descriptor) bool {
+	return images.IsManifestType(desc.MediaType) && desc.Platform != nil && desc.Platform.OS != "unknown" &&
+		desc.Annotations[attestationReferenceTypeAnnotation] == ""
+}
+
+// bestManifest returns the platform manifest best matching matcher.
+func bestManifest(manifests []ocispec.Descriptor, matcher platforms.MatchComparer) (ocispec.Descriptor, bool) {
+	var (
+		best  ocispec.Descriptor
+		found bool
+	)
+	for _, desc := range manifests {
+		if !isPlatformManifest(desc) || !matcher.Match(*desc.Platform) {
+			continue
+		}
+		if !found || matcher.Less(*desc.Platform, *best.Platform) {
+			best = desc
+			found = true
+		}
+	}
+	return best, found
+}
+
+func containsDescriptor(descs []ocispec.Descriptor, desc ocispec.Descriptor) bool {
+	for _, d := range descs {
+		if d.Digest == desc.Digest {
+			return true
+		}
+	}
+	return false
+}
+
+// writeImageIndex writes a copy of index, whose media type is indexDesc's, in which the manifests are replaced
+// according to replaced, by digest. The replacements keep the platform and the annotations of the original
+// manifests. The attestations of the replaced manifests are dropped, since they do not apply to the new ones.
+// If format is set, the index is written in that format, otherwise in the format of indexDesc.
+func (r *Runtime) writeImageIndex(ctx context.Context, indexDesc ocispec.Descriptor, index ocispec.Index, replaced map[digest.Digest]ocispec.Descriptor, format string) (ocispec.Descriptor, error) {
+	var manifests []ocispec.Descriptor
+	for _, desc := range index.Manifests {
+		if desc.Annotations[attestationReferenceTypeAnnotation] == attestationManifestType {
+			if _, ok := replaced[digest.Digest(desc.Annotations[attestationReferenceDigestAnnotation])]; ok {
+				r.Infof("drop the attestation %s of rewritten manifest %s", desc.Digest, desc.Annotations[attestationReferenceDigestAnnotation])
+				continue
+			}
+		}
+		if newDesc, ok := replaced[desc.Digest]; ok {
+			desc.MediaType = newDesc.MediaType
+			desc.Digest = newDesc.Digest
+			desc.Size = newDesc.Size
+		}
+		manifests = append(manifests, desc)
+	}
+	index.Manifests = manifests
+	if format != "" {
+		index.MediaType = indexMediaType(format)
+	} else if index.MediaType == "" {
+		index.MediaType = indexDesc.MediaType
+	}
+	indexJSON, err := json.Marshal(index)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	newDesc := ocispec.Descriptor{
+		MediaType: index.MediaType,
+		Digest:    digest.FromBytes(indexJSON),
+		Size:      int64(len(indexJSON)),
+	}
+	// the index references the manifests of all the platforms
+	labels := map[string]string{}
+	for i, desc := range manifests {
+		labels[fmt.Sprintf("containerd.io/gc.ref.content.m.%d", i)] = desc.Digest.String()
+	}
+	if err := content.WriteBlob(ctx, r.contentstore, newDesc.Digest.String(), bytes.NewReader(indexJSON), newDesc, content.WithLabels(labels)); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	return newDesc, nil
+}
@@ -0,0 +1,260 @@
+package runtime_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	goruntime "runtime"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/content/local"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/platforms"
+	"github.com/lingdie/image-manip-server/pkg/options"
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	attestationTypeAnnotation   = "vnd.docker.reference.type"
+	attestationDigestAnnotation = "vnd.docker.reference.digest"
+)
+
+// multiPlatformImage is an index for amd64, arm64/v8 and arm/v7 with the attestations of buildkit,
+// written to a content store along with its manifests.
+type multiPlatformImage struct {
+	store                              content.Store
+	image                              images.Image
+	index                              ocispec.Index
+	amd64, arm64, armv7                ocispec.Descriptor
+	amd64Attestation, arm64Attestation ocispec.Descriptor
+}
+
+func writeJSONBlob(t *testing.T, store content.Store, mediaType string, v interface{}) ocispec.Descriptor {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := ocispec.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(b), Size: int64(len(b))}
+	if err := content.WriteBlob(context.Background(), store, desc.Digest.String(), bytes.NewReader(b), desc); err != nil {
+		t.Fatal(err)
+	}
+	return desc
+}
+
+func writeIndex(t *testing.T, store content.Store, manifests ...ocispec.Descriptor) (images.Image, ocispec.Index) {
+	t.Helper()
+	index := ocispec.Index{MediaType: ocispec.MediaTypeImageIndex, Manifests: manifests}
+	index.SchemaVersion = 2
+	return images.Image{
+		Name:   "docker.io/library/app:latest",
+		Target: writeJSONBlob(t, store, ocispec.MediaTypeImageIndex, index),
+	}, index
+}
+
+func newMultiPlatformImage(t *testing.T) multiPlatformImage {
+	store, err := local.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := multiPlatformImage{store: store}
+	manifest := func(platform ocispec.Platform, annotations map[string]string) ocispec.Descriptor {
+		desc := writeJSONBlob(t, store, ocispec.MediaTypeImageManifest, ocispec.Manifest{
+			MediaType: ocispec.MediaTypeImageManifest,
+			Config:    ocispec.Descriptor{MediaType: ocispec.MediaTypeImageConfig, Digest: digest.FromString(platforms.Format(platform))},
+		})
+		desc.Platform = &platform
+		desc.Annotations = annotations
+		return desc
+	}
+	attestation := func(of ocispec.Descriptor) ocispec.Descriptor {
+		return manifest(ocispec.Platform{Architecture: "unknown", OS: "unknown"}, map[string]string{
+			attestationTypeAnnotation:   "attestation-manifest",
+			attestationDigestAnnotation: of.Digest.String(),
+		})
+	}
+	m.amd64 = manifest(ocispec.Platform{Architecture: "amd64", OS: "linux"}, nil)
+	m.arm64 = manifest(ocispec.Platform{Architecture: "arm64", OS: "linux", Variant: "v8"}, map[string]string{"org.opencontainers.image.ref.name": "arm64"})
+	m.armv7 = manifest(ocispec.Platform{Architecture: "arm", OS: "linux", Variant: "v7"}, nil)
+	m.amd64Attestation = attestation(m.amd64)
+	m.arm64Attestation = attestation(m.arm64)
+	m.image, m.index = writeIndex(t, store, m.amd64, m.arm64, m.armv7, m.amd64Attestation, m.arm64Attestation)
+	return m
+}
+
+func TestSelectManifests(t *testing.T) {
+	m := newMultiPlatformImage(t)
+	r := runtime.NewContentStoreRuntime(m.store)
+	for _, tc := range []struct {
+		name     string
+		opt      options.PlatformOptions
+		expected []ocispec.Descriptor
+		check    func(error) bool
+	}{
+		{
+			name:     "a platform",
+			opt:      options.PlatformOptions{Platforms: []string{"linux/arm64"}},
+			expected: []ocispec.Descriptor{m.arm64},
+		},
+		{
+			name:     "several platforms selected once",
+			opt:      options.PlatformOptions{Platforms: []string{"linux/arm/v7", "linux/amd64", "linux/arm64/v8", "linux/arm64"}},
+			expected: []ocispec.Descriptor{m.armv7, m.amd64, m.arm64},
+		},
+		{
+			name:     "all platforms but the attestations",
+			opt:      options.PlatformOptions{AllPlatforms: true, Platforms: []string{"linux/amd64"}},
+			expected: []ocispec.Descriptor{m.amd64, m.arm64, m.armv7},
+		},
+		{
+			name:  "no manifest for the platform",
+			opt:   options.PlatformOptions{Platforms: []string{"windows/amd64"}},
+			check: errdefs.IsNotFound,
+		},
+		{
+			name:  "attestations are not platforms",
+			opt:   options.PlatformOptions{Platforms: []string{"unknown/unknown"}},
+			check: errdefs.IsNotFound,
+		},
+		{
+			name:  "invalid platform",
+			opt:   options.PlatformOptions{Platforms: []string{"linux//"}},
+			check: errdefs.IsInvalidArgument,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			selected, index, err := runtime.SelectManifests(r, context.Background(), m.image, tc.opt)
+			if tc.check != nil {
+				if !tc.check(err) {
+					t.Fatalf("unexpected error %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(selected, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, selected)
+			}
+			if !reflect.DeepEqual(*index, m.index) {
+				t.Errorf("expected the index of the image, got %+v", *index)
+			}
+		})
+	}
+
+	// a platform whose manifest has not been pulled can not be manipulated
+	s390x := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Digest:    digest.FromString("s390x"),
+		Size:      5,
+		Platform:  &ocispec.Platform{Architecture: "s390x", OS: "linux"},
+	}
+	img, _ := writeIndex(t, m.store, m.amd64, s390x)
+	if _, _, err := runtime.SelectManifests(r, context.Background(), img, options.PlatformOptions{AllPlatforms: true}); !errdefs.IsNotFound(err) {
+		t.Errorf("expected a manifest not pulled to be reported, got %v", err)
+	}
+	if selected, _, err := runtime.SelectManifests(r, context.Background(), img, options.PlatformOptions{Platforms: []string{"linux/amd64"}}); err != nil || len(selected) != 1 {
+		t.Errorf("expected the pulled platform to be selected, got %v %v", selected, err)
+	}
+}
+
+func TestWriteImageIndex(t *testing.T) {
+	m := newMultiPlatformImage(t)
+	r := runtime.NewContentStoreRuntime(m.store)
+	ctx := context.Background()
+	// the arm64 manifest is rewritten, e.g. by a rebase of that platform only
+	newArm64 := writeJSONBlob(t, m.store, images.MediaTypeDockerSchema2Manifest, ocispec.Manifest{
+		MediaType: images.MediaTypeDockerSchema2Manifest,
+		Config:    ocispec.Descriptor{MediaType: images.MediaTypeDockerSchema2Config, Digest: digest.FromString("rebased")},
+	})
+	replaced := map[digest.Digest]ocispec.Descriptor{m.arm64.Digest: newArm64}
+	for _, tc := range []struct {
+		name      string
+		format    string
+		mediaType string
+	}{
+		{name: "format kept", mediaType: ocispec.MediaTypeImageIndex},
+		{name: "docker format", format: runtime.ManifestFormatDocker, mediaType: images.MediaTypeDockerSchema2ManifestList},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			desc, err := runtime.WriteImageIndex(r, ctx, m.image.Target, m.index, replaced, tc.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if desc.MediaType != tc.mediaType {
+				t.Errorf("expected media type %s, got %s", tc.mediaType, desc.MediaType)
+			}
+			b, err := content.ReadBlob(ctx, m.store, desc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var index ocispec.Index
+			if err := json.Unmarshal(b, &index); err != nil {
+				t.Fatal(err)
+			}
+			// the rewritten manifest keeps its platform, variant included, and its annotations
+			arm64 := m.arm64
+			arm64.MediaType = newArm64.MediaType
+			arm64.Digest = newArm64.Digest
+			arm64.Size = newArm64.Size
+			// the attestation of the rewritten manifest is dropped, the other platforms are carried over unchanged
+			expected := []ocispec.Descriptor{m.amd64, arm64, m.armv7, m.amd64Attestation}
+			if !reflect.DeepEqual(index.Manifests, expected) {
+				t.Errorf("expected manifests %+v, got %+v", expected, index.Manifests)
+			}
+			if index.MediaType != tc.mediaType {
+				t.Errorf("expected the index media type %s, got %s", tc.mediaType, index.MediaType)
+			}
+		})
+	}
+	// the original index is left as it is
+	if len(m.index.Manifests) != 5 || m.index.Manifests[1].Digest != m.arm64.Digest {
+		t.Errorf("the original index has been changed: %+v", m.index.Manifests)
+	}
+}
+
+func TestGenerateMergedImageConfigPlatform(t *testing.T) {
+	r := &runtime.Runtime{Logger: logrus.New()}
+	info, err := runtime.NewCommitInfo(options.CommitOptions{Created: "0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name     string
+		platform ocispec.Platform
+		expected ocispec.Platform
+	}{
+		{
+			name:     "variant kept",
+			platform: ocispec.Platform{Architecture: "arm64", OS: "linux", Variant: "v8"},
+			expected: ocispec.Platform{Architecture: "arm64", OS: "linux", Variant: "v8"},
+		},
+		{
+			name:     "OS version and features kept",
+			platform: ocispec.Platform{Architecture: "amd64", OS: "windows", OSVersion: "10.0.20348.2113", OSFeatures: []string{"win32k"}},
+			expected: ocispec.Platform{Architecture: "amd64", OS: "windows", OSVersion: "10.0.20348.2113", OSFeatures: []string{"win32k"}},
+		},
+		{
+			name:     "missing platform assumed",
+			platform: ocispec.Platform{Variant: "v7"},
+			expected: ocispec.Platform{Architecture: goruntime.GOARCH, OS: goruntime.GOOS, Variant: "v7"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := r.GenerateMergedImageConfig(context.Background(), ocispec.Image{Platform: tc.platform},
+				runtime.LayerChain{}, runtime.LayerChain{}, nil, nil, info)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(config.Platform, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, config.Platform)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package runtime
+
+import (
+	"context"
+	"time"
+
+	"github.com/lingdie/image-manip-server/pkg/timer"
+)
+
+// Progress is an event reported while an operation runs: a step has started (e.g. a layer is being
+// applied), or a tracked step has completed, in which case Duration is set.
+type Progress struct {
+	Time time.Time `json:"time"`
+	Step string    `json:"step"`
+	// Message describes the step, e.g. the digest of the layer being applied
+	Message string `json:"message,omitempty"`
+	// Current and Total count the items of the step, e.g. the layers to apply
+	Current int `json:"current,omitempty"`
+	Total   int `json:"total,omitempty"`
+	// Duration is in nanoseconds once marshaled to JSON
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+// ProgressFunc receives the progress of an operation. It is called synchronously and must not block.
+type ProgressFunc func(Progress)
+
+type progressKey struct{}
+
+// WithProgress returns a context in which the operations of the runtime report their progress to fn.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// reportProgress reports p to the progress function of ctx, if any.
+func reportProgress(ctx context.Context, p Progress) {
+	fn, ok := ctx.Value(progressKey{}).(ProgressFunc)
+	if !ok {
+		return
+	}
+	if p.Time.IsZero() {
+		p.Time = time.Now()
+	}
+	fn(p)
+}
+
+// track tracks a step like Track and reports its completion to the progress function of ctx.
+func (r *Runtime) track(ctx context.Context, start time.Time, name string) {
+	r.Track(start, name)
+	reportProgress(ctx, Progress{Step: name, Duration: time.Since(start)})
+}
+
+// record records a step like Record and reports its completion to the progress function of ctx.
+func (r *Runtime) record(ctx context.Context, timings *[]timer.Timing, start time.Time, name string) {
+	r.Record(timings, start, name)
+	reportProgress(ctx, Progress{Step: name, Duration: time.Since(start)})
+}
@@ -0,0 +1,261 @@
+package runtime
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/archive/compression"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/stargz-snapshotter/estargz"
+	imagesutil "github.com/lingdie/image-manip-server/pkg/images"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// PurgedLayer is a layer of an image rewritten by a purge, without the paths it contained.
+type PurgedLayer struct {
+	// Index is the position of the layer in the image, from the bottom
+	Index  int           `json:"index"`
+	Digest digest.Digest `json:"digest"`
+	// NewDigest and NewDiffID describe the rewritten layer, they are empty in dry-run mode
+	NewDigest digest.Digest `json:"new_digest,omitempty"`
+	NewDiffID digest.Digest `json:"new_diff_id,omitempty"`
+	// Paths are the paths purged from the layer
+	Paths []string `json:"paths"`
+}
+
+// estargzEntries are the tar entries added by estargz, they are dropped from a rewritten layer since
+// its table of contents does not apply anymore.
+var estargzEntries = map[string]bool{
+	estargz.TOCTarName:         true,
+	estargz.PrefetchLandmark:   true,
+	estargz.NoPrefetchLandmark: true,
+}
+
+// purgeCreatedBy returns the description of a purge of patterns.
+func purgeCreatedBy(patterns []PathPattern) string {
+	return "purge" + strings.TrimPrefix(removeCreatedBy(patterns), "remove")
+}
+
+// purgePlatform removes the paths matching patterns from every layer of image, the manifest of one
+// platform of the image, instead of hiding them behind whiteouts, and writes the new manifest without
+// updating the image store. The layers below the first one containing a match are kept, the ones
+// containing a match are rewritten and the others are reused on top of them. The history is kept as
+// it is, and an empty layer entry records the purge. In dry-run mode, the layers are only scanned. A pattern matching nothing is an error, unless
+// allowNoMatch is set.
+func (r *Runtime) purgePlatform(ctx context.Context, image imagesutil.Image, patterns []PathPattern, allowNoMatch bool, dryRun bool, info CommitInfo) (platformRemoval, error) {
+	p := platformRemoval{image: image}
+	info = info.forManifest(image.ManifestDesc.MediaType)
+	layers, err := NewLayerChain(image.Manifest.Layers, image.Config.RootFS.DiffIDs)
+	if err != nil {
+		r.Errorf("failed to create layer chain for original image %q: %v", image.Image.Name, err)
+		return p, err
+	}
+	p.layers = layers
+	p.matches = make([]PathMatch, len(patterns))
+	for i, pattern := range patterns {
+		p.matches[i].Pattern = pattern.String()
+	}
+	var (
+		newLayers  = NewEmptyLayerChain()
+		firstPurge = -1
+	)
+	for i := 0; i < layers.Len(); i++ {
+		layer, err := layers.GetLayerByIndex(i)
+		if err != nil {
+			return p, err
+		}
+		reportProgress(ctx, Progress{Step: "purgeLayer", Message: layer.Desc.Digest.String(), Current: i + 1, Total: layers.Len()})
+		if images.IsNonDistributable(layer.Desc.MediaType) {
+			r.Warnf("layer %s is non-distributable, it is not purged", layer.Desc.Digest)
+			newLayers.AppendLayer(layer)
+			continue
+		}
+		matches, err := r.filterLayer(ctx, layer, patterns, nil)
+		if err != nil {
+			return p, err
+		}
+		paths := matchedPaths(matches)
+		if len(paths) == 0 {
+			newLayers.AppendLayer(layer)
+			continue
+		}
+		for j, m := range matches {
+			p.matches[j].Paths = appendMissing(p.matches[j].Paths, m.Paths...)
+		}
+		purged := PurgedLayer{Index: i, Digest: layer.Desc.Digest, Paths: paths}
+		if !dryRun {
+			layer, err = r.purgeLayer(ctx, layer, patterns, info)
+			if err != nil {
+				return p, err
+			}
+			purged.NewDigest = layer.Desc.Digest
+			purged.NewDiffID = layer.DiffID
+		}
+		if firstPurge < 0 {
+			firstPurge = i
+		}
+		p.purged = append(p.purged, purged)
+		newLayers.AppendLayer(layer)
+	}
+	if err := r.checkMatches(p.matches, allowNoMatch); err != nil {
+		return p, err
+	}
+	if dryRun || firstPurge < 0 {
+		return p, nil
+	}
+	baseLayers, err := NewLayerChain(layers.Descriptors[:firstPurge], layers.DiffIDs[:firstPurge])
+	if err != nil {
+		return p, err
+	}
+	rewritten, err := NewLayerChain(newLayers.Descriptors[firstPurge:], newLayers.DiffIDs[firstPurge:])
+	if err != nil {
+		return p, err
+	}
+	newHistory := purgeHistory(image.Config.History, layers.Len(), firstPurge, patterns, info)
+	written, err := r.WriteBack(ctx, image.Config, baseLayers, rewritten, newHistory, nil, image.Manifest.Annotations, info)
+	if err != nil {
+		r.Errorf("failed to write back image %q: %v", image.Image.Name, err)
+		return p, err
+	}
+	p.written = &written
+	return p, nil
+}
+
+// purgeHistory returns the history entries of the layers from firstPurge of an image of layerCount
+// layers. The layers keep their entries, the trailing empty layer entries included, followed by an
+// empty layer entry recording the purge, since the layers are rewritten in place.
+func purgeHistory(history []ocispec.History, layerCount, firstPurge int, patterns []PathPattern, info CommitInfo) []ocispec.History {
+	histories, trailing := splitHistory(history, layerCount)
+	var newHistory []ocispec.History
+	for _, h := range histories[firstPurge:] {
+		newHistory = append(newHistory, h.Entries()...)
+	}
+	newHistory = append(newHistory, trailing...)
+	return append(newHistory, ocispec.History{
+		CreatedBy:  purgeCreatedBy(patterns),
+		Author:     info.Author,
+		Comment:    info.Comment,
+		EmptyLayer: true,
+	})
+}
+
+// purgeLayer rewrites layer without the entries matched by patterns, and compresses it with the
+// compression of info. The new layer has a new diffID.
+func (r *Runtime) purgeLayer(ctx context.Context, layer Layer, patterns []PathPattern, info CommitInfo) (Layer, error) {
+	defer r.track(ctx, time.Now(), fmt.Sprintf("purgeLayer %s", layer.Desc.Digest))
+	mediaType := compressedMediaType(layer.Desc.MediaType, CompressionGzip)
+	newLayer, err := r.writeTarLayer(ctx, mediaType, "purge", func(tw *tar.Writer) error {
+		_, err := r.filterLayer(ctx, layer, patterns, tw)
+		return err
+	})
+	if err != nil {
+		return layer, fmt.Errorf("failed to write purged layer: %w", err)
+	}
+	r.Infof("layer %s purged to %s", layer.Desc.Digest, newLayer.Desc.Digest)
+	return r.compressLayer(ctx, newLayer, info.Compression)
+}
+
+// filterLayer reads the tar of layer and returns the paths matched by each pattern, in the order of
+// patterns. If tw is not nil, the entries which are not matched are copied to it. A matched directory
+// is reported, not its content, which is dropped along with it, and so are the hard links to dropped
+// files. The entries of the estargz table of contents are dropped as well.
+func (r *Runtime) filterLayer(ctx context.Context, layer Layer, patterns []PathPattern, tw *tar.Writer) ([]PathMatch, error) {
+	ra, err := r.contentstore.ReaderAt(ctx, layer.Desc)
+	if err != nil {
+		return nil, err
+	}
+	defer ra.Close()
+	ds, err := compression.DecompressStream(content.NewReader(ra))
+	if err != nil {
+		return nil, err
+	}
+	defer ds.Close()
+	matches, err := filterTar(ds, patterns, tw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read layer %s: %w", layer.Desc.Digest, err)
+	}
+	return matches, nil
+}
+
+// filterTar reads the uncompressed tar r like filterLayer.
+func filterTar(r io.Reader, patterns []PathPattern, tw *tar.Writer) ([]PathMatch, error) {
+	matches := make([]PathMatch, len(patterns))
+	for i, p := range patterns {
+		matches[i].Pattern = p.String()
+	}
+	// dropped maps the dropped entries to the pattern which matched them
+	dropped := map[string]int{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := path.Clean("/" + hdr.Name)
+		matched, i := matchAncestors(name, patterns)
+		if matched == "" && hdr.Typeflag == tar.TypeLink {
+			if j, ok := dropped[path.Clean("/"+hdr.Linkname)]; ok {
+				matched, i = name, j
+			}
+		}
+		if matched != "" {
+			dropped[name] = i
+			matches[i].Paths = appendMissing(matches[i].Paths, matched)
+			continue
+		}
+		if tw == nil || estargzEntries[hdr.Name] {
+			continue
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return nil, err
+		}
+	}
+	return matches, nil
+}
+
+// matchAncestors returns the topmost of name and its parents matched by a pattern, along with the
+// index of the pattern, or an empty path if none is matched.
+func matchAncestors(name string, patterns []PathPattern) (string, int) {
+	var ancestors []string
+	for p := name; p != "/" && p != "."; p = path.Dir(p) {
+		ancestors = append(ancestors, p)
+	}
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		for j, pattern := range patterns {
+			if pattern.Match(ancestors[i]) {
+				return ancestors[i], j
+			}
+		}
+	}
+	return "", 0
+}
+
+// appendMissing appends the values which are not in list yet.
+func appendMissing(list []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, l := range list {
+			if l == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,200 @@
+package runtime_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// tarOf returns a tar of the given headers, the regular files holding their name as content.
+func tarOf(t *testing.T, headers ...tar.Header) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, h := range headers {
+		h := h
+		var content string
+		if h.Typeflag == tar.TypeReg {
+			content = h.Name
+			h.Size = int64(len(content))
+		}
+		if h.Mode == 0 {
+			h.Mode = 0o644
+		}
+		if err := tw.WriteHeader(&h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func dir(name string) tar.Header {
+	return tar.Header{Typeflag: tar.TypeDir, Name: name, Mode: 0o755}
+}
+
+func file(name string) tar.Header {
+	return tar.Header{Typeflag: tar.TypeReg, Name: name}
+}
+
+func hardLink(name, target string) tar.Header {
+	return tar.Header{Typeflag: tar.TypeLink, Name: name, Linkname: target}
+}
+
+func TestFilterTar(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		entries  []tar.Header
+		patterns []string
+		// matched are the paths matched by each pattern
+		matched [][]string
+		// kept are the names of the entries left in the tar
+		kept []string
+	}{
+		{
+			name:     "matched directory and its children",
+			entries:  []tar.Header{dir("etc/"), dir("etc/secret/"), file("etc/secret/key"), dir("etc/secret/sub/"), file("etc/secret/sub/cert"), file("etc/passwd")},
+			patterns: []string{"/etc/secret"},
+			matched:  [][]string{{"/etc/secret"}},
+			kept:     []string{"etc/", "etc/passwd"},
+		},
+		{
+			name: "hard links to a purged file",
+			// the link names sort before and after the name of their target
+			entries:  []tar.Header{file("m-secret"), hardLink("a-link", "m-secret"), hardLink("z-link", "./m-secret"), file("keep")},
+			patterns: []string{"/m-secret"},
+			matched:  [][]string{{"/m-secret", "/a-link", "/z-link"}},
+			kept:     []string{"keep"},
+		},
+		{
+			name:     "purged hard link keeps its target",
+			entries:  []tar.Header{file("m-secret"), hardLink("a-link", "m-secret"), hardLink("z-link", "m-secret")},
+			patterns: []string{"/z-link"},
+			matched:  [][]string{{"/z-link"}},
+			kept:     []string{"m-secret", "a-link"},
+		},
+		{
+			name: "estargz table of contents",
+			entries: []tar.Header{
+				file(estargz.PrefetchLandmark), file("app/main"), file("app/cache.tmp"),
+				file(estargz.NoPrefetchLandmark), file(estargz.TOCTarName),
+			},
+			patterns: []string{"/app/*.tmp"},
+			matched:  [][]string{{"/app/cache.tmp"}},
+			kept:     []string{"app/main"},
+		},
+		{
+			name:     "glob and regex",
+			entries:  []tar.Header{dir("usr/"), file("usr/a.pyc"), file("usr/lib/b.pyc"), file("usr/lib/b.py"), file("root/.bash_history"), file("home/u/.bash_history")},
+			patterns: []string{"**/*.pyc", `re:/\.bash_history$`},
+			matched:  [][]string{{"/usr/a.pyc", "/usr/lib/b.pyc"}, {"/root/.bash_history", "/home/u/.bash_history"}},
+			kept:     []string{"usr/", "usr/lib/b.py"},
+		},
+		{
+			name:     "no match",
+			entries:  []tar.Header{dir("etc/"), file("etc/passwd")},
+			patterns: []string{"/etc/shadow"},
+			matched:  [][]string{nil},
+			kept:     []string{"etc/", "etc/passwd"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			patterns, err := runtime.ParsePathPatterns(tc.patterns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			tw := tar.NewWriter(&out)
+			matches, err := runtime.FilterTar(bytes.NewReader(tarOf(t, tc.entries...)), patterns, tw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			for i, m := range matches {
+				if m.Pattern != tc.patterns[i] {
+					t.Errorf("expected pattern %q, got %q", tc.patterns[i], m.Pattern)
+				}
+				if !reflect.DeepEqual(m.Paths, tc.matched[i]) {
+					t.Errorf("pattern %q: expected %v, got %v", m.Pattern, tc.matched[i], m.Paths)
+				}
+			}
+			var kept []string
+			tr := tar.NewReader(&out)
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				// the content of the kept files is copied along
+				b, err := io.ReadAll(tr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if hdr.Typeflag == tar.TypeReg && string(b) != hdr.Name {
+					t.Errorf("%s: expected its content to be kept, got %q", hdr.Name, b)
+				}
+				kept = append(kept, hdr.Name)
+			}
+			if strings.Join(kept, " ") != strings.Join(tc.kept, " ") {
+				t.Errorf("expected the entries %v to be kept, got %v", tc.kept, kept)
+			}
+		})
+	}
+
+	// a scan without a writer only reports the matches
+	patterns, err := runtime.ParsePathPatterns([]string{"/etc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches, err := runtime.FilterTar(bytes.NewReader(tarOf(t, dir("etc/"), file("etc/passwd"))), patterns, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(matches[0].Paths, []string{"/etc"}) {
+		t.Errorf("expected /etc to be matched, got %v", matches[0].Paths)
+	}
+}
+
+func TestPurgeHistory(t *testing.T) {
+	patterns, err := runtime.ParsePathPatterns([]string{"/etc/secret", "**/*.key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	history := []ocispec.History{
+		{CreatedBy: "ADD rootfs.tar /"},
+		{CreatedBy: "ENV A=1", EmptyLayer: true},
+		{CreatedBy: "COPY secret /etc/secret"},
+		{CreatedBy: "RUN make"},
+		{CreatedBy: `CMD ["app"]`, EmptyLayer: true},
+	}
+	info := runtime.CommitInfo{Author: "security", Comment: "leaked key"}
+	newHistory := runtime.PurgeHistory(history, 3, 1, patterns, info)
+	var createdBy []string
+	for _, h := range newHistory {
+		createdBy = append(createdBy, h.CreatedBy)
+	}
+	expected := []string{"ENV A=1", "COPY secret /etc/secret", "RUN make", `CMD ["app"]`, "purge /etc/secret **/*.key"}
+	if !reflect.DeepEqual(createdBy, expected) {
+		t.Fatalf("expected %q, got %q", expected, createdBy)
+	}
+	last := newHistory[len(newHistory)-1]
+	if !last.EmptyLayer || last.Author != info.Author || last.Comment != info.Comment {
+		t.Errorf("expected an empty layer entry of the purge, got %+v", last)
+	}
+}
@@ -3,139 +3,540 @@ package runtime
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
 
+	"github.com/containerd/containerd/errdefs"
 	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/rootfs"
+	"github.com/containerd/platforms"
+	imagesutil "github.com/lingdie/image-manip-server/pkg/images"
 	"github.com/lingdie/image-manip-server/pkg/options"
+	"github.com/lingdie/image-manip-server/pkg/timer"
 	"github.com/opencontainers/go-digest"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
-func (r *Runtime) Rebase(ctx context.Context, opt options.RebaseOptions) error {
-	r.Infof("start to rebase image %q to layer digest %q", opt.ImageRef, opt.BaseLayerDigest)
-	defer r.Track(time.Now(), "rebase")
-	// get the image to be rebased
-	image, err := r.GetImage(ctx, opt.ImageRef)
+// rebaseTarget is the image to be rebased, split into base layers and layers to rebase.
+type rebaseTarget struct {
+	image imagesutil.Image
+	// layers is the full layer chain of the image
+	layers LayerChain
+	// histories holds the history of each layer in layers
+	histories []layerHistory
+	// trailingHistory holds the empty layer entries after the last layer
+	trailingHistory         []ocispec.History
+	firstLayerIndexToRebase int
+	// squashCount is the number of layers from firstLayerIndexToRebase squashed into one,
+	// if a range of layers is given
+	squashCount int
+	// planner chooses the todo list, if set
+	planner *SquashPlanner
+	// baseImage is the old base image, if given by reference
+	baseImage *images.Image
+}
+
+// layersToRebase returns the layers above the base layer.
+func (t rebaseTarget) layersToRebase() (LayerChain, error) {
+	return NewLayerChain(t.layers.Descriptors[t.firstLayerIndexToRebase:], t.layers.DiffIDs[t.firstLayerIndexToRebase:])
+}
+
+// baseLayers returns the layers up to and including the base layer.
+func (t rebaseTarget) baseLayers() (LayerChain, error) {
+	return NewLayerChain(t.layers.Descriptors[:t.firstLayerIndexToRebase], t.layers.DiffIDs[:t.firstLayerIndexToRebase])
+}
+
+// todoList returns the todo list of the layers to rebase, if none is given: the one of the planner
+// if set, or the range of layers is squashed if one is given, otherwise all the layers are squashed
+// if autoSquash is set.
+func (t rebaseTarget) todoList(layersToRebase LayerChain, autoSquash bool) (TodoList, error) {
+	switch {
+	case t.planner != nil:
+		return t.planner.Plan(layersToRebase)
+	case t.squashCount > 0:
+		// The layers above the range are picked, i.e. their blobs are reused rather than applied again:
+		// the squashed layer is the diff of the snapshot of the range against the base layers, so the
+		// filesystem it leaves is the one the original range left, on which those layers were created.
+		todoList := getAllPick(layersToRebase)
+		for i := 1; i < t.squashCount; i++ {
+			todoList[i].Action = TodoFixup
+		}
+		return todoList, nil
+	case autoSquash:
+		return getSquashAll(layersToRebase), nil
+	default:
+		return getAllPick(layersToRebase), nil
+	}
+}
+
+// resolveRebaseTarget splits image, the manifest of one platform of the image to be rebased, according to opt,
+// or right after the detected base layer if detection is set. The old base image is resolved for the same platform.
+func (r *Runtime) resolveRebaseTarget(ctx context.Context, opt options.RebaseOptions, image imagesutil.Image, detection *BaseDetection) (rebaseTarget, error) {
+	target := rebaseTarget{}
+	layers, err := NewLayerChain(image.Manifest.Layers, image.Config.RootFS.DiffIDs)
+	if err != nil {
+		return target, err
+	}
+	switch {
+	case opt.SquashFrom != "" || opt.SquashTo != "":
+		if opt.BaseImageRef != "" || opt.BaseLayerDigest != "" || opt.NewBaseImageRef != "" || opt.TodoList != "" {
+			return target, fmt.Errorf("a range of layers to squash can not be used with a base, a new base or a todo list: %w", errdefs.ErrInvalidArgument)
+		}
+		if opt.SquashFrom == "" || opt.SquashTo == "" {
+			return target, fmt.Errorf("both ends of the range of layers to squash must be specified: %w", errdefs.ErrInvalidArgument)
+		}
+		from, err := layerIndexOf(layers, image.Config.History, opt.SquashFrom)
+		if err != nil {
+			return target, err
+		}
+		to, err := layerIndexOf(layers, image.Config.History, opt.SquashTo)
+		if err != nil {
+			return target, err
+		}
+		if from >= to {
+			return target, fmt.Errorf("layer %s must be below layer %s to squash them: %w", opt.SquashFrom, opt.SquashTo, errdefs.ErrInvalidArgument)
+		}
+		// the layers below the range are the base, those above it are picked
+		target.firstLayerIndexToRebase = from
+		target.squashCount = to - from + 1
+	case detection != nil:
+		// the index rather than the digest, which may appear again above the base (e.g. the empty layer of buildkit)
+		if detection.BaseLayerIndex < 0 || detection.BaseLayerIndex >= layers.Len() {
+			return target, fmt.Errorf("detected base layer %d out of range, the image has %d layers: %w", detection.BaseLayerIndex, layers.Len(), errdefs.ErrInvalidArgument)
+		}
+		target.firstLayerIndexToRebase = detection.BaseLayerIndex + 1
+	case opt.BaseImageRef != "" && opt.BaseLayerDigest != "":
+		return target, fmt.Errorf("base layer digest and base image can not be specified together: %w", errdefs.ErrInvalidArgument)
+	case opt.BaseImageRef != "":
+		// the split point is right after the layers of the old base image
+		baseImage, err := r.GetPlatformImage(ctx, opt.BaseImageRef, image.ManifestDesc.Platform)
+		if err != nil {
+			r.Errorf("failed to get base image %q: %v", opt.BaseImageRef, err)
+			return target, err
+		}
+		if err := verifyBaseLayers(image, opt.ImageRef, baseImage, opt.BaseImageRef); err != nil {
+			r.Errorf("image %q is not based on %q: %v", opt.ImageRef, opt.BaseImageRef, err)
+			return target, fmt.Errorf("image %q is not based on %q: %w", opt.ImageRef, opt.BaseImageRef, err)
+		}
+		target.firstLayerIndexToRebase = len(baseImage.Manifest.Layers)
+		target.baseImage = &baseImage.Image
+	case opt.BaseLayerDigest != "":
+		baseLayerDigest, err := digest.Parse(opt.BaseLayerDigest)
+		if err != nil {
+			r.Errorf("failed to parse base layer ref %q: %v", opt.BaseLayerDigest, err)
+			return target, err
+		}
+		// generate the layers to be rebased
+		baseLayerIndex, err := r.getBaseLayerIndex(layers, baseLayerDigest)
+		if err != nil {
+			r.Errorf("failed to generate layers to rebase: %v", err)
+			return target, err
+		}
+		target.firstLayerIndexToRebase = baseLayerIndex + 1
+	case opt.SquashPlan != nil:
+		// without a base, all the layers are planned
+		target.firstLayerIndexToRebase = 0
+	default:
+		return target, fmt.Errorf("either base layer digest or base image must be specified: %w", errdefs.ErrInvalidArgument)
+	}
+	if opt.SquashPlan != nil {
+		if target.squashCount > 0 || opt.TodoList != "" || opt.NewBaseImageRef != "" {
+			return target, fmt.Errorf("a squash plan can not be used with a range of layers, a todo list or a new base: %w", errdefs.ErrInvalidArgument)
+		}
+		planner, err := newSquashPlanner(*opt.SquashPlan, layers, image.Config.History, target.firstLayerIndexToRebase)
+		if err != nil {
+			return target, err
+		}
+		target.planner = &planner
+	}
+	target.image = image
+	target.layers = layers
+	target.histories, target.trailingHistory = splitHistory(image.Config.History, layers.Len())
+	return target, nil
+}
+
+// newSquashPlanner returns the planner of the layers of an image above its first baseLayerCount
+// layers, which are kept. history is the history of the image, for the stable layers given by index.
+func newSquashPlanner(opt options.SquashPlanOptions, layers LayerChain, history []ocispec.History, baseLayerCount int) (SquashPlanner, error) {
+	planner := SquashPlanner{
+		MinLayerSize:  opt.MinLayerSize,
+		KeepLayerSize: opt.KeepLayerSize,
+	}
+	if opt.MaxLayers < 0 || opt.MinLayerSize < 0 || opt.KeepLayerSize < 0 {
+		return planner, fmt.Errorf("the limits of a squash plan can not be negative: %w", errdefs.ErrInvalidArgument)
+	}
+	if opt.MaxLayers > 0 {
+		planner.MaxLayers = opt.MaxLayers - baseLayerCount
+		if planner.MaxLayers < 1 {
+			return planner, fmt.Errorf("can not plan %d layers or less, the image has %d base layers: %w", opt.MaxLayers, baseLayerCount, errdefs.ErrInvalidArgument)
+		}
+	}
+	for _, ref := range opt.StableLayers {
+		i, err := layerIndexOf(layers, history, ref)
+		if err != nil {
+			return planner, err
+		}
+		// the base layers are kept anyway
+		if i >= baseLayerCount {
+			planner.Boundaries = append(planner.Boundaries, i-baseLayerCount)
+		}
+	}
+	return planner, nil
+}
+
+// GenerateRebaseTodo returns the default todo list of a rebase, annotated with
+// the size and CreatedBy of each layer, followed by a help text on the supported actions.
+// The digests of a todo list are those of a single platform.
+func (r *Runtime) GenerateRebaseTodo(ctx context.Context, opt options.RebaseOptions) (string, error) {
+	if opt.AllPlatforms || len(opt.Platforms) > 1 {
+		return "", fmt.Errorf("a todo list applies to a single platform: %w", errdefs.ErrInvalidArgument)
+	}
+	var platform *ocispec.Platform
+	if len(opt.Platforms) == 1 {
+		p, err := platforms.Parse(opt.Platforms[0])
+		if err != nil {
+			return "", fmt.Errorf("invalid platform %q: %w", opt.Platforms[0], errdefs.ErrInvalidArgument)
+		}
+		platform = &p
+	}
+	image, err := r.GetPlatformImage(ctx, opt.ImageRef, platform)
 	if err != nil {
 		r.Errorf("failed to get original image %q: %v", opt.ImageRef, err)
-		return err
+		return "", err
 	}
-	baseLayerDigest, err := digest.Parse(opt.BaseLayerDigest)
+	target, err := r.resolveRebaseTarget(ctx, opt, image, nil)
 	if err != nil {
-		r.Errorf("failed to parse base layer ref %q: %v", baseLayerDigest, err)
-		return err
+		return "", err
 	}
-	layers, err := NewLayerChain(image.Manifest.Layers, image.Config.RootFS.DiffIDs)
+	layersToRebase, err := target.layersToRebase()
 	if err != nil {
-		return err
+		return "", err
 	}
-	// generate the layers to be rebased
-	baseLayerIndex, err := r.getBaseLayerIndex(layers, baseLayerDigest)
+	todoList, err := target.todoList(layersToRebase, opt.AutoSquash)
 	if err != nil {
-		r.Errorf("failed to generate layers to rebase: %v", err)
-		return err
+		return "", err
+	}
+	annotateTodoList(todoList, layersToRebase, target.histories[target.firstLayerIndexToRebase:])
+	return todoList.String() + todoListHelp, nil
+}
+
+// platformRebase is the rebase of the manifest of one platform of an image.
+type platformRebase struct {
+	image  imagesutil.Image
+	target rebaseTarget
+	// written is nil if there is nothing to rebase, or in dry-run mode
+	written       *WrittenImage
+	plan          *Plan
+	configChanges []ConfigChange
+	// detection is the detected base layer, if the base was not given
+	detection *BaseDetection
+	// baseLayers are the layers the new image is based on, those of the new base image if given
+	baseLayers LayerChain
+}
+
+// manifestDesc returns the descriptor of the new manifest, with the platform of the original one.
+func (p platformRebase) manifestDesc() ocispec.Descriptor {
+	desc := p.written.Manifest
+	desc.Platform = p.image.ManifestDesc.Platform
+	return desc
+}
+
+// Rebase rebases the layers of an image according to opt. In dry-run mode, nothing is written
+// and the plan of the rebase is returned in the result.
+// For a multi-platform image, each selected platform is rebased on the same platform of the base
+// images, and a new index is written holding the new manifests and the untouched platforms.
+func (r *Runtime) Rebase(ctx context.Context, opt options.RebaseOptions) (result RebaseResult, err error) {
+	return r.rebase(ctx, opt, false)
+}
+
+// rebase rebases an image like Rebase. If neither the base layer digest nor the base image is given,
+// the base layer of each platform is found by DetectBase if detectBase is set.
+func (r *Runtime) rebase(ctx context.Context, opt options.RebaseOptions, detectBase bool) (result RebaseResult, err error) {
+	switch {
+	case opt.SquashFrom != "" || opt.SquashTo != "":
+		r.Infof("start to squash the layers %s to %s of image %q", opt.SquashFrom, opt.SquashTo, opt.ImageRef)
+	case opt.BaseImageRef != "":
+		r.Infof("start to rebase image %q from base image %q", opt.ImageRef, opt.BaseImageRef)
+	default:
+		r.Infof("start to rebase image %q to layer digest %q", opt.ImageRef, opt.BaseLayerDigest)
+	}
+	defer r.record(ctx, &result.Timings, time.Now(), "rebase")
+	result.ImageRef = opt.ImageRef
+	info, err := NewCommitInfo(opt.CommitOptions)
+	if err != nil {
+		return result, err
+	}
+	if !opt.DryRun {
+		// hold the images until the new image is written, so that concurrent operations do not clobber each other
+		unlock, err := r.LockImages(ctx, opt.ImageRef, opt.NewImageName)
+		if err != nil {
+			return result, err
+		}
+		defer unlock()
+	}
+	imageName, err := r.FindImage(ctx, opt.ImageRef)
+	if err != nil {
+		r.Errorf("failed to get original image %q: %v", opt.ImageRef, err)
+		return result, err
+	}
+	orig, err := r.imagestore.Get(ctx, imageName)
+	if err != nil {
+		r.Errorf("failed to get original image %q: %v", opt.ImageRef, err)
+		return result, err
+	}
+	manifests, index, err := r.selectManifests(ctx, orig, opt.PlatformOptions)
+	if err != nil {
+		return result, err
+	}
+	if len(manifests) > 1 && (opt.TodoList != "" || opt.BaseLayerDigest != "" || isDigest(opt.SquashFrom) || isDigest(opt.SquashTo)) {
+		return result, fmt.Errorf("a todo list or a layer digest applies to a single platform, select one: %w", errdefs.ErrInvalidArgument)
+	}
+	var newImageName string
+	// determine the new image name
+	// if NewImageName is not specified, use the original image name
+	if opt.NewImageName != "" {
+		newImageName = opt.NewImageName
+	} else {
+		newImageName = orig.Name
+	}
+	var rebased []platformRebase
+	replaced := map[digest.Digest]ocispec.Descriptor{}
+	for _, manifestDesc := range manifests {
+		image, err := r.readImage(ctx, orig, manifestDesc)
+		if err != nil {
+			return result, err
+		}
+		p, err := r.rebasePlatform(ctx, opt, image, newImageName, info, detectBase, &result.Timings)
+		if err != nil {
+			if index != nil {
+				err = fmt.Errorf("platform %s: %w", platforms.Format(*manifestDesc.Platform), err)
+			}
+			return result, err
+		}
+		if p.written != nil {
+			replaced[manifestDesc.Digest] = p.written.Manifest
+		}
+		rebased = append(rebased, p)
+	}
+	if opt.DryRun {
+		if index == nil {
+			result.Plan = rebased[0].plan
+			result.ConfigChanges = rebased[0].configChanges
+			result.BaseDetection = rebased[0].detection
+			return result, nil
+		}
+		for _, p := range rebased {
+			result.Platforms = append(result.Platforms, PlatformResult{
+				Platform:      platforms.Format(*p.image.ManifestDesc.Platform),
+				ConfigChanges: p.configChanges,
+				Plan:          p.plan,
+				BaseDetection: p.detection,
+			})
+		}
+		return result, nil
+	}
+	if len(replaced) == 0 {
+		return result, nil
+	}
+	// finally, point the image to the new manifest, or to a new index holding the new manifests
+	var target ocispec.Descriptor
+	if index == nil {
+		target = rebased[0].written.Manifest
+	} else {
+		target, err = r.writeImageIndex(ctx, orig.Target, *index, replaced, info.ManifestFormat)
+		if err != nil {
+			r.Errorf("failed to write the index of image %q: %v", newImageName, err)
+			return result, err
+		}
+	}
+	img := images.Image{
+		Name:      newImageName,
+		Target:    target,
+		UpdatedAt: time.Now(),
+	}
+	// update the image in the image store, unless it has been changed since it was read
+	img, err = r.CompareAndSwapImage(ctx, img, orig, "rebase")
+	if err != nil {
+		return result, err
+	}
+	// unpack image to the snapshot storage
+	start := time.Now()
+	for _, p := range rebased {
+		if p.written == nil {
+			continue
+		}
+		reportProgress(ctx, Progress{Step: "unpack", Message: newImageName})
+		if err := r.UnpackImage(ctx, img, p.manifestDesc()); err != nil {
+			r.Errorf("failed to unpack image %q: %v", img.Name, err)
+			return result, err
+		}
 	}
-	firstLayerIndexToRebase := baseLayerIndex + 1
+	r.record(ctx, &result.Timings, start, "unpack")
+	if index == nil {
+		p := rebased[0]
+		result.ImageResult = newImageResult(newImageName, *p.written, p.target.layers, p.baseLayers)
+		result.ConfigChanges = p.configChanges
+		result.BaseDetection = p.detection
+	} else {
+		result.ImageResult = ImageResult{NewImageName: newImageName, ManifestDigest: target.Digest}
+		for _, p := range rebased {
+			platformResult := PlatformResult{
+				Platform:      platforms.Format(*p.image.ManifestDesc.Platform),
+				ConfigChanges: p.configChanges,
+				BaseDetection: p.detection,
+			}
+			if p.written != nil {
+				platformResult.ImageResult = newImageResult(newImageName, *p.written, p.target.layers, p.baseLayers)
+			}
+			result.Platforms = append(result.Platforms, platformResult)
+		}
+	}
+	r.Infof("rebase image %q successfully, new image: %q", opt.ImageRef, img.Name)
+	return result, nil
+}
+
+// rebasePlatform rebases image, the manifest of one platform of the image to be rebased, and writes
+// the new manifest without updating the image store. In dry-run mode, only the plan is returned.
+func (r *Runtime) rebasePlatform(ctx context.Context, opt options.RebaseOptions, image imagesutil.Image, newImageName string, info CommitInfo, detectBase bool, timings *[]timer.Timing) (platformRebase, error) {
+	p := platformRebase{image: image}
+	info = info.forManifest(image.ManifestDesc.MediaType)
+	if detectBase && opt.BaseLayerDigest == "" && opt.BaseImageRef == "" && opt.SquashFrom == "" && opt.SquashTo == "" && opt.SquashPlan == nil {
+		detection, found, err := r.DetectBase(ctx, image, opt.BaseDetection)
+		if err != nil {
+			return p, err
+		}
+		if !found {
+			return p, fmt.Errorf("could not detect the base layer of image %q, specify it: %w", opt.ImageRef, errdefs.ErrInvalidArgument)
+		}
+		r.Infof("detected base layer %d %s of image %q with strategy %q (%s confidence): %s", detection.BaseLayerIndex, detection.BaseLayerDigest, opt.ImageRef, detection.Strategy, detection.Confidence, detection.Reason)
+		p.detection = &detection
+	}
+	target, err := r.resolveRebaseTarget(ctx, opt, image, p.detection)
+	if err != nil {
+		return p, err
+	}
+	p.target = target
+	firstLayerIndexToRebase := target.firstLayerIndexToRebase
 	// if the base layer is the last layer, nothing to do
-	if firstLayerIndexToRebase == layers.Len() {
-		r.Infof("base layer digest %q is the last layer of the image, nothing to rebase", opt.BaseLayerDigest)
-		return nil
+	if firstLayerIndexToRebase == target.layers.Len() {
+		r.Infof("the base layer is the last layer of image %q, nothing to rebase", opt.ImageRef)
+		return p, nil
 	}
 	// layers to be rebased
-	layersToRebase, err := NewLayerChain(layers.Descriptors[firstLayerIndexToRebase:], layers.DiffIDs[firstLayerIndexToRebase:])
+	layersToRebase, err := target.layersToRebase()
 	if err != nil {
 		r.Errorf("failed to create layer chain to rebase: %v", err)
-		return err
+		return p, err
 	}
-
-	root := NewSnapshot(image.Config.RootFS.DiffIDs[:firstLayerIndexToRebase])
-	var rebaseToDoList []string
-	if opt.AutoSquash {
-		rebaseToDoList = getSquashAll(layersToRebase.Len())
-	} else {
-		rebaseToDoList = getAllPick(layersToRebase.Len())
+	rootLayers, err := target.baseLayers()
+	if err != nil {
+		return p, err
 	}
-	// modify the layers according to the rebaseToDoList
-	newLayers, err := r.modifyLayers(ctx, root, layersToRebase, rebaseToDoList)
+	var rebaseToDoList TodoList
+	switch {
+	case opt.TodoList != "":
+		rebaseToDoList, err = ParseTodoList(opt.TodoList)
+		if err != nil {
+			r.Errorf("failed to parse todo list: %v", err)
+			return p, err
+		}
+		if len(rebaseToDoList) == 0 {
+			return p, fmt.Errorf("nothing to do, the todo list is empty")
+		}
+	default:
+		rebaseToDoList, err = target.todoList(layersToRebase, opt.AutoSquash)
+		if err != nil {
+			r.Errorf("failed to plan the squash: %v", err)
+			return p, err
+		}
+		if target.planner != nil {
+			planned := append(TodoList(nil), rebaseToDoList...)
+			annotateTodoList(planned, layersToRebase, target.histories[firstLayerIndexToRebase:])
+			r.Infof("planned todo list of image %q:\n%s", opt.ImageRef, planned)
+		}
+	}
+	// group the layers according to the rebaseToDoList
+	plan, err := r.planLayers(layersToRebase, target.histories[firstLayerIndexToRebase:], rebaseToDoList)
 	if err != nil {
-		r.Errorf("failed to modify layers: %v", err)
-		return err
+		r.Errorf("invalid todo list: %v", err)
+		return p, err
 	}
 	// if NewBaseImageRef is specified, use the config and layers from the new base image
 	// otherwise, use the config and layers from the original image up to the base layer
 	// then append the new layers
 	var origConfig ocispec.Image
 	var baseLayers LayerChain
+	var merge *ConfigMerge
+	// the new image is based on the new base image, or on the old one if given
+	annotations := withBaseAnnotations(image.Manifest.Annotations, target.baseImage)
 	if opt.NewBaseImageRef != "" {
-		newBaseImage, err := r.GetImage(ctx, opt.NewBaseImageRef)
+		newBaseImage, err := r.GetPlatformImage(ctx, opt.NewBaseImageRef, image.ManifestDesc.Platform)
 		if err != nil {
 			r.Errorf("failed to get new base image %q: %v", opt.NewBaseImageRef, err)
-			return err
+			return p, err
 		}
 		origConfig = newBaseImage.Config
+		annotations = withBaseAnnotations(image.Manifest.Annotations, &newBaseImage.Image)
+		// keep the config of the application according to the merge policy
+		merge, err = NewConfigMerge(image.Config.Config, opt.ConfigMergePolicy, opt.ConfigFieldPolicies)
+		if err != nil {
+			r.Errorf("failed to parse config merge policy: %v", err)
+			return p, err
+		}
 		baseLayers, err = NewLayerChain(newBaseImage.Manifest.Layers, newBaseImage.Config.RootFS.DiffIDs)
 		if err != nil {
 			r.Errorf("failed to create layer chain for new base image %q: %v", opt.NewBaseImageRef, err)
-			return err
+			return p, err
 		}
 	} else {
 		origConfig = image.Config
-		baseLayers, err = NewLayerChain(image.Manifest.Layers[:firstLayerIndexToRebase], image.Config.RootFS.DiffIDs[:firstLayerIndexToRebase])
+		baseLayers = rootLayers
+	}
+	p.baseLayers = baseLayers
+	if opt.DryRun {
+		dryRun, err := r.newRebasePlan(ctx, target, baseLayers, plan, rebaseToDoList, origConfig, merge, info)
 		if err != nil {
-			r.Errorf("failed to create layer chain for original image %q: %v", opt.ImageRef, err)
-			return err
+			return p, err
 		}
+		dryRun.NewImageName = newImageName
+		p.plan = &dryRun
+		p.configChanges = dryRun.ConfigChanges
+		return p, nil
 	}
-	// finally, write back the new image to the image store
-	manifestDesc, err := r.WriteBack(ctx, origConfig, firstLayerIndexToRebase, baseLayers, newLayers)
+	// modify the layers according to the plan
+	start := time.Now()
+	newLayers, newHistory, err := r.modifyLayers(ctx, rootLayers, plan, info)
 	if err != nil {
-		return err
-	}
-	var newImageName string
-	// determine the new image name
-	// if NewImageName is not specified, use the original image name
-	if opt.NewImageName != "" {
-		newImageName = opt.NewImageName
-	} else {
-		newImageName = image.Image.Name
-	}
-	img := images.Image{
-		Name:      newImageName,
-		Target:    manifestDesc,
-		UpdatedAt: time.Now(),
+		r.Errorf("failed to modify layers: %v", err)
+		return p, err
 	}
-	// update the image in the image store
-	img, err = r.UpdateImage(ctx, img)
+	r.record(ctx, timings, start, "modifyLayers")
+	newHistory = append(newHistory, target.trailingHistory...)
+	// write back the new manifest to the content store
+	written, err := r.WriteBack(ctx, origConfig, baseLayers, newLayers, newHistory, merge, annotations, info)
 	if err != nil {
-		return err
+		return p, err
 	}
-	// unpack image to the snapshot storage
-	if err := r.UnpackImage(ctx, img, manifestDesc); err != nil {
-		r.Errorf("failed to unpack image %q: %v", img.Name, err)
-		return err
+	p.written = &written
+	if merge != nil {
+		_, p.configChanges = merge.Merge(origConfig.Config)
 	}
-	r.Infof("rebase image %q successfully, new image: %q", opt.ImageRef, img.Name)
-	return nil
+	return p, nil
 }
 
-func getSquashAll(layerLen int) []string {
-	var toDoList []string
-	for i := 0; i < layerLen; i++ {
-		if i == 0 {
-			toDoList = append(toDoList, "pick")
-		} else {
-			toDoList = append(toDoList, "fixup")
-		}
+// withBaseAnnotations returns a copy of the manifest annotations recording base as the base image
+// of the manifest, or the annotations as they are if base is nil.
+func withBaseAnnotations(annotations map[string]string, base *images.Image) map[string]string {
+	if base == nil {
+		return annotations
 	}
-	return toDoList
-}
-
-func getAllPick(layerLen int) []string {
-	toDoList := make([]string, layerLen)
-	for i := 0; i < layerLen; i++ {
-		toDoList[i] = "pick"
+	newAnnotations := make(map[string]string, len(annotations)+2)
+	for key, value := range annotations {
+		newAnnotations[key] = value
 	}
-	return toDoList
+	newAnnotations[ocispec.AnnotationBaseImageName] = base.Name
+	newAnnotations[ocispec.AnnotationBaseImageDigest] = base.Target.Digest.String()
+	return newAnnotations
 }
 
 func (r *Runtime) getBaseLayerIndex(layerChain LayerChain, baseLayerRef digest.Digest) (int, error) {
@@ -153,77 +554,233 @@ func (r *Runtime) getBaseLayerIndex(layerChain LayerChain, baseLayerRef digest.D
 	return baseLayerIdx, nil
 }
 
-func (r *Runtime) modifyLayers(ctx context.Context, root Snapshot, layersToRebase LayerChain, rebaseToDoList []string) (LayerChain, error) {
-	var (
-		layersToSquash          = NewEmptyLayerChain()
-		newLayers               = NewEmptyLayerChain()
-		currentParent  Snapshot = root.Clone()
-	)
-	groupStartIdx := -1 // index in layersToRebase / rebaseDiffIDs where current group started
+// layerIndexOf returns the index in layers of the layer ref refers to: either the digest of the layer,
+// or the index of the entry of history which created it, counted from 0 for the oldest entry.
+// A digest appearing several times in layers is ambiguous.
+func layerIndexOf(layers LayerChain, history []ocispec.History, ref string) (int, error) {
+	if i, err := strconv.Atoi(ref); err == nil {
+		if i < 0 || i >= len(history) {
+			return -1, fmt.Errorf("history index %d out of range, the image has %d history entries: %w", i, len(history), errdefs.ErrInvalidArgument)
+		}
+		if history[i].EmptyLayer {
+			return -1, fmt.Errorf("history entry %d (%q) did not create a layer: %w", i, history[i].CreatedBy, errdefs.ErrInvalidArgument)
+		}
+		layerIndex := 0
+		for _, h := range history[:i] {
+			if !h.EmptyLayer {
+				layerIndex++
+			}
+		}
+		if layerIndex >= layers.Len() {
+			return -1, fmt.Errorf("history entry %d has no layer: %w", i, errdefs.ErrInvalidArgument)
+		}
+		return layerIndex, nil
+	}
+	dgst, err := digest.Parse(ref)
+	if err != nil {
+		return -1, fmt.Errorf("%q is neither a layer digest nor a history index: %w", ref, errdefs.ErrInvalidArgument)
+	}
+	index := -1
+	for i, desc := range layers.Descriptors {
+		if desc.Digest != dgst {
+			continue
+		}
+		if index != -1 {
+			// e.g. the empty layer of buildkit
+			return -1, fmt.Errorf("layer %q appears several times in the image, use a history index instead: %w", dgst, errdefs.ErrInvalidArgument)
+		}
+		index = i
+	}
+	if index == -1 {
+		return -1, fmt.Errorf("layer %q not found: %w", dgst, errdefs.ErrNotFound)
+	}
+	return index, nil
+}
 
-	update := func(layer Layer) {
-		newLayers.AppendLayer(layer)
-		currentParent = currentParent.NewChild(layer.DiffID)
-		layersToSquash.Clear()
+// isDigest reports whether ref is a digest rather than an index.
+func isDigest(ref string) bool {
+	_, err := digest.Parse(ref)
+	return err == nil
+}
+
+// layerGroup is a group of layers which becomes a single layer of the new image.
+type layerGroup struct {
+	layers LayerChain
+	// emptyLayers are the empty layer entries recorded before the layer
+	emptyLayers []ocispec.History
+	// entries are the history entries of the layers
+	entries []ocispec.History
+	// indexes are the positions of the layers in the layers to rebase
+	indexes []int
+}
+
+// history returns the history entry of the layer the group becomes.
+func (g layerGroup) history(info CommitInfo) ocispec.History {
+	if g.layers.Len() == 1 {
+		return g.entries[0]
 	}
+	return squashHistory(g.entries, info)
+}
 
-	flushGroup := func() error {
-		if layersToSquash.IsEmpty() {
-			return nil
+// layerPlan is the result of applying a todo list to the layers to rebase, before any layer is created.
+type layerPlan struct {
+	groups []layerGroup
+	// emptyLayers are the empty layer entries after the last group
+	emptyLayers []ocispec.History
+	dropped     []digest.Digest
+}
+
+// planLayers applies the todo list to layersToRebase and groups the layers to be squashed together.
+// histories holds the history of each layer in layersToRebase.
+func (r *Runtime) planLayers(layersToRebase LayerChain, histories []layerHistory, rebaseToDoList TodoList) (layerPlan, error) {
+	var (
+		plan layerPlan
+		// the group being built, it is complete when the next pick is found
+		group *layerGroup
+		// the empty layer entries not attached to a group yet
+		emptyLayers []ocispec.History
+	)
+	// the positions of each digest, an image may hold the same layer several times (e.g. the empty
+	// layer of buildkit), the items of a repeated digest take its positions in order
+	layerIndexes := make(map[digest.Digest][]int, layersToRebase.Len())
+	for i, desc := range layersToRebase.Descriptors {
+		layerIndexes[desc.Digest] = append(layerIndexes[desc.Digest], i)
+	}
+	visited := make([]bool, layersToRebase.Len())
+	flushGroup := func() {
+		if group == nil {
+			return
 		}
-		if layersToSquash.Len() == 1 {
-			// Reuse the original single layer & its diffID instead of re-squashing
-			layer, err := layersToSquash.GetLayerByIndex(0)
-			if err != nil {
-				return err
-			}
-			update(layer)
-			return nil
+		group.emptyLayers = emptyLayers
+		plan.groups = append(plan.groups, *group)
+		group = nil
+		emptyLayers = nil
+	}
+	for _, item := range rebaseToDoList {
+		positions, ok := layerIndexes[item.Digest]
+		if !ok {
+			return plan, fmt.Errorf("layer %q is not one of the layers to rebase", item.Digest)
 		}
-		layer, err := r.squashLayers(ctx, currentParent, layersToSquash)
-		if err != nil {
-			return fmt.Errorf("failed to squash layers: %w", err)
+		if len(positions) == 0 {
+			return plan, fmt.Errorf("layer %q appears more times in the todo list than in the image", item.Digest)
 		}
-		update(layer)
-		return nil
-	}
-	for i, action := range rebaseToDoList {
+		i := positions[0]
+		layerIndexes[item.Digest] = positions[1:]
+		visited[i] = true
 		layer := NewLayer(layersToRebase.Descriptors[i], layersToRebase.DiffIDs[i])
-		switch action {
-		case "fixup":
-			if i == 0 {
-				// the first layer cannot be fixed up
-				return newLayers, fmt.Errorf("the first layer cannot be fixed up")
+		var history layerHistory
+		if i < len(histories) {
+			history = histories[i]
+		}
+		entry := history.Layer
+		switch item.Action {
+		case TodoPick, TodoReword:
+			flushGroup()
+			if item.Action == TodoReword {
+				entry.Comment = item.Message
 			}
-			layersToSquash.AppendLayer(layer)
-		case "pick":
-			if layersToSquash.Len() > 0 {
-				if err := flushGroup(); err != nil {
-					return newLayers, err
-				}
+			group = &layerGroup{
+				layers:  NewLayerChainFromLayer(layer),
+				entries: []ocispec.History{entry},
+				indexes: []int{i},
 			}
-			layersToSquash.Clear()
-			layersToSquash.AppendLayer(layer)
-			groupStartIdx = i
-
+		case TodoSquash, TodoFixup:
+			if group == nil {
+				// there is no previous layer to merge into
+				return plan, fmt.Errorf("cannot %s layer %q without a previous layer", item.Action, item.Digest)
+			}
+			if item.Action == TodoFixup {
+				// the comment of a fixed up layer is discarded
+				entry.Comment = ""
+			}
+			group.layers.AppendLayer(layer)
+			group.entries = append(group.entries, entry)
+			group.indexes = append(group.indexes, i)
+		case TodoDrop:
+			plan.dropped = append(plan.dropped, item.Digest)
 		default:
-			return newLayers, fmt.Errorf("unknown action %q", action)
+			return plan, fmt.Errorf("unknown action %q", item.Action)
 		}
-		if groupStartIdx == -1 { // first time we add a layer (could be i==0 pick)
-			groupStartIdx = i
+		// the empty layer entries (e.g. ENV) are kept even if the layer is dropped
+		emptyLayers = append(emptyLayers, history.EmptyLayers...)
+	}
+	flushGroup()
+	plan.emptyLayers = emptyLayers
+	for i, desc := range layersToRebase.Descriptors {
+		if !visited[i] {
+			r.Warnf("layer %q is not in the todo list and will be dropped", desc.Digest)
+			plan.dropped = append(plan.dropped, desc.Digest)
+		}
+	}
+	return plan, nil
+}
+
+// modifyLayers creates the layers of the plan on top of baseLayers. A group of a single layer reuses it,
+// the other groups are squashed. The returned history holds the entries of the new layers, along with
+// the empty layer entries of the original layers. The entries of squashed layers are recorded with
+// the author, comment and creation time of info.
+func (r *Runtime) modifyLayers(ctx context.Context, baseLayers LayerChain, plan layerPlan, info CommitInfo) (LayerChain, []ocispec.History, error) {
+	var (
+		newLayers  = NewEmptyLayerChain()
+		newHistory []ocispec.History
+		// parentLayers is the layer chain the next new layer will be placed on
+		parentLayers = NewEmptyLayerChain()
+	)
+	parentLayers.AppendLayers(baseLayers)
+	for _, dgst := range plan.dropped {
+		r.Infof("drop layer %q", dgst)
+	}
+	for i, group := range plan.groups {
+		reportProgress(ctx, Progress{Step: "modifyLayer", Message: fmt.Sprintf("%d layer(s)", group.layers.Len()), Current: i + 1, Total: len(plan.groups)})
+		var layer Layer
+		if group.layers.Len() == 1 {
+			// Reuse the original single layer & its diffID instead of re-squashing
+			var err error
+			layer, err = group.layers.GetLayerByIndex(0)
+			if err != nil {
+				return newLayers, newHistory, err
+			}
+		} else {
+			// the parent may not exist yet if the layers have been reordered or dropped
+			if err := r.prepareParent(ctx, parentLayers); err != nil {
+				return newLayers, newHistory, fmt.Errorf("failed to prepare parent snapshot: %w", err)
+			}
+			var err error
+			layer, err = r.squashLayers(ctx, NewSnapshot(parentLayers.DiffIDs), group.layers, info)
+			if err != nil {
+				return newLayers, newHistory, fmt.Errorf("failed to squash layers: %w", err)
+			}
 		}
+		newLayers.AppendLayer(layer)
+		parentLayers.AppendLayer(layer)
+		newHistory = append(newHistory, group.emptyLayers...)
+		newHistory = append(newHistory, group.history(info))
+	}
+	newHistory = append(newHistory, plan.emptyLayers...)
+	return newLayers, newHistory, nil
+}
+
+// prepareParent makes sure the snapshot of the given layer chain exists, applying the missing layers if needed.
+func (r *Runtime) prepareParent(ctx context.Context, layers LayerChain) error {
+	if layers.IsEmpty() {
+		return nil
 	}
-	// remember to handle the leftover items in layersToSquash
-	if layersToSquash.Len() > 0 {
-		if err := flushGroup(); err != nil {
-			return newLayers, err
+	rootfsLayers := make([]rootfs.Layer, layers.Len())
+	for i := range layers.Descriptors {
+		rootfsLayers[i] = rootfs.Layer{
+			Blob: layers.Descriptors[i],
+			Diff: ocispec.Descriptor{
+				MediaType: ocispec.MediaTypeImageLayer,
+				Digest:    layers.DiffIDs[i],
+			},
 		}
 	}
-	return newLayers, nil
+	_, err := rootfs.ApplyLayers(ctx, rootfsLayers, r.snapshotter, r.differ)
+	return err
 }
 
-func (r *Runtime) squashLayers(ctx context.Context, parent Snapshot, layersToSquash LayerChain) (Layer, error) {
-	newLayer, _, err := r.createSnapshot(ctx, parent, layersToSquash)
+func (r *Runtime) squashLayers(ctx context.Context, parent Snapshot, layersToSquash LayerChain, info CommitInfo) (Layer, error) {
+	newLayer, _, err := r.createSnapshot(ctx, parent, layersToSquash, info)
 	if err != nil {
 		return newLayer, fmt.Errorf("failed to apply layers to snapshot: %w", err)
 	}
@@ -0,0 +1,179 @@
+package runtime_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/containerd/containerd/errdefs"
+	imagesutil "github.com/lingdie/image-manip-server/pkg/images"
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestPlanLayersRepeatedDigest(t *testing.T) {
+	var (
+		app   = digest.FromString("app")
+		lib   = digest.FromString("lib")
+		empty = digest.FromString("empty layer")
+	)
+	// the empty layer of buildkit appears twice
+	layers, err := runtime.NewLayerChain(
+		[]ocispec.Descriptor{{Digest: app}, {Digest: empty}, {Digest: lib}, {Digest: empty}},
+		[]digest.Digest{digest.FromString("app diff"), digest.FromString("empty diff"), digest.FromString("lib diff"), digest.FromString("empty diff")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name     string
+		todoList runtime.TodoList
+		expected [][]int
+	}{
+		{
+			name: "pick",
+			todoList: runtime.TodoList{
+				{Action: runtime.TodoPick, Digest: app},
+				{Action: runtime.TodoPick, Digest: empty},
+				{Action: runtime.TodoPick, Digest: lib},
+				{Action: runtime.TodoPick, Digest: empty},
+			},
+			expected: [][]int{{0}, {1}, {2}, {3}},
+		},
+		{
+			name: "fixup",
+			todoList: runtime.TodoList{
+				{Action: runtime.TodoPick, Digest: app},
+				{Action: runtime.TodoFixup, Digest: empty},
+				{Action: runtime.TodoPick, Digest: lib},
+				{Action: runtime.TodoFixup, Digest: empty},
+			},
+			expected: [][]int{{0, 1}, {2, 3}},
+		},
+		{
+			name: "drop one",
+			todoList: runtime.TodoList{
+				{Action: runtime.TodoPick, Digest: app},
+				{Action: runtime.TodoPick, Digest: lib},
+				{Action: runtime.TodoFixup, Digest: empty},
+			},
+			expected: [][]int{{0}, {2, 1}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			indexes, err := runtime.PlanLayerIndexes(layers, tc.todoList)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(indexes, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, indexes)
+			}
+		})
+	}
+
+	todoList := runtime.TodoList{
+		{Action: runtime.TodoPick, Digest: empty},
+		{Action: runtime.TodoPick, Digest: empty},
+		{Action: runtime.TodoPick, Digest: empty},
+	}
+	if _, err := runtime.PlanLayerIndexes(layers, todoList); err == nil {
+		t.Error("expected an error for a layer listed more times than it appears")
+	}
+}
+
+// squashRangeImage is an image built by buildkit, whose WORKDIR instructions created the same empty layer twice.
+func squashRangeImage() (imagesutil.Image, []digest.Digest) {
+	history := []ocispec.History{
+		{CreatedBy: "ADD rootfs.tar.gz /"},
+		{CreatedBy: "ENV PATH=/usr/local/bin:/usr/bin", EmptyLayer: true},
+		{CreatedBy: "RUN apt-get install -y python3"},
+		{CreatedBy: "WORKDIR /app"},
+		{CreatedBy: "RUN pip install -r requirements.txt"},
+		{CreatedBy: "WORKDIR /app"},
+		{CreatedBy: "COPY . /app"},
+	}
+	empty := digest.FromString("empty layer")
+	layers := []digest.Digest{digest.FromString("rootfs"), digest.FromString("python3"), empty, digest.FromString("requirements"), empty, digest.FromString("app")}
+	image := imagesutil.Image{Manifest: &ocispec.Manifest{}, Config: ocispec.Image{History: history}}
+	for _, dgst := range layers {
+		image.Manifest.Layers = append(image.Manifest.Layers, ocispec.Descriptor{Digest: dgst})
+		image.Config.RootFS.DiffIDs = append(image.Config.RootFS.DiffIDs, digest.FromString("diff "+dgst.String()))
+	}
+	return image, layers
+}
+
+func TestLayerIndexOf(t *testing.T) {
+	image, layers := squashRangeImage()
+	chain, err := runtime.NewLayerChain(image.Manifest.Layers, image.Config.RootFS.DiffIDs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name     string
+		ref      string
+		expected int
+		check    func(error) bool
+	}{
+		{name: "first history entry", ref: "0", expected: 0},
+		{name: "history entry after an empty layer entry", ref: "2", expected: 1},
+		{name: "last history entry", ref: "6", expected: 5},
+		{name: "history entry of a repeated layer", ref: "5", expected: 4},
+		{name: "digest", ref: layers[3].String(), expected: 3},
+		{name: "empty layer entry", ref: "1", check: errdefs.IsInvalidArgument},
+		{name: "history index out of range", ref: "7", check: errdefs.IsInvalidArgument},
+		{name: "negative history index", ref: "-1", check: errdefs.IsInvalidArgument},
+		{name: "ambiguous digest", ref: layers[2].String(), check: errdefs.IsInvalidArgument},
+		{name: "unknown digest", ref: digest.FromString("unknown").String(), check: errdefs.IsNotFound},
+		{name: "neither", ref: "latest", check: errdefs.IsInvalidArgument},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			i, err := runtime.LayerIndexOf(chain, image.Config.History, tc.ref)
+			if tc.check != nil {
+				if !tc.check(err) {
+					t.Errorf("unexpected error %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i != tc.expected {
+				t.Errorf("expected layer %d, got %d", tc.expected, i)
+			}
+		})
+	}
+}
+
+func TestSquashRangeTodoList(t *testing.T) {
+	image, layers := squashRangeImage()
+	// the noisy middle section is squashed, the layers above it are reused as they are
+	baseLayers, todoList, err := runtime.SquashRangeTodoList(image, "2", layers[3].String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if baseLayers != 1 {
+		t.Errorf("expected 1 base layer, got %d", baseLayers)
+	}
+	expected := runtime.TodoList{
+		{Action: runtime.TodoPick, Digest: layers[1]},
+		{Action: runtime.TodoFixup, Digest: layers[2]},
+		{Action: runtime.TodoFixup, Digest: layers[3]},
+		{Action: runtime.TodoPick, Digest: layers[4]},
+		{Action: runtime.TodoPick, Digest: layers[5]},
+	}
+	if !reflect.DeepEqual(todoList, expected) {
+		t.Errorf("expected %v, got %v", expected, todoList)
+	}
+	for _, tc := range []struct {
+		name     string
+		from, to string
+	}{
+		{name: "reversed range", from: "4", to: "2"},
+		{name: "single layer", from: "4", to: "4"},
+		{name: "missing end", from: "2"},
+	} {
+		if _, _, err := runtime.SquashRangeTodoList(image, tc.from, tc.to); !errdefs.IsInvalidArgument(err) {
+			t.Errorf("%s: expected an invalid argument, got %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// reflogLabelPrefix prefixes the labels of an image holding its reflog entries, by index
+	reflogLabelPrefix = "image-manip.reflog."
+	// reflogGCLabelPrefix prefixes the labels keeping the targets of the reflog from being garbage collected
+	reflogGCLabelPrefix = "containerd.io/gc.ref.content." + reflogLabelPrefix
+	// maxReflogEntries is the number of targets kept in the reflog of an image, the current one included
+	maxReflogEntries = 10
+)
+
+// ReflogEntry is a target an image has pointed to. Index 0 is the current target,
+// 1 the previous one, and so on.
+type ReflogEntry struct {
+	Index  int                `json:"index"`
+	Target ocispec.Descriptor `json:"target"`
+	// Time is when the image started to point to the target
+	Time time.Time `json:"time"`
+	// Operation is the operation which pointed the image to the target, empty if unknown
+	Operation string `json:"operation,omitempty"`
+}
+
+// ResetResult is the result of Reset.
+type ResetResult struct {
+	ImageRef string `json:"image_ref"`
+	// Index is the reflog entry the image has been reset to
+	Index          int                `json:"index"`
+	PreviousTarget ocispec.Descriptor `json:"previous_target"`
+	Target         ocispec.Descriptor `json:"target"`
+}
+
+var reflogRefRegexp = regexp.MustCompile(`^(.+)@\{(\d+)\}$`)
+
+// ParseReflogRef splits a reference like IMAGE@{n} into the image reference and the reflog index.
+func ParseReflogRef(ref string) (string, int, error) {
+	m := reflogRefRegexp.FindStringSubmatch(ref)
+	if m == nil {
+		return "", 0, fmt.Errorf("invalid reflog reference %q, expected IMAGE@{N}: %w", ref, errdefs.ErrInvalidArgument)
+	}
+	n, err := strconv.Atoi(m[2])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid reflog index in %q: %w", ref, errdefs.ErrInvalidArgument)
+	}
+	return m[1], n, nil
+}
+
+// reflogEntries returns the reflog of img, from its labels. If the image has been changed by another
+// tool since the reflog was recorded, its current target comes first with an unknown operation.
+func reflogEntries(img images.Image) []ReflogEntry {
+	var entries []ReflogEntry
+	for key, value := range img.Labels {
+		if !strings.HasPrefix(key, reflogLabelPrefix) {
+			continue
+		}
+		index, err := strconv.Atoi(strings.TrimPrefix(key, reflogLabelPrefix))
+		if err != nil {
+			continue
+		}
+		var entry ReflogEntry
+		if err := json.Unmarshal([]byte(value), &entry); err != nil {
+			continue
+		}
+		entry.Index = index
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Index < entries[j].Index
+	})
+	if img.Target.Digest != "" && (len(entries) == 0 || entries[0].Target.Digest != img.Target.Digest) {
+		entries = append([]ReflogEntry{{Target: img.Target, Time: img.UpdatedAt}}, entries...)
+	}
+	for i := range entries {
+		entries[i].Index = i
+	}
+	return entries
+}
+
+// withReflog returns the labels of img, an update of prev, with the reflog of prev followed by
+// the new target of img. prev is the zero image if img is created.
+func withReflog(prev, img images.Image, operation string) (map[string]string, error) {
+	labels := make(map[string]string, len(img.Labels))
+	for key, value := range img.Labels {
+		if !strings.HasPrefix(key, reflogLabelPrefix) && !strings.HasPrefix(key, reflogGCLabelPrefix) {
+			labels[key] = value
+		}
+	}
+	entries := reflogEntries(prev)
+	if len(entries) > 0 && entries[0].Target.Digest == img.Target.Digest {
+		// the target has not changed, e.g. a tag is set again
+		entries[0].Operation = operation
+	} else {
+		entries = append([]ReflogEntry{{Target: img.Target, Time: time.Now(), Operation: operation}}, entries...)
+	}
+	if len(entries) > maxReflogEntries {
+		entries = entries[:maxReflogEntries]
+	}
+	for i, entry := range entries {
+		value, err := json.Marshal(ReflogEntry{Target: entry.Target, Time: entry.Time, Operation: entry.Operation})
+		if err != nil {
+			return nil, err
+		}
+		key := strconv.Itoa(i)
+		labels[reflogLabelPrefix+key] = string(value)
+		labels[reflogGCLabelPrefix+key] = entry.Target.Digest.String()
+	}
+	return labels, nil
+}
+
+// Reflog returns the targets the image imageRef has pointed to, the current one first.
+func (r *Runtime) Reflog(ctx context.Context, imageRef string) ([]ReflogEntry, error) {
+	name, err := r.FindImage(ctx, imageRef)
+	if err != nil {
+		return nil, err
+	}
+	img, err := r.imagestore.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return reflogEntries(img), nil
+}
+
+// Reset points the image imageRef back to the target of its reflog entry index, and unpacks it.
+// The reset is recorded in the reflog as well, so that it can be undone.
+func (r *Runtime) Reset(ctx context.Context, imageRef string, index int) (result ResetResult, err error) {
+	result.ImageRef = imageRef
+	result.Index = index
+	unlock, err := r.LockImages(ctx, imageRef)
+	if err != nil {
+		return result, err
+	}
+	defer unlock()
+	name, err := r.FindImage(ctx, imageRef)
+	if err != nil {
+		return result, err
+	}
+	orig, err := r.imagestore.Get(ctx, name)
+	if err != nil {
+		return result, err
+	}
+	result.PreviousTarget = orig.Target
+	entries := reflogEntries(orig)
+	if index < 0 || index >= len(entries) {
+		return result, fmt.Errorf("image %q has %d reflog entries, %d is out of range: %w", name, len(entries), index, errdefs.ErrNotFound)
+	}
+	target := entries[index].Target
+	if _, err := r.contentstore.Info(ctx, target.Digest); err != nil {
+		return result, fmt.Errorf("target %s of %s@{%d} is not available anymore: %w", target.Digest, name, index, err)
+	}
+	img := images.Image{
+		Name:      name,
+		Target:    target,
+		Labels:    orig.Labels,
+		UpdatedAt: time.Now(),
+	}
+	img, err = r.CompareAndSwapImage(ctx, img, orig, fmt.Sprintf("reset to @{%d}", index))
+	if err != nil {
+		return result, err
+	}
+	if err := r.UnpackImage(ctx, img, target); err != nil {
+		r.Errorf("failed to unpack image %q: %v", name, err)
+		return result, err
+	}
+	result.Target = target
+	r.Infof("image %q reset to %s@{%d}: %s", name, name, index, target.Digest)
+	return result, nil
+}
@@ -0,0 +1,32 @@
+package runtime_test
+
+import (
+	"testing"
+
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+)
+
+func TestParseReflogRef(t *testing.T) {
+	for ref, expected := range map[string]struct {
+		image string
+		index int
+	}{
+		"my-app:latest@{0}":                    {"my-app:latest", 0},
+		"docker.io/library/my-app:latest@{12}": {"docker.io/library/my-app:latest", 12},
+		"my-app@sha256:1111111111111111111111111111111111111111111111111111111111111111@{1}": {"my-app@sha256:1111111111111111111111111111111111111111111111111111111111111111", 1},
+	} {
+		image, index, err := runtime.ParseReflogRef(ref)
+		if err != nil {
+			t.Errorf("%s: %v", ref, err)
+			continue
+		}
+		if image != expected.image || index != expected.index {
+			t.Errorf("%s: expected %s and %d, got %s and %d", ref, expected.image, expected.index, image, index)
+		}
+	}
+	for _, invalid := range []string{"my-app:latest", "my-app:latest@{}", "my-app:latest@{-1}", "@{1}"} {
+		if _, _, err := runtime.ParseReflogRef(invalid); err == nil {
+			t.Errorf("%s: expected an error", invalid)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package runtime
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/containerd/containerd/archive/compression"
+	"github.com/containerd/containerd/content"
+	"github.com/lingdie/image-manip-server/pkg/util"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// tarEntry is a tar header whose content is stored at offset in a spool file
+type tarEntry struct {
+	header *tar.Header
+	offset int64
+}
+
+// normalizeLayer rewrites a layer so that identical file trees always give identical diffIDs and blobs:
+// the entries are sorted by name, the timestamps are clamped to epoch and the gzip header is fixed.
+func (r *Runtime) normalizeLayer(ctx context.Context, layer Layer, epoch time.Time) (Layer, error) {
+	defer r.track(ctx, time.Now(), "normalizeLayer")
+	ra, err := r.contentstore.ReaderAt(ctx, layer.Desc)
+	if err != nil {
+		return layer, err
+	}
+	defer ra.Close()
+	ds, err := compression.DecompressStream(content.NewReader(ra))
+	if err != nil {
+		return layer, err
+	}
+	defer ds.Close()
+	// spool the content of the entries, so that they can be written in another order
+	spool, err := os.CreateTemp("", "layer-spool-")
+	if err != nil {
+		return layer, err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+	var (
+		entries []tarEntry
+		offset  int64
+	)
+	tr := tar.NewReader(ds)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return layer, fmt.Errorf("failed to read layer %s: %w", layer.Desc.Digest, err)
+		}
+		n, err := io.Copy(spool, tr)
+		if err != nil {
+			return layer, err
+		}
+		entries = append(entries, tarEntry{header: hdr, offset: offset})
+		offset += n
+	}
+	// write the normalized tar and compress it to another temporary file
+	blob, err := os.CreateTemp("", "layer-blob-")
+	if err != nil {
+		return layer, err
+	}
+	defer os.Remove(blob.Name())
+	defer blob.Close()
+	var (
+		diffIDDigester = digest.Canonical.Digester()
+		blobDigester   = digest.Canonical.Digester()
+	)
+	// the gzip header is left empty: no name, no modification time
+	gz, err := gzip.NewWriterLevel(io.MultiWriter(blob, blobDigester.Hash()), gzip.DefaultCompression)
+	if err != nil {
+		return layer, err
+	}
+	tw := tar.NewWriter(io.MultiWriter(gz, diffIDDigester.Hash()))
+	for _, e := range sortTarEntries(entries) {
+		hdr := normalizeTarHeader(e.header, epoch)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return layer, err
+		}
+		if _, err := io.Copy(tw, io.NewSectionReader(spool, e.offset, hdr.Size)); err != nil {
+			return layer, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return layer, err
+	}
+	if err := gz.Close(); err != nil {
+		return layer, err
+	}
+	size, err := blob.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return layer, err
+	}
+	if _, err := blob.Seek(0, io.SeekStart); err != nil {
+		return layer, err
+	}
+	newLayer := NewLayer(ocispec.Descriptor{
+		MediaType: layer.Desc.MediaType,
+		Digest:    blobDigester.Digest(),
+		Size:      size,
+	}, diffIDDigester.Digest())
+	labelOpt := content.WithLabels(map[string]string{
+		"containerd.io/uncompressed": newLayer.DiffID.String(),
+	})
+	ref := fmt.Sprintf("normalize-%s", util.UniquePart())
+	if err := content.WriteBlob(ctx, r.contentstore, ref, blob, newLayer.Desc, labelOpt); err != nil {
+		return layer, fmt.Errorf("failed to write normalized layer: %w", err)
+	}
+	r.Infof("layer %s normalized to %s", layer.Desc.Digest, newLayer.Desc.Digest)
+	return newLayer, nil
+}
+
+// sortTarEntries sorts the entries by name. A hard link is moved right after its target
+// if the target would be written after it, so that the archive can still be extracted.
+func sortTarEntries(entries []tarEntry) []tarEntry {
+	sorted := make([]tarEntry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].header.Name < sorted[j].header.Name
+	})
+	names := make(map[string]bool, len(sorted))
+	for _, e := range sorted {
+		names[e.header.Name] = true
+	}
+	var (
+		result  = make([]tarEntry, 0, len(sorted))
+		written = make(map[string]bool, len(sorted))
+		pending = map[string][]tarEntry{}
+		write   func(e tarEntry)
+	)
+	write = func(e tarEntry) {
+		result = append(result, e)
+		written[e.header.Name] = true
+		links := pending[e.header.Name]
+		delete(pending, e.header.Name)
+		for _, l := range links {
+			write(l)
+		}
+	}
+	for _, e := range sorted {
+		target := e.header.Linkname
+		if e.header.Typeflag == tar.TypeLink && names[target] && !written[target] {
+			pending[target] = append(pending[target], e)
+			continue
+		}
+		write(e)
+	}
+	// links to targets which are never written (e.g. cycles) are kept at the end
+	var rest []string
+	for target := range pending {
+		rest = append(rest, target)
+	}
+	sort.Strings(rest)
+	for _, target := range rest {
+		result = append(result, pending[target]...)
+	}
+	return result
+}
+
+// normalizeTarHeader clamps the modification, access and change times to epoch. The PAX records of
+// the times are dropped in favor of the clamped fields.
+func normalizeTarHeader(h *tar.Header, epoch time.Time) *tar.Header {
+	hdr := *h
+	hdr.ModTime = clampTime(hdr.ModTime, epoch)
+	hdr.AccessTime = clampTime(hdr.AccessTime, epoch)
+	hdr.ChangeTime = clampTime(hdr.ChangeTime, epoch)
+	if hdr.PAXRecords != nil {
+		records := make(map[string]string, len(hdr.PAXRecords))
+		for k, v := range hdr.PAXRecords {
+			switch k {
+			case "mtime", "atime", "ctime":
+				continue
+			}
+			records[k] = v
+		}
+		hdr.PAXRecords = records
+	}
+	// let the writer choose the format, it rounds the modification time to seconds
+	hdr.Format = tar.FormatUnknown
+	return &hdr
+}
+
+// clampTime returns t, or epoch if t is later.
+func clampTime(t, epoch time.Time) time.Time {
+	if t.After(epoch) {
+		return epoch
+	}
+	return t
+}
@@ -0,0 +1,111 @@
+package runtime_test
+
+import (
+	"archive/tar"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+)
+
+func TestNormalizeTarHeader(t *testing.T) {
+	epoch := time.Unix(1700000000, 0).UTC()
+	before := epoch.Add(-time.Hour)
+	after := epoch.Add(time.Hour)
+	for _, tc := range []struct {
+		name     string
+		header   tar.Header
+		expected tar.Header
+	}{
+		{
+			name:     "later times are clamped",
+			header:   tar.Header{Name: "a", ModTime: after, AccessTime: after, ChangeTime: after},
+			expected: tar.Header{Name: "a", ModTime: epoch, AccessTime: epoch, ChangeTime: epoch},
+		},
+		{
+			name:     "earlier times are kept",
+			header:   tar.Header{Name: "a", ModTime: before, AccessTime: before, ChangeTime: before},
+			expected: tar.Header{Name: "a", ModTime: before, AccessTime: before, ChangeTime: before},
+		},
+		{
+			name: "time records are dropped",
+			header: tar.Header{Name: "a", ModTime: after, Format: tar.FormatPAX, PAXRecords: map[string]string{
+				"mtime":                   "1800000000.5",
+				"atime":                   "1800000000.5",
+				"ctime":                   "1800000000.5",
+				"SCHILY.xattr.user.a":     "b",
+				"LIBARCHIVE.creationtime": "1800000000",
+			}},
+			expected: tar.Header{Name: "a", ModTime: epoch, PAXRecords: map[string]string{
+				"SCHILY.xattr.user.a":     "b",
+				"LIBARCHIVE.creationtime": "1800000000",
+			}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			original := tc.header
+			hdr := runtime.NormalizeTarHeader(&tc.header, epoch)
+			if !reflect.DeepEqual(*hdr, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, *hdr)
+			}
+			// the header read from the layer is left as it is
+			if !reflect.DeepEqual(tc.header, original) {
+				t.Errorf("the original header has been changed: %+v", tc.header)
+			}
+		})
+	}
+}
+
+func TestSortTarEntries(t *testing.T) {
+	headers := func(hs ...tar.Header) []*tar.Header {
+		var list []*tar.Header
+		for i := range hs {
+			list = append(list, &hs[i])
+		}
+		return list
+	}
+	for _, tc := range []struct {
+		name     string
+		headers  []*tar.Header
+		expected []string
+	}{
+		{
+			name:     "sorted by name",
+			headers:  headers(file("usr/bin/b"), dir("usr/"), file("etc/a"), dir("etc/"), dir("usr/bin/")),
+			expected: []string{"etc/", "etc/a", "usr/", "usr/bin/", "usr/bin/b"},
+		},
+		{
+			name: "hard link moved after its target",
+			// b-link sorts before its target z-file, it must follow it to be extracted
+			headers:  headers(file("z-file"), hardLink("b-link", "z-file"), hardLink("a-link", "z-file"), file("m-file")),
+			expected: []string{"m-file", "z-file", "a-link", "b-link"},
+		},
+		{
+			name:     "hard link after its target stays in place",
+			headers:  headers(file("a-file"), hardLink("z-link", "a-file"), file("m-file")),
+			expected: []string{"a-file", "m-file", "z-link"},
+		},
+		{
+			name:     "link to a link",
+			headers:  headers(file("z-file"), hardLink("y-link", "z-file"), hardLink("a-link", "y-link")),
+			expected: []string{"z-file", "y-link", "a-link"},
+		},
+		{
+			name:     "links to a missing target are kept in place",
+			headers:  headers(hardLink("b-link", "missing"), file("a-file")),
+			expected: []string{"a-file", "b-link"},
+		},
+		{
+			name:     "cycle kept at the end",
+			headers:  headers(hardLink("x-link", "y-link"), hardLink("y-link", "x-link"), file("a-file")),
+			expected: []string{"a-file", "y-link", "x-link"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if names := runtime.SortTarNames(tc.headers); !reflect.DeepEqual(names, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, names)
+			}
+		})
+	}
+}
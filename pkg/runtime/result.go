@@ -0,0 +1,184 @@
+package runtime
+
+import (
+	"github.com/lingdie/image-manip-server/pkg/timer"
+	"github.com/opencontainers/go-digest"
+)
+
+// ResultLayer is a layer of an image written by an operation.
+type ResultLayer struct {
+	Digest    digest.Digest `json:"digest"`
+	DiffID    digest.Digest `json:"diff_id"`
+	MediaType string        `json:"media_type"`
+	Size      int64         `json:"size"`
+	// Created is true if the layer has been created by the operation, false if it is reused
+	Created bool `json:"created"`
+}
+
+// ImageResult is the image written by an operation.
+type ImageResult struct {
+	NewImageName   string        `json:"new_image_name"`
+	ManifestDigest digest.Digest `json:"manifest_digest"`
+	ConfigDigest   digest.Digest `json:"config_digest"`
+	Layers         []ResultLayer `json:"layers"`
+}
+
+// newImageResult describes the image written as name. The layers which are in none of reusedLayers,
+// the original layers and e.g. those of a new base image, are reported as created.
+func newImageResult(name string, written WrittenImage, reusedLayers ...LayerChain) ImageResult {
+	orig := map[digest.Digest]bool{}
+	for _, layers := range reusedLayers {
+		for _, desc := range layers.Descriptors {
+			orig[desc.Digest] = true
+		}
+	}
+	result := ImageResult{
+		NewImageName:   name,
+		ManifestDigest: written.Manifest.Digest,
+		ConfigDigest:   written.Config.Digest,
+	}
+	for i, desc := range written.Layers.Descriptors {
+		result.Layers = append(result.Layers, ResultLayer{
+			Digest:    desc.Digest,
+			DiffID:    written.Layers.DiffIDs[i],
+			MediaType: desc.MediaType,
+			Size:      desc.Size,
+			Created:   !orig[desc.Digest],
+		})
+	}
+	return result
+}
+
+// PlatformResult is the result of an operation for one platform of a multi-platform image.
+type PlatformResult struct {
+	Platform string `json:"platform"`
+	// ImageResult describes the new manifest of the platform, it is empty in dry-run mode
+	// or if the platform has not changed
+	ImageResult
+	ConfigChanges []ConfigChange `json:"config_changes,omitempty"`
+	// Plan is only set in dry-run mode
+	Plan *Plan `json:"plan,omitempty"`
+	// Matches are the paths removed from the platform by a removal
+	Matches []PathMatch `json:"matches,omitempty"`
+	// PurgedLayers are the layers of the platform rewritten by a purge
+	PurgedLayers []PurgedLayer `json:"purged_layers,omitempty"`
+	// BaseDetection is the detected base layer of the platform for a squash
+	BaseDetection *BaseDetection `json:"base_detection,omitempty"`
+}
+
+// RebaseResult is the result of Rebase.
+type RebaseResult struct {
+	ImageRef string `json:"image_ref"`
+	// ImageResult is empty in dry-run mode. For a multi-platform image, its manifest digest is the
+	// digest of the new index, and the manifests are described in Platforms.
+	ImageResult
+	// ConfigChanges are the config fields of the new image which differ from the application image
+	ConfigChanges []ConfigChange `json:"config_changes,omitempty"`
+	// Plan is only set in dry-run mode
+	Plan *Plan `json:"plan,omitempty"`
+	// BaseDetection is the detected base layer of a squash, if the base was not given
+	BaseDetection *BaseDetection `json:"base_detection,omitempty"`
+	// Platforms holds the results of the platforms of a multi-platform image
+	Platforms []PlatformResult `json:"platforms,omitempty"`
+	Timings   []timer.Timing   `json:"timings"`
+}
+
+// RemoveResult is the result of Remove.
+type RemoveResult struct {
+	ImageRef string `json:"image_ref"`
+	File     string `json:"file"`
+	// Paths are the patterns to remove, File included
+	Paths []string `json:"paths"`
+	// Matches are the paths each pattern matched. In dry-run mode, they are only set if the image is unpacked.
+	Matches []PathMatch `json:"matches,omitempty"`
+	// PurgedLayers are the layers rewritten by a purge, or which would be in dry-run mode
+	PurgedLayers []PurgedLayer `json:"purged_layers,omitempty"`
+	// ImageResult is empty in dry-run mode. For a multi-platform image, its manifest digest is the
+	// digest of the new index, and the manifests are described in Platforms.
+	ImageResult
+	// Plan is only set in dry-run mode
+	Plan *Plan `json:"plan,omitempty"`
+	// Platforms holds the results of the platforms of a multi-platform image
+	Platforms []PlatformResult `json:"platforms,omitempty"`
+	Timings   []timer.Timing   `json:"timings"`
+}
+
+// AddResult is the result of Add.
+type AddResult struct {
+	ImageRef string   `json:"image_ref"`
+	Sources  []string `json:"sources"`
+	Dest     string   `json:"dest"`
+	// ImageResult describes the new image, the added layer is the created one. For a multi-platform
+	// image, its manifest digest is the digest of the new index, and the manifests are described in Platforms.
+	ImageResult
+	// Platforms holds the results of the platforms of a multi-platform image
+	Platforms []PlatformResult `json:"platforms,omitempty"`
+	Timings   []timer.Timing   `json:"timings"`
+}
+
+// ExecResult is the result of Exec.
+type ExecResult struct {
+	ImageRef string   `json:"image_ref"`
+	Command  []string `json:"command"`
+	// ImageResult describes the new image, the layer of the command is the created one. For a multi-platform
+	// image, its manifest digest is the digest of the new index, and the manifests are described in Platforms.
+	ImageResult
+	// Platforms holds the results of the platforms of a multi-platform image
+	Platforms []PlatformResult `json:"platforms,omitempty"`
+	Timings   []timer.Timing   `json:"timings"`
+}
+
+// ConfigResult is the result of EditConfig.
+type ConfigResult struct {
+	ImageRef string `json:"image_ref"`
+	// ConfigChanges are the fields changed by the edits, in Platforms for a multi-platform image
+	ConfigChanges []ConfigChange `json:"config_changes"`
+	// ImageResult is empty in dry-run mode or if nothing changed. For a multi-platform image, its
+	// manifest digest is the digest of the new index, and the manifests are described in Platforms.
+	ImageResult
+	// Platforms holds the results of the platforms of a multi-platform image
+	Platforms []PlatformResult `json:"platforms,omitempty"`
+	Timings   []timer.Timing   `json:"timings"`
+}
+
+// ConvertResult is the result of Convert.
+type ConvertResult struct {
+	ImageRef    string `json:"image_ref"`
+	Compression string `json:"compression"`
+	// ImageResult describes the converted image, the layers are reported as created if they have been
+	// recompressed. For a multi-platform image, its manifest digest is the digest of the new index,
+	// and the manifests are described in Platforms.
+	ImageResult
+	// Platforms holds the results of the platforms of a multi-platform image
+	Platforms []PlatformResult `json:"platforms,omitempty"`
+	Timings   []timer.Timing   `json:"timings"`
+}
+
+// TagResult is the result of Tag.
+type TagResult struct {
+	SourceImage    string         `json:"source_image"`
+	TargetImage    string         `json:"target_image"`
+	ManifestDigest digest.Digest  `json:"manifest_digest"`
+	Timings        []timer.Timing `json:"timings"`
+}
+
+// FindBaseResult is the result of FindBase.
+type FindBaseResult struct {
+	ImageRef string `json:"image_ref"`
+	// Platform is the platform of the manifest of a multi-platform image
+	Platform string `json:"platform,omitempty"`
+	// Candidates are the local images the image is built on, the best first
+	Candidates []BaseCandidate `json:"candidates"`
+	Timings    []timer.Timing  `json:"timings"`
+}
+
+// VerifyBaseResult is the result of Verifybase.
+type VerifyBaseResult struct {
+	OriginalImage string `json:"original_image"`
+	BaseImage     string `json:"base_image"`
+	Based         bool   `json:"based"`
+	// Reason explains why the original image is not based on the base image
+	Reason         string         `json:"reason,omitempty"`
+	BaseLayerCount int            `json:"base_layer_count"`
+	Timings        []timer.Timing `json:"timings"`
+}
@@ -0,0 +1,49 @@
+package runtime_test
+
+import (
+	"testing"
+
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestNewImageResultNewBase(t *testing.T) {
+	chain := func(names ...string) runtime.LayerChain {
+		var (
+			descs   []ocispec.Descriptor
+			diffIDs []digest.Digest
+		)
+		for _, name := range names {
+			descs = append(descs, ocispec.Descriptor{Digest: digest.FromString(name)})
+			diffIDs = append(diffIDs, digest.FromString("diff "+name))
+		}
+		layers, err := runtime.NewLayerChain(descs, diffIDs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return layers
+	}
+	// the image is rebased from its old base onto a new one, its two app layers are squashed
+	orig := chain("old base", "app", "config")
+	newBase := chain("new base 1", "new base 2")
+	written := runtime.WrittenImage{Layers: chain("new base 1", "new base 2", "squashed")}
+	result := runtime.NewImageResult("app:rebased", written, orig, newBase)
+	expected := []bool{false, false, true}
+	if len(result.Layers) != len(expected) {
+		t.Fatalf("expected %d layers, got %d", len(expected), len(result.Layers))
+	}
+	for i, layer := range result.Layers {
+		if layer.Created != expected[i] {
+			t.Errorf("layer %d: expected created %v, got %v", i, expected[i], layer.Created)
+		}
+	}
+
+	// a picked layer is reused on the new base
+	result = runtime.NewImageResult("app:rebased", runtime.WrittenImage{Layers: chain("new base 1", "new base 2", "app", "config")}, orig, newBase)
+	for i, layer := range result.Layers {
+		if layer.Created {
+			t.Errorf("layer %d: expected a reused layer", i)
+		}
+	}
+}
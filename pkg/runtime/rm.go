@@ -5,10 +5,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/containerd/containerd/errdefs"
 	"github.com/containerd/containerd/images"
 	"github.com/containerd/containerd/mount"
+	"github.com/containerd/platforms"
+	imagesutil "github.com/lingdie/image-manip-server/pkg/images"
 	"github.com/lingdie/image-manip-server/pkg/options"
 	"github.com/lingdie/image-manip-server/pkg/util"
 	"github.com/opencontainers/go-digest"
@@ -16,30 +20,54 @@ import (
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
-func (r *Runtime) Remove(ctx context.Context, opt options.RemoveOptions) error {
+// Remove removes paths from an image according to opt: the plain paths, globs and regular expressions
+// of opt.File and opt.Paths are matched against the root filesystem of the image, and everything they
+// match is removed in a single new layer. In dry-run mode, nothing is written and the plan of the
+// removal is returned in the result, along with the paths matched if the image is unpacked.
+// If opt.Purge is set, the paths are purged from every layer containing them instead, see purgePlatform.
+// For a multi-platform image, the paths are removed from each selected platform, and a new index is
+// written holding the new manifests and the untouched platforms.
+func (r *Runtime) Remove(ctx context.Context, opt options.RemoveOptions) (result RemoveResult, err error) {
+	result.ImageRef = opt.ImageRef
+	result.File = opt.File
+	result.Paths = opt.Paths
+	if opt.File != "" {
+		result.Paths = append([]string{opt.File}, opt.Paths...)
+	}
 	// get the original image
-	r.Infof("start to remove file %q from image %q", opt.File, opt.ImageRef)
-	defer r.Track(time.Now(), "remove")
-	image, err := r.GetImage(ctx, opt.ImageRef)
+	r.Infof("start to remove %q from image %q", result.Paths, opt.ImageRef)
+	defer r.record(ctx, &result.Timings, time.Now(), "remove")
+	if len(result.Paths) == 0 {
+		return result, fmt.Errorf("no path to remove: %w", errdefs.ErrInvalidArgument)
+	}
+	patterns, err := ParsePathPatterns(result.Paths)
 	if err != nil {
-		r.Errorf("failed to get original image %q: %v", opt.ImageRef, err)
-		return err
+		return result, err
 	}
-	layer, err := r.createRemovalLayer(ctx, image.Config, opt.File)
+	info, err := NewCommitInfo(opt.CommitOptions)
 	if err != nil {
-		r.Errorf("failed to create removal layer for file %q: %v", opt.File, err)
-		return err
+		return result, err
 	}
-	newLayers := NewLayerChainFromLayer(layer)
-	baseLayers, err := NewLayerChain(image.Manifest.Layers, image.Config.RootFS.DiffIDs)
+	if !opt.DryRun {
+		unlock, err := r.LockImages(ctx, opt.ImageRef, opt.NewImageName)
+		if err != nil {
+			return result, err
+		}
+		defer unlock()
+	}
+	imageName, err := r.FindImage(ctx, opt.ImageRef)
 	if err != nil {
-		r.Errorf("failed to create layer chain for original image %q: %v", opt.ImageRef, err)
-		return err
+		r.Errorf("failed to get original image %q: %v", opt.ImageRef, err)
+		return result, err
 	}
-	manifestDesc, err := r.WriteBack(ctx, image.Config, baseLayers.Len(), baseLayers, newLayers)
+	orig, err := r.imagestore.Get(ctx, imageName)
 	if err != nil {
-		r.Errorf("failed to write back image %q: %v", opt.ImageRef, err)
-		return err
+		r.Errorf("failed to get original image %q: %v", opt.ImageRef, err)
+		return result, err
+	}
+	manifests, index, err := r.selectManifests(ctx, orig, opt.PlatformOptions)
+	if err != nil {
+		return result, err
 	}
 	var newImageName string
 	// determine the new image name
@@ -47,69 +75,311 @@ func (r *Runtime) Remove(ctx context.Context, opt options.RemoveOptions) error {
 	if opt.NewImageName != "" {
 		newImageName = opt.NewImageName
 	} else {
-		newImageName = image.Image.Name
+		newImageName = orig.Name
+	}
+	if opt.DryRun {
+		for _, manifestDesc := range manifests {
+			image, err := r.readImage(ctx, orig, manifestDesc)
+			if err != nil {
+				return result, err
+			}
+			if opt.Purge {
+				// the layers are scanned, the patterns matching nothing are reported rather than failing
+				p, err := r.purgePlatform(ctx, image, patterns, true, true, info)
+				if err != nil {
+					return result, err
+				}
+				if index == nil {
+					result.Matches = p.matches
+					result.PurgedLayers = p.purged
+				} else {
+					result.Platforms = append(result.Platforms, PlatformResult{Platform: platforms.Format(*manifestDesc.Platform), Matches: p.matches, PurgedLayers: p.purged})
+				}
+				continue
+			}
+			matches, err := r.viewPaths(ctx, image.Config, patterns)
+			if err != nil {
+				return result, err
+			}
+			plan, err := r.newRemovePlan(ctx, image, patterns, info)
+			if err != nil {
+				return result, err
+			}
+			plan.NewImageName = newImageName
+			if index == nil {
+				result.Plan = &plan
+				result.Matches = matches
+			} else {
+				result.Platforms = append(result.Platforms, PlatformResult{Platform: platforms.Format(*manifestDesc.Platform), Plan: &plan, Matches: matches})
+			}
+		}
+		return result, nil
+	}
+	var (
+		removed     []platformRemoval
+		replaced    = map[digest.Digest]ocispec.Descriptor{}
+		removeStart = time.Now()
+	)
+	for _, manifestDesc := range manifests {
+		image, err := r.readImage(ctx, orig, manifestDesc)
+		if err != nil {
+			return result, err
+		}
+		var p platformRemoval
+		if opt.Purge {
+			p, err = r.purgePlatform(ctx, image, patterns, opt.AllowNoMatch, false, info)
+		} else {
+			p, err = r.removePlatform(ctx, image, patterns, opt.AllowNoMatch, info)
+		}
+		if err != nil {
+			if index != nil {
+				err = fmt.Errorf("platform %s: %w", platforms.Format(*manifestDesc.Platform), err)
+			}
+			return result, err
+		}
+		if p.written != nil {
+			replaced[manifestDesc.Digest] = p.written.Manifest
+		}
+		removed = append(removed, p)
+	}
+	r.record(ctx, &result.Timings, removeStart, "createRemovalLayer")
+	if index == nil {
+		result.Matches = removed[0].matches
+		result.PurgedLayers = removed[0].purged
+	}
+	if len(replaced) == 0 {
+		r.Warnf("nothing matched in image %q, it is left unchanged", opt.ImageRef)
+		for _, p := range removed {
+			if index != nil {
+				result.Platforms = append(result.Platforms, PlatformResult{Platform: platforms.Format(*p.image.ManifestDesc.Platform), Matches: p.matches})
+			}
+		}
+		return result, nil
+	}
+	var target ocispec.Descriptor
+	if index == nil {
+		target = removed[0].written.Manifest
+	} else {
+		target, err = r.writeImageIndex(ctx, orig.Target, *index, replaced, info.ManifestFormat)
+		if err != nil {
+			r.Errorf("failed to write the index of image %q: %v", newImageName, err)
+			return result, err
+		}
 	}
 	img := images.Image{
 		Name:      newImageName,
-		Target:    manifestDesc,
+		Target:    target,
 		UpdatedAt: time.Now(),
 	}
-	img, err = r.UpdateImage(ctx, img)
+	operation := removeCreatedBy(patterns)
+	if opt.Purge {
+		operation = purgeCreatedBy(patterns)
+	}
+	img, err = r.CompareAndSwapImage(ctx, img, orig, operation)
+	if err != nil {
+		r.Errorf("failed to update image %q: %v", newImageName, err)
+		return result, err
+	}
+	for _, p := range removed {
+		if p.written == nil {
+			continue
+		}
+		reportProgress(ctx, Progress{Step: "unpack", Message: newImageName})
+		manifestDesc := p.written.Manifest
+		manifestDesc.Platform = p.image.ManifestDesc.Platform
+		if err := r.UnpackImage(ctx, img, manifestDesc); err != nil {
+			r.Errorf("failed to unpack image %q: %v", newImageName, err)
+			return result, err
+		}
+	}
+	if index == nil {
+		result.ImageResult = newImageResult(newImageName, *removed[0].written, removed[0].layers)
+	} else {
+		result.ImageResult = ImageResult{NewImageName: newImageName, ManifestDigest: target.Digest}
+		for _, p := range removed {
+			platformResult := PlatformResult{
+				Platform:     platforms.Format(*p.image.ManifestDesc.Platform),
+				Matches:      p.matches,
+				PurgedLayers: p.purged,
+			}
+			if p.written != nil {
+				platformResult.ImageResult = newImageResult(newImageName, *p.written, p.layers)
+			}
+			result.Platforms = append(result.Platforms, platformResult)
+		}
+	}
+	r.Infof("%q removed from image %q successfully", result.Paths, opt.ImageRef)
+	return result, nil
+}
+
+// removeCreatedBy returns the description of the layer removing patterns.
+func removeCreatedBy(patterns []PathPattern) string {
+	names := make([]string, len(patterns))
+	for i, p := range patterns {
+		names[i] = p.String()
+	}
+	return "remove " + strings.Join(names, " ")
+}
+
+// platformRemoval is the removal of paths from the manifest of one platform of an image.
+type platformRemoval struct {
+	image imagesutil.Image
+	// layers are the layers of the original manifest
+	layers LayerChain
+	// written is nil if nothing matched
+	written *WrittenImage
+	matches []PathMatch
+	// purged are the layers rewritten by a purge
+	purged []PurgedLayer
+}
+
+// removePlatform removes the paths matching patterns from image, the manifest of one platform of the
+// image, and writes the new manifest without updating the image store. A pattern matching nothing is
+// an error, unless allowNoMatch is set.
+func (r *Runtime) removePlatform(ctx context.Context, image imagesutil.Image, patterns []PathPattern, allowNoMatch bool, info CommitInfo) (platformRemoval, error) {
+	p := platformRemoval{image: image}
+	info = info.forManifest(image.ManifestDesc.MediaType)
+	baseLayers, err := NewLayerChain(image.Manifest.Layers, image.Config.RootFS.DiffIDs)
+	if err != nil {
+		r.Errorf("failed to create layer chain for original image %q: %v", image.Image.Name, err)
+		return p, err
+	}
+	p.layers = baseLayers
+	// the snapshots of the platforms other than the default one are usually not unpacked
+	if err := r.prepareParent(ctx, baseLayers); err != nil {
+		r.Errorf("failed to prepare the rootfs of image %q: %v", image.Image.Name, err)
+		return p, err
+	}
+	layer, matches, err := r.createRemovalLayer(ctx, image.Config, patterns, allowNoMatch, info)
+	p.matches = matches
 	if err != nil {
-		r.Errorf("failed to unpack image %q: %v", newImageName, err)
-		return err
+		r.Errorf("failed to create removal layer: %v", err)
+		return p, err
+	}
+	if layer == nil {
+		return p, nil
 	}
-	if err := r.UnpackImage(ctx, img, manifestDesc); err != nil {
-		r.Errorf("failed to unpack image %q: %v", newImageName, err)
-		return err
+	newLayers := NewLayerChainFromLayer(*layer)
+	newHistory := []ocispec.History{{CreatedBy: removeCreatedBy(patterns)}}
+	written, err := r.WriteBack(ctx, image.Config, baseLayers, newLayers, newHistory, nil, image.Manifest.Annotations, info)
+	if err != nil {
+		r.Errorf("failed to write back image %q: %v", image.Image.Name, err)
+		return p, err
 	}
-	r.Infof("file %q removed from image %q successfully", opt.File, opt.ImageRef)
+	p.written = &written
+	return p, nil
+}
+
+// checkMatches fails if a pattern matched nothing, or only warns if allowNoMatch is set.
+func (r *Runtime) checkMatches(matches []PathMatch, allowNoMatch bool) error {
+	var unmatched []string
+	for _, m := range matches {
+		if len(m.Paths) == 0 {
+			unmatched = append(unmatched, m.Pattern)
+		}
+	}
+	if len(unmatched) == 0 {
+		return nil
+	}
+	if !allowNoMatch {
+		return fmt.Errorf("%q matched nothing: %w", unmatched, errdefs.ErrNotFound)
+	}
+	r.Warnf("%q matched nothing", unmatched)
 	return nil
 }
 
-func (r *Runtime) createRemovalLayer(ctx context.Context, origImage ocispec.Image, file string) (Layer, error) {
+// createRemovalLayer removes the paths matching patterns from the rootfs of origImage and returns the
+// layer holding their whiteouts, or nil if nothing matched and allowNoMatch is set.
+func (r *Runtime) createRemovalLayer(ctx context.Context, origImage ocispec.Image, patterns []PathPattern, allowNoMatch bool, info CommitInfo) (_ *Layer, _ []PathMatch, err error) {
 	var (
 		key           = fmt.Sprintf("file-removal-%s", util.UniquePart())
 		parentDiffIDs = origImage.RootFS.DiffIDs
 		parent        = identity.ChainID(origImage.RootFS.DiffIDs)
-		layer         = NewLayer(ocispec.Descriptor{}, digest.Digest(""))
 	)
 	// create mount target to mount the rootfs
 	mountTarget, err := os.MkdirTemp(os.Getenv("XDG_RUNTIME_DIR"), "remove-file-")
 	if err != nil {
 		r.Errorf("failed to create mount target %q: %v", mountTarget, err)
-		return layer, err
+		return nil, nil, err
 	}
 	defer os.RemoveAll(mountTarget)
 	// prepare a temporary rootfs
 	mounts, err := r.snapshotter.Prepare(ctx, key, parent.String())
 	if err != nil {
 		r.Errorf("failed to prepare snapshot %q: %v", key, err)
-		return layer, err
+		return nil, nil, err
 	}
+	committed := false
+	defer func() {
+		if !committed {
+			r.snapshotter.Remove(ctx, key)
+		}
+	}()
 	mounter := NewMounterImpl()
 	if err := mounter.Mount(mountTarget, mounts...); err != nil {
 		r.Errorf("failed to mount rootfs %q: %v", mountTarget, err)
-		return layer, err
+		return nil, nil, err
 	}
 	defer mounter.Unmount(mountTarget)
-	// remove the file
-	if err := os.RemoveAll(filepath.Join(mountTarget, file)); err != nil {
-		r.Errorf("failed to remove file %q: %v", file, err)
-		return layer, err
+	// find and remove the paths, all in the same layer
+	matches, err := findPaths(mountTarget, patterns)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := r.checkMatches(matches, allowNoMatch); err != nil {
+		return nil, matches, err
+	}
+	paths := matchedPaths(matches)
+	if len(paths) == 0 {
+		return nil, matches, nil
+	}
+	for _, p := range paths {
+		r.Infof("remove %s", p)
+		if err := os.RemoveAll(filepath.Join(mountTarget, p)); err != nil {
+			r.Errorf("failed to remove %q: %v", p, err)
+			return nil, matches, err
+		}
 	}
 	// create a diff from the modified rootfs
-	layer, err = r.createDiff(ctx, key)
+	layer, err := r.createDiff(ctx, key, info)
 	if err != nil {
 		r.Errorf("failed to create diff for snapshot %q: %v", key, err)
-		return layer, err
+		return nil, matches, err
 	}
 	child := identity.ChainID(append(parentDiffIDs, layer.DiffID)).String()
-	if err := r.snapshotter.Commit(ctx, child, key); err != nil {
+	if err := r.snapshotter.Commit(ctx, child, key); err != nil && !errdefs.IsAlreadyExists(err) {
 		r.Errorf("failed to commit snapshot %q: %v", child, err)
-		return layer, err
+		return nil, matches, err
+	}
+	committed = true
+	return &layer, matches, nil
+}
+
+// viewPaths returns the paths of the rootfs of image matched by patterns, without changing it. It
+// returns nil if the image is not unpacked.
+func (r *Runtime) viewPaths(ctx context.Context, image ocispec.Image, patterns []PathPattern) ([]PathMatch, error) {
+	parent := identity.ChainID(image.RootFS.DiffIDs).String()
+	if _, err := r.snapshotter.Stat(ctx, parent); err != nil {
+		r.Infof("the rootfs of the image is not unpacked, the paths are not matched: %v", err)
+		return nil, nil
+	}
+	key := fmt.Sprintf("file-removal-view-%s", util.UniquePart())
+	mounts, err := r.snapshotter.View(ctx, key, parent)
+	if err != nil {
+		return nil, err
+	}
+	defer r.snapshotter.Remove(ctx, key)
+	mountTarget, err := os.MkdirTemp(os.Getenv("XDG_RUNTIME_DIR"), "remove-file-")
+	if err != nil {
+		return nil, err
 	}
-	return layer, nil
+	defer os.RemoveAll(mountTarget)
+	mounter := NewMounterImpl()
+	if err := mounter.Mount(mountTarget, mounts...); err != nil {
+		return nil, err
+	}
+	defer mounter.Unmount(mountTarget)
+	return findPaths(mountTarget, patterns)
 }
 
 func NewMounterImpl() *MounterImpl {
@@ -3,6 +3,7 @@ package runtime
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"time"
 
 	"github.com/lingdie/image-manip-server/pkg/options"
@@ -29,6 +30,10 @@ type Runtime struct {
 	contentstore    content.Store
 	snapshotter     snapshots.Snapshotter
 	snapshotterName string
+	namespace       string
+	locker          *ImageLocker
+	// baseStrategies are the strategies of DetectBase
+	baseStrategies []BaseStrategy
 
 	runtimeCtx context.Context
 	cancel     context.CancelFunc
@@ -85,7 +90,15 @@ func NewRuntime(ctx context.Context, options options.RootOptions) (*Runtime, err
 		cancel()
 		return nil, err
 	}
-	return &Runtime{
+	lockDir := options.LockDir
+	if lockDir == "" {
+		lockDir = DefaultLockDir
+	}
+	locker := NewImageLocker(filepath.Join(lockDir, options.Namespace))
+	locker.OnWait = func(name string) {
+		logger.Infof("image %q is locked by another operation, waiting", name)
+	}
+	r := &Runtime{
 		client:       criClient,
 		differ:       criClient.DiffService(),
 		imagestore:   criClient.ImageService(),
@@ -94,11 +107,15 @@ func NewRuntime(ctx context.Context, options options.RootOptions) (*Runtime, err
 		// use default snapshotter
 		snapshotter:     criClient.SnapshotService(snapshotterName),
 		snapshotterName: snapshotterName,
+		namespace:       options.Namespace,
+		locker:          locker,
 		runtimeCtx:      runtimeCtx,
 		cancel:          cancel,
 		leaseDone:       done,
 		Timer:           t,
-	}, nil
+	}
+	r.baseStrategies = defaultBaseStrategies(r)
+	return r, nil
 }
 
 func (r *Runtime) Close() error {
@@ -118,8 +135,18 @@ func (r *Runtime) Context() context.Context {
 	return r.runtimeCtx
 }
 
+// WithLease returns a context derived from ctx in the namespace of the runtime, holding a new lease so that
+// the content and the snapshots created with it are not garbage collected. done releases the lease.
+// It is used by long-running servers instead of Context, whose lease expires after 24 hours.
+func (r *Runtime) WithLease(ctx context.Context) (context.Context, func(context.Context) error, error) {
+	ctx = namespaces.WithNamespace(ctx, r.namespace)
+	return r.client.WithLease(ctx, leases.WithRandomID(), leases.WithExpiration(24*time.Hour))
+}
+
 const (
 	DefaultSnapshotter = "overlayfs"
+	// DefaultLockDir is the directory of the image lock files, one subdirectory per namespace
+	DefaultLockDir = "/var/run/image-manip/locks"
 )
 
 func resolveSnapshotterName(ctx context.Context, c *containerd.Client, name string) (string, error) {
@@ -59,7 +59,8 @@ func (s *Snapshot) Clone() Snapshot {
 
 // TODO: should we just use rootfs.ApplyLayers?
 // createSnapshot creates a new snapshot from the parent specified by parentDiffIDs, and apply the given layers to it.
-func (r *Runtime) createSnapshot(ctx context.Context, parent Snapshot, layerChain LayerChain) (
+// The diff of the new snapshot is normalized if info requires reproducible layers.
+func (r *Runtime) createSnapshot(ctx context.Context, parent Snapshot, layerChain LayerChain, info CommitInfo) (
 	Layer, string, error) {
 	var (
 		key        = util.UniquePart()
@@ -90,6 +91,7 @@ func (r *Runtime) createSnapshot(ctx context.Context, parent Snapshot, layerChai
 			return newLayer, snapshotID, err
 		}
 		r.Infof("apply layer %s...(%v/%v)", layer.Desc.Digest, i+1, layerChain.Len())
+		reportProgress(ctx, Progress{Step: "applyLayer", Message: layer.Desc.Digest.String(), Current: i + 1, Total: layerChain.Len()})
 		err = r.applyLayerToMount(ctx, m, layer.Desc)
 		if err != nil {
 			r.Warnf("failed to apply layer to mount %q: %v", m, err)
@@ -97,7 +99,7 @@ func (r *Runtime) createSnapshot(ctx context.Context, parent Snapshot, layerChai
 		}
 	}
 	// create diff
-	newLayer, err = r.createDiff(ctx, key)
+	newLayer, err = r.createDiff(ctx, key, info)
 	if err != nil {
 		return newLayer, snapshotID, fmt.Errorf("failed to export layer: %w", err)
 	}
@@ -114,17 +116,19 @@ func (r *Runtime) createSnapshot(ctx context.Context, parent Snapshot, layerChai
 }
 
 func (r *Runtime) applyLayerToMount(ctx context.Context, mount []mount.Mount, layer ocispec.Descriptor) error {
-	defer r.Track(time.Now(), fmt.Sprintf("applyLayer %s", layer.Digest))
+	defer r.track(ctx, time.Now(), fmt.Sprintf("applyLayer %s", layer.Digest))
 	if _, err := r.differ.Apply(ctx, layer, mount); err != nil {
 		return err
 	}
 	return nil
 }
 
-// createDiff creates a diff between a snapshot and its parent
-func (r *Runtime) createDiff(ctx context.Context, snapshotName string) (Layer, error) {
-	defer r.Track(time.Now(), "createDiff")
+// createDiff creates a diff between a snapshot and its parent.
+// If commitInfo.Reproducible is set, the diff is normalized with the creation time of commitInfo as the epoch.
+func (r *Runtime) createDiff(ctx context.Context, snapshotName string, commitInfo CommitInfo) (Layer, error) {
+	defer r.track(ctx, time.Now(), "createDiff")
 	r.Infof("create diff for snapshot %s", snapshotName)
+	reportProgress(ctx, Progress{Step: "createDiff", Message: snapshotName})
 	var (
 		layer = NewLayer(ocispec.Descriptor{}, digest.Digest(""))
 	)
@@ -145,11 +149,23 @@ func (r *Runtime) createDiff(ctx context.Context, snapshotName string) (Layer, e
 		return layer, err
 	}
 	layer.Desc = ocispec.Descriptor{
-		MediaType: images.MediaTypeDockerSchema2LayerGzip,
+		MediaType: layerMediaType(commitInfo.ManifestFormat, images.MediaTypeDockerSchema2LayerGzip),
 		Digest:    newDesc.Digest,
 		Size:      info.Size,
 	}
 	layer.DiffID = diffID
+	if commitInfo.Reproducible {
+		layer, err = r.normalizeLayer(ctx, layer, commitInfo.Created)
+		if err != nil {
+			return layer, fmt.Errorf("failed to normalize diff: %w", err)
+		}
+	}
+	if commitInfo.Compression != "" {
+		layer, err = r.compressLayer(ctx, layer, commitInfo.Compression)
+		if err != nil {
+			return layer, fmt.Errorf("failed to compress diff: %w", err)
+		}
+	}
 	r.Infof("diff for snapshot %s created", snapshotName)
 	return layer, nil
 }
@@ -0,0 +1,19 @@
+package runtime
+
+import (
+	"context"
+
+	"github.com/lingdie/image-manip-server/pkg/options"
+)
+
+// DefaultDockerfileComment is the history comment of the layers built by a Dockerfile with buildkit.
+const DefaultDockerfileComment = "buildkit.dockerfile.v0"
+
+// Squash squashes the layers above the base layer of an image into one. If neither the base layer
+// digest nor the base image is given, the base layer is found by DetectBase with the strategies of
+// opt, for each platform of a multi-platform image, and the detection is reported in the result.
+// The base layer is not detected for a range of layers or a squash plan, which apply to all the layers.
+func (r *Runtime) Squash(ctx context.Context, opt options.RebaseOptions) (RebaseResult, error) {
+	opt.AutoSquash = true
+	return r.rebase(ctx, opt, true)
+}
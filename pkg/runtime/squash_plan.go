@@ -0,0 +1,105 @@
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/containerd/containerd/errdefs"
+)
+
+// SquashPlanner chooses the todo list of a squash from the sizes of the layers, the sizes of their blobs.
+// Adjacent layers are merged, smallest first, except the layers of KeepLayerSize or more, which are
+// kept on their own, and no layer is merged with the layer above a boundary.
+type SquashPlanner struct {
+	// MaxLayers is the number of layers to plan at most, 0 for no limit
+	MaxLayers int
+	// MinLayerSize is the size below which a layer is merged with a neighbour, 0 for no minimum
+	MinLayerSize int64
+	// KeepLayerSize is the size from which a layer is kept on its own, 0 for no threshold
+	KeepLayerSize int64
+	// Boundaries are the indexes of the layers which are the top of the layer they become. They are
+	// positions rather than digests since an image may hold the same layer several times.
+	Boundaries []int
+}
+
+// layerSpan is a run of adjacent layers planned to become a single layer.
+type layerSpan struct {
+	first, last int
+	size        int64
+}
+
+// Plan returns the todo list of layers: each group of layers to squash is a pick followed by fixups.
+// Layers smaller than MinLayerSize are first merged into their smaller neighbour, then the adjacent
+// layers of the smallest total size are merged until there are at most MaxLayers layers.
+// It fails if MaxLayers can not be reached.
+func (p SquashPlanner) Plan(layers LayerChain) (TodoList, error) {
+	boundaries := make(map[int]bool, len(p.Boundaries))
+	for _, i := range p.Boundaries {
+		boundaries[i] = true
+	}
+	spans := make([]layerSpan, layers.Len())
+	for i, desc := range layers.Descriptors {
+		spans[i] = layerSpan{first: i, last: i, size: desc.Size}
+	}
+	// a kept layer is never merged, so it is always a span of its own
+	kept := func(s layerSpan) bool {
+		return p.KeepLayerSize > 0 && s.first == s.last && s.size >= p.KeepLayerSize
+	}
+	// mergeable reports whether the spans i and i+1 can be merged
+	mergeable := func(i int) bool {
+		if i < 0 || i+1 >= len(spans) {
+			return false
+		}
+		return !boundaries[spans[i].last] && !kept(spans[i]) && !kept(spans[i+1])
+	}
+	merge := func(i int) {
+		spans[i].last = spans[i+1].last
+		spans[i].size += spans[i+1].size
+		spans = append(spans[:i+1], spans[i+2:]...)
+	}
+	for p.MinLayerSize > 0 {
+		// merge the smallest layer below the minimum into its smallest neighbour
+		next := -1
+		for i, s := range spans {
+			if s.size >= p.MinLayerSize || (!mergeable(i-1) && !mergeable(i)) {
+				continue
+			}
+			if next == -1 || s.size < spans[next].size {
+				next = i
+			}
+		}
+		if next == -1 {
+			break
+		}
+		if mergeable(next-1) && (!mergeable(next) || spans[next-1].size <= spans[next+1].size) {
+			next--
+		}
+		merge(next)
+	}
+	for p.MaxLayers > 0 && len(spans) > p.MaxLayers {
+		// merge the two adjacent layers of the smallest total size
+		next := -1
+		for i := range spans {
+			if !mergeable(i) {
+				continue
+			}
+			if next == -1 || spans[i].size+spans[i+1].size < spans[next].size+spans[next+1].size {
+				next = i
+			}
+		}
+		if next == -1 {
+			return nil, fmt.Errorf("can not plan %d layers or less, %d layers are left without merging a kept layer or across a boundary: %w", p.MaxLayers, len(spans), errdefs.ErrInvalidArgument)
+		}
+		merge(next)
+	}
+	todoList := make(TodoList, 0, layers.Len())
+	for _, s := range spans {
+		for i := s.first; i <= s.last; i++ {
+			action := TodoFixup
+			if i == s.first {
+				action = TodoPick
+			}
+			todoList = append(todoList, TodoItem{Action: action, Digest: layers.Descriptors[i].Digest})
+		}
+	}
+	return todoList, nil
+}
@@ -0,0 +1,85 @@
+package runtime_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestSquashPlanner(t *testing.T) {
+	layersOfSizes := func(sizes ...int64) runtime.LayerChain {
+		var (
+			descs   []ocispec.Descriptor
+			diffIDs []digest.Digest
+		)
+		for i, size := range sizes {
+			descs = append(descs, ocispec.Descriptor{Digest: digest.FromString(fmt.Sprintf("layer %d", i)), Size: size})
+			diffIDs = append(diffIDs, digest.FromString(fmt.Sprintf("diff %d", i)))
+		}
+		layers, err := runtime.NewLayerChain(descs, diffIDs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return layers
+	}
+	for _, tc := range []struct {
+		name    string
+		sizes   []int64
+		planner runtime.SquashPlanner
+		// expected holds the first letter of the action of each layer
+		expected string
+	}{
+		{
+			name:     "min layer size",
+			sizes:    []int64{100, 1, 2, 50, 3},
+			planner:  runtime.SquashPlanner{MinLayerSize: 10},
+			expected: "ppfff",
+		},
+		{
+			name:     "keep layer size",
+			sizes:    []int64{100, 1, 2, 50, 3},
+			planner:  runtime.SquashPlanner{MinLayerSize: 10, KeepLayerSize: 50},
+			expected: "ppfpp",
+		},
+		{
+			name:     "max layers",
+			sizes:    []int64{5, 5, 5, 5},
+			planner:  runtime.SquashPlanner{MaxLayers: 2, Boundaries: []int{1}},
+			expected: "pfpf",
+		},
+		{
+			name:     "nothing to do",
+			sizes:    []int64{5, 5},
+			planner:  runtime.SquashPlanner{MaxLayers: 3},
+			expected: "pp",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			layers := layersOfSizes(tc.sizes...)
+			todoList, err := tc.planner.Plan(layers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var actions strings.Builder
+			for i, item := range todoList {
+				if item.Digest != layers.Descriptors[i].Digest {
+					t.Errorf("item %d: expected layer %s, got %s", i, layers.Descriptors[i].Digest, item.Digest)
+				}
+				actions.WriteByte(item.Action[0])
+			}
+			if actions.String() != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, actions.String())
+			}
+		})
+	}
+
+	layers := layersOfSizes(5, 5, 5)
+	planner := runtime.SquashPlanner{MaxLayers: 1, Boundaries: []int{0}}
+	if _, err := planner.Plan(layers); err == nil {
+		t.Error("expected an error when merging across a boundary is needed")
+	}
+}
@@ -0,0 +1,162 @@
+package runtime
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/containerd/containerd/pkg/progress"
+	"github.com/opencontainers/go-digest"
+)
+
+// TodoAction is a command in a git-style rebase todo list.
+type TodoAction string
+
+const (
+	// TodoPick keeps the layer as it is.
+	TodoPick TodoAction = "pick"
+	// TodoReword keeps the layer but replaces the comment of its history entry.
+	TodoReword TodoAction = "reword"
+	// TodoSquash merges the layer into the previous one and combines their history comments.
+	TodoSquash TodoAction = "squash"
+	// TodoFixup merges the layer into the previous one and discards its history comment.
+	TodoFixup TodoAction = "fixup"
+	// TodoDrop removes the layer.
+	TodoDrop TodoAction = "drop"
+)
+
+// unsupportedTodoActions are the actions of git rebase that are rejected with a clearer error than an unknown action.
+var unsupportedTodoActions = map[string]string{
+	"e":    "edit",
+	"edit": "edit",
+}
+
+var todoActions = map[string]TodoAction{
+	"p":                TodoPick,
+	string(TodoPick):   TodoPick,
+	"r":                TodoReword,
+	string(TodoReword): TodoReword,
+	"s":                TodoSquash,
+	string(TodoSquash): TodoSquash,
+	"f":                TodoFixup,
+	string(TodoFixup):  TodoFixup,
+	"d":                TodoDrop,
+	string(TodoDrop):   TodoDrop,
+}
+
+const todoListHelp = `
+# Commands:
+# p, pick <layer> = use layer
+# r, reword <layer> <comment> = use layer, but replace the comment of its history entry
+# s, squash <layer> = merge layer into the previous one and combine their comments
+# f, fixup <layer> = like "squash", but discard the comment of this layer
+# d, drop <layer> = remove layer
+#
+# These lines can be re-ordered; they are executed from top (lowest layer) to bottom.
+# Anything after "#" following the layer digest is ignored.
+# If you remove a line here THAT LAYER WILL BE LOST.
+# However, if you remove everything, the rebase will be aborted.
+`
+
+// TodoItem is a single line of a rebase todo list.
+type TodoItem struct {
+	Action TodoAction
+	Digest digest.Digest
+	// Message is the text following the digest. It is the new history
+	// comment for reword and is ignored by the other actions.
+	Message string
+}
+
+func (t TodoItem) String() string {
+	if t.Message == "" {
+		return fmt.Sprintf("%s %s", t.Action, t.Digest)
+	}
+	return fmt.Sprintf("%s %s %s", t.Action, t.Digest, t.Message)
+}
+
+// TodoList is an ordered list of actions applied to the layers above the base layer.
+type TodoList []TodoItem
+
+// ParseTodoList parses a git-style todo list. Empty lines and lines starting with "#" are ignored.
+func ParseTodoList(text string) (TodoList, error) {
+	var list TodoList
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: missing layer digest in %q", i+1, line)
+		}
+		if name, ok := unsupportedTodoActions[fields[0]]; ok {
+			return nil, fmt.Errorf("line %d: action %q is not supported, a rebase can not stop to amend a layer", i+1, name)
+		}
+		action, ok := todoActions[fields[0]]
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown action %q", i+1, fields[0])
+		}
+		dgst, err := digest.Parse(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid layer digest %q: %w", i+1, fields[1], err)
+		}
+		// the message is everything after the digest, with its original spacing
+		message := strings.TrimSpace(line[len(fields[0]):])
+		message = strings.TrimSpace(message[len(fields[1]):])
+		if strings.HasPrefix(message, "#") {
+			message = ""
+		}
+		if action == TodoReword && message == "" {
+			return nil, fmt.Errorf("line %d: reword requires a new comment", i+1)
+		}
+		list = append(list, TodoItem{
+			Action:  action,
+			Digest:  dgst,
+			Message: message,
+		})
+	}
+	return list, nil
+}
+
+func (l TodoList) String() string {
+	var b strings.Builder
+	for _, item := range l {
+		b.WriteString(item.String())
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// annotateTodoList sets the message of every item to a comment describing
+// the size and the CreatedBy of the layer, so that it is easier to edit.
+func annotateTodoList(list TodoList, layers LayerChain, histories []layerHistory) {
+	for i := range list {
+		if i >= layers.Len() {
+			break
+		}
+		var createdBy string
+		if i < len(histories) {
+			createdBy = strings.Join(strings.Fields(histories[i].Layer.CreatedBy), " ")
+		}
+		list[i].Message = fmt.Sprintf("# %s %s", progress.Bytes(layers.Descriptors[i].Size), createdBy)
+	}
+}
+
+func getSquashAll(layers LayerChain) TodoList {
+	var toDoList TodoList
+	for i := 0; i < layers.Len(); i++ {
+		action := TodoFixup
+		if i == 0 {
+			action = TodoPick
+		}
+		toDoList = append(toDoList, TodoItem{Action: action, Digest: layers.Descriptors[i].Digest})
+	}
+	return toDoList
+}
+
+func getAllPick(layers LayerChain) TodoList {
+	toDoList := make(TodoList, layers.Len())
+	for i := 0; i < layers.Len(); i++ {
+		toDoList[i] = TodoItem{Action: TodoPick, Digest: layers.Descriptors[i].Digest}
+	}
+	return toDoList
+}
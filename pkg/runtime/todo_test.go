@@ -0,0 +1,50 @@
+package runtime_test
+
+import (
+	"testing"
+
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+)
+
+func TestParseTodoList(t *testing.T) {
+	const (
+		layer1 = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+		layer2 = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+		layer3 = "sha256:3333333333333333333333333333333333333333333333333333333333333333"
+	)
+	text := "# comment\n" +
+		"pick " + layer1 + " # 1.0 MiB RUN make\n" +
+		"\n" +
+		"s " + layer2 + "\n" +
+		"reword " + layer3 + "   install  the app\n"
+	list, err := runtime.ParseTodoList(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := runtime.TodoList{
+		{Action: runtime.TodoPick, Digest: layer1},
+		{Action: runtime.TodoSquash, Digest: layer2},
+		{Action: runtime.TodoReword, Digest: layer3, Message: "install  the app"},
+	}
+	if len(list) != len(expected) {
+		t.Fatalf("expected %d items, got %d", len(expected), len(list))
+	}
+	for i := range expected {
+		if list[i] != expected[i] {
+			t.Errorf("item %d: expected %+v, got %+v", i, expected[i], list[i])
+		}
+	}
+
+	for _, invalid := range []string{
+		"pick",
+		"jump " + layer1,
+		"pick not-a-digest",
+		"reword " + layer1,
+		"edit " + layer1,
+		"e " + layer1,
+	} {
+		if _, err := runtime.ParseTodoList(invalid); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
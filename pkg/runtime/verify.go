@@ -3,34 +3,50 @@ package runtime
 import (
 	"context"
 	"fmt"
+	"time"
 
+	imagesutil "github.com/lingdie/image-manip-server/pkg/images"
 	"github.com/lingdie/image-manip-server/pkg/options"
 )
 
-func (r *Runtime) Verifybase(ctx context.Context, opt options.VerifyBaseOptions) error {
+// Verifybase checks that the original image of opt is built on its base image. If it is not,
+// the reason is returned in the result along with the error.
+func (r *Runtime) Verifybase(ctx context.Context, opt options.VerifyBaseOptions) (result VerifyBaseResult, err error) {
+	defer r.record(ctx, &result.Timings, time.Now(), "verifyBase")
+	result.OriginalImage = opt.OriginalImage
+	result.BaseImage = opt.BaseImage
 	origImage, err := r.GetImage(ctx, opt.OriginalImage)
 	if err != nil {
 		r.Errorf("failed to get original image %q: %v", opt.OriginalImage, err)
-		return err
+		return result, err
 	}
 	baseImage, err := r.GetImage(ctx, opt.BaseImage)
 	if err != nil {
 		r.Errorf("failed to get base image %q: %v", opt.BaseImage, err)
-		return err
+		return result, err
 	}
-	if len(origImage.Manifest.Layers) < len(baseImage.Manifest.Layers) {
-		err := fmt.Errorf("original image %q has fewer layers (%d) than base image %q (%d)", opt.OriginalImage, len(origImage.Manifest.Layers), opt.BaseImage, len(baseImage.Manifest.Layers))
+	result.BaseLayerCount = len(baseImage.Manifest.Layers)
+	if err := verifyBaseLayers(origImage, opt.OriginalImage, baseImage, opt.BaseImage); err != nil {
 		r.Error(err)
-		return err
+		result.Reason = err.Error()
+		return result, err
+	}
+	result.Based = true
+	r.Infof("image %q is based on %q", opt.OriginalImage, opt.BaseImage)
+	return result, nil
+}
+
+// verifyBaseLayers checks that the layers of baseImage are a prefix of the layers of origImage.
+// The refs are only used in error messages.
+func verifyBaseLayers(origImage imagesutil.Image, origRef string, baseImage imagesutil.Image, baseRef string) error {
+	if len(origImage.Manifest.Layers) < len(baseImage.Manifest.Layers) {
+		return fmt.Errorf("original image %q has fewer layers (%d) than base image %q (%d)", origRef, len(origImage.Manifest.Layers), baseRef, len(baseImage.Manifest.Layers))
 	}
 	for i, baseLayer := range baseImage.Manifest.Layers {
 		origLayer := origImage.Manifest.Layers[i]
 		if baseLayer.Digest != origLayer.Digest {
-			err := fmt.Errorf("layer %d digest mismatch: original image %q has layer digest %q, base image %q has layer digest %q", i, opt.OriginalImage, origLayer.Digest.String(), opt.BaseImage, baseLayer.Digest.String())
-			r.Error(err)
-			return err
+			return fmt.Errorf("layer %d digest mismatch: original image %q has layer digest %q, base image %q has layer digest %q", i, origRef, origLayer.Digest.String(), baseRef, baseLayer.Digest.String())
 		}
 	}
-	r.Infof("image %q is based on %q", opt.OriginalImage, opt.BaseImage)
 	return nil
 }
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+	"github.com/sirupsen/logrus"
+)
+
+// MaxFinishedJobs is the number of finished jobs kept.
+const MaxFinishedJobs = maxFinishedJobs
+
+// FinishedJobs returns the ids of the finished jobs kept by q, the oldest first.
+func FinishedJobs(q *JobQueue) []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]string(nil), q.finished...)
+}
+
+// AddJobProgress reports a progress event of the job id, as its operation would.
+func AddJobProgress(q *JobQueue, id string, p runtime.Progress) error {
+	j, err := q.get(id)
+	if err != nil {
+		return err
+	}
+	j.addProgress(p)
+	return nil
+}
+
+// NewJobsHandler returns a server of the jobs of q, without a runtime to run operations.
+func NewJobsHandler(q *JobQueue) http.Handler {
+	s := &Server{runtime: &runtime.Runtime{Logger: logrus.New()}, mux: http.NewServeMux(), jobs: q}
+	s.mux.HandleFunc("GET /v1/jobs/{id}", s.handleGetJob)
+	s.mux.HandleFunc("POST /v1/jobs/{id}/cancel", s.handleCancelJob)
+	s.mux.HandleFunc("GET /v1/jobs/{id}/events", s.handleJobEvents)
+	return s
+}
+
+// NewHistoryHandler returns a server of the history routes listing the entries with entries.
+// The operations run without a lease.
+func NewHistoryHandler(entries func(ctx context.Context, imageRef, keyword string) ([]runtime.HistoryEntry, error)) http.Handler {
+	s := &Server{
+		runtime: &runtime.Runtime{Logger: logrus.New()},
+		mux:     http.NewServeMux(),
+		lease: func(ctx context.Context) (context.Context, func(context.Context) error, error) {
+			return ctx, func(context.Context) error { return nil }, nil
+		},
+	}
+	s.handleHistory(entries)
+	return s
+}
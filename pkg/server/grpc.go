@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/lingdie/image-manip-server/pkg/api/types"
+	apiv1 "github.com/lingdie/image-manip-server/pkg/api/v1"
+	"github.com/lingdie/image-manip-server/pkg/options"
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+	"google.golang.org/grpc"
+)
+
+// progressBufferSize is the number of progress events buffered for a slow client, more are dropped
+const progressBufferSize = 64
+
+// GRPCService exposes the operations of a Runtime as the gRPC service of pkg/api/v1. The operations
+// modifying layers stream their progress before their result. Like the HTTP API, every call holds
+// its own lease and shares the containerd connection of the runtime.
+type GRPCService struct {
+	apiv1.UnimplementedImageManipServer
+	server *Server
+}
+
+// NewGRPCService returns the gRPC service of the operations run by s.
+func NewGRPCService(s *Server) *GRPCService {
+	return &GRPCService{server: s}
+}
+
+// Register registers the service on a gRPC server.
+func (g *GRPCService) Register(s *grpc.Server) {
+	apiv1.RegisterImageManipServer(s, g)
+}
+
+func (g *GRPCService) Rebase(req *apiv1.RebaseRequest, stream grpc.ServerStreamingServer[apiv1.RebaseResponse]) error {
+	return g.rebase(req, stream, g.server.runtime.Rebase)
+}
+
+func (g *GRPCService) Squash(req *apiv1.RebaseRequest, stream grpc.ServerStreamingServer[apiv1.RebaseResponse]) error {
+	return g.rebase(req, stream, g.server.runtime.Squash)
+}
+
+func (g *GRPCService) rebase(req *apiv1.RebaseRequest, stream grpc.ServerStreamingServer[apiv1.RebaseResponse], op func(context.Context, options.RebaseOptions) (runtime.RebaseResult, error)) error {
+	opt := rebaseOptionsFromProto(req)
+	result, err := g.runStreaming(stream.Context(), func(p *apiv1.Progress) error {
+		return stream.Send(&apiv1.RebaseResponse{Event: &apiv1.RebaseResponse_Progress{Progress: p}})
+	}, func(ctx context.Context) (interface{}, error) {
+		return op(ctx, opt)
+	})
+	if err != nil {
+		return errdefs.ToGRPC(err)
+	}
+	return stream.Send(&apiv1.RebaseResponse{Event: &apiv1.RebaseResponse_Result{Result: rebaseResultToProto(result.(runtime.RebaseResult))}})
+}
+
+func (g *GRPCService) Remove(req *apiv1.RemoveRequest, stream grpc.ServerStreamingServer[apiv1.RemoveResponse]) error {
+	opt := removeOptionsFromProto(req)
+	result, err := g.runStreaming(stream.Context(), func(p *apiv1.Progress) error {
+		return stream.Send(&apiv1.RemoveResponse{Event: &apiv1.RemoveResponse_Progress{Progress: p}})
+	}, func(ctx context.Context) (interface{}, error) {
+		return g.server.runtime.Remove(ctx, opt)
+	})
+	if err != nil {
+		return errdefs.ToGRPC(err)
+	}
+	return stream.Send(&apiv1.RemoveResponse{Event: &apiv1.RemoveResponse_Result{Result: removeResultToProto(result.(runtime.RemoveResult))}})
+}
+
+func (g *GRPCService) Tag(ctx context.Context, req *apiv1.TagRequest) (*apiv1.TagResult, error) {
+	result, err := g.server.run(ctx, func(ctx context.Context) (interface{}, error) {
+		return g.server.runtime.Tag(ctx, req.GetSourceImageRef(), req.GetTargetImage())
+	})
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	return tagResultToProto(result.(runtime.TagResult)), nil
+}
+
+func (g *GRPCService) VerifyBase(ctx context.Context, req *apiv1.VerifyBaseRequest) (*apiv1.VerifyBaseResult, error) {
+	opt := options.VerifyBaseOptions{
+		OriginalImage: req.GetOriginalImage(),
+		BaseImage:     req.GetBaseImage(),
+	}
+	result, err := g.server.run(ctx, func(ctx context.Context) (interface{}, error) {
+		return g.server.runtime.Verifybase(ctx, opt)
+	})
+	verified, _ := result.(runtime.VerifyBaseResult)
+	if err != nil && verified.Reason == "" {
+		return nil, errdefs.ToGRPC(err)
+	}
+	// a mismatch is an answer rather than a failure
+	return verifyBaseResultToProto(verified), nil
+}
+
+func (g *GRPCService) ListImages(ctx context.Context, req *apiv1.ListImagesRequest) (*apiv1.ListImagesResponse, error) {
+	opt := types.ImageListOptions{
+		Filters:          req.GetFilters(),
+		NameAndRefFilter: req.GetNames(),
+	}
+	result, err := g.server.run(ctx, func(ctx context.Context) (interface{}, error) {
+		return g.server.runtime.ImageSummaries(ctx, opt)
+	})
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	resp := &apiv1.ListImagesResponse{}
+	for _, summary := range result.([]runtime.ImageSummary) {
+		resp.Images = append(resp.Images, imageSummaryToProto(summary))
+	}
+	return resp, nil
+}
+
+func (g *GRPCService) ImageHistory(ctx context.Context, req *apiv1.ImageHistoryRequest) (*apiv1.ImageHistoryResponse, error) {
+	result, err := g.server.run(ctx, func(ctx context.Context) (interface{}, error) {
+		return g.server.runtime.HistoryEntries(ctx, req.GetImageRef(), req.GetKeyword())
+	})
+	if err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+	resp := &apiv1.ImageHistoryResponse{}
+	for _, entry := range result.([]runtime.HistoryEntry) {
+		resp.Entries = append(resp.Entries, historyEntryToProto(entry))
+	}
+	return resp, nil
+}
+
+// runStreaming runs an operation like Server.run, sending its progress with send. The events are
+// buffered so that a slow client does not hold the operation back; they are dropped when the buffer
+// is full. The progress has been sent when runStreaming returns.
+func (g *GRPCService) runStreaming(ctx context.Context, send func(*apiv1.Progress) error, run jobFunc) (interface{}, error) {
+	events := make(chan runtime.Progress, progressBufferSize)
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		var err error
+		for p := range events {
+			// keep draining the events once the stream is broken
+			if err == nil {
+				err = send(progressToProto(p))
+			}
+		}
+	}()
+	ctx = runtime.WithProgress(ctx, func(p runtime.Progress) {
+		select {
+		case events <- p:
+		default:
+		}
+	})
+	result, err := g.server.run(ctx, run)
+	close(events)
+	<-sent
+	return result, err
+}
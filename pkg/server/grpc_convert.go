@@ -0,0 +1,309 @@
+package server
+
+import (
+	apiv1 "github.com/lingdie/image-manip-server/pkg/api/v1"
+	"github.com/lingdie/image-manip-server/pkg/options"
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+	"github.com/lingdie/image-manip-server/pkg/timer"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func commitOptionsFromProto(c *apiv1.CommitOptions) options.CommitOptions {
+	return options.CommitOptions{
+		Author:         c.GetAuthor(),
+		Comment:        c.GetComment(),
+		Created:        c.GetCreated(),
+		Reproducible:   c.GetReproducible(),
+		ManifestFormat: c.GetManifestFormat(),
+		Compression:    c.GetCompression(),
+	}
+}
+
+func rebaseOptionsFromProto(req *apiv1.RebaseRequest) options.RebaseOptions {
+	return options.RebaseOptions{
+		CommitOptions:       commitOptionsFromProto(req.GetCommit()),
+		ImageRef:            req.GetImageRef(),
+		NewImageName:        req.GetNewImageName(),
+		BaseLayerDigest:     req.GetBaseLayerDigest(),
+		BaseImageRef:        req.GetBaseImageRef(),
+		NewBaseImageRef:     req.GetNewBaseImageRef(),
+		AutoSquash:          req.GetAutoSquash(),
+		TodoList:            req.GetTodoList(),
+		SquashFrom:          req.GetSquashFrom(),
+		SquashTo:            req.GetSquashTo(),
+		SquashPlan:          squashPlanFromProto(req.GetSquashPlan()),
+		BaseDetection:       req.GetBaseDetection(),
+		ConfigMergePolicy:   req.GetConfigMergePolicy(),
+		ConfigFieldPolicies: req.GetConfigFieldPolicies(),
+		DryRun:              req.GetDryRun(),
+		PlatformOptions:     platformOptionsFromProto(req.GetPlatforms(), req.GetAllPlatforms()),
+	}
+}
+
+func squashPlanFromProto(p *apiv1.SquashPlan) *options.SquashPlanOptions {
+	if p == nil {
+		return nil
+	}
+	return &options.SquashPlanOptions{
+		MaxLayers:     int(p.GetMaxLayers()),
+		MinLayerSize:  p.GetMinLayerSize(),
+		KeepLayerSize: p.GetKeepLayerSize(),
+		StableLayers:  p.GetStableLayers(),
+	}
+}
+
+func removeOptionsFromProto(req *apiv1.RemoveRequest) options.RemoveOptions {
+	return options.RemoveOptions{
+		CommitOptions:   commitOptionsFromProto(req.GetCommit()),
+		File:            req.GetFile(),
+		Paths:           req.GetPaths(),
+		AllowNoMatch:    req.GetAllowNoMatch(),
+		Purge:           req.GetPurge(),
+		ImageRef:        req.GetImageRef(),
+		NewImageName:    req.GetNewImageName(),
+		DryRun:          req.GetDryRun(),
+		PlatformOptions: platformOptionsFromProto(req.GetPlatforms(), req.GetAllPlatforms()),
+	}
+}
+
+func platformOptionsFromProto(platforms []string, all bool) options.PlatformOptions {
+	return options.PlatformOptions{
+		Platforms:    platforms,
+		AllPlatforms: all,
+	}
+}
+
+func progressToProto(p runtime.Progress) *apiv1.Progress {
+	pb := &apiv1.Progress{
+		Time:    timestamppb.New(p.Time),
+		Step:    p.Step,
+		Message: p.Message,
+		Current: int32(p.Current),
+		Total:   int32(p.Total),
+	}
+	if p.Duration != 0 {
+		pb.Duration = durationpb.New(p.Duration)
+	}
+	return pb
+}
+
+func timingsToProto(timings []timer.Timing) []*apiv1.Timing {
+	var pb []*apiv1.Timing
+	for _, t := range timings {
+		pb = append(pb, &apiv1.Timing{Name: t.Name, Duration: durationpb.New(t.Duration)})
+	}
+	return pb
+}
+
+func digestsToProto(digests []digest.Digest) []string {
+	var pb []string
+	for _, dgst := range digests {
+		pb = append(pb, dgst.String())
+	}
+	return pb
+}
+
+// imageResultToProto returns nil for the empty result of a dry run.
+func imageResultToProto(r runtime.ImageResult) *apiv1.ImageResult {
+	if r.NewImageName == "" && r.ManifestDigest == "" {
+		return nil
+	}
+	pb := &apiv1.ImageResult{
+		NewImageName:   r.NewImageName,
+		ManifestDigest: r.ManifestDigest.String(),
+		ConfigDigest:   r.ConfigDigest.String(),
+	}
+	for _, layer := range r.Layers {
+		pb.Layers = append(pb.Layers, &apiv1.ResultLayer{
+			Digest:    layer.Digest.String(),
+			DiffId:    layer.DiffID.String(),
+			MediaType: layer.MediaType,
+			Size:      layer.Size,
+			Created:   layer.Created,
+		})
+	}
+	return pb
+}
+
+func configChangesToProto(changes []runtime.ConfigChange) []*apiv1.ConfigChange {
+	var pb []*apiv1.ConfigChange
+	for _, c := range changes {
+		pb = append(pb, &apiv1.ConfigChange{Field: c.Field, From: c.From, To: c.To})
+	}
+	return pb
+}
+
+func historyToProto(h ocispec.History) *apiv1.History {
+	pb := &apiv1.History{
+		CreatedBy:  h.CreatedBy,
+		Author:     h.Author,
+		Comment:    h.Comment,
+		EmptyLayer: h.EmptyLayer,
+	}
+	if h.Created != nil {
+		pb.Created = timestamppb.New(*h.Created)
+	}
+	return pb
+}
+
+func planToProto(p *runtime.Plan) *apiv1.Plan {
+	if p == nil {
+		return nil
+	}
+	pb := &apiv1.Plan{
+		ImageRef:       p.ImageRef,
+		NewImageName:   p.NewImageName,
+		SplitIndex:     int32(p.SplitIndex),
+		BaseLayerCount: int32(p.BaseLayerCount),
+		ConfigChanges:  configChangesToProto(p.ConfigChanges),
+		EstimatedSize:  p.EstimatedSize,
+	}
+	if len(p.TodoList) > 0 {
+		pb.TodoList = p.TodoList.String()
+	}
+	for _, layer := range p.Layers {
+		pb.Layers = append(pb.Layers, &apiv1.PlannedLayer{
+			Digest:    layer.Digest.String(),
+			Created:   layer.Created,
+			Sources:   digestsToProto(layer.Sources),
+			CreatedBy: layer.CreatedBy,
+			Size:      layer.Size,
+		})
+	}
+	for _, h := range p.History {
+		pb.History = append(pb.History, historyToProto(h))
+	}
+	return pb
+}
+
+func platformResultsToProto(results []runtime.PlatformResult) []*apiv1.PlatformResult {
+	var pb []*apiv1.PlatformResult
+	for _, r := range results {
+		pb = append(pb, &apiv1.PlatformResult{
+			Platform:      r.Platform,
+			Image:         imageResultToProto(r.ImageResult),
+			ConfigChanges: configChangesToProto(r.ConfigChanges),
+			Plan:          planToProto(r.Plan),
+			Matches:       pathMatchesToProto(r.Matches),
+			PurgedLayers:  purgedLayersToProto(r.PurgedLayers),
+			BaseDetection: baseDetectionToProto(r.BaseDetection),
+		})
+	}
+	return pb
+}
+
+func baseDetectionToProto(d *runtime.BaseDetection) *apiv1.BaseDetection {
+	if d == nil {
+		return nil
+	}
+	return &apiv1.BaseDetection{
+		Strategy:        d.Strategy,
+		Confidence:      string(d.Confidence),
+		BaseLayerIndex:  int32(d.BaseLayerIndex),
+		BaseLayerDigest: d.BaseLayerDigest.String(),
+		BaseImage:       d.BaseImage,
+		Reason:          d.Reason,
+	}
+}
+
+func pathMatchesToProto(matches []runtime.PathMatch) []*apiv1.PathMatch {
+	var pb []*apiv1.PathMatch
+	for _, m := range matches {
+		pb = append(pb, &apiv1.PathMatch{Pattern: m.Pattern, Paths: m.Paths})
+	}
+	return pb
+}
+
+func purgedLayersToProto(layers []runtime.PurgedLayer) []*apiv1.PurgedLayer {
+	var pb []*apiv1.PurgedLayer
+	for _, l := range layers {
+		pb = append(pb, &apiv1.PurgedLayer{
+			Index:     int32(l.Index),
+			Digest:    l.Digest.String(),
+			NewDigest: l.NewDigest.String(),
+			NewDiffId: l.NewDiffID.String(),
+			Paths:     l.Paths,
+		})
+	}
+	return pb
+}
+
+func rebaseResultToProto(r runtime.RebaseResult) *apiv1.RebaseResult {
+	return &apiv1.RebaseResult{
+		ImageRef:      r.ImageRef,
+		Image:         imageResultToProto(r.ImageResult),
+		ConfigChanges: configChangesToProto(r.ConfigChanges),
+		Plan:          planToProto(r.Plan),
+		Timings:       timingsToProto(r.Timings),
+		Platforms:     platformResultsToProto(r.Platforms),
+		BaseDetection: baseDetectionToProto(r.BaseDetection),
+	}
+}
+
+func removeResultToProto(r runtime.RemoveResult) *apiv1.RemoveResult {
+	return &apiv1.RemoveResult{
+		ImageRef:     r.ImageRef,
+		File:         r.File,
+		Image:        imageResultToProto(r.ImageResult),
+		Plan:         planToProto(r.Plan),
+		Timings:      timingsToProto(r.Timings),
+		Platforms:    platformResultsToProto(r.Platforms),
+		Paths:        r.Paths,
+		Matches:      pathMatchesToProto(r.Matches),
+		PurgedLayers: purgedLayersToProto(r.PurgedLayers),
+	}
+}
+
+func tagResultToProto(r runtime.TagResult) *apiv1.TagResult {
+	return &apiv1.TagResult{
+		SourceImage:    r.SourceImage,
+		TargetImage:    r.TargetImage,
+		ManifestDigest: r.ManifestDigest.String(),
+		Timings:        timingsToProto(r.Timings),
+	}
+}
+
+func verifyBaseResultToProto(r runtime.VerifyBaseResult) *apiv1.VerifyBaseResult {
+	return &apiv1.VerifyBaseResult{
+		OriginalImage:  r.OriginalImage,
+		BaseImage:      r.BaseImage,
+		Based:          r.Based,
+		Reason:         r.Reason,
+		BaseLayerCount: int32(r.BaseLayerCount),
+		Timings:        timingsToProto(r.Timings),
+	}
+}
+
+func imageSummaryToProto(s runtime.ImageSummary) *apiv1.ImageSummary {
+	return &apiv1.ImageSummary{
+		Name:         s.Name,
+		Repository:   s.Repository,
+		Tag:          s.Tag,
+		Digest:       s.Digest.String(),
+		ConfigDigest: s.ConfigDigest.String(),
+		CreatedAt:    timestamppb.New(s.CreatedAt),
+		Platform:     s.Platform,
+		Size:         s.Size,
+		BlobSize:     s.BlobSize,
+	}
+}
+
+func historyEntryToProto(e runtime.HistoryEntry) *apiv1.HistoryEntry {
+	entry := &apiv1.HistoryEntry{
+		LastSnapshot: e.LastSnapshot,
+		LastLayer:    e.LastLayer,
+		CreatedSince: e.CreatedSince,
+		CreatedBy:    e.CreatedBy,
+		Size:         e.Size,
+		Comment:      e.Comment,
+		Empty:        e.Empty,
+		SizeBytes:    e.SizeBytes,
+	}
+	if e.Created != nil {
+		entry.Created = timestamppb.New(*e.Created)
+	}
+	return entry
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/containerd/containerd/errdefs"
+)
+
+// handleSubmitJob queues an operation as a job and answers with its status.
+func (s *Server) handleSubmitJob(w http.ResponseWriter, req *http.Request) {
+	name := req.PathValue("operation")
+	op, ok := s.jobOperations[name]
+	if !ok {
+		s.writeError(w, req, http.StatusNotFound, fmt.Errorf("operation %q can not be submitted as a job", name))
+		return
+	}
+	run, err := op(w, req)
+	if err != nil {
+		s.writeError(w, req, http.StatusBadRequest, err)
+		return
+	}
+	status, err := s.jobs.Submit(name, func(ctx context.Context) (interface{}, error) {
+		return s.run(ctx, run)
+	})
+	if err != nil {
+		s.writeError(w, req, statusCode(err), err)
+		return
+	}
+	s.runtime.Infof("job %s submitted: %s", status.ID, name)
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+func (s *Server) handleGetJob(w http.ResponseWriter, req *http.Request) {
+	status, err := s.jobs.Get(req.PathValue("id"))
+	if err != nil {
+		s.writeError(w, req, statusCode(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Server) handleCancelJob(w http.ResponseWriter, req *http.Request) {
+	status, err := s.jobs.Cancel(req.PathValue("id"))
+	if err != nil {
+		s.writeError(w, req, statusCode(err), err)
+		return
+	}
+	s.runtime.Infof("job %s canceled", status.ID)
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleJobEvents streams the progress of a job as Server-Sent Events. The past events are
+// sent first, then the new ones as they happen. A "status" event is sent whenever the state
+// of the job changes; the stream ends with the status of the finished job.
+func (s *Server) handleJobEvents(w http.ResponseWriter, req *http.Request) {
+	j, err := s.jobs.get(req.PathValue("id"))
+	if err != nil {
+		s.writeError(w, req, statusCode(err), err)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.writeError(w, req, http.StatusInternalServerError, fmt.Errorf("streaming is not supported: %w", errdefs.ErrNotImplemented))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	var (
+		sent      int
+		lastState JobState
+	)
+	for {
+		events, status, changed := j.eventsSince(sent)
+		for _, e := range events {
+			if err := writeEvent(w, "progress", e); err != nil {
+				return
+			}
+		}
+		sent += len(events)
+		if status.State != lastState {
+			lastState = status.State
+			if err := writeEvent(w, "status", status); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+		if status.State.Finished() {
+			return
+		}
+		select {
+		case <-changed:
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
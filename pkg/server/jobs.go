@@ -0,0 +1,308 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+)
+
+// maxFinishedJobs is the number of finished jobs kept for their status to be queried
+const maxFinishedJobs = 1000
+
+// JobState is the state of a job.
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+	JobCanceled  JobState = "canceled"
+)
+
+// Finished returns whether the job can not change anymore.
+func (s JobState) Finished() bool {
+	return s == JobSucceeded || s == JobFailed || s == JobCanceled
+}
+
+// JobStatus is the status of a job returned by the API.
+type JobStatus struct {
+	ID        string   `json:"id"`
+	Operation string   `json:"operation"`
+	State     JobState `json:"state"`
+	// Error is set if the job has failed or has been canceled
+	Error string `json:"error,omitempty"`
+	// Result is the result of the operation once the job has succeeded
+	Result     interface{} `json:"result,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	StartedAt  *time.Time  `json:"started_at,omitempty"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+	// Progress is the last progress event of the job
+	Progress *runtime.Progress `json:"progress,omitempty"`
+}
+
+// jobFunc runs the operation of a job.
+type jobFunc func(ctx context.Context) (interface{}, error)
+
+type job struct {
+	run jobFunc
+
+	mu     sync.Mutex
+	status JobStatus
+	events []runtime.Progress
+	// changed is closed and replaced whenever an event is added or the state changes
+	changed chan struct{}
+	cancel  context.CancelFunc
+}
+
+func (j *job) snapshot() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
+
+// notify wakes up the subscribers, j.mu must be held.
+func (j *job) notify() {
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+func (j *job) addProgress(p runtime.Progress) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.events = append(j.events, p)
+	j.status.Progress = &p
+	j.notify()
+}
+
+// setState changes the state of the job, unless it has already finished.
+func (j *job) setState(state JobState, result interface{}, err error) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.setStateLocked(state, result, err)
+}
+
+// setStateLocked is setState with j.mu held.
+func (j *job) setStateLocked(state JobState, result interface{}, err error) bool {
+	if j.status.State.Finished() {
+		return false
+	}
+	now := time.Now()
+	j.status.State = state
+	switch {
+	case state == JobRunning:
+		j.status.StartedAt = &now
+	case state.Finished():
+		j.status.FinishedAt = &now
+		j.status.Result = result
+		if err != nil {
+			j.status.Error = err.Error()
+		}
+	}
+	j.notify()
+	return true
+}
+
+// requestCancel cancels the job if it is still queued, otherwise it returns the function
+// canceling its context once running. The state is the one before the request.
+func (j *job) requestCancel() (JobState, context.CancelFunc) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	state := j.status.State
+	if state == JobQueued {
+		// the worker picking the job up later sees it has finished and skips it
+		j.setStateLocked(JobCanceled, nil, errors.New("canceled before it started"))
+		return state, nil
+	}
+	return state, j.cancel
+}
+
+// eventsSince returns the events after the first n ones, the status of the job,
+// and a channel closed at the next change.
+func (j *job) eventsSince(n int) ([]runtime.Progress, JobStatus, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var events []runtime.Progress
+	if n < len(j.events) {
+		events = append(events, j.events[n:]...)
+	}
+	return events, j.status, j.changed
+}
+
+// JobQueue runs jobs with a bounded number of workers.
+type JobQueue struct {
+	// baseCtx is the parent of the contexts of the jobs, it is canceled on Close
+	baseCtx context.Context
+	cancel  context.CancelFunc
+	queue   chan *job
+	wg      sync.WaitGroup
+
+	mu       sync.Mutex
+	jobs     map[string]*job
+	finished []string
+}
+
+// NewJobQueue starts workers running the jobs. At most queueSize jobs wait for a worker.
+func NewJobQueue(workers, queueSize int) *JobQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &JobQueue{
+		baseCtx: ctx,
+		cancel:  cancel,
+		queue:   make(chan *job, queueSize),
+		jobs:    map[string]*job{},
+	}
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+func (q *JobQueue) work() {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.baseCtx.Done():
+			return
+		case j := <-q.queue:
+			q.runJob(j)
+		}
+	}
+}
+
+func (q *JobQueue) runJob(j *job) {
+	ctx, cancel := context.WithCancel(q.baseCtx)
+	defer cancel()
+	j.mu.Lock()
+	j.cancel = cancel
+	j.mu.Unlock()
+	if !j.setState(JobRunning, nil, nil) {
+		// canceled while queued
+		return
+	}
+	ctx = runtime.WithProgress(ctx, j.addProgress)
+	result, err := j.run(ctx)
+	switch {
+	case err == nil:
+		j.setState(JobSucceeded, result, nil)
+	case ctx.Err() != nil:
+		j.setState(JobCanceled, nil, err)
+	default:
+		j.setState(JobFailed, nil, err)
+	}
+	q.retire(j.status.ID)
+}
+
+// retire records that a job has finished and forgets the oldest finished jobs.
+func (q *JobQueue) retire(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.finished = append(q.finished, id)
+	for len(q.finished) > maxFinishedJobs {
+		delete(q.jobs, q.finished[0])
+		q.finished = q.finished[1:]
+	}
+}
+
+// Submit queues a job running fn. It fails if the queue is full.
+func (q *JobQueue) Submit(operation string, fn jobFunc) (JobStatus, error) {
+	j := &job{
+		run: fn,
+		status: JobStatus{
+			ID:        newJobID(),
+			Operation: operation,
+			State:     JobQueued,
+			CreatedAt: time.Now(),
+		},
+		changed: make(chan struct{}),
+	}
+	q.mu.Lock()
+	q.jobs[j.status.ID] = j
+	q.mu.Unlock()
+	select {
+	case q.queue <- j:
+		return j.snapshot(), nil
+	default:
+		q.mu.Lock()
+		delete(q.jobs, j.status.ID)
+		q.mu.Unlock()
+		return JobStatus{}, fmt.Errorf("job queue is full: %w", errdefs.ErrUnavailable)
+	}
+}
+
+func (q *JobQueue) get(id string) (*job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("job %q: %w", id, errdefs.ErrNotFound)
+	}
+	return j, nil
+}
+
+// Get returns the status of a job.
+func (q *JobQueue) Get(id string) (JobStatus, error) {
+	j, err := q.get(id)
+	if err != nil {
+		return JobStatus{}, err
+	}
+	return j.snapshot(), nil
+}
+
+// List returns the status of the known jobs, the most recent first.
+func (q *JobQueue) List() []JobStatus {
+	q.mu.Lock()
+	jobs := make([]*job, 0, len(q.jobs))
+	for _, j := range q.jobs {
+		jobs = append(jobs, j)
+	}
+	q.mu.Unlock()
+	statuses := make([]JobStatus, 0, len(jobs))
+	for _, j := range jobs {
+		statuses = append(statuses, j.snapshot())
+	}
+	sort.Slice(statuses, func(i, k int) bool {
+		return statuses[i].CreatedAt.After(statuses[k].CreatedAt)
+	})
+	return statuses
+}
+
+// Cancel cancels a queued or running job. A running job stops at the next step checking its context.
+func (q *JobQueue) Cancel(id string) (JobStatus, error) {
+	j, err := q.get(id)
+	if err != nil {
+		return JobStatus{}, err
+	}
+	// a running job is retired by its worker once the operation has returned
+	state, cancel := j.requestCancel()
+	switch {
+	case state.Finished():
+		return j.snapshot(), fmt.Errorf("job %q has already finished: %w", id, errdefs.ErrFailedPrecondition)
+	case state == JobQueued:
+		q.retire(id)
+	case cancel != nil:
+		cancel()
+	}
+	return j.snapshot(), nil
+}
+
+// Close cancels the running jobs and waits for the workers to stop.
+func (q *JobQueue) Close() {
+	q.cancel()
+	q.wg.Wait()
+}
+
+func newJobID() string {
+	var b [8]byte
+	// Ignore read failures, just decreases uniqueness
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,353 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+	"github.com/lingdie/image-manip-server/pkg/server"
+)
+
+// waitState waits for the job id to reach state.
+func waitState(t *testing.T, q *server.JobQueue, id string, state server.JobState) server.JobStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, err := q.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.State == state {
+			return status
+		}
+		if status.State.Finished() || time.Now().After(deadline) {
+			t.Fatalf("job %s: expected state %s, got %s", id, state, status.State)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// blockingJob returns a job function blocking until release is closed or its context is done.
+func blockingJob(release <-chan struct{}) func(ctx context.Context) (interface{}, error) {
+	return func(ctx context.Context) (interface{}, error) {
+		select {
+		case <-release:
+			return "done", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func TestJobQueueSubmitFull(t *testing.T) {
+	q := server.NewJobQueue(1, 1)
+	defer q.Close()
+	release := make(chan struct{})
+	running, err := q.Submit("rebase", blockingJob(release))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, q, running.ID, server.JobRunning)
+	queued, err := q.Submit("rebase", blockingJob(release))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Submit("rebase", blockingJob(release)); !errdefs.IsUnavailable(err) {
+		t.Fatalf("expected the queue to be full, got %v", err)
+	}
+	// the rejected job is forgotten
+	if jobs := q.List(); len(jobs) != 2 {
+		t.Errorf("expected 2 jobs, got %d", len(jobs))
+	}
+	close(release)
+	status := waitState(t, q, queued.ID, server.JobSucceeded)
+	if status.Result != "done" || status.StartedAt == nil || status.FinishedAt == nil {
+		t.Errorf("unexpected status of a succeeded job: %+v", status)
+	}
+}
+
+func TestJobQueueCancelQueued(t *testing.T) {
+	q := server.NewJobQueue(1, 1)
+	defer q.Close()
+	release := make(chan struct{})
+	running, err := q.Submit("rebase", blockingJob(release))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, q, running.ID, server.JobRunning)
+	ran := make(chan struct{}, 1)
+	queued, err := q.Submit("squash", func(ctx context.Context) (interface{}, error) {
+		ran <- struct{}{}
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := q.Cancel(queued.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != server.JobCanceled || status.StartedAt != nil {
+		t.Errorf("expected a job canceled before it started, got %+v", status)
+	}
+	// the worker skips the canceled job once the running one has finished
+	close(release)
+	waitState(t, q, running.ID, server.JobSucceeded)
+	if _, err := q.Submit("tag", func(ctx context.Context) (interface{}, error) { return nil, nil }); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(server.FinishedJobs(q)) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-ran:
+		t.Error("expected the canceled job not to run")
+	default:
+	}
+	if status, _ := q.Get(queued.ID); status.State != server.JobCanceled {
+		t.Errorf("expected the job to stay canceled, got %s", status.State)
+	}
+	if _, err := q.Cancel(queued.ID); !errdefs.IsFailedPrecondition(err) {
+		t.Errorf("expected a finished job not to be canceled again, got %v", err)
+	}
+}
+
+// TestJobQueueCancelRace cancels jobs while a worker picks them up: a job is either canceled
+// before it starts and never run, or canceled while running, and it is retired once.
+func TestJobQueueCancelRace(t *testing.T) {
+	q := server.NewJobQueue(4, 256)
+	defer q.Close()
+	const jobs = 200
+	var (
+		mu  sync.Mutex
+		ran = map[string]bool{}
+		ids []string
+	)
+	for i := 0; i < jobs; i++ {
+		started := make(chan string, 1)
+		status, err := q.Submit("rebase", func(ctx context.Context) (interface{}, error) {
+			id := <-started
+			mu.Lock()
+			ran[id] = true
+			mu.Unlock()
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		started <- status.ID
+		ids = append(ids, status.ID)
+		if _, err := q.Cancel(status.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for len(server.FinishedJobs(q)) < jobs && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	finished := server.FinishedJobs(q)
+	if len(finished) != jobs {
+		t.Fatalf("expected %d finished jobs, got %d", jobs, len(finished))
+	}
+	seen := map[string]bool{}
+	for _, id := range finished {
+		if seen[id] {
+			t.Errorf("job %s has been retired twice", id)
+		}
+		seen[id] = true
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, id := range ids {
+		status, err := q.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.State != server.JobCanceled {
+			t.Errorf("job %s: expected it to be canceled, got %s", id, status.State)
+		}
+		if ran[id] != (status.StartedAt != nil) {
+			t.Errorf("job %s: ran %v, but started at %v", id, ran[id], status.StartedAt)
+		}
+	}
+}
+
+func TestJobQueueCancelRunning(t *testing.T) {
+	q := server.NewJobQueue(1, 1)
+	defer q.Close()
+	running, err := q.Submit("rebase", blockingJob(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, q, running.ID, server.JobRunning)
+	if _, err := q.Cancel(running.ID); err != nil {
+		t.Fatal(err)
+	}
+	status := waitState(t, q, running.ID, server.JobCanceled)
+	if status.StartedAt == nil || status.FinishedAt == nil || status.Error != context.Canceled.Error() {
+		t.Errorf("unexpected status of a job canceled while running: %+v", status)
+	}
+	if _, err := q.Cancel("unknown"); !errdefs.IsNotFound(err) {
+		t.Errorf("expected an unknown job not to be found, got %v", err)
+	}
+}
+
+func TestJobQueueFailed(t *testing.T) {
+	q := server.NewJobQueue(1, 1)
+	defer q.Close()
+	status, err := q.Submit("rebase", func(ctx context.Context) (interface{}, error) {
+		return nil, errors.New("no space left on device")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status = waitState(t, q, status.ID, server.JobFailed)
+	if status.Error != "no space left on device" {
+		t.Errorf("expected the error of the job, got %q", status.Error)
+	}
+}
+
+func TestJobQueueRetire(t *testing.T) {
+	const extra = 5
+	q := server.NewJobQueue(4, server.MaxFinishedJobs+extra)
+	defer q.Close()
+	var ids []string
+	for i := 0; i < server.MaxFinishedJobs+extra; i++ {
+		status, err := q.Submit("tag", func(ctx context.Context) (interface{}, error) { return nil, nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, status.ID)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if finished := server.FinishedJobs(q); len(finished) == server.MaxFinishedJobs && len(q.List()) == server.MaxFinishedJobs {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if jobs := q.List(); len(jobs) != server.MaxFinishedJobs {
+		t.Fatalf("expected %d jobs to be kept, got %d", server.MaxFinishedJobs, len(jobs))
+	}
+	// the oldest finished jobs are forgotten
+	forgotten := 0
+	for _, id := range ids {
+		if _, err := q.Get(id); errdefs.IsNotFound(err) {
+			forgotten++
+		}
+	}
+	if forgotten != extra {
+		t.Errorf("expected %d jobs to be forgotten, got %d", extra, forgotten)
+	}
+}
+
+// sseEvent is an event of a Server-Sent Events stream.
+type sseEvent struct {
+	name string
+	data string
+}
+
+func TestJobEvents(t *testing.T) {
+	q := server.NewJobQueue(1, 1)
+	defer q.Close()
+	srv := httptest.NewServer(server.NewJobsHandler(q))
+	defer srv.Close()
+	release := make(chan struct{})
+	job, err := q.Submit("rebase", blockingJob(release))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, q, job.ID, server.JobRunning)
+	// a past event is sent first
+	if err := server.AddJobProgress(q, job.ID, runtime.Progress{Step: "applyLayer", Current: 1, Total: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(srv.URL + "/v1/jobs/" + job.ID + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected response: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	events := make(chan sseEvent)
+	go func() {
+		defer close(events)
+		var e sseEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				e.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				e.data = strings.TrimPrefix(line, "data: ")
+			case line == "":
+				events <- e
+				e = sseEvent{}
+			}
+		}
+	}()
+	next := func() sseEvent {
+		t.Helper()
+		select {
+		case e, ok := <-events:
+			if !ok {
+				t.Fatal("the stream has ended")
+			}
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event received")
+		}
+		return sseEvent{}
+	}
+	var progress runtime.Progress
+	if e := next(); e.name != "progress" || json.Unmarshal([]byte(e.data), &progress) != nil || progress.Step != "applyLayer" {
+		t.Errorf("expected the past progress event, got %+v", e)
+	}
+	var status server.JobStatus
+	if e := next(); e.name != "status" || json.Unmarshal([]byte(e.data), &status) != nil || status.State != server.JobRunning {
+		t.Errorf("expected the running status, got %+v", e)
+	}
+	// then the new events as they happen
+	if err := server.AddJobProgress(q, job.ID, runtime.Progress{Step: "applyLayer", Current: 2, Total: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if e := next(); e.name != "progress" || json.Unmarshal([]byte(e.data), &progress) != nil || progress.Current != 2 {
+		t.Errorf("expected the new progress event, got %+v", e)
+	}
+	close(release)
+	if e := next(); e.name != "status" || json.Unmarshal([]byte(e.data), &status) != nil || status.State != server.JobSucceeded {
+		t.Errorf("expected the succeeded status, got %+v", e)
+	}
+	// the stream ends with the finished job
+	select {
+	case e, ok := <-events:
+		if ok {
+			t.Errorf("expected the stream to end, got %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("expected the stream to end")
+	}
+
+	resp, err = http.Get(srv.URL + "/v1/jobs/unknown/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected an unknown job not to be found, got %d", resp.StatusCode)
+	}
+}
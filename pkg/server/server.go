@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/lingdie/image-manip-server/pkg/options"
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+)
+
+// maxRequestSize is the maximum size of a request body, todo lists included
+const maxRequestSize = 1 << 20
+
+// Server exposes the operations of a Runtime as an HTTP/JSON API. The request bodies are the
+// options of the operations. The RootOptions they embed are ignored: all the requests share
+// the containerd connection of the runtime.
+// The operations modifying images can also be submitted as jobs, run by a bounded number of workers.
+type Server struct {
+	runtime *runtime.Runtime
+	mux     *http.ServeMux
+	jobs    *JobQueue
+	// jobOperations are the operations which can be submitted as jobs, by name
+	jobOperations map[string]operation
+	// lease returns a context holding a new lease, and the function releasing it
+	lease func(ctx context.Context) (context.Context, func(context.Context) error, error)
+}
+
+// operation decodes the options of an operation from a request, and returns a function running it.
+type operation func(w http.ResponseWriter, req *http.Request) (jobFunc, error)
+
+// newOperation makes an operation of a runtime method taking options and returning a result.
+func newOperation[O any, R any](op func(ctx context.Context, opt O) (R, error)) operation {
+	return func(w http.ResponseWriter, req *http.Request) (jobFunc, error) {
+		var opt O
+		if err := decodeOptions(w, req, &opt); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) (interface{}, error) {
+			return op(ctx, opt)
+		}, nil
+	}
+}
+
+func NewServer(r *runtime.Runtime, opts options.ServeOptions) *Server {
+	s := &Server{
+		runtime: r,
+		mux:     http.NewServeMux(),
+		jobs:    NewJobQueue(opts.Workers, opts.QueueSize),
+		lease:   r.WithLease,
+		jobOperations: map[string]operation{
+			"rebase":  newOperation(r.Rebase),
+			"squash":  newOperation(r.Squash),
+			"remove":  newOperation(r.Remove),
+			"convert": newOperation(r.Convert),
+			"config":  newOperation(r.EditConfig),
+			"tag": newOperation(func(ctx context.Context, opt options.TagOptions) (runtime.TagResult, error) {
+				return r.Tag(ctx, opt.SourceImageRef, opt.TargetImage)
+			}),
+		},
+	}
+	s.mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, req *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	for name, op := range s.jobOperations {
+		s.mux.HandleFunc("POST /v1/"+name, s.handle(op))
+	}
+	s.mux.HandleFunc("POST /v1/verify-base", s.handle(newOperation(func(ctx context.Context, opt options.VerifyBaseOptions) (runtime.VerifyBaseResult, error) {
+		result, err := r.Verifybase(ctx, opt)
+		if err != nil && result.Reason != "" {
+			// the image is not based on the base image, this is an answer rather than a failure
+			return result, nil
+		}
+		return result, err
+	})))
+	s.mux.HandleFunc("POST /v1/find-base", s.handle(newOperation(r.FindBase)))
+	s.handleHistory(r.HistoryEntries)
+	s.mux.HandleFunc("POST /v1/images", s.handle(newOperation(r.ImageSummaries)))
+	// jobs
+	s.mux.HandleFunc("POST /v1/jobs/{operation}", s.handleSubmitJob)
+	s.mux.HandleFunc("GET /v1/jobs", func(w http.ResponseWriter, req *http.Request) {
+		writeJSON(w, http.StatusOK, s.jobs.List())
+	})
+	s.mux.HandleFunc("GET /v1/jobs/{id}", s.handleGetJob)
+	s.mux.HandleFunc("POST /v1/jobs/{id}/cancel", s.handleCancelJob)
+	s.mux.HandleFunc("GET /v1/jobs/{id}/events", s.handleJobEvents)
+	return s
+}
+
+// handleHistory registers the routes listing and searching the history of an image with entries.
+func (s *Server) handleHistory(entries func(ctx context.Context, imageRef, keyword string) ([]runtime.HistoryEntry, error)) {
+	s.mux.HandleFunc("POST /v1/history", s.handle(newOperation(func(ctx context.Context, opt options.HistoryOptions) ([]runtime.HistoryEntry, error) {
+		return entries(ctx, opt.ImageRef, "")
+	})))
+	s.mux.HandleFunc("POST /v1/history/search", s.handle(newOperation(func(ctx context.Context, opt options.SearchHistoryOptions) ([]runtime.HistoryEntry, error) {
+		return entries(ctx, opt.ImageRef, opt.Keyword)
+	})))
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mux.ServeHTTP(w, req)
+}
+
+// Close cancels the running jobs and waits for them to stop.
+func (s *Server) Close() {
+	s.jobs.Close()
+}
+
+// handle runs an operation during the request, and writes its result as JSON.
+func (s *Server) handle(op operation) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		run, err := op(w, req)
+		if err != nil {
+			s.writeError(w, req, http.StatusBadRequest, err)
+			return
+		}
+		result, err := s.run(req.Context(), run)
+		if err != nil {
+			s.writeError(w, req, statusCode(err), err)
+			return
+		}
+		s.runtime.Infof("%s %s: %d", req.Method, req.URL.Path, http.StatusOK)
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// run runs an operation with a context holding its own lease.
+func (s *Server) run(ctx context.Context, run jobFunc) (interface{}, error) {
+	ctx, done, err := s.lease(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		// release the lease even if the client has gone away
+		if err := done(context.WithoutCancel(ctx)); err != nil {
+			s.runtime.Warnf("failed to release lease: %v", err)
+		}
+	}()
+	return run(ctx)
+}
+
+// decodeOptions decodes the request body into opt. An empty body leaves opt to its zero value.
+func decodeOptions(w http.ResponseWriter, req *http.Request, opt interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxRequestSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(opt); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+// statusCode maps the errors of the runtime to HTTP status codes
+func statusCode(err error) int {
+	switch {
+	case errdefs.IsNotFound(err):
+		return http.StatusNotFound
+	case errdefs.IsInvalidArgument(err):
+		return http.StatusBadRequest
+	case errdefs.IsAlreadyExists(err), errdefs.IsFailedPrecondition(err):
+		return http.StatusConflict
+	case errdefs.IsUnavailable(err):
+		return http.StatusServiceUnavailable
+	case errdefs.IsCanceled(err):
+		// the client has gone away, the status will not be read
+		return 499
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ErrorResponse is the body of the responses of failed requests.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func (s *Server) writeError(w http.ResponseWriter, req *http.Request, code int, err error) {
+	s.runtime.Errorf("%s %s: %d: %v", req.Method, req.URL.Path, code, err)
+	writeJSON(w, code, ErrorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	// the status has been sent, an encoding error can only be ignored
+	_ = enc.Encode(v)
+}
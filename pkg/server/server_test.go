@@ -0,0 +1,113 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/lingdie/image-manip-server/pkg/runtime"
+	"github.com/lingdie/image-manip-server/pkg/server"
+)
+
+func TestHistoryHandler(t *testing.T) {
+	created := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	var imageRef, keyword string
+	handler := server.NewHistoryHandler(func(ctx context.Context, ref, kw string) ([]runtime.HistoryEntry, error) {
+		imageRef, keyword = ref, kw
+		switch ref {
+		case "missing":
+			return nil, fmt.Errorf("image %q: %w", ref, errdefs.ErrNotFound)
+		case "invalid":
+			return nil, fmt.Errorf("invalid reference %q: %w", ref, errdefs.ErrInvalidArgument)
+		case "broken":
+			return nil, errors.New("snapshot not found")
+		}
+		return []runtime.HistoryEntry{{
+			LastSnapshot: "sha256:snapshot",
+			LastLayer:    "sha256:layer",
+			Created:      &created,
+			CreatedSince: "2 days ago",
+			CreatedBy:    "RUN make",
+			SizeBytes:    1536,
+			Size:         "1.5 KiB",
+			Comment:      "buildkit.dockerfile.v0",
+		}}, nil
+	})
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	post := func(path, body string) *http.Response {
+		t.Helper()
+		resp, err := http.Post(srv.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := post("/v1/history/search", `{"image_ref": "app:latest", "keyword": "make"}`)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if imageRef != "app:latest" || keyword != "make" {
+		t.Errorf("unexpected options: %q %q", imageRef, keyword)
+	}
+	var entries []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"last_snapshot": "sha256:snapshot",
+		"last_layer":    "sha256:layer",
+		"created":       "2024-05-06T07:08:09Z",
+		"created_by":    "RUN make",
+		"size":          float64(1536),
+		"comment":       "buildkit.dockerfile.v0",
+		"empty":         false,
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	if fmt.Sprint(entries[0]) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, entries[0])
+	}
+
+	for _, tc := range []struct {
+		name string
+		path string
+		body string
+		code int
+	}{
+		{name: "empty body", path: "/v1/history", body: "", code: http.StatusOK},
+		{name: "unknown field", path: "/v1/history", body: `{"image": "app:latest"}`, code: http.StatusBadRequest},
+		{name: "invalid json", path: "/v1/history", body: `{"image_ref": `, code: http.StatusBadRequest},
+		{name: "not found", path: "/v1/history", body: `{"image_ref": "missing"}`, code: http.StatusNotFound},
+		{name: "invalid argument", path: "/v1/history/search", body: `{"image_ref": "invalid"}`, code: http.StatusBadRequest},
+		{name: "internal error", path: "/v1/history", body: `{"image_ref": "broken"}`, code: http.StatusInternalServerError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := post(tc.path, tc.body)
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.code {
+				t.Errorf("expected %d, got %d", tc.code, resp.StatusCode)
+			}
+			if tc.code == http.StatusOK {
+				return
+			}
+			var body server.ErrorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error == "" {
+				t.Errorf("expected an error response, got %v %+v", err, body)
+			}
+		})
+	}
+	if imageRef != "broken" {
+		t.Errorf("expected the last options to be decoded, got %q", imageRef)
+	}
+}
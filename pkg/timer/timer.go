@@ -9,6 +9,15 @@ import (
 
 type Timer interface {
 	Track(start time.Time, funcName string)
+	// Record tracks the function like Track and appends its timing to timings.
+	Record(timings *[]Timing, start time.Time, funcName string)
+}
+
+// Timing is the time spent in a function.
+type Timing struct {
+	Name string `json:"name"`
+	// Duration is in nanoseconds once marshaled to JSON
+	Duration time.Duration `json:"duration"`
 }
 
 type TimerImpl struct {
@@ -28,3 +37,9 @@ func (t *TimerImpl) Track(start time.Time, name string) {
 	elapsed := time.Since(start)
 	t.Infof("%s cost %s", name, elapsed.Truncate(time.Millisecond).String())
 }
+
+func (t *TimerImpl) Record(timings *[]Timing, start time.Time, name string) {
+	elapsed := time.Since(start)
+	t.Infof("%s cost %s", name, elapsed.Truncate(time.Millisecond).String())
+	*timings = append(*timings, Timing{Name: name, Duration: elapsed})
+}